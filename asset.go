@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// 模板中引用素材的前缀，如 value = "asset:ce"、"asset:logo_{{Customer}}"
+const assetPrefix = "asset:"
+
+// 素材库索引文件名，位于 assetDir
+const assetIndexName = "assets.toml"
+
+// 素材没有设置 dpi、文件中也没有分辨率时按该分辨率换算尺寸
+const defaultAssetDpi = 300
+
+// 普通图片文件未设置宽高时按 96 dpi 换算，与 PDF 中的原始尺寸一致
+const defaultImageDpi = 96
+
+// 生成 PDF 时 SVG 素材的栅格化分辨率(按实际打印尺寸)
+const svgPdfDpi = 600
+
+// 素材实际打印分辨率低于该值时检查给出警告
+const minAssetDpi = 150
+
+// Asset 素材库中的一个素材，如客户 logo、CE/RoHS 标志、警示图标
+type Asset struct {
+	Name        string `toml:"name"`
+	File        string `toml:"file"`
+	Description string `toml:"description,omitempty"`
+	// 分类，如 logo、认证、警示，仅用于界面分组显示
+	Category string `toml:"category,omitempty"`
+	// 默认打印尺寸(实际 mm)，模板未设置宽高时使用，只设置一边时按比例计算另一边
+	Width  float64 `toml:"width,omitzero"`
+	Height float64 `toml:"height,omitzero"`
+	// PNG/JPEG 的分辨率，未设置尺寸时按它换算；为 0 时读取文件中的分辨率，没有时按 300 dpi
+	Dpi float64 `toml:"dpi,omitzero"`
+}
+
+type assetIndex struct {
+	Assets []Asset `toml:"asset"`
+}
+
+// assetDir 素材库目录，默认 ./resources/assets
+func assetDir() string {
+	if config != nil && config.AssetDir != "" {
+		return config.AssetDir
+	}
+	return "./resources/assets"
+}
+
+// LoadAssets 读取素材库索引，没有索引文件时返回空列表
+func LoadAssets() ([]Asset, error) {
+	data, err := os.ReadFile(filepath.Join(assetDir(), assetIndexName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseAssetIndex(data)
+}
+
+// parseAssetIndex 解析并校验素材库索引
+func parseAssetIndex(data []byte) ([]Asset, error) {
+	var index assetIndex
+	md, err := toml.Decode(string(data), &index)
+	if err != nil {
+		return nil, fmt.Errorf("解析素材库 %s 失败: %w", assetIndexName, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("素材库 %s 中有未知配置项: %s", assetIndexName, undecoded[0].String())
+	}
+	seen := map[string]bool{}
+	for i, a := range index.Assets {
+		switch {
+		case !isIdentifier(strings.ReplaceAll(a.Name, "-", "_")):
+			return nil, fmt.Errorf("素材库第 %d 个素材的名称 %q 只能包含字母、数字、下划线和 -", i+1, a.Name)
+		case seen[a.Name]:
+			return nil, fmt.Errorf("素材 %s 重复", a.Name)
+		case !validAssetFile(a.File):
+			return nil, fmt.Errorf("素材 %s 的文件应为素材库目录下的相对路径", a.Name)
+		case a.imageType() == "":
+			return nil, fmt.Errorf("素材 %s 只支持 svg、png、jpg 文件", a.Name)
+		}
+		seen[a.Name] = true
+	}
+	return index.Assets, nil
+}
+
+// validAssetFile 素材文件应为素材库目录下的相对路径
+func validAssetFile(file string) bool {
+	_, ok := bundleRelPath(file)
+	return ok
+}
+
+// AssetNames 返回素材名，读取失败时返回空列表
+func AssetNames() []string {
+	assets, _ := LoadAssets()
+	names := make([]string, len(assets))
+	for i, a := range assets {
+		names[i] = a.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FindAsset 按名称查找素材
+func FindAsset(name string) (*Asset, error) {
+	assets, err := LoadAssets()
+	if err != nil {
+		return nil, err
+	}
+	for i := range assets {
+		if assets[i].Name == name {
+			return &assets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("素材库中没有素材 %s", name)
+}
+
+// matchAssets 返回名称匹配通配符的素材，用于含变量的素材引用
+func matchAssets(pattern string) ([]Asset, error) {
+	assets, err := LoadAssets()
+	if err != nil {
+		return nil, err
+	}
+	var matched []Asset
+	for _, a := range assets {
+		if ok, _ := path.Match(pattern, a.Name); ok {
+			matched = append(matched, a)
+		}
+	}
+	return matched, nil
+}
+
+// Path 素材文件路径
+func (a *Asset) Path() string {
+	return filepath.Join(assetDir(), filepath.FromSlash(a.File))
+}
+
+func (a *Asset) imageType() string {
+	return imageTypeOf(a.File)
+}
+
+// imageTypeOf 按扩展名返回图片类型 png/jpeg/svg
+func imageTypeOf(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".png":
+		return "png"
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".svg":
+		return "svg"
+	}
+	return ""
+}
+
+// AddAsset 添加素材库中的素材；宽高都为 0 时按素材的打印尺寸或分辨率换算为版面尺寸(见 PrintScale)，
+// 只设置一边时按比例计算另一边
+func (l *Label) AddAsset(name string, x, y, w, h float64) error {
+	a, data, err := l.resources.asset(name)
+	if err != nil {
+		return err
+	}
+	naturalW, naturalH, err := imageNaturalSize(data, a.imageType(), a.Dpi, defaultAssetDpi)
+	if err != nil {
+		return fmt.Errorf("素材 %s: %w", name, err)
+	}
+	if a.Width > 0 || a.Height > 0 {
+		naturalW, naturalH = fitImageSize(a.Width, a.Height, naturalW, naturalH)
+	}
+	scale := l.printScale()
+	w, h = fitImageSize(w, h, naturalW/scale, naturalH/scale)
+	l.AddImage(assetPrefix+name, a.imageType(), data, x, y, w, h)
+	return nil
+}
+
+// printScale 每个版面单位对应的实际毫米数
+func (l *Label) printScale() float64 {
+	if l.PrintScale > 0 {
+		return l.PrintScale
+	}
+	return 1
+}
+
+// fitImageSize 宽高都为 0 时使用原始尺寸，只设置一边时按原始比例计算另一边
+func fitImageSize(w, h, naturalW, naturalH float64) (float64, float64) {
+	switch {
+	case w <= 0 && h <= 0:
+		return naturalW, naturalH
+	case w <= 0 && naturalH > 0:
+		return h * naturalW / naturalH, h
+	case h <= 0 && naturalW > 0:
+		return w, w * naturalH / naturalW
+	}
+	return w, h
+}
+
+// imageNaturalSize 返回图片的原始尺寸(mm): SVG 按 width/height(或 viewBox，按 96 dpi)；
+// 位图按 dpi 换算，dpi 为 0 时读取文件中的分辨率，没有时使用 defaultDpi
+func imageNaturalSize(data []byte, imageType string, dpi, defaultDpi float64) (float64, float64, error) {
+	if imageType == "svg" {
+		return svgSize(data)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	if dpi <= 0 {
+		dpi = imageDpi(data, imageType)
+	}
+	if dpi <= 0 {
+		dpi = defaultDpi
+	}
+	return float64(cfg.Width) * 25.4 / dpi, float64(cfg.Height) * 25.4 / dpi, nil
+}
+
+// imageDpi 读取 PNG pHYs 或 JPEG JFIF 中记录的分辨率，没有时返回 0
+func imageDpi(data []byte, imageType string) float64 {
+	switch imageType {
+	case "png":
+		// 8 字节文件头后为 长度(4) 类型(4) 数据 CRC(4) 的数据块，pHYs 在 IDAT 之前
+		for pos := 8; pos+8 <= len(data); {
+			length := int(binary.BigEndian.Uint32(data[pos:]))
+			chunk := string(data[pos+4 : pos+8])
+			body := pos + 8
+			if chunk == "IDAT" || body+length > len(data) {
+				break
+			}
+			// 单位 1 表示每米像素数
+			if chunk == "pHYs" && length == 9 && data[body+8] == 1 {
+				return float64(binary.BigEndian.Uint32(data[body:])) * 0.0254
+			}
+			pos = body + length + 4
+		}
+	case "jpeg":
+		// SOI 之后的 APP0: FFE0 长度(2) "JFIF\0" 版本(2) 单位(1) 水平密度(2) 垂直密度(2)
+		if len(data) >= 18 && data[2] == 0xFF && data[3] == 0xE0 && string(data[6:11]) == "JFIF\x00" {
+			density := float64(binary.BigEndian.Uint16(data[14:]))
+			switch data[13] {
+			case 1:
+				return density
+			case 2:
+				return density * 2.54
+			}
+		}
+	}
+	return 0
+}
+
+// svgSize 读取 SVG 根元素的 width/height，没有时按 viewBox 的宽高(96 dpi)换算为 mm
+func svgSize(data []byte) (float64, float64, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, 0, fmt.Errorf("解析 SVG 失败: %w", err)
+		}
+		root, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root.Name.Local != "svg" {
+			return 0, 0, fmt.Errorf("不是 SVG 文件")
+		}
+		var width, height, viewBox string
+		for _, attr := range root.Attr {
+			switch attr.Name.Local {
+			case "width":
+				width = attr.Value
+			case "height":
+				height = attr.Value
+			case "viewBox":
+				viewBox = attr.Value
+			}
+		}
+		w, okW := svgLength(width)
+		h, okH := svgLength(height)
+		if okW && okH {
+			return w, h, nil
+		}
+		box := strings.Fields(strings.ReplaceAll(viewBox, ",", " "))
+		if len(box) == 4 {
+			vw, errW := strconv.ParseFloat(box[2], 64)
+			vh, errH := strconv.ParseFloat(box[3], 64)
+			if errW == nil && errH == nil && vw > 0 && vh > 0 {
+				// 只有一边有尺寸时按 viewBox 比例计算另一边
+				w, h = fitImageSize(w, h, vw*25.4/96, vh*25.4/96)
+				return w, h, nil
+			}
+		}
+		return 0, 0, fmt.Errorf("SVG 没有 width/height 或 viewBox，无法确定尺寸")
+	}
+}
+
+// svgLength 将 SVG 长度换算为 mm，支持 mm/cm/in/pt/pc/px 和无单位(px)，百分比等返回 false
+func svgLength(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	units := []struct {
+		suffix string
+		mm     float64
+	}{{"mm", 1}, {"cm", 10}, {"in", 25.4}, {"pt", 25.4 / 72}, {"pc", 25.4 / 6}, {"px", 25.4 / 96}, {"", 25.4 / 96}}
+	for _, unit := range units {
+		if number := strings.TrimSuffix(value, unit.suffix); number != value || unit.suffix == "" {
+			n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil || n <= 0 {
+				return 0, false
+			}
+			return n * unit.mm, true
+		}
+	}
+	return 0, false
+}
+
+// rasterizeSvg 将 SVG 渲染为指定像素大小的位图，背景透明
+func rasterizeSvg(data []byte, w, h int) (*image.RGBA, error) {
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.WarnErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("解析 SVG 失败: %w", err)
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	icon.SetTarget(0, 0, float64(w), float64(h))
+	// oksvg 的线宽不随 SetTarget 缩放，按缩放比例换算为像素
+	if icon.ViewBox.W > 0 && icon.ViewBox.H > 0 {
+		scale := math.Sqrt(float64(w) / icon.ViewBox.W * float64(h) / icon.ViewBox.H)
+		for i := range icon.SVGPaths {
+			icon.SVGPaths[i].LineWidth *= scale
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	scanner := rasterx.NewScannerGV(w, h, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(w, h, scanner), 1)
+	return img, nil
+}
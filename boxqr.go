@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 箱标二维码内容格式: legacy 按输入原样拼接箱号和设备号(旧标签的格式，随输入的分隔符变化)，lines 每行一项，csv 表格，
+// json 含产品信息，link 为 GS1 Digital Link 网址；除 legacy 外都带版本头，扫码后可按格式解析
+const (
+	boxQrLegacy = "legacy"
+	boxQrLines  = "lines"
+	boxQrCsv    = "csv"
+	boxQrJson   = "json"
+	boxQrLink   = "link"
+)
+
+// boxQrDefaultFormat 未指定时的格式，带版本头，界面、接口和 Excel 输入的分隔符不影响内容
+const boxQrDefaultFormat = boxQrLines
+
+// boxQrVersion 箱标二维码格式版本，格式变化时递增
+const boxQrVersion = 1
+
+// 默认 GS1 Digital Link 域名
+const boxQrDefaultDomain = "https://id.gs1.org"
+
+// boxQrHeader lines/csv 第一行的版本头，如 BOXQR/1;csv 或拆分后的 BOXQR/1;csv;part=1/3
+var boxQrHeader = regexp.MustCompile(`^BOXQR/(\d+);(lines|csv)(?:;part=(\d+)/(\d+))?$`)
+
+// BoxQrConfig 箱标二维码内容格式
+type BoxQrConfig struct {
+	// 格式 lines(默认)/legacy/csv/json/link，打印时可按单据指定
+	Format string
+	// GS1 Digital Link 的域名，默认 https://id.gs1.org
+	LinkDomain string
+}
+
+// boxProduct 箱标二维码 json 格式中的产品信息
+type boxProduct struct {
+	Name        string `json:"name,omitempty"`
+	Color       string `json:"color,omitempty"`
+	Date        string `json:"date,omitempty"`
+	Num         string `json:"num,omitempty"`
+	NetWeight   string `json:"netWeight,omitempty"`
+	GrossWeight string `json:"grossWeight,omitempty"`
+	Gtin        string `json:"gtin,omitempty"`
+	Lot         string `json:"lot,omitempty"`
+}
+
+// boxPayload 箱标二维码内容，按 format 编码；拆分为多个二维码时 Part/Parts 为序号和总数
+type boxPayload struct {
+	Version int        `json:"boxqr"`
+	Part    int        `json:"part,omitempty"`
+	Parts   int        `json:"parts,omitempty"`
+	Box     string     `json:"box"`
+	Product boxProduct `json:"product"`
+	Sscc    string     `json:"sscc,omitempty"`
+	Devices []string   `json:"devices"`
+
+	format string
+	// link 格式的 GS1 数据项，按 (01)、(10) 及其余 AI 的顺序
+	ais []Gs1Element
+	// link 格式的域名
+	domain string
+}
+
+// boxQrFormat 返回单据指定或配置的箱标二维码格式
+func boxQrFormat(excelData *ExcelData) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(excelData.QrFormat))
+	if format == "" && config != nil {
+		format = strings.ToLower(strings.TrimSpace(config.BoxQr.Format))
+	}
+	switch format {
+	case "":
+		return boxQrDefaultFormat, nil
+	case boxQrLegacy, boxQrLines, boxQrCsv, boxQrJson, boxQrLink:
+		return format, nil
+	}
+	return "", fmt.Errorf("不支持的箱标二维码格式 %s，可选 %s", format, strings.Join(BoxQrFormats(), "、"))
+}
+
+// BoxQrFormats 返回可选的箱标二维码格式
+func BoxQrFormats() []string {
+	return []string{boxQrLegacy, boxQrLines, boxQrCsv, boxQrJson, boxQrLink}
+}
+
+// tagBoxQr 按格式生成产品标签的箱标二维码内容(模板中的 {{BoxQr}})，fields 为已换算 GTIN、GS1 数据的标签字段
+func tagBoxQr(excelData *ExcelData, fields map[string]string) (string, error) {
+	format, err := boxQrFormat(excelData)
+	if err != nil {
+		return "", err
+	}
+	if format == boxQrLegacy {
+		return excelData.DeviceNos, nil
+	}
+	p := &boxPayload{
+		Version: boxQrVersion,
+		Box:     strings.TrimSpace(excelData.BoxNum),
+		Product: boxProduct{
+			Name:        excelData.ProductName,
+			Color:       excelData.ProductColor,
+			Date:        excelData.ProductDate,
+			Num:         excelData.ProductNum,
+			NetWeight:   excelData.NetWeight,
+			GrossWeight: excelData.GrossWeight,
+			Gtin:        fields["Gtin"],
+			Lot:         excelData.Lot,
+		},
+		Sscc:    fields["SSCC"],
+		Devices: deviceList(excelData),
+		format:  format,
+	}
+	if format == boxQrLink {
+		if p.Product.Gtin == "" {
+			return "", fmt.Errorf("GS1 Digital Link 格式需要商品条码(GTIN)，请填写 GTIN 或在 config.toml 的 [gtins] 中配置")
+		}
+		if p.ais, err = ParseGs1(fields["GS1"]); err != nil {
+			return "", fmt.Errorf("生成 GS1 Digital Link 失败: %w", err)
+		}
+		p.domain = boxQrDefaultDomain
+		if config != nil && config.BoxQr.LinkDomain != "" {
+			p.domain = strings.TrimSuffix(config.BoxQr.LinkDomain, "/")
+		}
+	}
+	return p.encode()
+}
+
+// partSuffix 拆分后的序号，如 ;part=1/3，未拆分时为空
+func (p *boxPayload) partSuffix(sep string) string {
+	if p.Parts <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("%spart=%d/%d", sep, p.Part, p.Parts)
+}
+
+// encode 按格式生成二维码内容
+func (p *boxPayload) encode() (string, error) {
+	header := fmt.Sprintf("BOXQR/%d;%s%s", p.Version, p.format, p.partSuffix(";"))
+	switch p.format {
+	case boxQrLines:
+		return strings.Join(append([]string{header, p.Box}, p.Devices...), "\n"), nil
+	case boxQrCsv:
+		var buf bytes.Buffer
+		buf.WriteString(header + "\n")
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"box", "device"})
+		for _, d := range p.Devices {
+			w.Write([]string{p.Box, d})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	case boxQrJson:
+		// 紧凑格式，不转义 <>&
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(p); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	case boxQrLink:
+		return p.link(), nil
+	}
+	return "", fmt.Errorf("不支持的箱标二维码格式 %s", p.format)
+}
+
+// link 生成 GS1 Digital Link: 路径为 /01/GTIN[/10/批号]，其余 AI 及版本、箱号、设备号(sn，逗号分隔)放在查询参数中
+func (p *boxPayload) link() string {
+	var path strings.Builder
+	query := []string{fmt.Sprintf("boxqr=%d", p.Version)}
+	for _, e := range p.ais {
+		switch e.AI {
+		case "01", "10":
+			path.WriteString("/" + e.AI + "/" + url.PathEscape(e.Value))
+		default:
+			query = append(query, e.AI+"="+url.QueryEscape(e.Value))
+		}
+	}
+	if p.Sscc != "" {
+		query = append(query, "00="+p.Sscc)
+	}
+	query = append(query, "box="+url.QueryEscape(p.Box))
+	sn := make([]string, len(p.Devices))
+	for i, d := range p.Devices {
+		sn[i] = url.QueryEscape(d)
+	}
+	query = append(query, "sn="+strings.Join(sn, ","))
+	if suffix := p.partSuffix(""); suffix != "" {
+		query = append(query, suffix)
+	}
+	return p.domain + path.String() + "?" + strings.Join(query, "&")
+}
+
+// parseBoxQr 解析带版本头的箱标二维码内容，用于按设备号拆分成多个二维码；不是箱标二维码时返回 false
+func parseBoxQr(content string) (*boxPayload, bool) {
+	lines := strings.Split(content, "\n")
+	if m := boxQrHeader.FindStringSubmatch(lines[0]); m != nil {
+		version, _ := strconv.Atoi(m[1])
+		p := &boxPayload{Version: version, format: m[2]}
+		if m[2] == boxQrLines {
+			if len(lines) < 2 {
+				return nil, false
+			}
+			p.Box, p.Devices = lines[1], lines[2:]
+			return p, true
+		}
+		records, err := csv.NewReader(strings.NewReader(strings.Join(lines[1:], "\n"))).ReadAll()
+		if err != nil || len(records) < 1 {
+			return nil, false
+		}
+		for _, r := range records[1:] {
+			p.Box = r[0]
+			p.Devices = append(p.Devices, r[1])
+		}
+		return p, true
+	}
+	if strings.HasPrefix(content, `{"boxqr":`) {
+		p := &boxPayload{format: boxQrJson}
+		if err := json.Unmarshal([]byte(content), p); err != nil {
+			return nil, false
+		}
+		return p, true
+	}
+	u, err := url.Parse(content)
+	if err != nil || u.Scheme == "" || !strings.HasPrefix(u.RawQuery, "boxqr=") {
+		return nil, false
+	}
+	p := &boxPayload{format: boxQrLink, domain: u.Scheme + "://" + u.Host}
+	segments := strings.Split(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+	for i := 0; i+1 < len(segments); i += 2 {
+		value, _ := url.PathUnescape(segments[i+1])
+		p.ais = append(p.ais, Gs1Element{AI: segments[i], Value: value})
+	}
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		key, raw, _ := strings.Cut(pair, "=")
+		value, _ := url.QueryUnescape(raw)
+		switch key {
+		case "boxqr":
+			p.Version, _ = strconv.Atoi(value)
+		case "00":
+			p.Sscc = value
+		case "box":
+			p.Box = value
+		case "sn":
+			for _, d := range strings.Split(raw, ",") {
+				d, _ = url.QueryUnescape(d)
+				p.Devices = append(p.Devices, d)
+			}
+		case "part":
+		default:
+			p.ais = append(p.ais, Gs1Element{AI: key, Value: value})
+		}
+	}
+	return p, true
+}
+
+// chunk 返回只含 devices 的第 part 段(共 parts 段)内容，版本头和其他信息不变
+func (p *boxPayload) chunk(devices []string, part, parts int) (string, error) {
+	c := *p
+	c.Devices = devices
+	c.Part, c.Parts = part, parts
+	if parts <= 1 {
+		c.Part, c.Parts = 0, 0
+	}
+	return c.encode()
+}
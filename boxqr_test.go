@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 各格式编码后按 parseBoxQr 解析，箱号、设备号和版本不变；拆分后的每段带序号
+func TestBoxQrRoundTrip(t *testing.T) {
+	devices := []string{"SN2024000001", `SN,"2"`, "SN 3/4?&=#"}
+	product := boxProduct{Name: "耳机", Color: "黑", Date: "2024-01-05", Num: "3", Gtin: "6979018510006", Lot: "L2401"}
+	ais := []Gs1Element{{AI: "01", Value: "06979018510006"}, {AI: "10", Value: "L/24 01"}, {AI: "11", Value: "240105"}}
+	for _, format := range []string{boxQrLines, boxQrCsv, boxQrJson, boxQrLink} {
+		box := `B,"0001"`
+		if format == boxQrLines {
+			box = "B0001"
+		}
+		p := &boxPayload{Version: boxQrVersion, Box: box, Product: product, Sscc: "069790181234567897", Devices: devices, format: format}
+		if format == boxQrLink {
+			p.ais, p.domain = ais, boxQrDefaultDomain
+		}
+		for _, parts := range []int{1, 3} {
+			for part := 1; part <= parts; part++ {
+				chunk := devices
+				if parts > 1 {
+					chunk = devices[part-1 : part]
+				}
+				content, err := p.chunk(chunk, part, parts)
+				if err != nil {
+					t.Fatalf("%s: %v", format, err)
+				}
+				got, ok := parseBoxQr(content)
+				if !ok {
+					t.Errorf("%s part %d/%d: %q not parsed", format, part, parts, content)
+					continue
+				}
+				if got.format != format || got.Version != boxQrVersion || got.Box != box || !reflect.DeepEqual(got.Devices, chunk) {
+					t.Errorf("%s part %d/%d: parsed %s v%d box %q devices %q from %q", format, part, parts, got.format, got.Version, got.Box, got.Devices, content)
+				}
+				var header string
+				switch format {
+				case boxQrLines, boxQrCsv:
+					header = fmt.Sprintf("BOXQR/%d;%s", boxQrVersion, format)
+					if parts > 1 {
+						header += fmt.Sprintf(";part=%d/%d", part, parts)
+					}
+					if first := strings.SplitN(content, "\n", 2)[0]; first != header {
+						t.Errorf("%s part %d/%d: header %q, want %q", format, part, parts, first, header)
+					}
+				case boxQrJson:
+					// 未拆分时不写序号和总数
+					if got.Product != product || got.Sscc != p.Sscc || (parts > 1) != (got.Part == part && got.Parts == parts) {
+						t.Errorf("%s part %d/%d: parsed %+v", format, part, parts, got)
+					}
+				case boxQrLink:
+					if !reflect.DeepEqual(got.ais, ais) || got.Sscc != p.Sscc || got.domain != boxQrDefaultDomain {
+						t.Errorf("%s part %d/%d: parsed ais %v sscc %q domain %q", format, part, parts, got.ais, got.Sscc, got.domain)
+					}
+					if suffix := fmt.Sprintf("&part=%d/%d", part, parts); (parts > 1) != strings.HasSuffix(content, suffix) {
+						t.Errorf("%s part %d/%d: %q, want suffix %q only when split", format, part, parts, content, suffix)
+					}
+				}
+			}
+		}
+	}
+}
+
+// 默认格式带版本头，界面(逗号或换行拼接箱号)、接口(竖线)和 Excel 的输入得到相同的内容
+func TestTagBoxQrDefault(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config = &Config{}
+
+	inputs := []string{
+		"B0001\nSN1\nSN2",     // 界面，每行一个设备号
+		"B0001,SN1,SN2",       // 界面，逗号分隔
+		"B0001\nSN1|SN2",      // 界面，竖线分隔
+		"B0001\nSN1\nSN2\n",   // 接口，竖线转为换行
+		"B0001,SN1\nSN2",      // 接口，换行分隔时箱号用逗号拼接
+		"SN1\nSN2",            // Excel，不拼接箱号
+		" SN1 , SN2 ",         // 含空格
+		"B0001\r\nSN1\r\nSN2", // Windows 换行
+	}
+	want := "BOXQR/1;lines\nB0001\nSN1\nSN2"
+	for _, devices := range inputs {
+		excelData := &ExcelData{BoxNum: "B0001", DeviceNos: devices}
+		got, err := tagBoxQr(excelData, map[string]string{})
+		if err != nil {
+			t.Errorf("%q: %v", devices, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: %q, want %q", devices, got, want)
+		}
+	}
+
+	// 指定 legacy 时与旧标签相同，按输入原样输出
+	excelData := &ExcelData{BoxNum: "B0001", DeviceNos: "B0001,SN1,SN2", QrFormat: "legacy"}
+	if got, err := tagBoxQr(excelData, map[string]string{}); err != nil || got != excelData.DeviceNos {
+		t.Errorf("legacy: %q, %v, want %q", got, err, excelData.DeviceNos)
+	}
+	config.BoxQr.Format = "csv"
+	excelData = &ExcelData{BoxNum: "B0001", DeviceNos: "SN1"}
+	if got, err := tagBoxQr(excelData, map[string]string{}); err != nil || !strings.HasPrefix(got, "BOXQR/1;csv\n") {
+		t.Errorf("config csv: %q, %v", got, err)
+	}
+	excelData.QrFormat = "xml"
+	if _, err := tagBoxQr(excelData, map[string]string{}); err == nil || !strings.Contains(err.Error(), "不支持的箱标二维码格式") {
+		t.Errorf("unknown format: error = %v", err)
+	}
+}
@@ -5,7 +5,7 @@ echo ====================================
 echo.
 
 echo 正在编译桌面应用...
-go build -o print_desktop.exe main_desktop.go print_functions.go
+go build -o print_desktop.exe .
 
 if %ERRORLEVEL% EQU 0 (
     echo.
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/image/font/opentype"
+)
+
+// 模板包格式版本，导入时拒绝更高版本的包
+const bundleFormat = 1
+
+// 模板包清单文件名
+const bundleManifestName = "manifest.json"
+
+// 模板包中各类文件的目录: 模板安装到 templateDir，标题表安装到 localeDir，素材安装到 assetDir，
+// 其余(图片、字体)按相对路径安装到程序目录的 resources 下
+const (
+	bundleTemplates = "templates/"
+	bundleLocales   = "locales/"
+	bundleAssets    = "assets/"
+	bundleFiles     = "files/"
+)
+
+// bundleFilesRoot files/ 中的文件只能位于该目录下，避免覆盖配置文件或程序
+const bundleFilesRoot = "resources"
+
+// 模板包中单个文件和全部文件解压后的大小上限，防止压缩率极高的包占满内存
+var (
+	bundleMaxFileSize  int64 = 64 << 20
+	bundleMaxTotalSize int64 = 256 << 20
+)
+
+// BundleManifest 模板包清单，记录包内模板及每个文件的大小和 sha256
+type BundleManifest struct {
+	Format    int              `json:"format"`
+	Created   time.Time        `json:"created"`
+	Templates []BundleTemplate `json:"templates"`
+	Files     []BundleFile     `json:"files"`
+}
+
+// BundleTemplate 包内的模板及其版本
+type BundleTemplate struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// BundleFile 包内的文件，Path 为包内路径
+type BundleFile struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// TemplateBundle 已读取并校验的模板包
+type TemplateBundle struct {
+	Manifest BundleManifest
+	files    map[string][]byte
+}
+
+// ExportTemplateBundle 将模板及其引用的图片、素材、字体和用户标题表打包写入 w；
+// 素材库索引只包含用到的素材，导入时合并到本机的索引
+func ExportTemplateBundle(names []string, w io.Writer) (*BundleManifest, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("请指定要导出的模板")
+	}
+	manifest := &BundleManifest{Format: bundleFormat, Created: time.Now()}
+	files := map[string][]byte{}
+	var assets []Asset
+	seenAssets := map[string]bool{}
+	for _, name := range names {
+		t, err := LoadTemplate(name)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Templates = append(manifest.Templates, BundleTemplate{Name: name, Version: t.version})
+		files[bundleTemplates+name+".toml"] = t.source
+
+		paths, err := templateFiles(t)
+		if err != nil {
+			return nil, fmt.Errorf("模板 %s: %w", name, err)
+		}
+		for _, p := range paths {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("模板 %s: %w", name, err)
+			}
+			files[bundleFiles+filepath.ToSlash(filepath.Clean(p))] = data
+		}
+
+		used, err := templateAssets(t)
+		if err != nil {
+			return nil, fmt.Errorf("模板 %s: %w", name, err)
+		}
+		for _, a := range used {
+			if seenAssets[a.Name] {
+				continue
+			}
+			seenAssets[a.Name] = true
+			data, err := os.ReadFile(a.Path())
+			if err != nil {
+				return nil, fmt.Errorf("素材 %s: %w", a.Name, err)
+			}
+			files[bundleAssets+filepath.ToSlash(a.File)] = data
+			assets = append(assets, a)
+		}
+	}
+	if len(assets) > 0 {
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(assetIndex{Assets: assets}); err != nil {
+			return nil, err
+		}
+		files[bundleAssets+assetIndexName] = buf.Bytes()
+	}
+	// 用户标题表覆盖内置标题，一并打包保证新工位上标题相同
+	for _, lang := range LanguageNames() {
+		if data, err := os.ReadFile(filepath.Join(localeDir(), lang+".toml")); err == nil {
+			files[bundleLocales+lang+".toml"] = data
+		}
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		manifest.Files = append(manifest.Files, BundleFile{Path: p, Size: len(files[p]), Sha256: ContentHash(files[p])})
+	}
+
+	zw := zip.NewWriter(w)
+	add := func(name string, data []byte) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: manifest.Created})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := add(bundleManifestName, data); err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		if err := add(p, files[p]); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, zw.Close()
+}
+
+// ExportTemplateBundleFile 将模板打包到导出目录，文件名为模板名加日期，返回文件路径
+func ExportTemplateBundleFile(names []string) (string, error) {
+	if err := os.MkdirAll(exportDir(), 0755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(exportDir(), fmt.Sprintf("%s_%s.zip", strings.Join(names, "+"), time.Now().Format("20060102")))
+	var buf bytes.Buffer
+	if _, err := ExportTemplateBundle(names, &buf); err != nil {
+		return "", err
+	}
+	return file, os.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// templateAssets 返回模板引用的素材；素材名含变量时包含所有可能用到的素材
+func templateAssets(t *LabelTemplate) ([]Asset, error) {
+	var assets []Asset
+	for _, e := range t.allElements() {
+		name := strings.TrimPrefix(e.Value, assetPrefix)
+		if e.Type != TemplateImage || name == e.Value {
+			continue
+		}
+		pattern := fieldPattern.ReplaceAllString(name, "*")
+		matched, err := matchAssets(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("素材库中没有素材 %s", pattern)
+		}
+		assets = append(assets, matched...)
+	}
+	return assets, nil
+}
+
+// templateFiles 返回模板引用的图片和字体文件(相对程序目录)；图片路径含变量时包含所有可能用到的文件
+func templateFiles(t *LabelTemplate) ([]string, error) {
+	var patterns []string
+	for _, e := range t.allElements() {
+		if e.Type == TemplateImage && !strings.HasPrefix(e.Value, assetPrefix) {
+			patterns = append(patterns, fieldPattern.ReplaceAllString(e.Value, "*"))
+		}
+	}
+	switch {
+	case t.Font == chineseFont:
+		// 系统字体不随包分发，只打包随程序分发的中文字体
+		if _, err := os.Stat(bundledChineseFont); err == nil {
+			patterns = append(patterns, bundledChineseFont)
+		}
+	case isFontFile(t.Font):
+		patterns = append(patterns, t.Font)
+	}
+
+	seen := map[string]bool{}
+	var assets []string
+	for _, pattern := range patterns {
+		if _, err := bundleFilePath(pattern); err != nil {
+			return nil, fmt.Errorf("%w，无法打包", err)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("找不到文件 %s", pattern)
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && !info.IsDir() && !seen[match] {
+				seen[match] = true
+				assets = append(assets, match)
+			}
+		}
+	}
+	sort.Strings(assets)
+	return assets, nil
+}
+
+// bundleRelPath 将包内路径去掉目录前缀后的部分转换为本机的相对路径；/ 和 \ 都按分隔符处理(Windows 上两者都是)，
+// 拒绝绝对路径、盘符、..、空的路径段以及 Windows 会忽略的结尾点和空格
+func bundleRelPath(rel string) (string, bool) {
+	if rel == "" || strings.ContainsAny(rel, ":\x00") || strings.HasPrefix(rel, "/") || strings.HasPrefix(rel, "\\") {
+		return "", false
+	}
+	parts := strings.FieldsFunc(rel, func(r rune) bool { return r == '/' || r == '\\' })
+	if len(parts) == 0 || len(parts) != strings.Count(rel, "/")+strings.Count(rel, "\\")+1 {
+		return "", false
+	}
+	for _, part := range parts {
+		if part == "." || part == ".." || strings.HasSuffix(part, ".") || strings.HasSuffix(part, " ") {
+			return "", false
+		}
+	}
+	return filepath.Join(parts...), true
+}
+
+// bundleFilePath 检查程序目录下的图片、字体路径能否放入模板包，返回本机相对路径
+func bundleFilePath(p string) (string, error) {
+	rel, ok := bundleRelPath(p)
+	if !ok {
+		return "", fmt.Errorf("%s 不是程序目录下的相对路径", p)
+	}
+	if root, _, found := strings.Cut(filepath.ToSlash(rel), "/"); !found || !strings.EqualFold(root, bundleFilesRoot) {
+		return "", fmt.Errorf("%s 不在 %s 目录下", p, bundleFilesRoot)
+	}
+	return rel, nil
+}
+
+// ReadTemplateBundle 读取模板包并校验清单、校验和、模板和引用的文件，不写入任何文件
+func ReadTemplateBundle(file string) (*TemplateBundle, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("打开模板包失败: %w", err)
+	}
+	defer zr.Close()
+
+	b := &TemplateBundle{files: map[string][]byte{}}
+	var manifest []byte
+	var total int64
+	for _, entry := range zr.File {
+		if strings.HasSuffix(entry.Name, "/") {
+			continue
+		}
+		if entry.UncompressedSize64 > uint64(bundleMaxFileSize) {
+			return nil, fmt.Errorf("%s 解压后超过 %d MB，不是有效的模板包", entry.Name, bundleMaxFileSize>>20)
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		// 不信任压缩包中记录的大小，按剩余额度限制实际读取的字节数
+		limit := bundleMaxFileSize
+		if remaining := bundleMaxTotalSize - total; remaining < limit {
+			limit = remaining
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", entry.Name, err)
+		}
+		if int64(len(data)) > bundleMaxFileSize {
+			return nil, fmt.Errorf("%s 解压后超过 %d MB，不是有效的模板包", entry.Name, bundleMaxFileSize>>20)
+		}
+		if total += int64(len(data)); total > bundleMaxTotalSize {
+			return nil, fmt.Errorf("模板包解压后超过 %d MB，不是有效的模板包", bundleMaxTotalSize>>20)
+		}
+		if entry.Name == bundleManifestName {
+			manifest = data
+			continue
+		}
+		b.files[entry.Name] = data
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("模板包中没有 %s", bundleManifestName)
+	}
+	if err := json.Unmarshal(manifest, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", bundleManifestName, err)
+	}
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// validate 校验模板包: 文件与清单一一对应且校验和一致，路径安全，模板和标题表能解析，引用的文件在包内或本机已有
+func (b *TemplateBundle) validate() error {
+	m := &b.Manifest
+	if m.Format <= 0 || m.Format > bundleFormat {
+		return fmt.Errorf("不支持的模板包格式版本 %d，请升级程序", m.Format)
+	}
+	listed := map[string]bool{}
+	for _, f := range m.Files {
+		if listed[f.Path] {
+			return fmt.Errorf("清单中 %s 重复", f.Path)
+		}
+		listed[f.Path] = true
+		if _, err := b.installPath(f.Path); err != nil {
+			return err
+		}
+		data, ok := b.files[f.Path]
+		if !ok {
+			return fmt.Errorf("模板包中缺少 %s", f.Path)
+		}
+		if len(data) != f.Size || ContentHash(data) != f.Sha256 {
+			return fmt.Errorf("%s 校验和不一致，模板包可能已损坏或被修改", f.Path)
+		}
+	}
+	for p := range b.files {
+		if !listed[p] {
+			return fmt.Errorf("%s 不在清单中", p)
+		}
+	}
+
+	for p, data := range b.files {
+		if name := strings.TrimPrefix(p, bundleLocales); name != p {
+			catalog := map[string]string{}
+			if _, err := toml.Decode(string(data), &catalog); err != nil {
+				return fmt.Errorf("解析标题表 %s 失败: %w", name, err)
+			}
+		}
+	}
+	if data, ok := b.files[bundleAssets+assetIndexName]; ok {
+		assets, err := parseAssetIndex(data)
+		if err != nil {
+			return err
+		}
+		for _, a := range assets {
+			if _, ok := b.files[bundleAssets+a.File]; !ok {
+				return fmt.Errorf("模板包中缺少素材 %s 的文件 %s", a.Name, a.File)
+			}
+		}
+	}
+	if len(m.Templates) == 0 {
+		return fmt.Errorf("模板包中没有模板")
+	}
+	for _, bt := range m.Templates {
+		data, ok := b.files[bundleTemplates+bt.Name+".toml"]
+		if !ok {
+			return fmt.Errorf("模板包中缺少模板 %s", bt.Name)
+		}
+		if templateVersion(data) != bt.Version {
+			return fmt.Errorf("模板 %s 的版本与清单不一致", bt.Name)
+		}
+		t, err := b.parseTemplate(bt.Name, data)
+		if err != nil {
+			return err
+		}
+		if err := b.checkAssets(t); err != nil {
+			return fmt.Errorf("模板 %s: %w", bt.Name, err)
+		}
+	}
+	return nil
+}
+
+// parseTemplate 解析包内模板，模板指定的语言可以来自包内的标题表
+func (b *TemplateBundle) parseTemplate(name string, data []byte) (*LabelTemplate, error) {
+	return parseTemplateWith(name, data, func(lang string) error {
+		if _, ok := b.files[bundleLocales+lang+".toml"]; ok {
+			return nil
+		}
+		_, err := LoadCatalog(lang)
+		return err
+	})
+}
+
+// checkAssets 检查模板引用的固定路径图片、素材和字体文件在包内或本机已有
+func (b *TemplateBundle) checkAssets(t *LabelTemplate) error {
+	var paths []string
+	for _, e := range t.allElements() {
+		if e.Type != TemplateImage || fieldPattern.MatchString(e.Value) {
+			continue
+		}
+		if name := strings.TrimPrefix(e.Value, assetPrefix); name != e.Value {
+			if !b.hasAsset(name) {
+				if _, err := FindAsset(name); err != nil {
+					return fmt.Errorf("引用的素材 %s 不在模板包中，本机也没有", name)
+				}
+			}
+			continue
+		}
+		paths = append(paths, e.Value)
+	}
+	if isFontFile(t.Font) {
+		paths = append(paths, t.Font)
+	}
+	for _, p := range paths {
+		if _, ok := b.files[bundleFiles+path.Clean(filepath.ToSlash(p))]; ok {
+			continue
+		}
+		if _, err := os.Stat(p); err != nil {
+			return fmt.Errorf("引用的文件 %s 不在模板包中，本机也没有", p)
+		}
+	}
+	return nil
+}
+
+// hasAsset 判断包内的素材库索引中是否有该素材
+func (b *TemplateBundle) hasAsset(name string) bool {
+	assets, _ := parseAssetIndex(b.files[bundleAssets+assetIndexName])
+	for _, a := range assets {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// installPath 返回包内文件的安装路径，路径不安全或不在允许的目录下时返回错误
+func (b *TemplateBundle) installPath(p string) (string, error) {
+	unsafe := fmt.Errorf("模板包中的路径 %s 不安全", p)
+	switch {
+	case strings.HasPrefix(p, bundleTemplates):
+		name := strings.TrimPrefix(p, bundleTemplates)
+		if !strings.HasSuffix(name, ".toml") || !isIdentifier(strings.ReplaceAll(strings.TrimSuffix(name, ".toml"), "-", "_")) {
+			return "", fmt.Errorf("模板包中的模板文件名 %s 不合法", name)
+		}
+		return filepath.Join(templateDir(), name), nil
+	case strings.HasPrefix(p, bundleLocales):
+		name := strings.TrimPrefix(p, bundleLocales)
+		if !strings.HasSuffix(name, ".toml") || !isIdentifier(strings.ReplaceAll(strings.TrimSuffix(name, ".toml"), "-", "_")) {
+			return "", fmt.Errorf("模板包中的标题表文件名 %s 不合法", name)
+		}
+		return filepath.Join(localeDir(), name), nil
+	case strings.HasPrefix(p, bundleAssets):
+		rel, ok := bundleRelPath(strings.TrimPrefix(p, bundleAssets))
+		if !ok {
+			return "", unsafe
+		}
+		return filepath.Join(assetDir(), rel), nil
+	case strings.HasPrefix(p, bundleFiles):
+		rel, err := bundleFilePath(strings.TrimPrefix(p, bundleFiles))
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", unsafe, err.Error())
+		}
+		return rel, nil
+	}
+	return "", fmt.Errorf("模板包中有未知文件 %s", p)
+}
+
+// TemplateNames 返回包内的模板名
+func (b *TemplateBundle) TemplateNames() []string {
+	names := make([]string, len(b.Manifest.Templates))
+	for i, t := range b.Manifest.Templates {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Changes 返回导入时会覆盖的本机文件(内容不同的同名文件)
+func (b *TemplateBundle) Changes() []string {
+	var changed []string
+	for _, f := range b.Manifest.Files {
+		target, _ := b.installPath(f.Path)
+		data, err := b.installContent(f.Path, target)
+		if old, readErr := os.ReadFile(target); readErr == nil && (err != nil || !bytes.Equal(old, data)) {
+			changed = append(changed, target)
+		}
+	}
+	return changed
+}
+
+// installContent 返回包内文件安装后的内容，素材库索引与本机索引合并
+func (b *TemplateBundle) installContent(p, target string) ([]byte, error) {
+	if p != bundleAssets+assetIndexName {
+		return b.files[p], nil
+	}
+	local, err := os.ReadFile(target)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return mergeAssetIndex(local, b.files[p])
+}
+
+// mergeAssetIndex 将包内的素材合并到本机素材库索引: 新素材追加到末尾(保留原文件的注释)，同名但不同的素材以包内为准
+func mergeAssetIndex(local, bundled []byte) ([]byte, error) {
+	localAssets, err := parseAssetIndex(local)
+	if err != nil {
+		return nil, err
+	}
+	bundledAssets, err := parseAssetIndex(bundled)
+	if err != nil {
+		return nil, err
+	}
+	replaced := false
+	var added []Asset
+	for _, a := range bundledAssets {
+		found := false
+		for i := range localAssets {
+			if localAssets[i].Name == a.Name {
+				found = true
+				if localAssets[i] != a {
+					localAssets[i] = a
+					replaced = true
+				}
+				break
+			}
+		}
+		if !found {
+			added = append(added, a)
+		}
+	}
+
+	var buf bytes.Buffer
+	if replaced {
+		err = toml.NewEncoder(&buf).Encode(assetIndex{Assets: append(localAssets, added...)})
+		return buf.Bytes(), err
+	}
+	buf.Write(local)
+	if len(added) > 0 {
+		if len(local) > 0 && !bytes.HasSuffix(local, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		if len(local) > 0 {
+			buf.WriteString("\n")
+		}
+		err = toml.NewEncoder(&buf).Encode(assetIndex{Assets: added})
+	}
+	return buf.Bytes(), err
+}
+
+// Install 安装模板包: 先将全部文件写入临时文件，都成功后再替换，内容相同的文件跳过；返回写入的文件个数。
+// 替换中途失败时恢复已替换的文件，无法恢复时在错误中列出可能已被修改的文件
+func (b *TemplateBundle) Install() (int, error) {
+	type pending struct{ tmp, target, backup string }
+	var written []*pending
+	cleanup := func() {
+		for _, p := range written {
+			os.Remove(p.tmp)
+		}
+	}
+	for _, f := range b.Manifest.Files {
+		target, err := b.installPath(f.Path)
+		if err != nil {
+			cleanup()
+			return 0, err
+		}
+		data, err := b.installContent(f.Path, target)
+		if err != nil {
+			cleanup()
+			return 0, err
+		}
+		if old, err := os.ReadFile(target); err == nil && bytes.Equal(old, data) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			cleanup()
+			return 0, err
+		}
+		tmp := target + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			cleanup()
+			return 0, err
+		}
+		written = append(written, &pending{tmp: tmp, target: target})
+	}
+
+	// 原文件先改名备份，替换失败时改回
+	var replaced []*pending
+	rollback := func(cause error) error {
+		var failed []string
+		for _, p := range replaced {
+			if p.backup == "" {
+				if err := os.Remove(p.target); err != nil {
+					failed = append(failed, p.target)
+				}
+			} else if err := os.Rename(p.backup, p.target); err != nil {
+				failed = append(failed, p.target)
+			}
+		}
+		cleanup()
+		if len(failed) > 0 {
+			return fmt.Errorf("导入失败且无法恢复，以下文件可能已被修改: %s: %w", strings.Join(failed, ", "), cause)
+		}
+		return fmt.Errorf("导入失败，已恢复原文件: %w", cause)
+	}
+	for _, p := range written {
+		if _, err := os.Stat(p.target); err == nil {
+			p.backup = p.target + ".bak"
+			if err := os.Rename(p.target, p.backup); err != nil {
+				return 0, rollback(err)
+			}
+		}
+		replaced = append(replaced, p)
+		if err := os.Rename(p.tmp, p.target); err != nil {
+			return 0, rollback(err)
+		}
+	}
+	for _, p := range replaced {
+		if p.backup != "" {
+			os.Remove(p.backup)
+		}
+	}
+	fontCacheMu.Lock()
+	fontCache = map[string]*opentype.Font{}
+	fontCacheMu.Unlock()
+	notifyTemplatesChanged()
+	return len(written), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundleInstallPath(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config = &Config{TemplateDir: "tpl", LocaleDir: "loc", AssetDir: "ast"}
+
+	b := &TemplateBundle{}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"templates/tag_客户A.toml", filepath.Join("tpl", "tag_客户A.toml")},
+		{"templates/tag-a.toml", filepath.Join("tpl", "tag-a.toml")},
+		{"templates/sub/tag.toml", ""},
+		{`templates/..\tag.toml`, ""},
+		{"locales/en.toml", filepath.Join("loc", "en.toml")},
+		{`locales/..\..\x.toml`, ""},
+		{"locales/../x.toml", ""},
+		{"assets/logo/ce.svg", filepath.Join("ast", "logo", "ce.svg")},
+		{`assets/logo\ce.svg`, filepath.Join("ast", "logo", "ce.svg")},
+		{`assets/..\..\x.exe`, ""},
+		{"assets/../x.svg", ""},
+		{"files/resources/images/401-69.png", filepath.Join("resources", "images", "401-69.png")},
+		{`files/resources\fonts\a.ttf`, filepath.Join("resources", "fonts", "a.ttf")},
+		{`files/..\..\x.exe`, ""},
+		{`files/C:\Windows\x`, ""},
+		{"files/C:/Windows/x", ""},
+		{`files/\\server\share\x`, ""},
+		{"files//etc/passwd", ""},
+		{"files/config.toml", ""},
+		{"files/PrintTool.exe", ""},
+		{"files/resources", ""},
+		{"files/resources/../config.toml", ""},
+		{"files/resources/images/x.png:stream", ""},
+		{"files/resources/.. /x", ""},
+		{"files/resources/images./x", ""},
+		{"other/x", ""},
+	}
+	for _, tt := range tests {
+		got, err := b.installPath(tt.path)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("installPath(%q) = %q, want error", tt.path, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("installPath(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+// 单个文件或全部文件解压后超过上限时拒绝，不读入全部内容
+func TestReadTemplateBundleSize(t *testing.T) {
+	savedFile, savedTotal := bundleMaxFileSize, bundleMaxTotalSize
+	defer func() { bundleMaxFileSize, bundleMaxTotalSize = savedFile, savedTotal }()
+	bundleMaxFileSize, bundleMaxTotalSize = 1024, 2000
+
+	tests := []struct {
+		name  string
+		sizes []int
+		err   string
+	}{
+		{"file", []int{2000}, "files/a0 解压后超过"},
+		{"total", []int{800, 800, 800}, "模板包解压后超过"},
+		{"within limits", []int{1024, 900}, "模板包中没有 manifest.json"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for i, size := range tt.sizes {
+			w, err := zw.Create("files/a" + string(rune('0'+i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(make([]byte, size))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(t.TempDir(), "bundle.zip")
+		if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadTemplateBundle(file); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want containing %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// cliCommands 命令行子命令，第一个参数匹配时不启动界面
+var cliCommands = map[string]func(args []string) error{
+	"bundle":  runBundleCommand,
+	"export":  runExportCommand,
+	"grade":   runGradeCommand,
+	"history": runHistoryCommand,
+	"lint":    runLintCommand,
+	"reprint": runReprintCommand,
+	"sscc":    runSsccCommand,
+}
+
+// runCLI 执行命令行子命令，返回进程退出码；不是子命令时 ok 为 false
+func runCLI(args []string) (code int, ok bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	command, ok := cliCommands[args[0]]
+	if !ok {
+		return 0, false
+	}
+	if err := command(args[1:]); err != nil {
+		fmt.Println("❌", err.Error())
+		return 1, true
+	}
+	return 0, true
+}
+
+// runExportCommand 导出标签图片
+//
+//	PrintTool.exe export -kind device -deviceNos 12345,67890 -format svg
+//	PrintTool.exe export -kind tag -productName 耳机 ... -format png -dpi 600
+//	PrintTool.exe export -excel 生成二维码模版.xlsx -format png
+func runExportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", FormatPng, "导出格式: png/svg/pdf")
+	dpi := fs.Int("dpi", 0, "PNG 分辨率，默认使用 config.toml 中的 exportDpi")
+	buildLabels := addLabelFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	labels, err := buildLabels()
+	if err != nil {
+		return err
+	}
+
+	for _, label := range labels {
+		path, err := ExportLabel(label, strings.ToLower(*format), *dpi)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// 渲染结果是确定的，同一标签重新导出得到相同的 sha256
+		fmt.Println("✓ 已导出:", path, "sha256:", ContentHash(data))
+	}
+	return nil
+}
+
+// runGradeCommand 按打印机分辨率分析标签上的条码和二维码，有低于规范的条码时返回失败，长批量打印前检查
+//
+//	PrintTool.exe grade -kind tag -productName 耳机 ... -template gs1
+//	PrintTool.exe grade -excel 生成二维码模版.xlsx -dpi 300
+func runGradeCommand(args []string) error {
+	fs := flag.NewFlagSet("grade", flag.ContinueOnError)
+	dpi := fs.Int("dpi", 0, "打印机分辨率，默认使用 config.toml 中的 printerDpi")
+	buildLabels := addLabelFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	labels, err := buildLabels()
+	if err != nil {
+		return err
+	}
+	if *dpi <= 0 {
+		*dpi = printerDpi()
+	}
+
+	failed := 0
+	for i, label := range labels {
+		qualities, err := AnalyzeLabelQuality(label, *dpi)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("第 %d 张标签(%d dpi):\n", i+1, *dpi)
+		for _, q := range qualities {
+			mark := "✓"
+			if len(q.Warnings) > 0 {
+				mark = "⚠"
+				failed++
+			}
+			fmt.Println(" ", mark, q)
+			for _, warning := range q.Warnings {
+				fmt.Println("     -", warning)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("有 %d 个条码低于规范", failed)
+	}
+	return nil
+}
+
+// addLabelFlags 添加生成标签的参数(标签类型、单据内容或 Excel 文件)，返回解析参数后生成标签的函数，export、grade 共用
+func addLabelFlags(fs *flag.FlagSet) func() ([]*Label, error) {
+	kind := fs.String("kind", KindTag, "标签类型: device/multi/tag")
+	excelFile := fs.String("excel", "", "按 Excel 文件逐行导出产品标签")
+
+	excelData := new(ExcelData)
+	fs.StringVar(&excelData.ProductName, "productName", "", "产品名称")
+	fs.StringVar(&excelData.ProductColor, "productColor", "", "产品颜色")
+	fs.StringVar(&excelData.ProductDate, "productDate", "", "生产日期")
+	fs.StringVar(&excelData.ProductNum, "productNum", "", "产品数量")
+	fs.StringVar(&excelData.GrossWeight, "grossWeight", "", "毛重")
+	fs.StringVar(&excelData.NetWeight, "netWeight", "", "净重")
+	fs.StringVar(&excelData.BarCode69Type, "barCode69Type", "", "条码类型，例如 401")
+	fs.StringVar(&excelData.Lot, "lot", "", "批号，用于 GS1-128")
+	fs.StringVar(&excelData.Gtin, "gtin", "", "商品条码(GTIN)，为空时按条码类型查找 config.toml 的 [gtins]")
+	fs.StringVar(&excelData.Sscc, "sscc", "", "托盘 SSCC，导出不自动分配，可先用 sscc 命令分配")
+	fs.StringVar(&excelData.BoxNum, "boxNum", "", "箱号")
+	fs.StringVar(&excelData.DeviceNos, "deviceNos", "", "设备号，多个用逗号或竖线分隔")
+	fs.StringVar(&excelData.Customer, "customer", "", "客户，用于按 templateRules 选择模板")
+	fs.StringVar(&excelData.Template, "template", "", "指定产品标签模板")
+	fs.StringVar(&excelData.Language, "language", "", "标题语言，如 en、zh+en")
+	fs.StringVar(&excelData.QrFormat, "qrFormat", "", "箱标二维码格式: legacy/lines/csv/json/link")
+	return func() ([]*Label, error) {
+		var labels []*Label
+		if *excelFile != "" {
+			data, err := ParseExcel(*excelFile)
+			if err != nil {
+				return nil, err
+			}
+			for _, row := range data {
+				pages, err := BuildExcelTagLabel(row)
+				if err != nil {
+					return nil, err
+				}
+				labels = append(labels, pages...)
+			}
+		} else {
+			if *kind == KindTag {
+				if msg := validateTagData(excelData); msg != "" {
+					return nil, fmt.Errorf("%s", msg)
+				}
+				normalizeTagData(excelData)
+			} else if strings.TrimSpace(excelData.DeviceNos) == "" {
+				return nil, fmt.Errorf("请输入设备号")
+			}
+			var err error
+			if labels, err = BuildLabels(*kind, excelData); err != nil {
+				return nil, err
+			}
+		}
+		return labels, nil
+	}
+}
+
+// runLintCommand 用示例数据检查模板，有错误时返回失败，便于上线前或脚本中检查
+//
+//	PrintTool.exe lint
+//	PrintTool.exe lint -template tag,tag_客户A -strict
+//	PrintTool.exe lint -template tag -language zh+en
+func runLintCommand(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	templates := fs.String("template", "", "要检查的模板，多个用逗号分隔，默认检查全部模板")
+	strict := fs.Bool("strict", false, "有警告时也返回失败")
+	language := fs.String("language", "", "按指定语言检查，如 en、zh+en，默认使用模板的语言")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var names []string
+	for _, name := range strings.Split(*templates, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	errors, warnings := lintTemplates(names, *language, func(msg string) { fmt.Println(msg) })
+	if errors > 0 || (*strict && warnings > 0) {
+		return fmt.Errorf("模板检查未通过: %d 个错误，%d 个警告", errors, warnings)
+	}
+	return nil
+}
+
+// runHistoryCommand 列出打印记录
+//
+//	PrintTool.exe history -search C0102
+func runHistoryCommand(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	search := fs.String("search", "", "按箱号、设备号、模板等搜索")
+	limit := fs.Int("n", 20, "最多显示的条数")
+	verbose := fs.Bool("v", false, "显示字段等详细内容")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	jobs, err := LoadPrintJobs()
+	if err != nil {
+		return err
+	}
+	shown := 0
+	for _, job := range jobs {
+		if shown >= *limit {
+			break
+		}
+		if !job.Matches(*search) {
+			continue
+		}
+		shown++
+		if *verbose {
+			fmt.Println(job.Details())
+		} else {
+			fmt.Println(job.ID, job.Summary())
+		}
+	}
+	if shown == 0 {
+		fmt.Println("没有打印记录")
+	}
+	return nil
+}
+
+// runReprintCommand 按打印记录重打，默认使用当时的模板版本
+//
+//	PrintTool.exe reprint -id 20240101-093000.123
+//	PrintTool.exe reprint -id 20240101-093000.123 -current
+func runReprintCommand(args []string) error {
+	fs := flag.NewFlagSet("reprint", flag.ContinueOnError)
+	id := fs.String("id", "", "打印记录 ID，见 history 命令")
+	current := fs.Bool("current", false, "使用当前模板而不是原模板版本")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *id == "" {
+		return fmt.Errorf("请用 -id 指定打印记录")
+	}
+
+	job, err := FindPrintJob(*id)
+	if err != nil {
+		return err
+	}
+	fmt.Println(job.VersionStatus())
+	if err := ReprintJob(job, *current); err != nil {
+		return err
+	}
+	fmt.Println("✓ 重打完成:", job.Name)
+	return nil
+}
+
+// runBundleCommand 导出或导入模板包，导入前校验整个包，-check 时只校验不安装
+//
+//	PrintTool.exe bundle -export tag,packing
+//	PrintTool.exe bundle -export tag -o 产品标签.zip
+//	PrintTool.exe bundle -import 产品标签.zip -check
+func runBundleCommand(args []string) error {
+	fs := flag.NewFlagSet("bundle", flag.ContinueOnError)
+	export := fs.String("export", "", "要导出的模板，多个用逗号分隔")
+	output := fs.String("o", "", "导出的文件路径，默认写入导出目录")
+	importFile := fs.String("import", "", "要导入的模板包")
+	check := fs.Bool("check", false, "只校验模板包，不安装")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *export != "" {
+		var names []string
+		for _, name := range strings.Split(*export, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		path := *output
+		if path == "" {
+			var err error
+			if path, err = ExportTemplateBundleFile(names); err != nil {
+				return err
+			}
+		} else {
+			var buf bytes.Buffer
+			if _, err := ExportTemplateBundle(names, &buf); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				return err
+			}
+		}
+		fmt.Println("✓ 已导出模板包:", path)
+		return nil
+	}
+	if *importFile == "" {
+		return fmt.Errorf("请用 -export 指定模板或用 -import 指定模板包")
+	}
+
+	bundle, err := ReadTemplateBundle(*importFile)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ 模板包校验通过: 模板 %s，共 %d 个文件\n", strings.Join(bundle.TemplateNames(), ", "), len(bundle.Manifest.Files))
+	for _, path := range bundle.Changes() {
+		fmt.Println("  将覆盖:", path)
+	}
+	if *check {
+		return nil
+	}
+	n, err := bundle.Install()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ 已导入，写入 %d 个文件\n", n)
+	lintTemplates(bundle.TemplateNames(), "", func(msg string) { fmt.Println(msg) })
+	return nil
+}
+
+// exitIfCLI 命令行调用时执行子命令并退出
+func exitIfCLI() {
+	if code, ok := runCLI(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+}
+
+// runSsccCommand 按 config.toml 的 [gs1] 分配 SSCC，用于其他系统打印的托盘标签
+//
+//	PrintTool.exe sscc -n 10
+func runSsccCommand(args []string) error {
+	fs := flag.NewFlagSet("sscc", flag.ContinueOnError)
+	count := fs.Int("n", 1, "分配的个数")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *count < 1 {
+		return fmt.Errorf("个数应大于 0")
+	}
+
+	codes, err := AllocateSscc(*count)
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		fmt.Println(code)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code39"
+)
+
+// Code 39 两侧空白(模块)，旧扫码枪要求至少 10 个窄条宽度
+const code39Quiet = 10
+
+// encodeCode39 生成 Code 39(宽窄比 2:1)，checkChar 为 true 时加模 43 校验字符；只支持标准字符集，不使用全 ASCII 模式
+func encodeCode39(content string, checkChar bool) (barcode.Barcode, error) {
+	for _, r := range content {
+		if r == '*' || !strings.ContainsRune(code39Chars, r) {
+			return nil, fmt.Errorf("Code 39 只能编码数字、大写字母和 -. $/+%%，内容中有 %q", r)
+		}
+	}
+	return code39.Encode(content, checkChar, false)
+}
+
+// code39CheckChar 返回 Code 39 的模 43 校验字符
+func code39CheckChar(content string) string {
+	sum := 0
+	for _, r := range content {
+		sum += strings.IndexRune(code39Chars, r)
+	}
+	return string(code39Chars[sum%43])
+}
+
+// code39Png 生成 Code 39 png 数据，两侧各留 10 个模块空白；width 为 0 时每个模块 3 像素，ratio 为高宽比
+func code39Png(content string, checkChar bool, width int, ratio float64) ([]byte, error) {
+	code, err := encodeCode39(content, checkChar)
+	if err != nil {
+		return nil, err
+	}
+	modules := code.Bounds().Dx() + 2*code39Quiet
+	module := 3
+	if width > 0 {
+		module = width / modules
+		if module < 1 {
+			module = 1
+		}
+	}
+	width = module * modules
+	height := int(float64(width)*ratio + 0.5)
+	if height < 1 {
+		height = 1
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for x := 0; x < code.Bounds().Dx(); x++ {
+		if r, _, _, _ := code.At(x, 0).RGBA(); r == 0 {
+			left := (code39Quiet + x) * module
+			draw.Draw(img, image.Rect(left, 0, left+module, height), image.Black, image.Point{}, draw.Src)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
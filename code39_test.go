@@ -0,0 +1,104 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+func TestCode39CheckChar(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		// 模 43: C12 O24 D13 E14 3 9 合计 75，余 32 为 W；S28 N23 -36 2 0 2 4 合计 95，余 9
+		{"CODE39", "W"},
+		{"A", "A"},
+		{"SN-2024", "9"},
+		{"%", "%"},
+	}
+	for _, tt := range tests {
+		if got := code39CheckChar(tt.content); got != tt.want {
+			t.Errorf("code39CheckChar(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+// code39SpecModules ISO/IEC 16388 中部分字符的模块图案(1 为条)，宽条、宽空为 2 个模块
+var code39SpecModules = map[byte]string{
+	'*': "100101101101",
+	'A': "110101001011",
+	'0': "101001101101",
+	'1': "110100101011",
+}
+
+// code39SpecImage 按规范图案绘制 *content*，字符间隔 1 个窄空，每个模块 3 像素
+func code39SpecImage(content string) grayImage {
+	var bits []string
+	for _, c := range []byte("*" + content + "*") {
+		bits = append(bits, code39SpecModules[c])
+	}
+	modules := strings.Join(bits, "0")
+	img := image.NewRGBA(image.Rect(0, 0, (len(modules)+20)*3, 60))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for i, m := range modules {
+		if m == '1' {
+			draw.Draw(img, image.Rect((i+10)*3, 0, (i+11)*3, 60), image.Black, image.Point{}, draw.Src)
+		}
+	}
+	return grayImage{img}
+}
+
+func TestCode39Spec(t *testing.T) {
+	for _, content := range []string{"A", "A10", "0110"} {
+		got, err := decodeCode39(code39SpecImage(content))
+		if err != nil || got != content {
+			t.Errorf("decodeCode39(spec %q) = %q, %v", content, got, err)
+		}
+		// 生成的条空与规范图案一致
+		code, err := encodeCode39(content, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		for x := 0; x < code.Bounds().Dx(); x++ {
+			if r, _, _, _ := code.At(x, 0).RGBA(); r == 0 {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		}
+		var want []string
+		for _, c := range []byte("*" + content + "*") {
+			want = append(want, code39SpecModules[c])
+		}
+		if got := b.String(); got != strings.Join(want, "0") {
+			t.Errorf("encodeCode39(%q) = %s, want %s", content, got, strings.Join(want, "0"))
+		}
+	}
+}
+
+func TestCode39Decode(t *testing.T) {
+	tests := []struct {
+		content   string
+		checkChar bool
+		want      string
+	}{
+		{"CODE39", true, "CODE39W"},
+		{"SN-2024/01", false, "SN-2024/01"},
+		{"A B.$+%", false, "A B.$+%"},
+	}
+	for _, tt := range tests {
+		data, err := code39Png(tt.content, tt.checkChar, 0, 0.3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := decodeBarcodePng("code39", data); err != nil || got != tt.want {
+			t.Errorf("decode %q = %q, %v, want %q", tt.content, got, err, tt.want)
+		}
+	}
+	if _, err := encodeCode39("sn-1", false); err == nil {
+		t.Errorf("encodeCode39 accepted lower case")
+	}
+}
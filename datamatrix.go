@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/utils"
+)
+
+// Data Matrix (ECC200) 编码，支持 GS1 DataMatrix(以 FNC1 开头)。
+// boombuler/barcode 的 datamatrix 无法写入 FNC1，这里按 ISO/IEC 16022 实现 ASCII 编码
+
+// 码字: FNC1、扩展 ASCII 切换、填充
+const (
+	dmFNC1       = 232
+	dmUpperShift = 235
+	dmPad        = 129
+)
+
+// dmSize Data Matrix 符号规格
+type dmSize struct {
+	rows, cols int
+	// 数据区块数(纵向 × 横向)及每块数据区的行列数
+	regionRows, regionCols int
+	dataRows, dataCols     int
+	dataCodewords          int
+	// 纠错码字数(每个交错块)及交错块数
+	eccPerBlock, blocks int
+}
+
+func (s dmSize) String() string {
+	return fmt.Sprintf("%dx%d", s.rows, s.cols)
+}
+
+// dmSizes 按容量从小到大排列，正方形在前、长方形在后
+var dmSizes = []dmSize{
+	{10, 10, 1, 1, 8, 8, 3, 5, 1},
+	{12, 12, 1, 1, 10, 10, 5, 7, 1},
+	{14, 14, 1, 1, 12, 12, 8, 10, 1},
+	{16, 16, 1, 1, 14, 14, 12, 12, 1},
+	{18, 18, 1, 1, 16, 16, 18, 14, 1},
+	{20, 20, 1, 1, 18, 18, 22, 18, 1},
+	{22, 22, 1, 1, 20, 20, 30, 20, 1},
+	{24, 24, 1, 1, 22, 22, 36, 24, 1},
+	{26, 26, 1, 1, 24, 24, 44, 28, 1},
+	{32, 32, 2, 2, 14, 14, 62, 36, 1},
+	{36, 36, 2, 2, 16, 16, 86, 42, 1},
+	{40, 40, 2, 2, 18, 18, 114, 48, 1},
+	{44, 44, 2, 2, 20, 20, 144, 56, 1},
+	{48, 48, 2, 2, 22, 22, 174, 68, 1},
+	{52, 52, 2, 2, 24, 24, 204, 42, 2},
+	{64, 64, 4, 4, 14, 14, 280, 56, 2},
+	{72, 72, 4, 4, 16, 16, 368, 36, 4},
+	{80, 80, 4, 4, 18, 18, 456, 48, 4},
+	{88, 88, 4, 4, 20, 20, 576, 56, 4},
+	{96, 96, 4, 4, 22, 22, 696, 68, 4},
+	{104, 104, 4, 4, 24, 24, 816, 56, 6},
+	{120, 120, 6, 6, 18, 18, 1050, 68, 6},
+	{132, 132, 6, 6, 20, 20, 1304, 62, 8},
+	{144, 144, 6, 6, 22, 22, 1558, 62, 10},
+	{8, 18, 1, 1, 6, 16, 5, 7, 1},
+	{8, 32, 1, 2, 6, 14, 10, 11, 1},
+	{12, 26, 1, 1, 10, 24, 16, 14, 1},
+	{12, 36, 1, 2, 10, 16, 22, 18, 1},
+	{16, 36, 1, 2, 14, 16, 32, 24, 1},
+	{16, 48, 1, 2, 14, 22, 49, 28, 1},
+}
+
+// 模板中 size 的取值: square 正方形(默认)、rect 长方形，或指定规格如 16x16、12x36
+const (
+	dmSizeSquare = "square"
+	dmSizeRect   = "rect"
+)
+
+// checkDataMatrixSize 检查模板中的 size
+func checkDataMatrixSize(size string) error {
+	size = strings.ToLower(strings.TrimSpace(size))
+	if size == "" || size == dmSizeSquare || size == dmSizeRect {
+		return nil
+	}
+	for _, s := range dmSizes {
+		if s.String() == size {
+			return nil
+		}
+	}
+	names := make([]string, len(dmSizes))
+	for i, s := range dmSizes {
+		names[i] = s.String()
+	}
+	return fmt.Errorf("不支持的 Data Matrix 规格 %s，可选 square、rect 或 %s", size, strings.Join(names, "、"))
+}
+
+// chooseDataMatrixSize 选择能容纳 count 个码字的最小规格
+func chooseDataMatrixSize(count int, size string) (dmSize, error) {
+	size = strings.ToLower(strings.TrimSpace(size))
+	for _, s := range dmSizes {
+		square := s.rows == s.cols
+		switch {
+		case size == "" || size == dmSizeSquare:
+			if !square {
+				continue
+			}
+		case size == dmSizeRect:
+			if square {
+				continue
+			}
+		case size != s.String():
+			continue
+		}
+		if count <= s.dataCodewords {
+			return s, nil
+		}
+		if size == s.String() {
+			return dmSize{}, fmt.Errorf("内容需要 %d 个码字，超出 Data Matrix %s 的容量 %d", count, size, s.dataCodewords)
+		}
+	}
+	if err := checkDataMatrixSize(size); err != nil {
+		return dmSize{}, err
+	}
+	return dmSize{}, fmt.Errorf("内容需要 %d 个码字，超出 Data Matrix 的最大容量", count)
+}
+
+// dmEncodeASCII ASCII 编码: 两个连续数字合为一个码字，128 以上的字节先加扩展切换
+func dmEncodeASCII(codewords []byte, text string) []byte {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c >= '0' && c <= '9' && i+1 < len(text) && text[i+1] >= '0' && text[i+1] <= '9':
+			codewords = append(codewords, 130+(c-'0')*10+(text[i+1]-'0'))
+			i++
+		case c >= 128:
+			codewords = append(codewords, dmUpperShift, c-127)
+		default:
+			codewords = append(codewords, c+1)
+		}
+	}
+	return codewords
+}
+
+// dataMatrix 生成的 Data Matrix 符号，实现 barcode.Barcode
+type dataMatrix struct {
+	content string
+	size    dmSize
+	dark    []bool
+}
+
+func (d *dataMatrix) Content() string { return d.content }
+
+func (d *dataMatrix) Metadata() barcode.Metadata {
+	return barcode.Metadata{CodeKind: "DataMatrix", Dimensions: 2}
+}
+
+func (d *dataMatrix) ColorModel() color.Model { return color.Gray16Model }
+
+func (d *dataMatrix) Bounds() image.Rectangle {
+	return image.Rect(0, 0, d.size.cols, d.size.rows)
+}
+
+func (d *dataMatrix) At(x, y int) color.Color {
+	if d.dark[y*d.size.cols+x] {
+		return color.Black
+	}
+	return color.White
+}
+
+// encodeDataMatrix 生成 Data Matrix；gs1 为 true 时内容按 (AI)数据 解析，生成 GS1 DataMatrix；size 见 dmSizeSquare
+func encodeDataMatrix(content string, gs1 bool, size string) (*dataMatrix, error) {
+	s, codewords, err := dmCodewords(content, gs1, size)
+	if err != nil {
+		return nil, err
+	}
+	d := &dataMatrix{content: content, size: s, dark: make([]bool, s.rows*s.cols)}
+	d.place(codewords)
+	return d, nil
+}
+
+// dmCodewords 返回选定的规格和含填充、纠错的全部码字
+func dmCodewords(content string, gs1 bool, size string) (dmSize, []byte, error) {
+	var codewords []byte
+	if gs1 {
+		elements, err := ParseGs1(content)
+		if err != nil {
+			return dmSize{}, nil, err
+		}
+		codewords = append(codewords, dmFNC1)
+		for i, e := range elements {
+			codewords = dmEncodeASCII(codewords, e.AI+e.Value)
+			if spec, _ := lookupGs1AI(e.AI); spec.length == 0 && i < len(elements)-1 {
+				codewords = append(codewords, dmFNC1)
+			}
+		}
+	} else {
+		if content == "" {
+			return dmSize{}, nil, fmt.Errorf("Data Matrix 内容为空")
+		}
+		codewords = dmEncodeASCII(nil, content)
+	}
+
+	s, err := chooseDataMatrixSize(len(codewords), size)
+	if err != nil {
+		return dmSize{}, nil, err
+	}
+	// 填充: 第一个为 129，其余按位置做 253 状态随机化
+	if len(codewords) < s.dataCodewords {
+		codewords = append(codewords, dmPad)
+	}
+	for len(codewords) < s.dataCodewords {
+		r := dmPad + (149*(len(codewords)+1))%253 + 1
+		if r > 254 {
+			r -= 254
+		}
+		codewords = append(codewords, byte(r))
+	}
+	return s, dmAppendECC(codewords, s), nil
+}
+
+var dmReedSolomon = utils.NewReedSolomonEncoder(utils.NewGaloisField(301, 256, 1))
+
+// dmAppendECC 计算纠错码字；多个块时数据和纠错码字都按块交错排列
+func dmAppendECC(data []byte, s dmSize) []byte {
+	result := append([]byte{}, data...)
+	result = append(result, make([]byte, s.eccPerBlock*s.blocks)...)
+	for block := 0; block < s.blocks; block++ {
+		var values []int
+		for i := block; i < len(data); i += s.blocks {
+			values = append(values, int(data[i]))
+		}
+		for j, ecc := range dmReedSolomon.Encode(values, s.eccPerBlock) {
+			result[len(data)+block+j*s.blocks] = byte(ecc)
+		}
+	}
+	return result
+}
+
+// dmPlacement 按 ECC200 的排布规则返回数据区(不含定位图形)每个模块对应的 码字序号*10+位(1 为最高位)，
+// 1 为固定深色，0 为固定浅色
+func dmPlacement(s dmSize) []int {
+	nrow, ncol := s.dataRows*s.regionRows, s.dataCols*s.regionCols
+	grid := make([]int, nrow*ncol)
+	module := func(row, col, chr, bit int) {
+		if row < 0 {
+			row += nrow
+			col += 4 - (nrow+4)%8
+		}
+		if col < 0 {
+			col += ncol
+			row += 4 - (ncol+4)%8
+		}
+		grid[row*ncol+col] = chr*10 + bit
+	}
+	utah := func(row, col, chr int) {
+		module(row-2, col-2, chr, 1)
+		module(row-2, col-1, chr, 2)
+		module(row-1, col-2, chr, 3)
+		module(row-1, col-1, chr, 4)
+		module(row-1, col, chr, 5)
+		module(row, col-2, chr, 6)
+		module(row, col-1, chr, 7)
+		module(row, col, chr, 8)
+	}
+	// 四种角落的特殊排布，依次为位 1~8 的 (行, 列)
+	corner := func(chr int, positions [8][2]int) {
+		for i, p := range positions {
+			module(p[0], p[1], chr, i+1)
+		}
+	}
+	corner1 := [8][2]int{{nrow - 1, 0}, {nrow - 1, 1}, {nrow - 1, 2}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}}
+	corner2 := [8][2]int{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 4}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}}
+	corner3 := [8][2]int{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}}
+	corner4 := [8][2]int{{nrow - 1, 0}, {nrow - 1, ncol - 1}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 3}, {1, ncol - 2}, {1, ncol - 1}}
+
+	chr, row, col := 1, 4, 0
+	for row < nrow || col < ncol {
+		if row == nrow && col == 0 {
+			corner(chr, corner1)
+			chr++
+		}
+		if row == nrow-2 && col == 0 && ncol%4 != 0 {
+			corner(chr, corner2)
+			chr++
+		}
+		if row == nrow-2 && col == 0 && ncol%8 == 4 {
+			corner(chr, corner3)
+			chr++
+		}
+		if row == nrow+4 && col == 2 && ncol%8 == 0 {
+			corner(chr, corner4)
+			chr++
+		}
+		// 向右上
+		for {
+			if row < nrow && col >= 0 && grid[row*ncol+col] == 0 {
+				utah(row, col, chr)
+				chr++
+			}
+			row -= 2
+			col += 2
+			if row < 0 || col >= ncol {
+				break
+			}
+		}
+		row++
+		col += 3
+		// 向左下
+		for {
+			if row >= 0 && col < ncol && grid[row*ncol+col] == 0 {
+				utah(row, col, chr)
+				chr++
+			}
+			row += 2
+			col -= 2
+			if row >= nrow || col < 0 {
+				break
+			}
+		}
+		row += 3
+		col++
+	}
+	// 右下角未用到的 2×2 固定为交错图形
+	if grid[nrow*ncol-1] == 0 {
+		grid[nrow*ncol-1] = 1
+		grid[nrow*ncol-ncol-2] = 1
+	}
+	return grid
+}
+
+// place 放置码字，再加上每个数据区的定位图形
+func (d *dataMatrix) place(codewords []byte) {
+	s := d.size
+	nrow, ncol := s.dataRows*s.regionRows, s.dataCols*s.regionCols
+	grid := dmPlacement(s)
+	for r := 0; r < nrow; r++ {
+		for c := 0; c < ncol; c++ {
+			v := grid[r*ncol+c]
+			dark := v == 1
+			if v >= 10 {
+				dark = codewords[v/10-1]&(1<<uint(8-v%10)) != 0
+			}
+			// 数据区之间隔着定位图形，左、下为实线，上、右为虚线
+			y := r/s.dataRows*(s.dataRows+2) + r%s.dataRows + 1
+			x := c/s.dataCols*(s.dataCols+2) + c%s.dataCols + 1
+			d.dark[y*s.cols+x] = dark
+		}
+	}
+	for y := 0; y < s.rows; y++ {
+		for x := 0; x < s.cols; x++ {
+			inRow, inCol := y%(s.dataRows+2), x%(s.dataCols+2)
+			switch {
+			case inCol == 0 || inRow == s.dataRows+1:
+				d.dark[y*s.cols+x] = true
+			case inRow == 0:
+				d.dark[y*s.cols+x] = x%2 == 0
+			case inCol == s.dataCols+1:
+				d.dark[y*s.cols+x] = y%2 == 1
+			}
+		}
+	}
+}
+
+// dataMatrixPng 生成 Data Matrix png 数据，四周留 1 个模块空白；pixels 为图片宽度，为 0 时每个模块 10 像素
+func dataMatrixPng(d *dataMatrix, pixels int) ([]byte, error) {
+	cols, rows := d.size.cols+2, d.size.rows+2
+	module := 10
+	if pixels > 0 {
+		module = pixels / cols
+		if module < 1 {
+			module = 1
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, cols*module, rows*module))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for y := 0; y < d.size.rows; y++ {
+		for x := 0; x < d.size.cols; x++ {
+			if d.dark[y*d.size.cols+x] {
+				rect := image.Rect((x+1)*module, (y+1)*module, (x+2)*module, (y+2)*module)
+				draw.Draw(img, rect, image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// modules 返回含四周空白的模块数(宽, 高)
+func (d *dataMatrix) modules() (int, int) {
+	return d.size.cols + 2, d.size.rows + 2
+}
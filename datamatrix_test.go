@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	bdm "github.com/boombuler/barcode/datamatrix"
+)
+
+func TestDataMatrixCodewords(t *testing.T) {
+	tests := []struct {
+		content string
+		gs1     bool
+		size    string
+		want    []byte
+	}{
+		// ISO/IEC 16022 附录中的示例 "123456"
+		{"123456", false, "", []byte{142, 164, 186, 114, 25, 5, 88, 102}},
+		// 补充填充码字: 第一个为 129，之后随机化
+		{"A", false, "", []byte{66, 129, 70}},
+		// GS1: FNC1 开头，定长 AI 之间不加分隔，可变长度的 (10) 后面加 FNC1
+		{"(01)06979018510006(10)L2401(37)12", true, "", []byte{232, 131, 136, 227, 220, 148, 181, 130, 136, 140, 77, 154, 131, 232, 167, 142}},
+		{"(10)A(21)7", true, "", []byte{232, 140, 66, 232, 151, 56}},
+	}
+	for _, tt := range tests {
+		s, codewords, err := dmCodewords(tt.content, tt.gs1, tt.size)
+		if err != nil {
+			t.Errorf("dmCodewords(%q): %v", tt.content, err)
+			continue
+		}
+		if !bytes.HasPrefix(codewords, tt.want) {
+			t.Errorf("dmCodewords(%q) = %v (%s), want prefix %v", tt.content, codewords, s, tt.want)
+		}
+		if len(codewords) != s.dataCodewords+s.eccPerBlock*s.blocks {
+			t.Errorf("dmCodewords(%q) has %d codewords, want %d for %s", tt.content, len(codewords), s.dataCodewords+s.eccPerBlock*s.blocks, s)
+		}
+	}
+}
+
+// boombuler/barcode 测试中的 24x24 参考符号
+const dmReference24 = `
+#.#.#.#.#.#.#.#.#.#.#.#.
+#....###..#..#....#...##
+##.......#...#.#.#....#.
+#.###...##..#...##.##..#
+##...####..##..#.#.#.##.
+#.###.##.###..#######.##
+#..###...##.##..#.##.##.
+#.#.#.#.#.#.###....#.#.#
+##.#...#.#.#..#...#####.
+#...####..#...##..#.#..#
+##...#...##.###.#.....#.
+#.###.#.##.#.....###..##
+##..#####...#..##...###.
+###...#.####.##.#.#.#..#
+#..###..#.#.####.#.###..
+###.#.#..#..#.###.#.##.#
+#####.##.###..#.####.#..
+#.##.#......#.#..#.#.###
+###.#....######.#...##..
+##...#..##.###..#...####
+#.######.###.##..#...##.
+#..#..#.##.#..####...#.#
+###.###..#..##.#.##...#.
+########################`
+
+func TestDataMatrixReferenceSymbol(t *testing.T) {
+	d, err := encodeDataMatrix(`{"po":12,"batchAction":"start_end"}`, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for y := 0; y < d.size.rows; y++ {
+		b.WriteByte('\n')
+		for x := 0; x < d.size.cols; x++ {
+			if d.dark[y*d.size.cols+x] {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+	}
+	if got := b.String(); got != dmReference24 {
+		t.Errorf("symbol = %s\nwant %s", got, dmReference24)
+	}
+}
+
+// 与 boombuler/barcode 的编码结果逐模块比较，覆盖单区块、多区块、多个交错块和 144x144 的不等长交错块
+func TestDataMatrixMatchesReferenceEncoder(t *testing.T) {
+	for _, n := range []int{1, 6, 30, 60, 140, 200, 400, 1000, 1500} {
+		content := strings.Repeat("Data Matrix 2024/", n/17+1)[:n]
+		d, err := encodeDataMatrix(content, false, "")
+		if err != nil {
+			t.Fatalf("encodeDataMatrix(%d chars): %v", n, err)
+		}
+		ref, err := bdm.Encode(content)
+		if err != nil {
+			t.Fatalf("reference Encode(%d chars): %v", n, err)
+		}
+		if ref.Bounds() != d.Bounds() {
+			t.Errorf("%d chars: size %v, reference %v", n, d.Bounds(), ref.Bounds())
+			continue
+		}
+		mismatch := 0
+		for y := 0; y < d.size.rows; y++ {
+			for x := 0; x < d.size.cols; x++ {
+				if d.At(x, y) != ref.At(x, y) {
+					mismatch++
+				}
+			}
+		}
+		if mismatch > 0 {
+			t.Errorf("%d chars (%s): %d modules differ from reference", n, d.size, mismatch)
+		}
+	}
+}
+
+func TestDataMatrixSize(t *testing.T) {
+	tests := []struct {
+		content string
+		size    string
+		want    string
+		err     string
+	}{
+		{content: "123456", want: "10x10"},
+		{content: "123456", size: "rect", want: "8x18"},
+		{content: "123456", size: "16X16", want: "16x16"},
+		{content: "ABCDEF", size: "8x18", err: "超出 Data Matrix 8x18 的容量"},
+		{content: "A", size: "9x9", err: "不支持的 Data Matrix 规格"},
+		{content: strings.Repeat("A", 1600), err: "最大容量"},
+	}
+	for _, tt := range tests {
+		d, err := encodeDataMatrix(tt.content, false, tt.size)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("encodeDataMatrix(%d chars, %q) error = %v, want containing %q", len(tt.content), tt.size, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || d.size.String() != tt.want {
+			t.Errorf("encodeDataMatrix(%d chars, %q) = %v, %v, want %s", len(tt.content), tt.size, d, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,1404 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/boombuler/barcode/code128"
+)
+
+// 标签版面生成后按条码原图的分辨率渲染每个条码、二维码所在的区域并解码，与应写入的内容逐字节比较，
+// 不一致时停止生成，避免内容错误、被其他元素覆盖或超出页面的标签被打印出去；支持全部码制
+
+// verifyDecoded 比较解码结果与应写入的内容
+func verifyDecoded(kind, decoded, want string) error {
+	if decoded != want {
+		// GS1-128 的 FNC1 显示为 <FNC1>
+		fnc1 := strings.NewReplacer(string(code128.FNC1), "<FNC1>")
+		return fmt.Errorf("%s 解码校验不一致: 应为 %q，图片中为 %q", kind, fnc1.Replace(want), fnc1.Replace(decoded))
+	}
+	return nil
+}
+
+// verifyLabelBarcodes 渲染标签中每个条码、二维码元素的区域并解码校验；每个模块的像素数与原图相同，
+// 元素被拉伸、被后面的元素遮挡或超出页面时无法解码
+func verifyLabelBarcodes(l *Label) error {
+	pageW, pageH := l.PageSize()
+	for i := range l.Elements {
+		e := &l.Elements[i]
+		if e.Symbology == "" {
+			continue
+		}
+		img, err := png.DecodeConfig(bytes.NewReader(e.ImageData))
+		if err != nil {
+			return err
+		}
+		if e.W <= 0 || e.H <= 0 {
+			return fmt.Errorf("%s 大小为 0，无法解码校验", e.Symbology)
+		}
+		scale := float64(img.Width) / e.W
+		page := image.Rect(0, 0, int(pageW*scale+0.5), int(pageH*scale+0.5))
+		rendered, err := renderLabelRegion(l, scale, e.pixelRect(scale).Intersect(page))
+		if err != nil {
+			return err
+		}
+		decoded, err := decodeSymbol(e.Symbology, grayImage{rendered})
+		if err != nil {
+			return fmt.Errorf("%s 解码校验失败: %w", e.Symbology, err)
+		}
+		if err := verifyDecoded(e.Symbology, decoded, e.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyBarcodes 打印、导出前解码校验标签上的条码，同一标签只校验一次；预览和模板设计时不校验，
+// 避免每次输入都渲染解码
+func (l *Label) verifyBarcodes() error {
+	if l.verified {
+		return nil
+	}
+	if err := verifyLabelBarcodes(l); err != nil {
+		return err
+	}
+	l.verified = true
+	return nil
+}
+
+// decodeSymbol 按码制解码图片中的条码或二维码；GS1 数据中的 FNC1 按 code128 包的 FNC1 字符返回
+func decodeSymbol(symbology string, g grayImage) (string, error) {
+	switch symbology {
+	case TemplateQrcode:
+		return decodeQr(g)
+	case "code128", "gs1-128":
+		return decodeCode128(g)
+	case "ean13":
+		return decodeEan13(g)
+	case "itf14":
+		return decodeItf14(g)
+	case "code39":
+		return decodeCode39(g)
+	case "pdf417":
+		return decodePdf417(g)
+	case "datamatrix", "gs1-datamatrix":
+		return decodeDataMatrix(g)
+	}
+	return "", fmt.Errorf("不支持解码 %s", symbology)
+}
+
+// decodeBarcodePng 按码制解码条码 png 图片
+func decodeBarcodePng(symbology string, data []byte) (string, error) {
+	g, err := decodePngImage(data)
+	if err != nil {
+		return "", err
+	}
+	return decodeSymbol(symbology, g)
+}
+
+// grayImage 解码 png 并按灰度阈值转为深浅矩阵
+type grayImage struct {
+	img image.Image
+}
+
+func decodePngImage(data []byte) (grayImage, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return grayImage{}, err
+	}
+	return grayImage{img}, nil
+}
+
+func (g grayImage) dark(x, y int) bool {
+	// 常见格式直接读取像素，逐像素取 color 较慢
+	switch img := g.img.(type) {
+	case *image.Gray:
+		return img.GrayAt(x, y).Y < 0x80
+	case *image.NRGBA:
+		i := img.PixOffset(x, y)
+		return (int(img.Pix[i])+int(img.Pix[i+1])+int(img.Pix[i+2]))/3 < 0x80
+	case *image.RGBA:
+		i := img.PixOffset(x, y)
+		return (int(img.Pix[i])+int(img.Pix[i+1])+int(img.Pix[i+2]))/3 < 0x80
+	}
+	r, gr, b, _ := g.img.At(x, y).RGBA()
+	return (r+gr+b)/3 < 0x8000
+}
+
+// scanRuns 返回第 y 行从第一个深色像素到最后一个深色像素之间的条、空宽度(像素)，第一个为条
+func (g grayImage) scanRuns(y int) []int {
+	bounds := g.img.Bounds()
+	var runs []int
+	current, started := false, false
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		d := g.dark(x, y)
+		if !started {
+			if !d {
+				continue
+			}
+			started, current = true, true
+			runs = append(runs, 0)
+		}
+		if d != current {
+			current = d
+			runs = append(runs, 0)
+		}
+		runs[len(runs)-1]++
+	}
+	// 去掉最后一个条之后的空白
+	if len(runs) > 0 && !current {
+		runs = runs[:len(runs)-1]
+	}
+	return runs
+}
+
+// darkBounds 返回全部深色像素的范围(含边界)，没有深色像素时 ok 为 false
+func (g grayImage) darkBounds() (minX, minY, maxX, maxY int, ok bool) {
+	bounds := g.img.Bounds()
+	minX, minY, maxX, maxY = bounds.Max.X, bounds.Max.Y, bounds.Min.X-1, bounds.Min.Y-1
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if g.dark(x, y) {
+				if x < minX {
+					minX = x
+				}
+				if x > maxX {
+					maxX = x
+				}
+				if y < minY {
+					minY = y
+				}
+				maxY = y
+			}
+		}
+	}
+	return minX, minY, maxX, maxY, maxX >= minX
+}
+
+// barcodeRow 线性条码的扫描行: 条码上方 1/3 处，避开下方文字和 ITF-14 保护框
+func (g grayImage) barcodeRow() int {
+	bounds := g.img.Bounds()
+	return bounds.Min.Y + bounds.Dy()/3
+}
+
+// toModules 按模块宽度把像素宽度换算为模块数，有无法对齐的宽度时返回错误
+func toModules(runs []int, module float64) ([]int, error) {
+	modules := make([]int, len(runs))
+	for i, r := range runs {
+		n := int(math.Round(float64(r) / module))
+		if n < 1 || math.Abs(float64(r)-float64(n)*module) > module/2 {
+			return nil, fmt.Errorf("条宽不是模块宽度的整数倍")
+		}
+		modules[i] = n
+	}
+	return modules, nil
+}
+
+func widthsKey(modules []int) string {
+	var b strings.Builder
+	for _, m := range modules {
+		b.WriteString(strconv.Itoa(m))
+	}
+	return b.String()
+}
+
+// code128Patterns Code128 各符号的条、空宽度(模块)，下标为符号值；106 为终止符
+var code128Patterns = [107]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Code128 特殊符号值
+const (
+	code128StartA = 103
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// decodeCode128 解码 Code128 图片，FNC1~FNC4 按 code128 包的 FNC 字符返回
+func decodeCode128(g grayImage) (string, error) {
+	runs := g.scanRuns(g.barcodeRow())
+	// 起始符、校验符、终止符至少 6+6+7 个条空
+	if len(runs) < 19 || (len(runs)-7)%6 != 0 {
+		return "", fmt.Errorf("找不到完整的条码")
+	}
+	start := 0
+	for _, r := range runs[:6] {
+		start += r
+	}
+	modules, err := toModules(runs, float64(start)/11)
+	if err != nil {
+		return "", err
+	}
+	lookup := map[string]int{}
+	for v, p := range code128Patterns {
+		lookup[p] = v
+	}
+	var values []int
+	for i := 0; i+6 <= len(modules)-7; i += 6 {
+		v, ok := lookup[widthsKey(modules[i:i+6])]
+		if !ok {
+			return "", fmt.Errorf("第 %d 个符号无法识别", len(values)+1)
+		}
+		values = append(values, v)
+	}
+	if widthsKey(modules[len(modules)-7:]) != code128Patterns[code128Stop] {
+		return "", fmt.Errorf("找不到终止符")
+	}
+	if len(values) < 2 || values[0] < code128StartA || values[0] > code128StartC {
+		return "", fmt.Errorf("找不到起始符")
+	}
+	sum := values[0]
+	for i, v := range values[1 : len(values)-1] {
+		sum += (i + 1) * v
+	}
+	if sum%103 != values[len(values)-1] {
+		return "", fmt.Errorf("校验符错误")
+	}
+
+	// 按当前字符集(A/B/C)解释符号，98 为下一个符号临时切换 A/B
+	set := values[0] - code128StartA
+	var b strings.Builder
+	data128 := values[1 : len(values)-1]
+	for i := 0; i < len(data128); i++ {
+		v := data128[i]
+		current := set
+		shift := false
+		if v == 98 && set != 2 {
+			if i+1 >= len(data128) {
+				return "", fmt.Errorf("切换符后缺少字符")
+			}
+			i++
+			v = data128[i]
+			current = 1 - set
+			shift = true
+		}
+		switch {
+		case v == 102:
+			b.WriteRune(code128.FNC1)
+		case current == 2 && v < 100:
+			fmt.Fprintf(&b, "%02d", v)
+		case current == 2:
+			set = 101 - v
+		case v < 64 && current == 0, v < 96 && current == 1:
+			b.WriteByte(byte(v + 32))
+		case v < 96:
+			b.WriteByte(byte(v - 64))
+		case v == 96:
+			b.WriteRune(code128.FNC3)
+		case v == 97:
+			b.WriteRune(code128.FNC2)
+		case v == 99 && !shift:
+			set = 2
+		case (v == 100 && current == 1) || (v == 101 && current == 0):
+			b.WriteRune(code128.FNC4)
+		case !shift:
+			set = 101 - v
+		default:
+			return "", fmt.Errorf("第 %d 个符号无法解释", i+2)
+		}
+	}
+	return b.String(), nil
+}
+
+// EAN-13 数字的条空宽度(模块): L 码依次为空条空条，R 码相同但从条开始，G 码为 R 码反向
+var ean13Digits = [10]string{"3211", "2221", "2122", "1411", "1132", "1231", "1114", "1312", "1213", "3112"}
+
+// ean13Parities 左半 6 位的 L/G 组合(G 为 1)对应的第一位数字
+var ean13Parities = [10]string{"000000", "001011", "001101", "001110", "010011", "011001", "011100", "010101", "010110", "011010"}
+
+// decodeEan13 解码 EAN-13 图片，返回 13 位数字
+func decodeEan13(g grayImage) (string, error) {
+	runs := g.scanRuns(g.barcodeRow())
+	// 起始符 3 + 左半 24 + 中间分隔符 5 + 右半 24 + 终止符 3
+	if len(runs) != 59 {
+		return "", fmt.Errorf("找不到完整的条码")
+	}
+	span := 0
+	for _, r := range runs {
+		span += r
+	}
+	modules, err := toModules(runs, float64(span)/95)
+	if err != nil {
+		return "", err
+	}
+	if widthsKey(modules[:3]) != "111" || widthsKey(modules[27:32]) != "11111" || widthsKey(modules[56:]) != "111" {
+		return "", fmt.Errorf("起始符、分隔符或终止符错误")
+	}
+	reverse := func(s string) string {
+		return string([]byte{s[3], s[2], s[1], s[0]})
+	}
+	digits := make([]byte, 13)
+	parity := make([]byte, 6)
+	for i := 0; i < 12; i++ {
+		offset := 3 + 4*i
+		if i >= 6 {
+			offset = 32 + 4*(i-6)
+		}
+		key := widthsKey(modules[offset : offset+4])
+		found := false
+		for d, p := range ean13Digits {
+			switch {
+			case key == p:
+				digits[i+1] = byte('0' + d)
+				if i < 6 {
+					parity[i] = '0'
+				}
+				found = true
+			case i < 6 && key == reverse(p):
+				digits[i+1] = byte('0' + d)
+				parity[i] = '1'
+				found = true
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("第 %d 位数字无法识别", i+2)
+		}
+	}
+	first := -1
+	for d, p := range ean13Parities {
+		if p == string(parity) {
+			first = d
+		}
+	}
+	if first < 0 {
+		return "", fmt.Errorf("左半部分奇偶组合错误")
+	}
+	digits[0] = byte('0' + first)
+	if gs1CheckDigit(string(digits[:12])) != digits[12] {
+		return "", fmt.Errorf("校验位错误")
+	}
+	return string(digits), nil
+}
+
+// itf14Digits 交叉二五码各数字的 5 个宽窄单元，n 为窄、w 为宽
+var itf14Digits = [10]string{"nnwwn", "wnnnw", "nwnnw", "wwnnn", "nnwnw", "wnwnn", "nwwnn", "nnnww", "wnnwn", "nwnwn"}
+
+// decodeItf14 解码 ITF-14 图片: 去掉两侧保护框后按起始符的窄条宽度区分宽窄单元，返回 14 位数字
+func decodeItf14(g grayImage) (string, error) {
+	runs := g.scanRuns(g.barcodeRow())
+	// 保护框左右两边各多出一个条和一段空白
+	if len(runs) == 81 {
+		runs = runs[2 : len(runs)-2]
+	}
+	// 起始符 4 + 7 对数字各 10 + 终止符 3
+	if len(runs) != 77 {
+		return "", fmt.Errorf("找不到完整的条码")
+	}
+	narrow := float64(runs[0]+runs[1]+runs[2]+runs[3]) / 4
+	units := make([]byte, len(runs))
+	for i, r := range runs {
+		units[i] = 'n'
+		if float64(r) > 1.5*narrow {
+			units[i] = 'w'
+		}
+	}
+	if string(units[:4]) != "nnnn" || string(units[74:]) != "wnn" {
+		return "", fmt.Errorf("起始符或终止符错误")
+	}
+	digits := make([]byte, 0, 14)
+	for pair := 0; pair < 7; pair++ {
+		// 一对数字中第一个数字用条、第二个数字用空表示
+		var bars, spaces []byte
+		for k := 0; k < 5; k++ {
+			bars = append(bars, units[4+pair*10+2*k])
+			spaces = append(spaces, units[4+pair*10+2*k+1])
+		}
+		for _, key := range [][]byte{bars, spaces} {
+			d := -1
+			for j, p := range itf14Digits {
+				if p == string(key) {
+					d = j
+				}
+			}
+			if d < 0 {
+				return "", fmt.Errorf("第 %d 位数字无法识别", len(digits)+1)
+			}
+			digits = append(digits, byte('0'+d))
+		}
+	}
+	if gs1CheckDigit(string(digits[:13])) != digits[13] {
+		return "", fmt.Errorf("校验位错误")
+	}
+	return string(digits), nil
+}
+
+// QR 各版本(下标 1~40)每块纠错码字数及块数，按纠错等级 L、M、Q、H
+var (
+	qrEccPerBlock = [4][41]int{
+		{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+		{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	}
+	qrBlocks = [4][41]int{
+		{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+		{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+		{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+		{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+	}
+)
+
+// qrFormatLevels 格式信息中纠错等级位对应的等级序号(L、M、Q、H 为 0~3)
+var qrFormatLevels = [4]int{1, 0, 3, 2}
+
+// decodeQr 解码二维码图片: 按左上角定位图形确定模块大小后逐模块取样
+func decodeQr(g grayImage) (string, error) {
+	minX, minY, maxX, maxY, ok := g.darkBounds()
+	if !ok {
+		return "", fmt.Errorf("图片中没有二维码")
+	}
+	// 非整数倍缩放渲染时最上一行可能只有部分像素为深色，取前几行中最长的一段
+	finder := 0
+	for y := minY; y <= maxY && y < minY+3; y++ {
+		n := 0
+		for x := minX; x <= maxX && g.dark(x, y); x++ {
+			n++
+		}
+		if n > finder {
+			finder = n
+		}
+	}
+	if finder < 7 {
+		return "", fmt.Errorf("找不到定位图形")
+	}
+	// 定位图形只用来估计版本，模块按整个符号的宽高计算，避免误差沿行列累积；
+	// 定位图形差 1 像素就可能差一个版本，在估计值附近选定时图形(第 6 行、列深浅交替)最吻合的边长
+	width, height := float64(maxX-minX+1), float64(maxY-minY+1)
+	if math.Abs(height/width-1) > 0.1 {
+		return "", fmt.Errorf("找不到定位图形")
+	}
+	estimate := int(math.Round((width*7/float64(finder) - 17) / 4))
+	var matrix [][]bool
+	best := -1
+	for version := estimate - 2; version <= estimate+2; version++ {
+		if version < 1 || version > 40 {
+			continue
+		}
+		size := 17 + 4*version
+		moduleX, moduleY := width/float64(size), height/float64(size)
+		m := make([][]bool, size)
+		for y := range m {
+			m[y] = make([]bool, size)
+			for x := range m[y] {
+				m[y][x] = g.dark(minX+int((float64(x)+0.5)*moduleX), minY+int((float64(y)+0.5)*moduleY))
+			}
+		}
+		score := 0
+		for i := 8; i < size-8; i++ {
+			if m[6][i] == (i%2 == 0) {
+				score++
+			}
+			if m[i][6] == (i%2 == 0) {
+				score++
+			}
+		}
+		// 分数按定时图形长度归一，长度不同的候选才能比较
+		if score*100/(2*(size-16)) > best {
+			best, matrix = score*100/(2*(size-16)), m
+		}
+	}
+	if matrix == nil || best < 90 {
+		return "", fmt.Errorf("找不到定位图形")
+	}
+	return decodeQrMatrix(matrix)
+}
+
+// qrFormatBits 返回格式信息(5 位数据)的 15 位 BCH 编码，已与 101010000010010 异或
+func qrFormatBits(data int) int {
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// qrAlignmentPositions 返回版本的校正图形中心坐标
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	num := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + num*2 + 1) / (num*2 - 2) * 2
+	}
+	positions := make([]int, num)
+	positions[0] = 6
+	for i, pos := num-1, 17+4*version-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// qrFunctionModules 标记定位、分隔、定时、校正图形以及格式、版本信息所在的模块
+func qrFunctionModules(version int) [][]bool {
+	size := 17 + 4*version
+	function := make([][]bool, size)
+	for i := range function {
+		function[i] = make([]bool, size)
+	}
+	fill := func(x, y, w, h int) {
+		for dy := 0; dy < h; dy++ {
+			for dx := 0; dx < w; dx++ {
+				function[y+dy][x+dx] = true
+			}
+		}
+	}
+	fill(0, 0, 9, 9)
+	fill(size-8, 0, 8, 9)
+	fill(0, size-8, 9, 8)
+	fill(6, 0, 1, size)
+	fill(0, 6, size, 1)
+	positions := qrAlignmentPositions(version)
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			fill(x-2, y-2, 5, 5)
+		}
+	}
+	if version >= 7 {
+		fill(size-11, 0, 3, 6)
+		fill(0, size-11, 6, 3)
+	}
+	return function
+}
+
+// qrMasked 判断掩模图形在 (x, y) 是否取反
+func qrMasked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (y/2+x/3)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	}
+	return ((x+y)%2+x*y%3)%2 == 0
+}
+
+// qrReadFormat 读取左上角和另一组格式信息，返回纠错等级序号和掩模
+func qrReadFormat(matrix [][]bool) (int, int, error) {
+	size := len(matrix)
+	bit := func(x, y int) int {
+		if matrix[y][x] {
+			return 1
+		}
+		return 0
+	}
+	var first, second int
+	for x := 0; x <= 5; x++ {
+		first = first<<1 | bit(x, 8)
+	}
+	first = first<<1 | bit(7, 8)
+	first = first<<1 | bit(8, 8)
+	first = first<<1 | bit(8, 7)
+	for y := 5; y >= 0; y-- {
+		first = first<<1 | bit(8, y)
+	}
+	for y := size - 1; y >= size-7; y-- {
+		second = second<<1 | bit(8, y)
+	}
+	for x := size - 8; x < size; x++ {
+		second = second<<1 | bit(x, 8)
+	}
+	best, bestDistance := -1, 4
+	for data := 0; data < 32; data++ {
+		code := qrFormatBits(data)
+		for _, read := range []int{first, second} {
+			distance := 0
+			for diff := code ^ read; diff != 0; diff &= diff - 1 {
+				distance++
+			}
+			if distance < bestDistance {
+				best, bestDistance = data, distance
+			}
+		}
+	}
+	if best < 0 {
+		return 0, 0, fmt.Errorf("格式信息无法识别")
+	}
+	return qrFormatLevels[best>>3], best & 7, nil
+}
+
+// gf256 QR 纠错使用的有限域 GF(256)，本原多项式 0x11d
+var gf256Exp, gf256Log = func() ([512]byte, [256]int) {
+	var exp [512]byte
+	var log [256]int
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+// qrBlockValid 检查一个块(数据码字 + 纠错码字)的伴随式是否全为 0
+func qrBlockValid(block []byte, ecc int) bool {
+	for i := 0; i < ecc; i++ {
+		var s byte
+		for _, c := range block {
+			// s = s*α^i + c
+			if s != 0 {
+				s = gf256Exp[gf256Log[s]+i]
+			}
+			s ^= c
+		}
+		if s != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeQrMatrix 解码不含空白的模块矩阵
+func decodeQrMatrix(matrix [][]bool) (string, error) {
+	size := len(matrix)
+	version := (size - 17) / 4
+	level, mask, err := qrReadFormat(matrix)
+	if err != nil {
+		return "", err
+	}
+
+	// 从右下角开始两列一组蛇形读取数据位
+	function := qrFunctionModules(version)
+	var codewords []byte
+	var current byte
+	bits := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if function[y][x] {
+					continue
+				}
+				current <<= 1
+				if matrix[y][x] != qrMasked(mask, x, y) {
+					current |= 1
+				}
+				if bits++; bits == 8 {
+					codewords = append(codewords, current)
+					current, bits = 0, 0
+				}
+			}
+		}
+	}
+
+	// 按块拆开交织的码字，逐块检查纠错码
+	numBlocks, ecc := qrBlocks[level][version], qrEccPerBlock[level][version]
+	if numBlocks == 0 || len(codewords) < numBlocks*(ecc+1) {
+		return "", fmt.Errorf("版本 %d 的码字数不正确", version)
+	}
+	shortLen := len(codewords) / numBlocks
+	numShort := numBlocks - len(codewords)%numBlocks
+	blocks := make([][]byte, numBlocks)
+	dataLen := func(b int) int {
+		if b < numShort {
+			return shortLen - ecc
+		}
+		return shortLen - ecc + 1
+	}
+	k := 0
+	for i := 0; i <= shortLen-ecc; i++ {
+		for b := range blocks {
+			if i < dataLen(b) {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < ecc; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[k])
+			k++
+		}
+	}
+	var payload []byte
+	for b, block := range blocks {
+		if !qrBlockValid(block, ecc) {
+			return "", fmt.Errorf("第 %d 块纠错码校验失败", b+1)
+		}
+		payload = append(payload, block[:dataLen(b)]...)
+	}
+	return parseQrPayload(payload, version)
+}
+
+// qrBitReader 按位读取数据码字
+type qrBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *qrBitReader) available() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *qrBitReader) read(n int) (int, error) {
+	if n > r.available() {
+		return 0, fmt.Errorf("数据不完整")
+	}
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | int(r.data[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v, nil
+}
+
+// parseQrPayload 按数字、字母数字、字节模式解析数据，遇到结束符或数据用完时结束
+func parseQrPayload(payload []byte, version int) (string, error) {
+	const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+	group := 0
+	if version >= 27 {
+		group = 2
+	} else if version >= 10 {
+		group = 1
+	}
+	countBits := map[int][3]int{1: {10, 12, 14}, 2: {9, 11, 13}, 4: {8, 16, 16}}
+
+	r := &qrBitReader{data: payload}
+	var b strings.Builder
+	for r.available() >= 4 {
+		mode, _ := r.read(4)
+		if mode == 0 {
+			break
+		}
+		if mode == 7 {
+			// ECI 指定字符集，内容按字节比较，跳过即可
+			first, err := r.read(8)
+			if err != nil {
+				return "", err
+			}
+			extra := 0
+			if first&0xc0 == 0x80 {
+				extra = 8
+			} else if first&0xe0 == 0xc0 {
+				extra = 16
+			}
+			if _, err := r.read(extra); err != nil {
+				return "", err
+			}
+			continue
+		}
+		bitsOf, ok := countBits[mode]
+		if !ok {
+			return "", fmt.Errorf("不支持的编码模式 %04b", mode)
+		}
+		count, err := r.read(bitsOf[group])
+		if err != nil {
+			return "", err
+		}
+		switch mode {
+		case 1:
+			for ; count >= 3; count -= 3 {
+				v, err := r.read(10)
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&b, "%03d", v)
+			}
+			if count > 0 {
+				v, err := r.read(3*count + 1)
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&b, "%0*d", count, v)
+			}
+		case 2:
+			for ; count >= 2; count -= 2 {
+				v, err := r.read(11)
+				if err != nil {
+					return "", err
+				}
+				if v/45 >= 45 {
+					return "", fmt.Errorf("字母数字数据错误")
+				}
+				b.WriteByte(alphanumeric[v/45])
+				b.WriteByte(alphanumeric[v%45])
+			}
+			if count > 0 {
+				v, err := r.read(6)
+				if err != nil {
+					return "", err
+				}
+				if v >= 45 {
+					return "", fmt.Errorf("字母数字数据错误")
+				}
+				b.WriteByte(alphanumeric[v])
+			}
+		case 4:
+			for ; count > 0; count-- {
+				v, err := r.read(8)
+				if err != nil {
+					return "", err
+				}
+				b.WriteByte(byte(v))
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// code39Chars Code 39 的字符，下标为校验值；* 为起始、终止符
+const code39Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ-. $/+%*"
+
+// code39Patterns Code 39 各字符的条空宽度(模块，宽条为 2)，顺序同 code39Chars
+var code39Patterns = [44]string{
+	"111221211", "211211112", "112211112", "212211111", "111221112", "211221111", "112221111", "111211212", "211211211", "112211211",
+	"211112112", "112112112", "212112111", "111122112", "211122111", "112122111", "111112212", "211112211", "112112211", "111122211",
+	"211111122", "112111122", "212111121", "111121122", "211121121", "112121121", "111111222", "211111221", "112111221", "111121221",
+	"221111112", "122111112", "222111111", "121121112", "221121111", "122121111", "121111212", "221111211", "122111211", "121212111",
+	"121211121", "121112121", "111212121", "121121211",
+}
+
+// decodeCode39 解码 Code 39 图片，返回起始、终止符之间的字符(含校验字符)
+func decodeCode39(g grayImage) (string, error) {
+	// 每个字符 9 个条空，字符间有 1 个窄空
+	runs := g.scanRuns(g.barcodeRow())
+	if len(runs) < 29 || (len(runs)+1)%10 != 0 {
+		return "", fmt.Errorf("找不到完整的条码")
+	}
+	// 每个字符 12 个模块(宽条为 2)加 1 个模块的间隔，按总宽度计算模块宽度，缩放后条宽不一致时也能识别
+	width := 0
+	for _, r := range runs {
+		width += r
+	}
+	modules, err := toModules(runs, float64(width)/float64((len(runs)+1)/10*13-1))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i := 0; i < len(modules); i += 10 {
+		key := widthsKey(modules[i : i+9])
+		v := -1
+		for j, p := range code39Patterns {
+			if p == key {
+				v = j
+			}
+		}
+		if v < 0 {
+			return "", fmt.Errorf("第 %d 个字符无法识别", i/10+1)
+		}
+		b.WriteByte(code39Chars[v])
+	}
+	s := b.String()
+	if s[0] != '*' || s[len(s)-1] != '*' || strings.Count(s, "*") != 2 {
+		return "", fmt.Errorf("找不到起始符或终止符")
+	}
+	return s[1 : len(s)-1], nil
+}
+
+// decodePdf417 解码 PDF417 图片: 逐像素行读取码字，按左侧行指示码字确定行号，校验纠错码字后解释数据
+func decodePdf417(g grayImage) (string, error) {
+	// 条空图案 → 簇*1000+码字值
+	lookup := map[int]int{}
+	for cluster, patterns := range pdf417Patterns {
+		for v, p := range patterns {
+			lookup[p] = cluster*1000 + v
+		}
+	}
+	bounds := g.img.Bounds()
+	rowWords := map[int][]int{}
+	var indicators [3]int
+	columns := -1
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		runs := g.scanRuns(y)
+		if len(runs) == 0 {
+			continue
+		}
+		// 起始符的第一个条为 8 个模块，据此估计总模块数(17 的倍数加 1)，再按总宽度计算模块宽度
+		width := 0
+		for _, r := range runs {
+			width += r
+		}
+		total := int(math.Round((float64(width)*8/float64(runs[0])-1)/17))*17 + 1
+		if total < 86 {
+			continue
+		}
+		module := float64(width) / float64(total)
+		left := bounds.Min.X
+		for !g.dark(left, y) {
+			left++
+		}
+		word := func(i int) int {
+			p := 0
+			for k := 0; k < 17; k++ {
+				p <<= 1
+				if g.dark(left+int((float64(i*17+k)+0.5)*module), y) {
+					p |= 1
+				}
+			}
+			return p
+		}
+		if word(0) != pdf417StartPattern {
+			continue
+		}
+		n := (total-1)/17 - 2
+		// 同一行的码字属于同一簇，跨两行的像素行读出的簇不一致
+		words := make([]int, 0, n)
+		for i := 1; i <= n; i++ {
+			v, ok := lookup[word(i)]
+			if !ok || (len(words) > 0 && v/1000 != words[0]/1000) {
+				words = nil
+				break
+			}
+			words = append(words, v)
+		}
+		if words == nil {
+			continue
+		}
+		cluster := words[0] / 1000
+		indicator := words[0] % 1000
+		row := 3*(indicator/30) + cluster
+		if _, ok := rowWords[row]; ok {
+			continue
+		}
+		indicators[cluster] = indicator % 30
+		columns = n - 2
+		values := make([]int, columns)
+		for i := range values {
+			values[i] = words[i+1] % 1000
+		}
+		rowWords[row] = values
+	}
+	if columns <= 0 || indicators[2]+1 != columns {
+		return "", fmt.Errorf("找不到完整的 PDF417")
+	}
+	rows := indicators[0]*3 + indicators[1]%3 + 1
+	security := indicators[1] / 3
+	var codewords []int
+	for r := 0; r < rows; r++ {
+		values, ok := rowWords[r]
+		if !ok {
+			return "", fmt.Errorf("第 %d 行无法识别", r+1)
+		}
+		codewords = append(codewords, values...)
+	}
+	ecCount := 2 << security
+	// 纠错校验: 码字多项式在 3^1..3^ecCount 处的值都为 0
+	root := 1
+	for i := 1; i <= ecCount; i++ {
+		root = root * 3 % 929
+		s := 0
+		for _, c := range codewords {
+			s = (s*root + c) % 929
+		}
+		if s != 0 {
+			return "", fmt.Errorf("纠错码字校验失败")
+		}
+	}
+	length := codewords[0]
+	if length < 1 || length > len(codewords)-ecCount {
+		return "", fmt.Errorf("长度码字错误")
+	}
+	return parsePdf417Data(codewords[1:length])
+}
+
+// parsePdf417Data 按文本、字节、数字压缩解释数据码字
+func parsePdf417Data(words []int) (string, error) {
+	var out []byte
+	submode, shift := pdf417Upper, -1
+	for i := 0; i < len(words); {
+		w := words[i]
+		switch {
+		case w == pdf417LatchText:
+			submode, shift = pdf417Upper, -1
+			i++
+		case w == pdf417ShiftByte:
+			if i+1 >= len(words) {
+				return "", fmt.Errorf("字节切换符后缺少数据")
+			}
+			out = append(out, byte(words[i+1]))
+			shift = -1
+			i += 2
+		case w == pdf417LatchByte || w == pdf417LatchByte6 || w == pdf417LatchNumeric:
+			end := i + 1
+			for end < len(words) && words[end] < 900 {
+				end++
+			}
+			group := words[i+1 : end]
+			if w == pdf417LatchNumeric {
+				out = append(out, parsePdf417Numeric(group)...)
+			} else {
+				out = append(out, parsePdf417Bytes(group, w == pdf417LatchByte6)...)
+			}
+			i = end
+		case w >= 900:
+			return "", fmt.Errorf("不支持的码字 %d", w)
+		default:
+			for _, v := range [2]int{w / 30, w % 30} {
+				out, submode, shift = pdf417TextValue(out, v, submode, shift)
+			}
+			i++
+		}
+	}
+	return string(out), nil
+}
+
+// pdf417TextValue 解释文本压缩的一个值，shift 为临时切换的子模式(-1 表示没有)
+func pdf417TextValue(out []byte, v, submode, shift int) ([]byte, int, int) {
+	if shift >= 0 {
+		switch {
+		case shift == pdf417Punct && v < 29:
+			out = append(out, pdf417PunctChars[v])
+		case shift == pdf417Upper && v < 26:
+			out = append(out, byte('A'+v))
+		case shift == pdf417Upper && v == 26:
+			out = append(out, ' ')
+		}
+		return out, submode, -1
+	}
+	switch submode {
+	case pdf417Upper, pdf417Lower:
+		switch {
+		case v < 26 && submode == pdf417Upper:
+			out = append(out, byte('A'+v))
+		case v < 26:
+			out = append(out, byte('a'+v))
+		case v == 26:
+			out = append(out, ' ')
+		case v == 27 && submode == pdf417Upper:
+			submode = pdf417Lower
+		case v == 27:
+			shift = pdf417Upper
+		case v == 28:
+			submode = pdf417Mixed
+		default:
+			shift = pdf417Punct
+		}
+	case pdf417Mixed:
+		switch v {
+		case 25:
+			submode = pdf417Punct
+		case 27:
+			submode = pdf417Lower
+		case 28:
+			submode = pdf417Upper
+		case 29:
+			shift = pdf417Punct
+		default:
+			out = append(out, pdf417MixedChars[v])
+		}
+	default:
+		if v == 29 {
+			submode = pdf417Upper
+		} else {
+			out = append(out, pdf417PunctChars[v])
+		}
+	}
+	return out, submode, shift
+}
+
+// parsePdf417Bytes 字节压缩: 每 5 个码字为 6 字节；901 开头时最后不足 6 字节的部分每个码字一字节
+func parsePdf417Bytes(words []int, six bool) []byte {
+	raw := 0
+	if !six {
+		if raw = len(words) % 5; raw == 0 {
+			raw = 5
+		}
+		if raw > len(words) {
+			raw = len(words)
+		}
+	}
+	var out []byte
+	for i := 0; i+5 <= len(words)-raw; i += 5 {
+		var t int64
+		for _, w := range words[i : i+5] {
+			t = t*900 + int64(w)
+		}
+		for k := 5; k >= 0; k-- {
+			out = append(out, byte(t>>(8*uint(k))))
+		}
+	}
+	for _, w := range words[len(words)-raw:] {
+		out = append(out, byte(w))
+	}
+	return out
+}
+
+// parsePdf417Numeric 数字压缩: 每 15 个码字为一组 900 进制数，去掉开头的 1
+func parsePdf417Numeric(words []int) []byte {
+	var out []byte
+	for start := 0; start < len(words); start += 15 {
+		end := start + 15
+		if end > len(words) {
+			end = len(words)
+		}
+		n := new(big.Int)
+		for _, w := range words[start:end] {
+			n.Mul(n, big.NewInt(900))
+			n.Add(n, big.NewInt(int64(w)))
+		}
+		out = append(out, n.String()[1:]...)
+	}
+	return out
+}
+
+// decodeDataMatrix 解码 Data Matrix 图片: 按上边的虚线确定列数和模块大小，逐模块取样后按排布规则读出码字，
+// 用伴随式检查纠错码字，再按 ASCII 编码解释；FNC1 按 code128 包的 FNC1 字符返回。
+// 排布和纠错按 ISO/IEC 16022 独立实现，不使用编码时的排布表和纠错码生成，避免编码错误被同样的逻辑掩盖
+func decodeDataMatrix(g grayImage) (string, error) {
+	minX, minY, maxX, maxY, ok := g.darkBounds()
+	if !ok {
+		return "", fmt.Errorf("图片中没有 Data Matrix")
+	}
+	// 上边虚线每个条、空为一个模块，最右一个模块为浅色；最上一行可能因抗锯齿只有部分变深，
+	// 按上边各行分别估计列数，出现最多的优先尝试(最小的规格有 8 行，虚线不超过高度的 1/8)
+	var candidates []int
+	counts := map[int]int{}
+	for y := minY; y <= minY+(maxY-minY)/8; y++ {
+		cols := len(g.scanRuns(y)) + 1
+		if counts[cols] == 0 {
+			candidates = append(candidates, cols)
+		}
+		counts[cols]++
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return counts[candidates[i]] > counts[candidates[j]] })
+	var firstErr error
+	for _, cols := range candidates {
+		text, err := decodeDataMatrixCols(g, image.Rect(minX, minY, maxX+1, maxY+1), cols)
+		if err == nil {
+			return text, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", firstErr
+}
+
+// decodeDataMatrixCols 按列数 cols 解码 bounds 范围内的 Data Matrix
+func decodeDataMatrixCols(g grayImage, bounds image.Rectangle, cols int) (string, error) {
+	module := float64(bounds.Dx()) / float64(cols)
+	rows := int(math.Round(float64(bounds.Dy()) / module))
+	var s dmSize
+	for _, size := range dmSizes {
+		if size.rows == rows && size.cols == cols {
+			s = size
+		}
+	}
+	if s.rows == 0 {
+		return "", fmt.Errorf("找不到 %dx%d 规格的 Data Matrix", rows, cols)
+	}
+	moduleY := float64(bounds.Dy()) / float64(rows)
+	dark := func(x, y int) bool {
+		return g.dark(bounds.Min.X+int((float64(x)+0.5)*module), bounds.Min.Y+int((float64(y)+0.5)*moduleY))
+	}
+	// 左边、下边为实线，上边、右边为虚线
+	for i := 0; i < rows || i < cols; i++ {
+		if (i < rows && !dark(0, i)) || (i < cols && !dark(i, rows-1)) ||
+			(i < cols && dark(i, 0) != (i%2 == 0)) || (i < rows && dark(cols-1, i) != (i%2 == 1)) {
+			return "", fmt.Errorf("找不到定位图形")
+		}
+	}
+
+	// 去掉定位图形后数据区的第 r 行第 c 列
+	bit := func(r, c int) bool {
+		y := r/s.dataRows*(s.dataRows+2) + r%s.dataRows + 1
+		x := c/s.dataCols*(s.dataCols+2) + c%s.dataCols + 1
+		return dark(x, y)
+	}
+	codewords, err := dmReadCodewords(bit, s.dataRows*s.regionRows, s.dataCols*s.regionCols, s.dataCodewords+s.eccPerBlock*s.blocks)
+	if err != nil {
+		return "", err
+	}
+	if !dmCheckECC(codewords, s) {
+		return "", fmt.Errorf("纠错码字校验失败")
+	}
+
+	var out []byte
+	data := codewords[:s.dataCodewords]
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == dmPad:
+			return string(out), nil
+		case c >= 1 && c <= 128:
+			out = append(out, c-1)
+		case c >= 130 && c <= 229:
+			out = append(out, '0'+(c-130)/10, '0'+(c-130)%10)
+		case c == dmFNC1:
+			out = append(out, string(code128.FNC1)...)
+		case c == dmUpperShift && i+1 < len(data):
+			i++
+			out = append(out, data[i]+127)
+		default:
+			return "", fmt.Errorf("不支持的码字 %d", c)
+		}
+	}
+	return string(out), nil
+}
+
+// dmReadCodewords 按 ISO/IEC 16022 附录 F 的排布规则，沿对角线从数据区读出 total 个码字；
+// bit 返回数据区第 r 行第 c 列模块是否为深色
+func dmReadCodewords(bit func(r, c int) bool, nrow, ncol, total int) ([]byte, error) {
+	read := make([]bool, nrow*ncol)
+	module := func(r, c int) byte {
+		// 超出上边、左边时折回到另一侧
+		if r < 0 {
+			r += nrow
+			c += 4 - (nrow+4)%8
+		}
+		if c < 0 {
+			c += ncol
+			r += 4 - (ncol+4)%8
+		}
+		read[r*ncol+c] = true
+		if bit(r, c) {
+			return 1
+		}
+		return 0
+	}
+	codeword := func(cells [8][2]int) byte {
+		var v byte
+		for _, cell := range cells {
+			v = v<<1 | module(cell[0], cell[1])
+		}
+		return v
+	}
+	// utah 以 (r, c) 为右下角的 L 形 8 个模块
+	utah := func(r, c int) byte {
+		return codeword([8][2]int{{r - 2, c - 2}, {r - 2, c - 1}, {r - 1, c - 2}, {r - 1, c - 1}, {r - 1, c}, {r, c - 2}, {r, c - 1}, {r, c}})
+	}
+	corners := [4][8][2]int{
+		{{nrow - 1, 0}, {nrow - 1, 1}, {nrow - 1, 2}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}},
+		{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 4}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}},
+		{{nrow - 1, 0}, {nrow - 1, ncol - 1}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 3}, {1, ncol - 2}, {1, ncol - 1}},
+		{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}},
+	}
+
+	var out []byte
+	var cornerRead [4]bool
+	corner := func(i int) {
+		cornerRead[i] = true
+		out = append(out, codeword(corners[i]))
+	}
+	r, c := 4, 0
+	for r < nrow || c < ncol {
+		switch {
+		case r == nrow && c == 0 && !cornerRead[0]:
+			corner(0)
+			r, c = r-2, c+2
+		case r == nrow-2 && c == 0 && ncol%4 != 0 && !cornerRead[1]:
+			corner(1)
+			r, c = r-2, c+2
+		case r == nrow+4 && c == 2 && ncol%8 == 0 && !cornerRead[2]:
+			corner(2)
+			r, c = r-2, c+2
+		case r == nrow-2 && c == 0 && ncol%8 == 4 && !cornerRead[3]:
+			corner(3)
+			r, c = r-2, c+2
+		default:
+			// 向右上读一条对角线，再向左下读下一条
+			for {
+				if r < nrow && c >= 0 && !read[r*ncol+c] {
+					out = append(out, utah(r, c))
+				}
+				r, c = r-2, c+2
+				if r < 0 || c >= ncol {
+					break
+				}
+			}
+			r, c = r+1, c+3
+			for {
+				if r >= 0 && c < ncol && !read[r*ncol+c] {
+					out = append(out, utah(r, c))
+				}
+				r, c = r+2, c-2
+				if r >= nrow || c < 0 {
+					break
+				}
+			}
+			r, c = r+3, c+1
+		}
+	}
+	if len(out) != total {
+		return nil, fmt.Errorf("读出 %d 个码字，应为 %d 个", len(out), total)
+	}
+	return out, nil
+}
+
+// Data Matrix 纠错使用的 GF(256)，本原多项式 x^8+x^5+x^3+x^2+1
+var dmGFExp, dmGFLog = func() (exp [255]byte, log [256]int) {
+	x := 1
+	for i := range exp {
+		exp[i] = byte(x)
+		log[x] = i
+		if x <<= 1; x >= 256 {
+			x ^= 301
+		}
+	}
+	return exp, log
+}()
+
+// dmCheckECC 按交错块计算伴随式，生成多项式的根为 α^1…α^n，全部为 0 时码字正确
+func dmCheckECC(codewords []byte, s dmSize) bool {
+	for b := 0; b < s.blocks; b++ {
+		// 数据码字和纠错码字都按块交错排列
+		var block []byte
+		for i := b; i < s.dataCodewords; i += s.blocks {
+			block = append(block, codewords[i])
+		}
+		for i := b; i < s.eccPerBlock*s.blocks; i += s.blocks {
+			block = append(block, codewords[s.dataCodewords+i])
+		}
+		for k := 1; k <= s.eccPerBlock; k++ {
+			var syndrome byte
+			for _, v := range block {
+				if syndrome != 0 {
+					syndrome = dmGFExp[(dmGFLog[syndrome]+k)%255]
+				}
+				syndrome ^= v
+			}
+			if syndrome != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
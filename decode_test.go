@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	bdm "github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/qr"
+	"github.com/boombuler/barcode/twooffive"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// referenceImage 把其他编码器生成的条码按 w×h 像素放在四周留白的图片中
+func referenceImage(t *testing.T, code barcode.Barcode, err error, w, h int) grayImage {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scaled, err := barcode.Scale(code, w, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w+40, h+40))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(20, 20, w+20, h+20), scaled, scaled.Bounds().Min, draw.Src)
+	return grayImage{img}
+}
+
+// 解码 boombuler/barcode 生成的条码，与本项目的编码器相互独立
+func TestDecodeReferenceSymbols(t *testing.T) {
+	fnc1 := string(code128.FNC1)
+	tests := []struct {
+		symbology string
+		want      string
+		image     func() grayImage
+	}{
+		{"qrcode", "SN2024000001\nSN2024000002", func() grayImage {
+			code, err := qr.Encode("SN2024000001\nSN2024000002", qr.M, qr.Auto)
+			return referenceImage(t, code, err, 290, 290)
+		}},
+		{"qrcode", "https://id.gs1.org/01/06979018510006", func() grayImage {
+			code, err := qr.Encode("https://id.gs1.org/01/06979018510006", qr.H, qr.Unicode)
+			return referenceImage(t, code, err, 330, 330)
+		}},
+		{"qrcode", "0123456789012345", func() grayImage {
+			code, err := qr.Encode("0123456789012345", qr.L, qr.Numeric)
+			return referenceImage(t, code, err, 210, 210)
+		}},
+		{"code128", "C0001-100", func() grayImage {
+			code, err := code128.Encode("C0001-100")
+			return referenceImage(t, code, err, 400, 80)
+		}},
+		{"code128", "12345678", func() grayImage {
+			code, err := code128.Encode("12345678")
+			return referenceImage(t, code, err, 300, 80)
+		}},
+		{"gs1-128", fnc1 + "0106979018510006" + "10L2401", func() grayImage {
+			code, err := code128.Encode(fnc1 + "0106979018510006" + "10L2401")
+			return referenceImage(t, code, err, 600, 100)
+		}},
+		{"ean13", "4006381333931", func() grayImage {
+			code, err := ean.Encode("4006381333931")
+			return referenceImage(t, code, err, 380, 100)
+		}},
+		{"itf14", "16979018510003", func() grayImage {
+			code, err := twooffive.Encode("16979018510003", true)
+			return referenceImage(t, code, err, 400, 100)
+		}},
+		{"datamatrix", "123456", func() grayImage {
+			code, err := bdm.Encode("123456")
+			return referenceImage(t, code, err, 100, 100)
+		}},
+		{"datamatrix", `{"po":12,"batchAction":"start_end"}`, func() grayImage {
+			code, err := bdm.Encode(`{"po":12,"batchAction":"start_end"}`)
+			return referenceImage(t, code, err, 240, 240)
+		}},
+	}
+	for _, tt := range tests {
+		got, err := decodeSymbol(tt.symbology, tt.image())
+		if err != nil || got != tt.want {
+			t.Errorf("decodeSymbol(%s) = %q, %v, want %q", tt.symbology, got, err, tt.want)
+		}
+	}
+}
+
+// Data Matrix 解码器的排布和纠错与编码器相互独立: 用外部参考符号、ISO/IEC 16022 的码字示例和
+// boombuler/barcode 生成的多区块、多交错块符号检查，再与本项目编码器的全部规格互相验证
+func TestDecodeDataMatrix(t *testing.T) {
+	// boombuler/barcode 测试中的 24x24 参考符号，按模块画成 4 像素
+	rows := strings.Split(strings.TrimPrefix(dmReference24, "\n"), "\n")
+	img := image.NewRGBA(image.Rect(0, 0, (len(rows[0])+2)*4, (len(rows)+2)*4))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for y, row := range rows {
+		for x, c := range row {
+			if c == '#' {
+				draw.Draw(img, image.Rect((x+1)*4, (y+1)*4, (x+2)*4, (y+2)*4), image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if got, err := decodeDataMatrix(grayImage{img}); err != nil || got != `{"po":12,"batchAction":"start_end"}` {
+		t.Errorf("reference symbol decodes to %q, %v", got, err)
+	}
+
+	// ISO/IEC 16022 示例 "123456" 的数据码字和纠错码字
+	iso := []byte{142, 164, 186, 114, 25, 5, 88, 102}
+	if !dmCheckECC(iso, dmSizes[0]) {
+		t.Error("ISO 123456 codewords: ECC check failed")
+	}
+	for i := range iso {
+		changed := append([]byte(nil), iso...)
+		changed[i] ^= 0x10
+		if dmCheckECC(changed, dmSizes[0]) {
+			t.Errorf("ISO 123456 codewords with codeword %d changed: ECC check passed", i+1)
+		}
+	}
+
+	for _, n := range []int{200, 400, 1000, 1500} {
+		content := strings.Repeat("Data Matrix 2024/", n/17+1)[:n]
+		code, err := bdm.Encode(content)
+		side := code.Bounds().Dx() * 3
+		if got, err := decodeDataMatrix(referenceImage(t, code, err, side, side)); err != nil || got != content {
+			t.Errorf("reference %d chars (%dx%d): %q, %v", n, code.Bounds().Dx(), code.Bounds().Dy(), got, err)
+		}
+	}
+
+	// 按每种规格的容量填满内容，覆盖全部四种角落排布
+	for _, s := range dmSizes {
+		content := strings.Repeat("1234567890", s.dataCodewords)[:2*s.dataCodewords]
+		d, err := encodeDataMatrix(content, false, s.String())
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		data, err := dataMatrixPng(d, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := decodeBarcodePng("datamatrix", data); err != nil || got != content {
+			t.Errorf("%s: decodes to %q, %v", s, got, err)
+		}
+	}
+}
+
+// 上边缘一行因抗锯齿只有部分虚线变深时，按下面的行确定列数
+func TestDecodeDataMatrixPartialTopRow(t *testing.T) {
+	d, err := encodeDataMatrix("SN2024000001", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := dataMatrixPng(d, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := decodePngImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := g.img.Bounds()
+	module := bounds.Dx() / (d.size.cols + 2)
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()+1))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, bounds.Add(image.Pt(0, 1)), g.img, bounds.Min, draw.Src)
+	// 多出的一行只有左边一半的虚线
+	for x := module; x < bounds.Dx()/2; x++ {
+		if g.dark(x, module) {
+			img.Set(x, module, color.Gray{Y: 60})
+		}
+	}
+	if got, err := decodeDataMatrix(grayImage{img}); err != nil || got != "SN2024000001" {
+		t.Errorf("decodes to %q, %v, want SN2024000001", got, err)
+	}
+}
+
+// 本项目生成的各码制图片都能解码回应写入的内容
+func TestDecodeGeneratedSymbols(t *testing.T) {
+	tests := []struct {
+		element TemplateElement
+		value   string
+	}{
+		{TemplateElement{Type: TemplateBarcode, W: 400, H: 100}, "C0001-100"},
+		{TemplateElement{Type: TemplateBarcode, Symbology: "ean13", W: 300, H: 100}, "697901851000"},
+		{TemplateElement{Type: TemplateBarcode, Symbology: "gs1-128", W: 600, H: 150}, "(01)06979018510006(10)L2401(37)12"},
+		{TemplateElement{Type: TemplateBarcode, Symbology: "itf14", W: 600, H: 150}, "1697901851000"},
+		{TemplateElement{Type: TemplateBarcode, Symbology: "code39", W: 600, H: 150, CheckChar: true}, "SN-2024/01"},
+		{TemplateElement{Type: TemplateBarcode, Symbology: "datamatrix", W: 100}, "设备 SN2024000001"},
+		{TemplateElement{Type: TemplateBarcode, Symbology: "gs1-datamatrix", W: 100}, "(01)06979018510006(21)A1(17)261231"},
+		{TemplateElement{Type: TemplateBarcode, Symbology: "pdf417", W: 600, H: 200}, "SN2024000001,SN2024000002"},
+		{TemplateElement{Type: TemplateQrcode, W: 200, H: 200}, "SN2024000001\nSN2024000002"},
+	}
+	for _, tt := range tests {
+		label := &Label{Orientation: "P", Size: gofpdf.SizeType{Wd: 1000, Ht: 600}}
+		if err := tt.element.addTo(label, tt.value); err != nil {
+			t.Errorf("%s %q: %v", tt.element.symbology(), tt.value, err)
+			continue
+		}
+		e := label.Elements[0]
+		got, err := decodeBarcodePng(e.Symbology, e.ImageData)
+		if err != nil || got != e.Content {
+			t.Errorf("%s %q decodes to %q, %v, want %q", e.Symbology, tt.value, got, err, e.Content)
+		}
+		if err := verifyLabelBarcodes(label); err != nil {
+			t.Errorf("%s %q: verifyLabelBarcodes: %v", e.Symbology, tt.value, err)
+		}
+	}
+}
+
+// 版面中被遮挡、超出页面或内容不一致的条码在导出时报错，预览时不校验
+func TestVerifyLabelBarcodes(t *testing.T) {
+	black := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(black, black.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	blackPng := encodeTestPng(t, black)
+
+	tests := []struct {
+		name  string
+		x     float64
+		cover bool
+		want  string
+		err   string
+	}{
+		{name: "ok", x: 100},
+		{name: "covered", x: 100, cover: true, err: "解码校验失败"},
+		{name: "off page", x: 800, err: "解码校验失败"},
+		{name: "content", x: 100, want: "C0002", err: "解码校验不一致"},
+	}
+	for _, tt := range tests {
+		label := &Label{Orientation: "P", Size: gofpdf.SizeType{Wd: 1000, Ht: 600}}
+		e := TemplateElement{Type: TemplateBarcode, X: tt.x, Y: 100, W: 400, H: 100}
+		if err := e.addTo(label, "C0001"); err != nil {
+			t.Fatal(err)
+		}
+		if tt.want != "" {
+			label.Elements[0].Content = tt.want
+		}
+		if tt.cover {
+			label.AddImage("cover", "png", blackPng, tt.x+150, 100, 20, 100)
+		}
+		if _, err := RenderLabelImage(label, 0.5); err != nil {
+			t.Errorf("%s: preview: %v", tt.name, err)
+		}
+		_, err := RenderLabel(label, FormatSvg, 0)
+		if tt.err == "" {
+			if err != nil || !label.verified {
+				t.Errorf("%s: %v, verified = %v", tt.name, err, label.verified)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want containing %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func encodeTestPng(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,1026 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 设计画布宽度(像素)，按模板页面宽度换算每毫米像素数
+const designerWidthPx = 760
+
+// 拖动后坐标按该步长(mm)对齐
+const designerSnap = 0.5
+
+// 缩放手柄大小(像素)
+const designerHandleSize = 12
+
+// 模板未指定语言时语言下拉框显示的选项
+const designerDefaultLanguage = "默认"
+
+// 二维码参数未在模板中指定时下拉框显示的选项
+const designerQrDefault = "默认"
+
+var (
+	designerBorderColor   = color.NRGBA{R: 0x33, G: 0x66, B: 0xcc, A: 0xff}
+	designerSelectedColor = color.NRGBA{R: 0xe6, G: 0x4a, B: 0x19, A: 0xff}
+	designerFillColor     = color.NRGBA{R: 0x33, G: 0x66, B: 0xcc, A: 0x18}
+)
+
+// TemplateDesigner 标签模板设计器: 在缩放后的画布上拖动元素、修改属性，保存后打印立即使用
+type TemplateDesigner struct {
+	logger *Logger
+	window fyne.Window
+	fields map[string]string
+
+	mu       sync.Mutex
+	tmpl     *LabelTemplate
+	selected int
+	scale    float64
+	loading  bool
+	timer    *time.Timer
+
+	templateSelect *widget.Select
+	nameEntry      *widget.Entry
+	status         *widget.Label
+
+	background *canvas.Image
+	board      *fyne.Container
+	items      []*designerItem
+	handle     *designerHandle
+
+	// 页面属性
+	descEntry       *widget.Entry
+	widthEntry      *widget.Entry
+	heightEntry     *widget.Entry
+	printWidthEntry *widget.Entry
+	fontSelect      *widget.Select
+	styleSelect     *widget.Select
+	langSelect      *widget.Select
+
+	// 元素属性
+	props           *fyne.Container
+	typeLabel       *widget.Label
+	xEntry          *widget.Entry
+	yEntry          *widget.Entry
+	wEntry          *widget.Entry
+	hEntry          *widget.Entry
+	valueEntry      *widget.Entry
+	fieldSelect     *widget.Select
+	assetSelect     *widget.Select
+	fontSizeEntry   *widget.Entry
+	minFontEntry    *widget.Entry
+	wrapCheck       *widget.Check
+	ellipsisCheck   *widget.Check
+	alignSelect     *widget.Select
+	valignSelect    *widget.Select
+	levelSelect     *widget.Select
+	splitSelect     *widget.Select
+	quietZoneEntry  *widget.Entry
+	modeSelect      *widget.Select
+	librarySelect   *widget.Select
+	symbologySel    *widget.Select
+	pixelsEntry     *widget.Entry
+	dmSizeEntry     *widget.Entry
+	moduleEntry     *widget.Entry
+	columnsEntry    *widget.Entry
+	rowsEntry       *widget.Entry
+	securityEntry   *widget.Entry
+	checkCharCheck  *widget.Check
+	textProps       *fyne.Container
+	qrcodeProps     *fyne.Container
+	barcodeProps    *fyne.Container
+	dataMatrixProps *fyne.Container
+	pdf417Props     *fyne.Container
+	deleteBtn       *widget.Button
+}
+
+// createDesignerTab 创建模板设计界面，window 用于显示导入模板包的对话框
+func createDesignerTab(logger *Logger, window fyne.Window) fyne.CanvasObject {
+	d := &TemplateDesigner{logger: logger, window: window, fields: sampleTemplateFields(), selected: -1}
+	content := d.content()
+	OnTemplatesChanged(func() {
+		d.templateSelect.Options = TemplateNames()
+		d.templateSelect.Refresh()
+		d.assetSelect.Options = AssetNames()
+		d.assetSelect.Refresh()
+	})
+	return content
+}
+
+func (d *TemplateDesigner) content() fyne.CanvasObject {
+	d.status = widget.NewLabel("")
+	d.status.Wrapping = fyne.TextWrapWord
+
+	d.nameEntry = widget.NewEntry()
+	d.nameEntry.SetPlaceHolder("保存的模板名，如 tag 或 tag_客户A")
+	d.templateSelect = widget.NewSelect(TemplateNames(), func(name string) { d.load(name) })
+	reloadBtn := widget.NewButton("🔄 重新加载", func() {
+		if d.templateSelect.Selected != "" {
+			d.load(d.templateSelect.Selected)
+		}
+	})
+	saveBtn := widget.NewButton("💾 保存模板", d.save)
+	saveBtn.Importance = widget.HighImportance
+	lintBtn := widget.NewButton("🔍 检查", d.lint)
+	exportBtn := widget.NewButton("📦 导出包", d.exportBundle)
+	importBtn := widget.NewButton("📥 导入包", d.importBundle)
+
+	// 画布
+	d.background = canvas.NewImageFromImage(nil)
+	d.background.FillMode = canvas.ImageFillStretch
+	d.handle = newDesignerHandle(d)
+	d.handle.Hide()
+	d.board = container.NewWithoutLayout(d.background)
+
+	// 素材库中的 logo、认证标志等，选中后按实际尺寸插入
+	d.assetSelect = widget.NewSelect(AssetNames(), func(name string) {
+		if name == "" {
+			return
+		}
+		d.addAsset(name)
+		d.assetSelect.ClearSelected()
+	})
+	d.assetSelect.PlaceHolder = "➕ 素材"
+
+	addButtons := container.NewGridWithColumns(5,
+		widget.NewButton("➕ 文字", func() { d.addElement(TemplateText) }),
+		widget.NewButton("➕ 二维码", func() { d.addElement(TemplateQrcode) }),
+		widget.NewButton("➕ 条码", func() { d.addElement(TemplateBarcode) }),
+		widget.NewButton("➕ 图片", func() { d.addElement(TemplateImage) }),
+		d.assetSelect,
+	)
+
+	toolbar := container.NewBorder(nil, nil, widget.NewLabel("模板"), container.NewHBox(reloadBtn, exportBtn, importBtn),
+		d.templateSelect)
+	saveBar := container.NewBorder(nil, nil, widget.NewLabel("保存为"), container.NewHBox(lintBtn, saveBtn), d.nameEntry)
+
+	left := container.NewBorder(
+		container.NewVBox(toolbar, addButtons),
+		container.NewVBox(d.status, saveBar),
+		nil, nil,
+		container.NewScroll(container.NewPadded(d.board)),
+	)
+
+	split := container.NewHSplit(left, container.NewScroll(d.propertyPanel()))
+	split.SetOffset(0.68)
+
+	if names := TemplateNames(); len(names) > 0 {
+		d.templateSelect.SetSelected(names[0])
+	}
+	return split
+}
+
+// propertyPanel 页面和元素属性编辑区
+func (d *TemplateDesigner) propertyPanel() fyne.CanvasObject {
+	d.descEntry = d.newEntry(func(t *LabelTemplate, _ *TemplateElement, text string) { t.Description = text })
+	d.widthEntry = d.newEntry(func(t *LabelTemplate, _ *TemplateElement, text string) { t.Width = parseMm(text, t.Width) })
+	d.heightEntry = d.newEntry(func(t *LabelTemplate, _ *TemplateElement, text string) { t.Height = parseMm(text, t.Height) })
+	d.printWidthEntry = d.newEntry(func(t *LabelTemplate, _ *TemplateElement, text string) {
+		t.PrintWidth = 0
+		if text != "" {
+			t.PrintWidth = parseMm(text, t.PrintWidth)
+		}
+	})
+	d.printWidthEntry.SetPlaceHolder("与宽相同")
+	d.fontSelect = widget.NewSelect([]string{chineseFont, "Arial", "Helvetica", "Times", "Courier"}, func(font string) {
+		d.update(func(t *LabelTemplate, _ *TemplateElement) { t.Font = font })
+	})
+	d.styleSelect = widget.NewSelect([]string{"常规", "粗体"}, func(style string) {
+		d.update(func(t *LabelTemplate, _ *TemplateElement) {
+			t.FontStyle = ""
+			if style == "粗体" {
+				t.FontStyle = "B"
+			}
+		})
+	})
+
+	// 标题语言，"默认" 表示使用配置的语言
+	d.langSelect = widget.NewSelect(append([]string{designerDefaultLanguage}, LanguageOptions()...), func(lang string) {
+		d.update(func(t *LabelTemplate, _ *TemplateElement) {
+			t.Language = ""
+			if lang != designerDefaultLanguage {
+				t.Language = lang
+			}
+		})
+	})
+
+	d.typeLabel = widget.NewLabel("")
+	d.xEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.X = parseMm(text, e.X) })
+	d.yEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.Y = parseMm(text, e.Y) })
+	d.wEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.W = parseMm(text, e.W) })
+	d.hEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.H = parseMm(text, e.H) })
+	d.valueEntry = widget.NewMultiLineEntry()
+	d.valueEntry.SetMinRowsVisible(2)
+	d.valueEntry.OnChanged = func(text string) {
+		d.update(func(_ *LabelTemplate, e *TemplateElement) {
+			if e != nil {
+				e.Value = text
+			}
+		})
+	}
+	d.fieldSelect = widget.NewSelect(fieldNames(d.fields), func(name string) {
+		if name == "" {
+			return
+		}
+		d.valueEntry.SetText(d.valueEntry.Text + "{{" + name + "}}")
+		d.fieldSelect.ClearSelected()
+	})
+	d.fieldSelect.PlaceHolder = "插入字段"
+
+	d.fontSizeEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.FontSize = parseMm(text, e.FontSize) })
+	d.minFontEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.MinFontSize = parseMm(text, e.MinFontSize) })
+	d.wrapCheck = d.newElementCheck("自动换行", func(e *TemplateElement, on bool) { e.Wrap = on })
+	d.ellipsisCheck = d.newElementCheck("省略号", func(e *TemplateElement, on bool) { e.Ellipsis = on })
+	d.alignSelect = d.newElementSelect([]string{"L", "C", "R"}, func(e *TemplateElement, v string) { e.Align = v })
+	d.valignSelect = d.newElementSelect([]string{"T", "M", "B"}, func(e *TemplateElement, v string) { e.VAlign = v })
+	// 二维码参数选“默认”时使用 config.toml 中该类标签的设置
+	d.levelSelect = d.newElementSelect([]string{designerQrDefault, "L", "M", "Q", "H"}, func(e *TemplateElement, v string) { e.Level = designerQrValue(v) })
+	d.splitSelect = d.newElementSelect([]string{"不拆分", qrSplitPage, qrSplitGrid}, func(e *TemplateElement, v string) {
+		e.Split = v
+		if v == "不拆分" {
+			e.Split = ""
+		}
+	})
+	d.quietZoneEntry = d.newElementEntry(func(e *TemplateElement, text string) {
+		e.QuietZone = nil
+		if n, err := strconv.Atoi(strings.TrimSpace(text)); err == nil && n >= 0 {
+			e.QuietZone = &n
+		}
+	})
+	d.quietZoneEntry.SetPlaceHolder(designerQrDefault)
+	d.modeSelect = d.newElementSelect([]string{designerQrDefault, qrModeAuto, qrModeNumeric, qrModeAlphanumeric, qrModeByte}, func(e *TemplateElement, v string) { e.Mode = designerQrValue(v) })
+	d.librarySelect = d.newElementSelect([]string{designerQrDefault, qrLibrarySkip2, qrLibraryBoombuler}, func(e *TemplateElement, v string) { e.Library = designerQrValue(v) })
+	d.symbologySel = d.newElementSelect(barcodeSymbologies(), func(e *TemplateElement, v string) {
+		e.Symbology = v
+		showIf(d.dataMatrixProps, e.isDataMatrix())
+		showIf(d.pdf417Props, e.symbology() == "pdf417")
+		showIf(d.checkCharCheck, e.symbology() == "code39")
+	})
+	d.pixelsEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.Pixels = StringToInt(text) })
+	d.dmSizeEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.Size = strings.TrimSpace(text) })
+	d.dmSizeEntry.SetPlaceHolder("square / rect / 16x16")
+	d.moduleEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.Module = parseMm(text, e.Module) })
+	d.columnsEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.Columns = StringToInt(text) })
+	d.columnsEntry.SetPlaceHolder("自动")
+	d.rowsEntry = d.newElementEntry(func(e *TemplateElement, text string) { e.Rows = StringToInt(text) })
+	d.rowsEntry.SetPlaceHolder("自动")
+	d.securityEntry = d.newElementEntry(func(e *TemplateElement, text string) {
+		e.Security = nil
+		if n, err := strconv.Atoi(strings.TrimSpace(text)); err == nil && n >= 0 {
+			e.Security = &n
+		}
+	})
+	d.securityEntry.SetPlaceHolder("自动")
+	d.checkCharCheck = d.newElementCheck("校验字符", func(e *TemplateElement, on bool) { e.CheckChar = on })
+
+	d.deleteBtn = widget.NewButton("🗑️ 删除元素", d.deleteSelected)
+	d.deleteBtn.Importance = widget.LowImportance
+
+	d.textProps = container.NewVBox(
+		widget.NewForm(
+			widget.NewFormItem("字号(pt)", d.fontSizeEntry),
+			widget.NewFormItem("最小字号", d.minFontEntry),
+			widget.NewFormItem("水平对齐", d.alignSelect),
+			widget.NewFormItem("垂直对齐", d.valignSelect),
+		),
+		container.NewGridWithColumns(2, d.wrapCheck, d.ellipsisCheck),
+	)
+	d.qrcodeProps = container.NewVBox(widget.NewForm(
+		widget.NewFormItem("纠错等级", d.levelSelect),
+		widget.NewFormItem("像素", d.pixelsEntry),
+		widget.NewFormItem("过密拆分", d.splitSelect),
+		widget.NewFormItem("空白(模块)", d.quietZoneEntry),
+		widget.NewFormItem("编码模式", d.modeSelect),
+		widget.NewFormItem("编码库", d.librarySelect),
+	))
+	d.barcodeProps = container.NewVBox(widget.NewForm(
+		widget.NewFormItem("条码类型", d.symbologySel),
+	))
+	d.dataMatrixProps = container.NewVBox(widget.NewForm(
+		widget.NewFormItem("规格", d.dmSizeEntry),
+		widget.NewFormItem("模块宽(mm)", d.moduleEntry),
+	))
+	d.barcodeProps.Add(d.dataMatrixProps)
+	d.pdf417Props = container.NewVBox(widget.NewForm(
+		widget.NewFormItem("列数", d.columnsEntry),
+		widget.NewFormItem("行数", d.rowsEntry),
+		widget.NewFormItem("纠错等级", d.securityEntry),
+	))
+	d.barcodeProps.Add(d.pdf417Props)
+	d.barcodeProps.Add(d.checkCharCheck)
+
+	d.props = container.NewVBox(
+		widget.NewLabelWithStyle("🔧 元素属性", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		d.typeLabel,
+		widget.NewForm(
+			widget.NewFormItem("X(mm)", d.xEntry),
+			widget.NewFormItem("Y(mm)", d.yEntry),
+			widget.NewFormItem("宽(mm)", d.wEntry),
+			widget.NewFormItem("高(mm)", d.hEntry),
+			widget.NewFormItem("内容", d.valueEntry),
+			widget.NewFormItem("", d.fieldSelect),
+		),
+		d.textProps,
+		d.qrcodeProps,
+		d.barcodeProps,
+		d.deleteBtn,
+	)
+	d.props.Hide()
+
+	return container.NewVBox(
+		widget.NewLabelWithStyle("📄 页面", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewForm(
+			widget.NewFormItem("说明", d.descEntry),
+			widget.NewFormItem("宽(mm)", d.widthEntry),
+			widget.NewFormItem("高(mm)", d.heightEntry),
+			widget.NewFormItem("打印宽(mm)", d.printWidthEntry),
+			widget.NewFormItem("字体", d.fontSelect),
+			widget.NewFormItem("字形", d.styleSelect),
+			widget.NewFormItem("语言", d.langSelect),
+		),
+		widget.NewSeparator(),
+		d.props,
+	)
+}
+
+func (d *TemplateDesigner) newEntry(apply func(t *LabelTemplate, e *TemplateElement, text string)) *widget.Entry {
+	entry := widget.NewEntry()
+	entry.OnChanged = func(text string) {
+		d.update(func(t *LabelTemplate, e *TemplateElement) { apply(t, e, text) })
+	}
+	return entry
+}
+
+func (d *TemplateDesigner) newElementEntry(apply func(e *TemplateElement, text string)) *widget.Entry {
+	return d.newEntry(func(_ *LabelTemplate, e *TemplateElement, text string) {
+		if e != nil {
+			apply(e, text)
+		}
+	})
+}
+
+func (d *TemplateDesigner) newElementCheck(text string, apply func(e *TemplateElement, on bool)) *widget.Check {
+	return widget.NewCheck(text, func(on bool) {
+		d.update(func(_ *LabelTemplate, e *TemplateElement) {
+			if e != nil {
+				apply(e, on)
+			}
+		})
+	})
+}
+
+func (d *TemplateDesigner) newElementSelect(options []string, apply func(e *TemplateElement, v string)) *widget.Select {
+	return widget.NewSelect(options, func(v string) {
+		d.update(func(_ *LabelTemplate, e *TemplateElement) {
+			if e != nil {
+				apply(e, v)
+			}
+		})
+	})
+}
+
+// update 修改模板或选中的元素，属性面板正在填充时忽略
+func (d *TemplateDesigner) update(apply func(t *LabelTemplate, e *TemplateElement)) {
+	d.mu.Lock()
+	if d.loading || d.tmpl == nil {
+		d.mu.Unlock()
+		return
+	}
+	var e *TemplateElement
+	if d.selected >= 0 && d.selected < len(d.tmpl.Elements) {
+		e = &d.tmpl.Elements[d.selected]
+	}
+	apply(d.tmpl, e)
+	d.mu.Unlock()
+	d.scheduleRender()
+}
+
+// load 读取模板并重建画布
+func (d *TemplateDesigner) load(name string) {
+	t, err := LoadTemplate(name)
+	if err != nil {
+		d.status.SetText("❌ " + err.Error())
+		return
+	}
+	d.mu.Lock()
+	d.tmpl = t
+	d.selected = -1
+	d.mu.Unlock()
+
+	d.nameEntry.SetText(name)
+	d.fillPage()
+	d.rebuild()
+}
+
+// fillPage 将页面属性填入输入框
+func (d *TemplateDesigner) fillPage() {
+	d.setLoading(true)
+	defer d.setLoading(false)
+	t := d.tmpl
+	d.descEntry.SetText(t.Description)
+	d.widthEntry.SetText(formatMm(t.Width))
+	d.heightEntry.SetText(formatMm(t.Height))
+	d.printWidthEntry.SetText("")
+	if t.PrintWidth > 0 {
+		d.printWidthEntry.SetText(formatMm(t.PrintWidth))
+	}
+	d.fontSelect.SetSelected(t.Font)
+	if strings.Contains(t.FontStyle, "B") {
+		d.styleSelect.SetSelected("粗体")
+	} else {
+		d.styleSelect.SetSelected("常规")
+	}
+	if t.Language == "" {
+		d.langSelect.SetSelected(designerDefaultLanguage)
+	} else {
+		d.langSelect.SetSelected(t.Language)
+	}
+}
+
+func (d *TemplateDesigner) setLoading(loading bool) {
+	d.mu.Lock()
+	d.loading = loading
+	d.mu.Unlock()
+}
+
+// rebuild 按当前模板重建画布上的元素框并渲染背景
+func (d *TemplateDesigner) rebuild() {
+	d.mu.Lock()
+	d.scale = designerWidthPx / d.tmpl.Width
+	count := len(d.tmpl.Elements)
+	d.mu.Unlock()
+
+	d.items = d.items[:0]
+	objects := []fyne.CanvasObject{d.background}
+	for i := 0; i < count; i++ {
+		item := newDesignerItem(d, i)
+		d.items = append(d.items, item)
+		objects = append(objects, item)
+	}
+	objects = append(objects, d.handle)
+	d.board.Objects = objects
+	d.board.Refresh()
+	d.render()
+	d.fillElement()
+}
+
+// scheduleRender 输入停止变化一段时间后重新渲染
+func (d *TemplateDesigner) scheduleRender() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(previewDelay, d.render)
+}
+
+// render 用示例数据渲染背景，并按模板更新各元素框的位置
+func (d *TemplateDesigner) render() {
+	d.mu.Lock()
+	if d.tmpl == nil || d.tmpl.Width <= 0 || d.tmpl.Height <= 0 {
+		d.mu.Unlock()
+		return
+	}
+	// 复制一份，渲染时不持有锁
+	t := *d.tmpl
+	t.Elements = append([]TemplateElement(nil), d.tmpl.Elements...)
+	d.scale = designerWidthPx / t.Width
+	scale := d.scale
+	d.mu.Unlock()
+
+	size := fyne.NewSize(float32(t.Width*scale), float32(t.Height*scale))
+	d.background.Resize(size)
+	d.background.SetMinSize(size)
+
+	var label *Label
+	labels, err := t.Build(t.name, d.fields)
+	if err == nil {
+		// 有多页时显示第一页
+		label = labels[0]
+	}
+	if err != nil {
+		d.background.Image = nil
+		d.status.SetText("❌ " + err.Error())
+	} else if img, err := RenderLabelImage(label, scale); err != nil {
+		d.background.Image = nil
+		d.status.SetText("❌ " + err.Error())
+	} else {
+		d.background.Image = img
+		d.status.SetText(fmt.Sprintf("%s: %s×%s mm，共 %d 个元素，可拖动元素调整位置，拖动右下角调整大小",
+			t.name, formatMm(t.Width), formatMm(t.Height), len(t.Elements)))
+	}
+	d.background.Refresh()
+
+	for i, item := range d.items {
+		if i < len(t.Elements) {
+			item.place(label, &t.Elements[i], scale)
+		}
+	}
+	d.placeHandle()
+	d.board.Refresh()
+}
+
+// elementBounds 返回元素在画布上占据的区域(mm)；未设置宽度的文字按示例数据测量
+func (d *TemplateDesigner) elementBounds(label *Label, e *TemplateElement) (x, y, w, h float64) {
+	if e.Type != TemplateText || e.W > 0 {
+		return e.X, e.Y, e.W, e.H
+	}
+	sizeMm := e.FontSize * mmPerPt
+	text, err := expandFields(e.Value, d.fields)
+	if err != nil {
+		text = e.Value
+	}
+	w = float64(len([]rune(text))) * sizeMm * 0.6
+	if label != nil {
+		if measured, err := (&textMeasurer{label: label}).width(text, e.FontSize); err == nil {
+			w = measured
+		}
+	}
+	// (X, Y) 为基线起点
+	return e.X, e.Y - sizeMm*0.8, w, sizeMm
+}
+
+// selectElement 选中元素并显示其属性
+func (d *TemplateDesigner) selectElement(index int) {
+	d.mu.Lock()
+	d.selected = index
+	d.mu.Unlock()
+	for i, item := range d.items {
+		item.setSelected(i == index)
+	}
+	d.fillElement()
+	d.placeHandle()
+}
+
+// fillElement 将选中元素的属性填入输入框
+func (d *TemplateDesigner) fillElement() {
+	d.mu.Lock()
+	if d.tmpl == nil || d.selected < 0 || d.selected >= len(d.tmpl.Elements) {
+		d.mu.Unlock()
+		d.props.Hide()
+		return
+	}
+	e := d.tmpl.Elements[d.selected]
+	index := d.selected
+	d.mu.Unlock()
+
+	d.setLoading(true)
+	defer d.setLoading(false)
+	d.typeLabel.SetText(fmt.Sprintf("第 %d 个元素: %s", index+1, elementTypeName(e.Type)))
+	d.xEntry.SetText(formatMm(e.X))
+	d.yEntry.SetText(formatMm(e.Y))
+	d.wEntry.SetText(formatMm(e.W))
+	d.hEntry.SetText(formatMm(e.H))
+	d.valueEntry.SetText(e.Value)
+	d.fontSizeEntry.SetText(formatMm(e.FontSize))
+	d.minFontEntry.SetText(formatMm(e.MinFontSize))
+	d.wrapCheck.SetChecked(e.Wrap)
+	d.ellipsisCheck.SetChecked(e.Ellipsis)
+	d.alignSelect.SetSelected(e.Align)
+	d.valignSelect.SetSelected(e.VAlign)
+	d.levelSelect.SetSelected(designerQrOption(strings.ToUpper(e.Level)))
+	if e.Split == "" {
+		d.splitSelect.SetSelected("不拆分")
+	} else {
+		d.splitSelect.SetSelected(e.Split)
+	}
+	if e.QuietZone == nil {
+		d.quietZoneEntry.SetText("")
+	} else {
+		d.quietZoneEntry.SetText(strconv.Itoa(*e.QuietZone))
+	}
+	d.modeSelect.SetSelected(designerQrOption(strings.ToLower(e.Mode)))
+	d.librarySelect.SetSelected(designerQrOption(strings.ToLower(e.Library)))
+	d.symbologySel.SetSelected(e.symbology())
+	d.pixelsEntry.SetText(strconv.Itoa(e.Pixels))
+	d.dmSizeEntry.SetText(e.Size)
+	d.moduleEntry.SetText(formatMm(e.Module))
+	d.columnsEntry.SetText(designerCount(e.Columns))
+	d.rowsEntry.SetText(designerCount(e.Rows))
+	if e.Security == nil {
+		d.securityEntry.SetText("")
+	} else {
+		d.securityEntry.SetText(strconv.Itoa(*e.Security))
+	}
+	d.checkCharCheck.SetChecked(e.CheckChar)
+
+	showIf(d.textProps, e.Type == TemplateText)
+	showIf(d.qrcodeProps, e.Type == TemplateQrcode)
+	showIf(d.barcodeProps, e.Type == TemplateBarcode)
+	showIf(d.dataMatrixProps, e.isDataMatrix())
+	showIf(d.pdf417Props, e.symbology() == "pdf417")
+	showIf(d.checkCharCheck, e.symbology() == "code39")
+	d.props.Show()
+}
+
+// addElement 在页面左上角添加一个元素
+func (d *TemplateDesigner) addElement(elementType string) {
+	d.mu.Lock()
+	if d.tmpl == nil {
+		d.mu.Unlock()
+		return
+	}
+	e := TemplateElement{Type: elementType, X: 10, Y: 10, W: d.tmpl.Width / 4, H: d.tmpl.Height / 4}
+	switch elementType {
+	case TemplateText:
+		e.Value = "文字"
+		e.FontSize = 60
+		e.MinFontSize = 30
+		e.Wrap = true
+		e.Ellipsis = true
+		e.H = 60 * mmPerPt * defaultLineSpacing
+	case TemplateQrcode:
+		e.Value = "{{DeviceNos}}"
+		e.H = e.W
+	case TemplateBarcode:
+		e.Value = "{{BoxNum}}"
+		e.H = e.W / 4
+	case TemplateImage:
+		e.Value = "resources/images/{{BarCode69Type}}"
+	}
+	d.tmpl.Elements = append(d.tmpl.Elements, e)
+	index := len(d.tmpl.Elements) - 1
+	d.mu.Unlock()
+
+	d.rebuild()
+	d.selectElement(index)
+}
+
+// addAsset 插入素材库中的素材；模板设置了 printWidth 时按素材的实际尺寸，否则宽度为页面的 1/4、高度按比例
+func (d *TemplateDesigner) addAsset(name string) {
+	d.mu.Lock()
+	if d.tmpl == nil {
+		d.mu.Unlock()
+		return
+	}
+	e := TemplateElement{Type: TemplateImage, X: 10, Y: 10, Value: assetPrefix + name}
+	if d.tmpl.PrintWidth <= 0 {
+		e.W = d.tmpl.Width / 4
+	}
+	// 按打印时的换算得到具体宽高，便于在画布上拖动调整
+	label := d.tmpl.newLabel(name)
+	if err := label.AddAsset(name, e.X, e.Y, e.W, e.H); err != nil {
+		d.mu.Unlock()
+		d.logger.Log("❌ 插入素材失败: " + err.Error())
+		return
+	}
+	e.W, e.H = label.Elements[0].W, label.Elements[0].H
+	d.tmpl.Elements = append(d.tmpl.Elements, e)
+	index := len(d.tmpl.Elements) - 1
+	d.mu.Unlock()
+
+	d.rebuild()
+	d.selectElement(index)
+}
+
+func (d *TemplateDesigner) deleteSelected() {
+	d.mu.Lock()
+	if d.tmpl == nil || d.selected < 0 || d.selected >= len(d.tmpl.Elements) {
+		d.mu.Unlock()
+		return
+	}
+	d.tmpl.Elements = append(d.tmpl.Elements[:d.selected], d.tmpl.Elements[d.selected+1:]...)
+	d.selected = -1
+	d.mu.Unlock()
+	d.rebuild()
+	d.placeHandle()
+}
+
+// save 保存到 templateDir，打印时下次读取模板即生效
+func (d *TemplateDesigner) save() {
+	name := strings.TrimSpace(d.nameEntry.Text)
+	d.mu.Lock()
+	if d.tmpl == nil {
+		d.mu.Unlock()
+		return
+	}
+	path, err := SaveTemplate(name, d.tmpl)
+	d.mu.Unlock()
+	if err != nil {
+		d.logger.Log("❌ 保存模板失败: " + err.Error())
+		return
+	}
+	d.logger.Log(fmt.Sprintf("✓ 模板已保存: %s，打印时立即生效", path))
+}
+
+// exportBundle 将选中模板(已保存的版本)及其图片、字体打包到导出目录
+func (d *TemplateDesigner) exportBundle() {
+	name := d.templateSelect.Selected
+	if name == "" {
+		return
+	}
+	path, err := ExportTemplateBundleFile([]string{name})
+	if err != nil {
+		d.logger.Log("❌ 导出模板包失败: " + err.Error())
+		return
+	}
+	d.logger.Log(fmt.Sprintf("✓ 模板包已导出: %s，未保存的修改不会导出", path))
+}
+
+// importBundle 选择模板包，校验通过并确认后安装
+func (d *TemplateDesigner) importBundle() {
+	open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		path := reader.URI().Path()
+		reader.Close()
+
+		bundle, err := ReadTemplateBundle(path)
+		if err != nil {
+			d.logger.Log("❌ 模板包校验失败，未导入: " + err.Error())
+			return
+		}
+		message := fmt.Sprintf("模板: %s\n文件: %d 个", strings.Join(bundle.TemplateNames(), ", "), len(bundle.Manifest.Files))
+		if changes := bundle.Changes(); len(changes) > 0 {
+			message += "\n将覆盖:\n" + strings.Join(changes, "\n")
+		}
+		dialog.ShowConfirm("导入模板包", message, func(ok bool) {
+			if !ok {
+				return
+			}
+			n, err := bundle.Install()
+			if err != nil {
+				d.logger.Log("❌ 导入模板包失败: " + err.Error())
+				return
+			}
+			d.logger.Log(fmt.Sprintf("✓ 模板包已导入，写入 %d 个文件", n))
+			lintTemplates(bundle.TemplateNames(), "", d.logger.Log)
+		}, d.window)
+	}, d.window)
+	open.SetFilter(storage.NewExtensionFileFilter([]string{".zip"}))
+	open.Show()
+}
+
+// lint 按打印时的变量检查当前编辑的模板，结果写入日志
+func (d *TemplateDesigner) lint() {
+	d.mu.Lock()
+	if d.tmpl == nil {
+		d.mu.Unlock()
+		return
+	}
+	t := *d.tmpl
+	t.Elements = append([]TemplateElement(nil), d.tmpl.Elements...)
+	d.mu.Unlock()
+
+	name := strings.TrimSpace(d.nameEntry.Text)
+	if name == "" {
+		name = t.name
+	}
+	issues := LintTemplate(&t, lintSampleFields(name))
+	if len(issues) == 0 {
+		d.logger.Log(fmt.Sprintf("✓ 模板 %s 没有发现问题", name))
+		return
+	}
+	d.logger.Log(fmt.Sprintf("模板 %s 发现 %d 个问题:", name, len(issues)))
+	for _, issue := range issues {
+		d.logger.Log("  " + issue.String())
+	}
+}
+
+// moveSelected 按拖动的像素移动或缩放选中元素
+func (d *TemplateDesigner) moveSelected(index int, dx, dy float32, resize bool) {
+	d.mu.Lock()
+	if d.tmpl == nil || index < 0 || index >= len(d.tmpl.Elements) {
+		d.mu.Unlock()
+		return
+	}
+	e := &d.tmpl.Elements[index]
+	if resize {
+		e.W += float64(dx) / d.scale
+		e.H += float64(dy) / d.scale
+		if e.W < 1 {
+			e.W = 1
+		}
+		if e.H < 1 {
+			e.H = 1
+		}
+	} else {
+		e.X += float64(dx) / d.scale
+		e.Y += float64(dy) / d.scale
+	}
+	d.mu.Unlock()
+}
+
+// finishDrag 拖动结束后对齐坐标并重新渲染
+func (d *TemplateDesigner) finishDrag(index int) {
+	d.mu.Lock()
+	if d.tmpl != nil && index >= 0 && index < len(d.tmpl.Elements) {
+		e := &d.tmpl.Elements[index]
+		e.X, e.Y = snapMm(e.X), snapMm(e.Y)
+		e.W, e.H = snapMm(e.W), snapMm(e.H)
+	}
+	d.mu.Unlock()
+	d.fillElement()
+	d.render()
+}
+
+// placeHandle 将缩放手柄放到选中元素的右下角，没有宽度的文字不显示
+func (d *TemplateDesigner) placeHandle() {
+	d.mu.Lock()
+	if d.tmpl == nil || d.selected < 0 || d.selected >= len(d.tmpl.Elements) || d.selected >= len(d.items) ||
+		d.tmpl.Elements[d.selected].Type == TemplateText && d.tmpl.Elements[d.selected].W <= 0 {
+		d.mu.Unlock()
+		d.handle.Hide()
+		return
+	}
+	item := d.items[d.selected]
+	d.mu.Unlock()
+
+	pos := item.Position().Add(item.Size())
+	d.handle.Move(pos.Subtract(fyne.NewSize(designerHandleSize/2, designerHandleSize/2)))
+	d.handle.Show()
+}
+
+// designerItem 画布上代表一个模板元素的可拖动框
+type designerItem struct {
+	widget.BaseWidget
+	designer *TemplateDesigner
+	index    int
+	rect     *canvas.Rectangle
+	text     *canvas.Text
+}
+
+func newDesignerItem(d *TemplateDesigner, index int) *designerItem {
+	item := &designerItem{designer: d, index: index}
+	item.rect = canvas.NewRectangle(designerFillColor)
+	item.rect.StrokeColor = designerBorderColor
+	item.rect.StrokeWidth = 1
+	item.text = canvas.NewText("", designerBorderColor)
+	item.text.TextSize = 10
+	item.ExtendBaseWidget(item)
+	return item
+}
+
+func (item *designerItem) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewStack(item.rect, container.NewVBox(item.text)))
+}
+
+// place 按元素位置移动框
+func (item *designerItem) place(label *Label, e *TemplateElement, scale float64) {
+	x, y, w, h := item.designer.elementBounds(label, e)
+	item.text.Text = fmt.Sprintf("%d %s", item.index+1, elementTypeName(e.Type))
+	item.Move(fyne.NewPos(float32(x*scale), float32(y*scale)))
+	item.Resize(fyne.NewSize(float32(w*scale), float32(h*scale)))
+	item.Refresh()
+}
+
+func (item *designerItem) setSelected(selected bool) {
+	item.rect.StrokeColor = designerBorderColor
+	item.rect.StrokeWidth = 1
+	if selected {
+		item.rect.StrokeColor = designerSelectedColor
+		item.rect.StrokeWidth = 2
+	}
+	item.rect.Refresh()
+}
+
+func (item *designerItem) Tapped(*fyne.PointEvent) {
+	item.designer.selectElement(item.index)
+}
+
+func (item *designerItem) Dragged(ev *fyne.DragEvent) {
+	d := item.designer
+	d.mu.Lock()
+	selected := d.selected
+	d.mu.Unlock()
+	if selected != item.index {
+		d.selectElement(item.index)
+	}
+	d.moveSelected(item.index, ev.Dragged.DX, ev.Dragged.DY, false)
+	item.Move(item.Position().Add(ev.Dragged))
+	d.placeHandle()
+}
+
+func (item *designerItem) DragEnd() {
+	item.designer.finishDrag(item.index)
+}
+
+// designerHandle 选中元素右下角的缩放手柄
+type designerHandle struct {
+	widget.BaseWidget
+	designer *TemplateDesigner
+}
+
+func newDesignerHandle(d *TemplateDesigner) *designerHandle {
+	h := &designerHandle{designer: d}
+	h.ExtendBaseWidget(h)
+	h.Resize(fyne.NewSize(designerHandleSize, designerHandleSize))
+	return h
+}
+
+func (h *designerHandle) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(canvas.NewRectangle(designerSelectedColor))
+}
+
+func (h *designerHandle) MinSize() fyne.Size {
+	return fyne.NewSize(designerHandleSize, designerHandleSize)
+}
+
+func (h *designerHandle) Dragged(ev *fyne.DragEvent) {
+	d := h.designer
+	d.mu.Lock()
+	index := d.selected
+	d.mu.Unlock()
+	if index < 0 || index >= len(d.items) {
+		return
+	}
+	d.moveSelected(index, ev.Dragged.DX, ev.Dragged.DY, true)
+	item := d.items[index]
+	item.Resize(item.Size().Add(fyne.NewSize(ev.Dragged.DX, ev.Dragged.DY)))
+	h.Move(h.Position().Add(ev.Dragged))
+}
+
+func (h *designerHandle) DragEnd() {
+	d := h.designer
+	d.mu.Lock()
+	index := d.selected
+	d.mu.Unlock()
+	d.finishDrag(index)
+}
+
+func elementTypeName(elementType string) string {
+	switch elementType {
+	case TemplateText:
+		return "文字"
+	case TemplateImage:
+		return "图片"
+	case TemplateQrcode:
+		return "二维码"
+	case TemplateBarcode:
+		return "条码"
+	}
+	return elementType
+}
+
+// barcodeSymbologies 返回支持的条码类型
+func barcodeSymbologies() []string {
+	names := make([]string, 0, len(barcodeEncoders))
+	for name := range barcodeEncoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func showIf(obj fyne.CanvasObject, visible bool) {
+	if visible {
+		obj.Show()
+	} else {
+		obj.Hide()
+	}
+}
+
+// parseMm 解析输入的数值，无法解析时保留原值
+func parseMm(text string, old float64) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return old
+	}
+	return v
+}
+
+// designerQrValue 二维码参数选项对应的模板值，“默认”为空
+func designerQrValue(option string) string {
+	if option == designerQrDefault {
+		return ""
+	}
+	return option
+}
+
+// designerQrOption 模板中二维码参数对应的选项
+func designerQrOption(value string) string {
+	if value == "" {
+		return designerQrDefault
+	}
+	return value
+}
+
+func formatMm(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func snapMm(v float64) float64 {
+	return math.Round(v/designerSnap) * designerSnap
+}
+
+// designerCount 行列数的显示文字，0(自动)显示为空
+func designerCount(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
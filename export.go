@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 导出格式
+const (
+	FormatPdf = "pdf"
+	FormatPng = "png"
+	FormatSvg = "svg"
+)
+
+// 标签类型
+const (
+	KindDevice = "device"
+	KindMulti  = "multi"
+	KindTag    = "tag"
+)
+
+// 导出 PNG 的默认分辨率
+const defaultExportDpi = 300
+
+// BuildLabels 按标签类型生成版面: device 按逗号拆分设备号两两成对，multi 为批量二维码，
+// tag 为产品标签(数据需已经过 normalizeTagData 处理)
+func BuildLabels(kind string, excelData *ExcelData) ([]*Label, error) {
+	switch kind {
+	case KindDevice:
+		deviceNoArr := strings.Split(strings.TrimSpace(excelData.DeviceNos), ",")
+		if duplicate := findDuplicate(deviceNoArr); len(duplicate) > 0 {
+			return nil, fmt.Errorf("设备号重复: %s", strings.Join(duplicate, ","))
+		}
+		return buildDeviceLabels(deviceNoArr)
+	case KindMulti:
+		return BuildMultiLabel(strings.TrimSpace(excelData.DeviceNos))
+	case KindTag:
+		return BuildTagLabel(excelData)
+	}
+	return nil, fmt.Errorf("不支持的标签类型: %s", kind)
+}
+
+// RenderLabelPng 按指定 DPI 将标签渲染为 PNG
+func RenderLabelPng(l *Label, dpi int) ([]byte, error) {
+	if dpi <= 0 {
+		dpi = defaultExportDpi
+	}
+	img, err := RenderLabelImage(l, float64(dpi)/25.4)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderLabelSvg 将标签渲染为 SVG，坐标单位为 mm，文字排版与 PDF 相同
+func RenderLabelSvg(l *Label) ([]byte, error) {
+	pageW, pageH := l.PageSize()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%smm" height="%smm" viewBox="0 0 %s %s">`+"\n",
+		svgNum(pageW), svgNum(pageH), svgNum(pageW), svgNum(pageH))
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#fff"/>`+"\n")
+
+	primary := l.font()
+	for i := range l.Elements {
+		e := &l.Elements[i]
+		switch e.Kind {
+		case ElementImage:
+			mime, style := "image/png", ` style="image-rendering:pixelated"`
+			switch e.ImageType {
+			case "jpeg":
+				mime = "image/jpeg"
+			case "svg":
+				// SVG 素材原样嵌入，保持矢量
+				mime, style = "image/svg+xml", ""
+			}
+			fmt.Fprintf(&buf, `<image x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="none"%s href="data:%s;base64,%s"/>`+"\n",
+				svgNum(e.X), svgNum(e.Y), svgNum(e.W), svgNum(e.H), style, mime, base64.StdEncoding.EncodeToString(e.ImageData))
+		case ElementText:
+			lines, err := layoutText(l, e)
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range lines {
+				fmt.Fprintf(&buf, `<text x="%s" y="%s" font-family="%s" font-weight="%s" font-size="%s" xml:space="preserve">`,
+					svgNum(line.X), svgNum(line.Y), svgEscape(primary.Family), svgFontWeight(primary), svgNum(line.FontSize*mmPerPt))
+				// 主字体缺字的部分用 tspan 指定后备字体
+				for _, run := range l.textRuns(line.Text) {
+					if run.Font == primary {
+						buf.WriteString(svgEscape(run.Text))
+						continue
+					}
+					fmt.Fprintf(&buf, `<tspan font-family="%s" font-weight="%s">%s</tspan>`,
+						svgEscape(run.Font.Family), svgFontWeight(run.Font), svgEscape(run.Text))
+				}
+				buf.WriteString("</text>\n")
+			}
+		}
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
+
+func svgFontWeight(f LabelFont) string {
+	if strings.Contains(f.Style, "B") {
+		return "bold"
+	}
+	return "normal"
+}
+
+// RenderLabel 按格式(pdf/png/svg)渲染标签
+func RenderLabel(l *Label, format string, dpi int) ([]byte, error) {
+	if err := l.verifyBarcodes(); err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(format) {
+	case FormatPdf:
+		return RenderLabelPdf(l)
+	case FormatPng:
+		return RenderLabelPng(l, exportDpi(dpi))
+	case FormatSvg:
+		return RenderLabelSvg(l)
+	}
+	return nil, fmt.Errorf("不支持的导出格式: %s", format)
+}
+
+// ExportLabel 渲染标签并写入导出目录，返回文件路径
+func ExportLabel(l *Label, format string, dpi int) (string, error) {
+	data, err := RenderLabel(l, format, dpi)
+	if err != nil {
+		return "", err
+	}
+	dir := exportDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := l.Name
+	if format == FormatPng {
+		name = fmt.Sprintf("%s_%ddpi", name, exportDpi(dpi))
+	}
+	path := filepath.Join(dir, name+"."+strings.ToLower(format))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// exportDir 标签导出目录，默认 ./exports
+func exportDir() string {
+	if config.ExportDir != "" {
+		return config.ExportDir
+	}
+	return "./exports"
+}
+
+// exportDpi 返回实际使用的导出分辨率
+func exportDpi(dpi int) int {
+	if dpi > 0 {
+		return dpi
+	}
+	if config.ExportDpi > 0 {
+		return config.ExportDpi
+	}
+	return defaultExportDpi
+}
+
+// contentTypeOf 返回导出格式对应的 Content-Type
+func contentTypeOf(format string) string {
+	switch format {
+	case FormatPng:
+		return "image/png"
+	case FormatSvg:
+		return "image/svg+xml"
+	}
+	return "application/pdf"
+}
+
+func svgNum(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+func svgEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 模板字段表达式: {{变量 | 过滤器 参数 | 过滤器}}，只能引用变量和下方注册的过滤器，不能执行其他代码
+//
+//	{{ProductNum}}PCS
+//	{{ProductDate | date "yyyy/MM"}}
+//	{{NetWeight | fixed 2}}
+//	{{DeviceNos | count}}
+//	{{Now | date "MM-dd HH:mm"}} {{Shift}}
+
+// pad 的最大长度、fixed 的最多小数位数，避免模板中过大的参数占满内存或长时间计算
+const (
+	maxPadWidth    = 100
+	maxFixedDigits = 10
+)
+
+// fieldExpr 解析后的表达式
+type fieldExpr struct {
+	// 变量名，或 literal 为 true 时的字符串常量
+	head    string
+	literal bool
+	filters []filterCall
+}
+
+type filterCall struct {
+	name string
+	args []string
+}
+
+// fieldFilter 过滤器: args 为参数个数，optional 为其中可省略的个数
+type fieldFilter struct {
+	args     int
+	optional int
+	usage    string
+	apply    func(value string, args []string) (string, error)
+}
+
+// fieldFilters 可用的过滤器
+var fieldFilters = map[string]fieldFilter{
+	"date":    {args: 1, usage: `date "yyyy/MM/dd"`, apply: filterDate},
+	"fixed":   {args: 1, usage: "fixed 2", apply: filterFixed},
+	"count":   {usage: "count", apply: filterCount},
+	"upper":   {usage: "upper", apply: func(v string, _ []string) (string, error) { return strings.ToUpper(v), nil }},
+	"lower":   {usage: "lower", apply: func(v string, _ []string) (string, error) { return strings.ToLower(v), nil }},
+	"trim":    {usage: "trim", apply: func(v string, _ []string) (string, error) { return strings.TrimSpace(v), nil }},
+	"default": {args: 1, usage: `default "无"`, apply: filterDefault},
+	"replace": {args: 2, usage: `replace "-" "/"`, apply: filterReplace},
+	"pad":     {args: 2, optional: 1, usage: `pad 6 "0"`, apply: filterPad},
+}
+
+// parseFieldExpr 解析 {{ }} 中的表达式
+func parseFieldExpr(text string) (*fieldExpr, error) {
+	segments, err := splitPipes(text)
+	if err != nil {
+		return nil, err
+	}
+	head, err := tokenize(segments[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(head) != 1 || head[0].text == "" && !head[0].quoted {
+		return nil, fmt.Errorf("表达式 %q 应以一个变量或字符串开头", text)
+	}
+	expr := &fieldExpr{head: head[0].text, literal: head[0].quoted}
+	if !expr.literal && !isFieldName(expr.head) {
+		return nil, fmt.Errorf("变量名 %q 不合法", expr.head)
+	}
+
+	for _, segment := range segments[1:] {
+		tokens, err := tokenize(segment)
+		if err != nil {
+			return nil, err
+		}
+		if len(tokens) == 0 || tokens[0].quoted {
+			return nil, fmt.Errorf("表达式 %q 中 | 后应为过滤器名", text)
+		}
+		name := tokens[0].text
+		filter, ok := fieldFilters[name]
+		if !ok {
+			return nil, fmt.Errorf("未知过滤器 %s，可用过滤器: %s", name, strings.Join(filterNames(), ", "))
+		}
+		args := make([]string, 0, len(tokens)-1)
+		for _, token := range tokens[1:] {
+			args = append(args, token.text)
+		}
+		if len(args) > filter.args || len(args) < filter.args-filter.optional {
+			return nil, fmt.Errorf("过滤器 %s 参数个数不对，用法: %s", name, filter.usage)
+		}
+		expr.filters = append(expr.filters, filterCall{name: name, args: args})
+	}
+	return expr, nil
+}
+
+// eval 计算表达式的值
+func (expr *fieldExpr) eval(fields map[string]string) (string, error) {
+	value := expr.head
+	if !expr.literal {
+		var ok bool
+		if value, ok = fields[expr.head]; !ok {
+			return "", fmt.Errorf("未知变量 %s，可用变量: %s", expr.head, strings.Join(fieldNames(fields), ", "))
+		}
+	}
+	for _, call := range expr.filters {
+		result, err := fieldFilters[call.name].apply(value, call.args)
+		if err != nil {
+			if expr.literal {
+				return "", fmt.Errorf("%s: %w", call.name, err)
+			}
+			return "", fmt.Errorf("%s 的 %s: %w", expr.head, call.name, err)
+		}
+		value = result
+	}
+	return value, nil
+}
+
+// splitPipes 按引号外的 | 拆分表达式
+func splitPipes(text string) ([]string, error) {
+	var segments []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case r == '|' && !quoted:
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("表达式 %q 中引号未闭合", text)
+	}
+	return append(segments, current.String()), nil
+}
+
+type exprToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenize 按空白拆分，双引号内的内容作为一个参数，支持 \" 和 \\ 转义
+func tokenize(segment string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(segment)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if unicode.IsSpace(r) {
+			i++
+			continue
+		}
+		var text strings.Builder
+		if r == '"' {
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					text.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				text.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("引号未闭合: %s", segment)
+			}
+			tokens = append(tokens, exprToken{text: text.String(), quoted: true})
+			continue
+		}
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			text.WriteRune(runes[i])
+			i++
+		}
+		tokens = append(tokens, exprToken{text: text.String()})
+	}
+	return tokens, nil
+}
+
+// isFieldName 判断变量名是否合法，标题变量可以带点，如 T.ProductName
+func isFieldName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if !isIdentifier(part) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func filterNames() []string {
+	names := make([]string, 0, len(fieldFilters))
+	for name := range fieldFilters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dateInputLayouts 可识别的日期写法
+var dateInputLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"2006.01.02",
+	"2006-1-2",
+	"2006/1/2",
+	"20060102",
+	"2006-01",
+	"2006/01",
+	"2006年1月2日",
+}
+
+// dateFormatReplacer 将 yyyy/MM/dd HH:mm:ss 形式的格式转换为 Go 的时间格式
+var dateFormatReplacer = strings.NewReplacer(
+	"yyyy", "2006",
+	"yy", "06",
+	"MM", "01",
+	"dd", "02",
+	"HH", "15",
+	"mm", "04",
+	"ss", "05",
+)
+
+func filterDate(value string, args []string) (string, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateInputLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Format(dateFormatReplacer.Replace(args[0])), nil
+		}
+	}
+	return "", fmt.Errorf("无法识别日期 %q", value)
+}
+
+func filterFixed(value string, args []string) (string, error) {
+	digits, err := strconv.Atoi(args[0])
+	if err != nil || digits < 0 {
+		return "", fmt.Errorf("小数位数 %q 不是非负整数", args[0])
+	}
+	if digits > maxFixedDigits {
+		return "", fmt.Errorf("小数位数 %d 超过上限 %d", digits, maxFixedDigits)
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return "", fmt.Errorf("%q 不是数字", value)
+	}
+	return strconv.FormatFloat(number, 'f', digits, 64), nil
+}
+
+// filterCount 统计按换行、逗号或竖线分隔的非空项个数
+func filterCount(value string, _ []string) (string, error) {
+	return strconv.Itoa(len(splitList(value))), nil
+}
+
+func filterDefault(value string, args []string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return args[0], nil
+	}
+	return value, nil
+}
+
+func filterReplace(value string, args []string) (string, error) {
+	return strings.ReplaceAll(value, args[0], args[1]), nil
+}
+
+// filterPad 在左侧补齐到指定长度，默认补 0
+func filterPad(value string, args []string) (string, error) {
+	width, err := strconv.Atoi(args[0])
+	if err != nil || width < 0 {
+		return "", fmt.Errorf("长度 %q 不是非负整数", args[0])
+	}
+	if width > maxPadWidth {
+		return "", fmt.Errorf("长度 %d 超过上限 %d", width, maxPadWidth)
+	}
+	padding := "0"
+	if len(args) > 1 && args[1] != "" {
+		padding = args[1]
+	}
+	missing := width - len([]rune(value))
+	if missing <= 0 {
+		return value, nil
+	}
+	// 补齐字符有多个字时按整个重复，可能超出指定长度
+	step := len([]rune(padding))
+	return strings.Repeat(padding, (missing+step-1)/step) + value, nil
+}
+
+// splitList 按换行、逗号或竖线拆分并去掉空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == '\n' || r == ',' || r == '|' || r == '\r'
+	}) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ShiftConfig 班次，从 Start 开始到下一个班次开始为止
+type ShiftConfig struct {
+	Name  string
+	Start string // HH:MM
+}
+
+// defaultShifts 未配置班次时使用
+var defaultShifts = []ShiftConfig{
+	{Name: "白班", Start: "08:00"},
+	{Name: "夜班", Start: "20:00"},
+}
+
+// currentShift 返回 now 所在的班次名称，早于第一个班次开始时间时属于最后一个班次(跨夜)
+func currentShift(now time.Time) string {
+	shifts := defaultShifts
+	if config != nil && len(config.Shifts) > 0 {
+		shifts = config.Shifts
+	}
+	minutes := now.Hour()*60 + now.Minute()
+	name, latest := "", -1
+	lastName, lastStart := "", -1
+	for _, shift := range shifts {
+		start, err := time.Parse("15:04", shift.Start)
+		if err != nil {
+			continue
+		}
+		m := start.Hour()*60 + start.Minute()
+		if m <= minutes && m > latest {
+			name, latest = shift.Name, m
+		}
+		if m > lastStart {
+			lastName, lastStart = shift.Name, m
+		}
+	}
+	if name == "" {
+		return lastName
+	}
+	return name
+}
+
+// withBuiltinFields 加入所有模板都可用的变量: Now 当前时间、Shift 当前班次；同名字段以传入的为准
+func withBuiltinFields(fields map[string]string) map[string]string {
+	now := time.Now()
+	result := map[string]string{
+		"Now":   now.Format("2006-01-02 15:04:05"),
+		"Shift": currentShift(now),
+	}
+	for name, value := range fields {
+		result[name] = value
+	}
+	return result
+}
+
+// 条件表达式，用于元素的 when: 为空时总是显示
+//
+//	DeviceNos                  变量非空且不为 0/false 时成立
+//	!DeviceNos                 取反
+//	ProductNum < 10            数字比较，两边都是数字时按数值比较，否则按文字比较
+//	DeviceNos | count >= 2     左边可以使用过滤器
+//	Customer == "客户A" and ProductNum > 0
+var conditionOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// evalCondition 计算条件是否成立
+func evalCondition(cond string, fields map[string]string) (bool, error) {
+	return walkCondition(cond, func(left, op, right string, negate bool) (bool, error) {
+		leftExpr, err := parseFieldExpr(left)
+		if err != nil {
+			return false, err
+		}
+		value, err := leftExpr.eval(fields)
+		if err != nil {
+			return false, err
+		}
+		if op == "" {
+			return truthy(value) != negate, nil
+		}
+		other, err := conditionOperand(right, fields)
+		if err != nil {
+			return false, err
+		}
+		return compareValues(value, op, other) != negate, nil
+	})
+}
+
+// checkCondition 检查条件语法，不计算变量
+func checkCondition(cond string) error {
+	_, err := walkCondition(cond, func(left, op, right string, _ bool) (bool, error) {
+		if _, err := parseFieldExpr(left); err != nil {
+			return false, err
+		}
+		if op != "" {
+			if _, err := conditionOperand(right, nil); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	return err
+}
+
+// walkCondition 按 or、and 拆分条件，对每个比较调用 compare；检查语法时会遍历全部比较
+func walkCondition(cond string, compare func(left, op, right string, negate bool) (bool, error)) (bool, error) {
+	if strings.TrimSpace(cond) == "" {
+		return true, nil
+	}
+	result := false
+	for _, clause := range splitKeyword(cond, "or") {
+		all := true
+		for _, term := range splitKeyword(clause, "and") {
+			term = strings.TrimSpace(term)
+			negate := false
+			if strings.HasPrefix(term, "!") {
+				negate, term = true, strings.TrimSpace(term[1:])
+			} else if strings.HasPrefix(term, "not ") {
+				negate, term = true, strings.TrimSpace(term[4:])
+			}
+			if term == "" {
+				return false, fmt.Errorf("条件 %q 不完整", cond)
+			}
+			left, op, right := splitComparison(term)
+			if op != "" && (strings.TrimSpace(left) == "" || strings.TrimSpace(right) == "") {
+				return false, fmt.Errorf("条件 %q 中 %s 两边都需要有值", cond, op)
+			}
+			ok, err := compare(left, op, right, negate)
+			if err != nil {
+				return false, err
+			}
+			all = all && ok
+		}
+		result = result || all
+	}
+	return result, nil
+}
+
+// splitKeyword 按引号外、两侧为空白的关键字拆分
+func splitKeyword(text, keyword string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	runes := []rune(text)
+	word := []rune(" " + keyword + " ")
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '"' {
+			quoted = !quoted
+			continue
+		}
+		if !quoted && i+len(word) <= len(runes) && string(runes[i:i+len(word)]) == string(word) {
+			parts = append(parts, string(runes[start:i]))
+			start = i + len(word)
+			i = start - 1
+		}
+	}
+	return append(parts, string(runes[start:]))
+}
+
+// splitComparison 拆分引号外的第一个比较运算符
+func splitComparison(term string) (left, op, right string) {
+	quoted := false
+	for i := 0; i < len(term); i++ {
+		if term[i] == '"' {
+			quoted = !quoted
+			continue
+		}
+		if quoted {
+			continue
+		}
+		for _, candidate := range conditionOperators {
+			if strings.HasPrefix(term[i:], candidate) {
+				return term[:i], candidate, term[i+len(candidate):]
+			}
+		}
+	}
+	return term, "", ""
+}
+
+// conditionOperand 计算比较运算符右边的值: 数字、字符串或变量表达式；fields 为 nil 时只检查语法
+func conditionOperand(text string, fields map[string]string) (string, error) {
+	text = strings.TrimSpace(text)
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		return text, nil
+	}
+	expr, err := parseFieldExpr(text)
+	if err != nil || fields == nil {
+		return "", err
+	}
+	return expr.eval(fields)
+}
+
+func compareValues(left, op, right string) bool {
+	l, lerr := strconv.ParseFloat(strings.TrimSpace(left), 64)
+	r, rerr := strconv.ParseFloat(strings.TrimSpace(right), 64)
+	cmp := strings.Compare(left, right)
+	if lerr == nil && rerr == nil {
+		cmp = 0
+		if l < r {
+			cmp = -1
+		} else if l > r {
+			cmp = 1
+		}
+	}
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// truthy 非空且不是 0、false 时为真
+func truthy(value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "false") {
+		return false
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return n != 0
+	}
+	return true
+}
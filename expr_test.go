@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandFields(t *testing.T) {
+	fields := map[string]string{
+		"ProductNum":   "10",
+		"ProductDate":  "2024-01-05",
+		"NetWeight":    "1.8",
+		"DeviceNos":    "A1\nA2, A3|A4",
+		"ProductColor": "",
+		"BoxNum":       "42",
+		"Name":         " Ab-c ",
+	}
+	tests := []struct {
+		text string
+		want string
+		err  string
+	}{
+		{text: "{{ProductNum}}PCS", want: "10PCS"},
+		{text: `{{ProductDate | date "yyyy/MM"}}`, want: "2024/01"},
+		{text: `{{"20240105" | date "yy-MM-dd"}}`, want: "24-01-05"},
+		{text: "{{NetWeight | fixed 2}}KG", want: "1.80KG"},
+		{text: "{{DeviceNos | count}}", want: "4"},
+		{text: `{{ProductColor | default "无"}}`, want: "无"},
+		{text: `{{BoxNum | pad 6}}`, want: "000042"},
+		{text: `{{BoxNum | pad 7 "ab"}}`, want: "ababab42"},
+		{text: `{{BoxNum | pad 1}}`, want: "42"},
+		{text: `{{Name | trim | upper | replace "-" "/"}}`, want: "AB/C"},
+		{text: `{{"a|b" | upper}}`, want: "A|B"},
+		{text: "{{Missing}}", err: "未知变量 Missing"},
+		{text: "{{ProductNum | nope}}", err: "未知过滤器 nope"},
+		{text: "{{ProductNum | fixed}}", err: "参数个数不对"},
+		{text: "{{ProductNum | fixed -1}}", err: "不是非负整数"},
+		{text: "{{ProductNum | fixed 1000000000}}", err: "超过上限"},
+		{text: "{{ProductNum | pad 1000000000}}", err: "超过上限"},
+		{text: `{{ProductColor | date "yyyy"}}`, err: "无法识别日期"},
+		{text: "{{NetWeight | fixed x}}", err: "不是非负整数"},
+	}
+	for _, tt := range tests {
+		got, err := expandFields(tt.text, fields)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expandFields(%q) error = %v, want containing %q", tt.text, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("expandFields(%q) = %q, %v, want %q", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestEvalCondition(t *testing.T) {
+	fields := map[string]string{
+		"DeviceNos":  "A1,A2",
+		"ProductNum": "9",
+		"Customer":   "客户A",
+		"Empty":      "",
+		"Zero":       "0",
+		"Flag":       "false",
+	}
+	tests := []struct {
+		cond string
+		want bool
+		err  bool
+	}{
+		{cond: "", want: true},
+		{cond: "DeviceNos", want: true},
+		{cond: "!DeviceNos", want: false},
+		{cond: "not Empty", want: true},
+		{cond: "Zero", want: false},
+		{cond: "Flag", want: false},
+		{cond: "ProductNum < 10", want: true},
+		{cond: "ProductNum >= 10", want: false},
+		{cond: "DeviceNos | count >= 2", want: true},
+		{cond: `Customer == "客户A" and ProductNum > 0`, want: true},
+		{cond: `Customer == "客户B" or Empty`, want: false},
+		{cond: `Customer != "a or b"`, want: true},
+		{cond: "ProductNum == Zero", want: false},
+		{cond: "ProductNum ==", err: true},
+		{cond: "Missing", err: true},
+		{cond: "!", err: true},
+	}
+	for _, tt := range tests {
+		got, err := evalCondition(tt.cond, fields)
+		if (err != nil) != tt.err {
+			t.Errorf("evalCondition(%q) error = %v, want error %v", tt.cond, err, tt.err)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("evalCondition(%q) = %v, want %v", tt.cond, got, tt.want)
+		}
+	}
+}
+
+func TestCurrentShift(t *testing.T) {
+	tests := []struct {
+		clock string
+		want  string
+	}{
+		{"08:00", "白班"},
+		{"19:59", "白班"},
+		{"20:00", "夜班"},
+		{"03:00", "夜班"},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse("15:04", tt.clock)
+		if got := currentShift(now); got != tt.want {
+			t.Errorf("currentShift(%s) = %q, want %q", tt.clock, got, tt.want)
+		}
+	}
+}
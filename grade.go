@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// 打印质量分析: 按打印机实际分辨率渲染标签，逐个检查条码和二维码的模块尺寸(打印点数)、X 尺寸取整误差和空白区，
+// 并从渲染结果重新解码，参照 ISO/IEC 15415/15416 给出估计等级。反射率、对比度等需要实物检测的指标无法从版面得到，
+// 等级只是版面层面的估计，长批量打印前仍建议用检测仪抽检
+
+// 默认打印机分辨率，常见热转印标签打印机为 203 dpi
+const defaultPrinterDpi = 203
+
+// 各码制要求的空白(模块): 线性条码左右两侧，二维码四周；EAN-13 左侧 11、右侧 7
+var quietZoneModules = map[string]int{
+	TemplateQrcode:   qrDefaultQuietZone,
+	"datamatrix":     1,
+	"gs1-datamatrix": 1,
+	"pdf417":         pdf417QuietZone,
+	"code128":        code128Quiet,
+	"gs1-128":        10,
+	"itf14":          itf14Quiet,
+	"code39":         code39Quiet,
+	"ean13":          11,
+}
+
+// GS1 规范的最小 X 尺寸(mm): EAN-13 为 80% 放大系数，GS1-128、ITF-14 为物流标签
+var minModuleMm = map[string]float64{
+	"ean13":   0.264,
+	"gs1-128": 0.495,
+	"itf14":   0.495,
+}
+
+// 等级，下标为 ISO 的数值等级 0~4
+var qualityGrades = [5]string{"F", "D", "C", "B", "A"}
+
+// BarcodeQuality 一个条码或二维码的打印质量分析结果
+type BarcodeQuality struct {
+	Symbology string
+	// 图片名，如 barcode_内容、qrcode_内容
+	Name string
+	// 模块宽度(打印点、mm)
+	ModuleDots float64
+	ModuleMm   float64
+	// X 尺寸取整误差: 打印时条空宽度只能是整数个点，最大偏差占模块宽度的比例
+	RoundingError float64
+	// 实际空白(模块，各侧中最小的)及要求的空白；QuietZone 为 -1 表示未测量
+	QuietZone     float64
+	QuietRequired int
+	// 原图或按打印分辨率渲染后无法解码、内容不一致时的原因，能正确解码时为空
+	DecodeError string
+	// 估计等级 A~F 及数值等级 4~0
+	Grade string
+	Score int
+	// 低于规范的问题
+	Warnings []string
+}
+
+func (q BarcodeQuality) String() string {
+	quiet := "未测量"
+	if q.QuietZone >= 0 {
+		quiet = fmt.Sprintf("%.1f/%d", q.QuietZone, q.QuietRequired)
+	}
+	decoded := "是"
+	if q.DecodeError != "" {
+		decoded = "否"
+	}
+	return fmt.Sprintf("%s %s: 等级 %s(%d)，模块 %.2f 点(%.3f mm)，取整误差 %.0f%%，空白 %s 模块，解码 %s",
+		q.Symbology, q.Content(), q.Grade, q.Score, q.ModuleDots, q.ModuleMm, q.RoundingError*100, quiet, decoded)
+}
+
+// Content 返回便于显示的条码内容: 去掉图片名的类型前缀，换行合并为空格，过长时截断
+func (q BarcodeQuality) Content() string {
+	name := q.Name
+	if i := strings.Index(name, "_"); i >= 0 {
+		name = name[i+1:]
+	}
+	content := []rune(strings.Join(strings.Fields(name), " "))
+	if len(content) > 32 {
+		return string(content[:32]) + "…"
+	}
+	return string(content)
+}
+
+// printerDpi 返回打印质量分析使用的打印机分辨率
+func printerDpi() int {
+	if config != nil && config.PrinterDpi > 0 {
+		return config.PrinterDpi
+	}
+	return defaultPrinterDpi
+}
+
+// AnalyzeLabelQuality 按 dpi 分析标签上每个条码和二维码的打印质量；模板需写明实际打印宽度 printWidth
+func AnalyzeLabelQuality(l *Label, dpi int) ([]BarcodeQuality, error) {
+	if l.PrintScale <= 0 {
+		return nil, fmt.Errorf("模板 %s 未设置 printWidth，无法换算实际尺寸分析打印质量，请在模板中填写实际打印宽度(mm)", l.Template)
+	}
+	if dpi <= 0 {
+		dpi = printerDpi()
+	}
+	// 每个版面单位对应的打印点数
+	dotsPerUnit := float64(dpi) / 25.4 * l.printScale()
+	var results []BarcodeQuality
+	for i := range l.Elements {
+		e := &l.Elements[i]
+		if e.Symbology == "" {
+			continue
+		}
+		q, err := analyzeBarcode(l, e, dpi, dotsPerUnit)
+		if err != nil {
+			return nil, fmt.Errorf("分析 %s 失败: %w", e.ImageName, err)
+		}
+		results = append(results, q)
+	}
+	return results, nil
+}
+
+// analyzeBarcode 分析一个条码图片元素
+func analyzeBarcode(l *Label, e *LabelElement, dpi int, dotsPerUnit float64) (BarcodeQuality, error) {
+	q := BarcodeQuality{Symbology: e.Symbology, Name: e.ImageName, QuietZone: -1, QuietRequired: quietZoneModules[e.Symbology]}
+	src, err := decodePngImage(e.ImageData)
+	if err != nil {
+		return q, err
+	}
+	srcBounds := src.img.Bounds()
+	linear := isLinearSymbology(e.Symbology)
+
+	// 原图中一个模块的像素数: 条码生成时模块为整数像素，取中间一行条空宽度的最大公约数
+	row := srcBounds.Min.Y + srcBounds.Dy()/2
+	if linear {
+		row = src.barcodeRow()
+	}
+	srcModule := 0
+	for _, r := range src.scanRuns(row) {
+		srcModule = gcd(srcModule, r)
+	}
+	if srcModule == 0 {
+		return q, fmt.Errorf("图片中没有条码")
+	}
+
+	rect := e.pixelRect(dotsPerUnit)
+	if rect.Dx() <= 0 || rect.Dy() <= 0 {
+		return q, fmt.Errorf("元素大小为 0")
+	}
+	q.ModuleDots = float64(rect.Dx()) * float64(srcModule) / float64(srcBounds.Dx())
+	if !linear && e.Symbology != "pdf417" {
+		// 二维码按横竖两个方向中较小的模块计算
+		q.ModuleDots = math.Min(q.ModuleDots, float64(rect.Dy())*float64(srcModule)/float64(srcBounds.Dy()))
+	}
+	q.ModuleMm = q.ModuleDots / float64(dpi) * 25.4
+	q.RoundingError = roundingError(q.ModuleDots)
+
+	// 渲染元素及四周要求空白的范围，相邻元素侵入空白时能检查出来
+	margin := int(math.Ceil(float64(q.QuietRequired)*q.ModuleDots)) + 2
+	pageW, pageH := l.PageSize()
+	page := image.Rect(0, 0, int(pageW*dotsPerUnit+0.5), int(pageH*dotsPerUnit+0.5))
+	region := rect.Inset(-margin).Intersect(page)
+	img, err := renderLabelRegion(l, dotsPerUnit, region)
+	if err != nil {
+		return q, err
+	}
+	rendered := grayImage{img}
+	if e.Symbology != "itf14" {
+		// ITF-14 的空白在保护框内，由生成时保证
+		q.QuietZone = measureQuietZone(rendered, rect.Intersect(region), linear, e.Symbology == "ean13") / q.ModuleDots
+	}
+
+	// 按打印分辨率渲染后重新解码，与原图解码结果比较；任一侧解码失败都算不合格
+	want, err := decodeBarcodePng(e.Symbology, e.ImageData)
+	if err != nil {
+		q.DecodeError = "原图无法解码: " + err.Error()
+	} else if got, err := decodeSymbol(e.Symbology, grayImage{img.SubImage(rect.Intersect(region))}); err != nil {
+		q.DecodeError = "按打印分辨率渲染后无法解码: " + err.Error()
+	} else if got != want {
+		q.DecodeError = "按打印分辨率渲染后解码内容不一致"
+	}
+	q.grade()
+	return q, nil
+}
+
+// grade 按各项指标计算估计等级(取最低项)，并记录低于规范的问题
+func (q *BarcodeQuality) grade() {
+	score := 4
+	lower := func(s int) {
+		if s < score {
+			score = s
+		}
+	}
+	switch {
+	case q.ModuleDots < 1:
+		lower(0)
+		q.Warnings = append(q.Warnings, fmt.Sprintf("模块宽度只有 %.2f 个打印点，无法打印", q.ModuleDots))
+	case q.ModuleDots < 2:
+		lower(1)
+		q.Warnings = append(q.Warnings, fmt.Sprintf("模块宽度只有 %.2f 个打印点，低于 2 点时墨粉扩散会使条空宽度严重失真", q.ModuleDots))
+	}
+	switch e := q.RoundingError; {
+	case e <= 0.05:
+	case e <= 0.15:
+		lower(3)
+	case e <= 0.25:
+		lower(2)
+	case e <= 0.35:
+		lower(1)
+	default:
+		lower(0)
+	}
+	if q.RoundingError > 0.25 {
+		q.Warnings = append(q.Warnings, fmt.Sprintf("X 尺寸 %.2f 点不是整数，条空宽度最大偏差 %.0f%%，建议调整元素宽度使模块为整数个点", q.ModuleDots, q.RoundingError*100))
+	}
+	if q.QuietZone >= 0 && q.QuietZone+0.05 < float64(q.QuietRequired) {
+		lower(0)
+		q.Warnings = append(q.Warnings, fmt.Sprintf("空白只有 %.1f 个模块，要求至少 %d 个，可能被相邻元素或页边干扰", q.QuietZone, q.QuietRequired))
+	}
+	if q.DecodeError != "" {
+		lower(0)
+		q.Warnings = append(q.Warnings, q.DecodeError)
+	}
+	// 低于 GS1 规范的 X 尺寸不符合应用规范，按不合格计
+	if minMm, ok := minModuleMm[q.Symbology]; ok && q.ModuleMm+0.0005 < minMm {
+		lower(0)
+		q.Warnings = append(q.Warnings, fmt.Sprintf("X 尺寸 %.3f mm 小于 GS1 规范的最小值 %.3f mm", q.ModuleMm, minMm))
+	}
+	q.Score = score
+	q.Grade = qualityGrades[score]
+}
+
+// isLinearSymbology 是否为线性条码，线性条码只要求左右两侧的空白
+func isLinearSymbology(symbology string) bool {
+	switch symbology {
+	case "code128", "gs1-128", "ean13", "itf14", "code39":
+		return true
+	}
+	return false
+}
+
+// roundingError 模块宽度为 dots 个点时，打印出的条空只能是相邻的整数点宽，返回最大偏差占模块宽度的比例
+func roundingError(dots float64) float64 {
+	if dots < 1 {
+		return 1
+	}
+	floor, ceil := math.Floor(dots), math.Ceil(dots)
+	if ceil-dots < 1e-6 || dots-floor < 1e-6 {
+		return 0
+	}
+	return math.Max(dots-floor, ceil-dots) / dots
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// measureQuietZone 测量符号四周(线性条码为左右两侧)连续空白的最小宽度(打印点)；
+// 符号范围按元素区域内的深色像素确定，线性条码只看条的上部，避开下方的文字；ean13 右侧只要求 7 个模块，按 11/7 换算
+func measureQuietZone(g grayImage, rect image.Rectangle, linear, ean13 bool) float64 {
+	bounds := g.img.Bounds()
+	var left, right, top, bottom int
+	if linear {
+		row := rect.Min.Y + rect.Dy()/3
+		left, right = -1, -1
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if g.dark(x, row) {
+				if left < 0 {
+					left = x
+				}
+				right = x
+			}
+		}
+		if left < 0 {
+			return 0
+		}
+		// 第一个条在扫描行上下连续的范围，只取扫描行以上和同样高度的以下部分
+		top = row
+		for top > rect.Min.Y && g.dark(left, top-1) {
+			top--
+		}
+		bottom = row + (row - top)
+		for b := row; b < bottom; b++ {
+			if b+1 >= rect.Max.Y || !g.dark(left, b+1) {
+				bottom = b
+				break
+			}
+		}
+	} else {
+		left, top, right, bottom = rect.Max.X, rect.Max.Y, -1, -1
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if g.dark(x, y) {
+					if x < left {
+						left = x
+					}
+					if x > right {
+						right = x
+					}
+					if y < top {
+						top = y
+					}
+					if y > bottom {
+						bottom = y
+					}
+				}
+			}
+		}
+		if right < 0 {
+			return 0
+		}
+	}
+
+	lightColumn := func(x int) bool {
+		for y := top; y <= bottom; y++ {
+			if g.dark(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	lightRow := func(y int) bool {
+		for x := left; x <= right; x++ {
+			if g.dark(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	// 渲染范围的边缘是页边或已超过要求的空白，都按到此为止计算
+	count := func(from, step, limit int, light func(int) bool) float64 {
+		n := 0
+		for p := from; p != limit && light(p); p += step {
+			n++
+		}
+		return float64(n)
+	}
+	leftZone := count(left-1, -1, bounds.Min.X-1, lightColumn)
+	rightZone := count(right+1, 1, bounds.Max.X, lightColumn)
+	if ean13 {
+		rightZone = rightZone * 11 / 7
+	}
+	zone := math.Min(leftZone, rightZone)
+	if !linear {
+		zone = math.Min(zone, count(top-1, -1, bounds.Min.Y-1, lightRow))
+		zone = math.Min(zone, count(bottom+1, 1, bounds.Max.Y, lightRow))
+	}
+	return zone
+}
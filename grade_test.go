@@ -0,0 +1,211 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/jung-kurt/gofpdf"
+)
+
+func TestRoundingError(t *testing.T) {
+	tests := []struct {
+		dots float64
+		want float64
+	}{
+		{0.5, 1},
+		{1, 0},
+		{3, 0},
+		{1.5, 1.0 / 3},
+		{2.5, 0.2},
+		{3.2, 0.25},
+		{4.9, 0.9 / 4.9},
+	}
+	for _, tt := range tests {
+		if got := roundingError(tt.dots); got-tt.want > 1e-9 || tt.want-got > 1e-9 {
+			t.Errorf("roundingError(%v) = %v, want %v", tt.dots, got, tt.want)
+		}
+	}
+}
+
+func TestBarcodeQualityGrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		q        BarcodeQuality
+		grade    string
+		warnings int
+	}{
+		{"ok", BarcodeQuality{Symbology: "code128", ModuleDots: 3, QuietZone: 12, QuietRequired: 10}, "A", 0},
+		{"rounding B", BarcodeQuality{Symbology: "code128", ModuleDots: 3, RoundingError: 0.1, QuietZone: -1}, "B", 0},
+		{"rounding C", BarcodeQuality{Symbology: "code128", ModuleDots: 3, RoundingError: 0.2, QuietZone: -1}, "C", 0},
+		{"rounding D", BarcodeQuality{Symbology: "code128", ModuleDots: 3, RoundingError: 0.3, QuietZone: -1}, "D", 1},
+		{"rounding F", BarcodeQuality{Symbology: "code128", ModuleDots: 3, RoundingError: 0.4, QuietZone: -1}, "F", 1},
+		{"module under 2 dots", BarcodeQuality{Symbology: "code128", ModuleDots: 1.5, QuietZone: -1}, "D", 1},
+		{"module under 1 dot", BarcodeQuality{Symbology: "code128", ModuleDots: 0.5, RoundingError: 1, QuietZone: -1}, "F", 2},
+		{"quiet zone", BarcodeQuality{Symbology: "code128", ModuleDots: 3, QuietZone: 3.8, QuietRequired: 10}, "F", 1},
+		{"quiet zone rounding", BarcodeQuality{Symbology: "code128", ModuleDots: 3, QuietZone: 9.96, QuietRequired: 10}, "A", 0},
+		{"decode", BarcodeQuality{Symbology: "code128", ModuleDots: 3, QuietZone: -1, DecodeError: "原图无法解码"}, "F", 1},
+		{"gs1 minimum", BarcodeQuality{Symbology: "ean13", ModuleDots: 2, ModuleMm: 0.25, QuietZone: -1}, "F", 1},
+		{"gs1 minimum met", BarcodeQuality{Symbology: "ean13", ModuleDots: 2, ModuleMm: 0.264, QuietZone: -1}, "A", 0},
+	}
+	for _, tt := range tests {
+		q := tt.q
+		q.grade()
+		if q.Grade != tt.grade || len(q.Warnings) != tt.warnings {
+			t.Errorf("%s: grade %s with %d warnings %v, want %s with %d", tt.name, q.Grade, len(q.Warnings), q.Warnings, tt.grade, tt.warnings)
+		}
+	}
+}
+
+// 按 100mm 宽、254 dpi(每个版面单位 1 点)分析标签上的 Code 128，检查空白、遮挡和原图无法解码的情况
+func TestAnalyzeLabelQuality(t *testing.T) {
+	black := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(black, black.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	blackPng := encodeTestPng(t, black)
+	// 等宽条纹，能找到模块宽度但不是条码
+	stripes := image.NewRGBA(image.Rect(0, 0, 100, 25))
+	draw.Draw(stripes, stripes.Bounds(), image.White, image.Point{}, draw.Src)
+	for x := 0; x < 100; x += 4 {
+		draw.Draw(stripes, image.Rect(x, 0, x+2, 25), image.Black, image.Point{}, draw.Src)
+	}
+	stripesPng := encodeTestPng(t, stripes)
+	// 没有留空白的 Code 128，模块 2 像素
+	code, err := code128.Encode("C0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scaled, err := barcode.Scale(code, code.Bounds().Dx()*2, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noQuietPng := encodeTestPng(t, scaled)
+
+	tests := []struct {
+		name       string
+		printScale float64
+		// 遮挡物的位置，宽度为 0 时不遮挡
+		cover   [4]float64
+		source  []byte
+		grade   string
+		err     string
+		warning string
+	}{
+		{name: "ok", printScale: 0.1, grade: "A"},
+		{name: "no printWidth", err: "未设置 printWidth"},
+		{name: "quiet zone", printScale: 0.1, cover: [4]float64{90, 100, 8, 100}, source: noQuietPng, grade: "F", warning: "空白只有"},
+		{name: "covered", printScale: 0.1, cover: [4]float64{250, 100, 20, 100}, grade: "F", warning: "渲染后无法解码"},
+		{name: "source", printScale: 0.1, source: stripesPng, grade: "F", warning: "原图无法解码"},
+	}
+	for _, tt := range tests {
+		label := &Label{Template: "test", Orientation: "P", Size: gofpdf.SizeType{Wd: 1000, Ht: 600}, PrintScale: tt.printScale}
+		e := TemplateElement{Type: TemplateBarcode, X: 100, Y: 100, W: 396, H: 100}
+		if err := e.addTo(label, "C0001"); err != nil {
+			t.Fatal(err)
+		}
+		if tt.source != nil {
+			label.Elements[0].ImageData = tt.source
+		}
+		if c := tt.cover; c[2] > 0 {
+			label.AddImage("cover", "png", blackPng, c[0], c[1], c[2], c[3])
+		}
+		results, err := AnalyzeLabelQuality(label, 254)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(results) != 1 {
+			t.Errorf("%s: %d results, want 1", tt.name, len(results))
+			continue
+		}
+		q := results[0]
+		if q.Grade != tt.grade || (tt.warning == "") != (len(q.Warnings) == 0) ||
+			(tt.warning != "" && !strings.Contains(strings.Join(q.Warnings, "\n"), tt.warning)) {
+			t.Errorf("%s: %s, warnings %v, want grade %s with %q", tt.name, q, q.Warnings, tt.grade, tt.warning)
+		}
+	}
+}
+
+// 模板中的 Code 128 两侧留足空白，不受内容长度影响
+func TestCode128QuietZone(t *testing.T) {
+	for _, content := range []string{"B0001", "BOX-0001", "BX20240105-0001", "C2024-00012", "A1B2C3D4E5F6G7"} {
+		label := &Label{Template: "test", Orientation: "P", Size: gofpdf.SizeType{Wd: 1000, Ht: 600}, PrintScale: 0.1}
+		e := TemplateElement{Type: TemplateBarcode, X: 20, Y: 410, W: 560, H: 110, Pixels: 200}
+		if err := e.addTo(label, content); err != nil {
+			t.Fatal(err)
+		}
+		results, err := AnalyzeLabelQuality(label, defaultPrinterDpi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q := results[0]; q.QuietZone < float64(code128Quiet) {
+			t.Errorf("%s: quiet zone %.1f modules, want at least %d", content, q.QuietZone, code128Quiet)
+		}
+	}
+}
+
+// 按默认打印机分辨率分析内置模板生成的标签: 从读取模板、生成版面到渲染解码走完整流程
+func TestGradeShippedTemplates(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config = &Config{}
+
+	tag := func(template string) func() ([]*Label, error) {
+		return func() ([]*Label, error) {
+			return BuildTagLabel(&ExcelData{
+				ProductName: "耳机", ProductColor: "黑", ProductDate: "2024-01-05", ProductNum: "10",
+				NetWeight: "1.8", GrossWeight: "2", BarCode69Type: "401", Gtin: "697901851000", Lot: "L2401",
+				Sscc: "069790181234567897", BoxNum: "B0001", DeviceNos: "SN2024000001,SN2024000002", Template: template,
+			})
+		}
+	}
+	tests := []struct {
+		template string
+		build    func() ([]*Label, error)
+		// 允许不合格的码制: gs1 模板的 GS1-128 内容较长，100 mm 宽的标签上达不到物流标签要求的 0.495 mm
+		failing string
+	}{
+		{TemplateTag, tag(TemplateTag), ""},
+		{"gs1", tag("gs1"), "gs1-128"},
+		{"carton", tag("carton"), ""},
+		{"pallet", tag("pallet"), ""},
+		{"packing", tag("packing"), ""},
+		{TemplateDevice, func() ([]*Label, error) { return BuildDeviceLabel("SN2024000001", "SN2024000002") }, ""},
+		{TemplateMulti, func() ([]*Label, error) { return BuildMultiLabel("SN2024000001,SN2024000002") }, ""},
+	}
+	for _, tt := range tests {
+		labels, err := tt.build()
+		if err != nil {
+			t.Errorf("%s: %v", tt.template, err)
+			continue
+		}
+		results, err := AnalyzeLabelQuality(labels[0], defaultPrinterDpi)
+		if err != nil {
+			t.Errorf("%s: %v", tt.template, err)
+			continue
+		}
+		if len(results) == 0 {
+			t.Errorf("%s: no barcodes graded", tt.template)
+		}
+		for _, q := range results {
+			if q.Symbology == tt.failing {
+				if q.Grade != "F" {
+					t.Errorf("%s: %s graded %s, want F below the GS1 minimum", tt.template, q, q.Grade)
+				}
+				continue
+			}
+			if len(q.Warnings) > 0 || q.DecodeError != "" {
+				t.Errorf("%s: %s: %v", tt.template, q, q.Warnings)
+			}
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/ean"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// EAN-13 宽度(模块): 左侧空白 11、条码 95、右侧空白 7，与原 69 码图片一致
+const (
+	ean13LeftQuiet  = 11
+	ean13RightQuiet = 7
+	ean13Modules    = ean13LeftQuiet + 95 + ean13RightQuiet
+)
+
+// 未设置 pixels 时 EAN-13 图片的宽度，与原 resources/images 中的 69 码图片相同
+const ean13DefaultPixels = 2212
+
+// gs1CheckDigit 计算 GS1 校验位(模 10，从右往左权重 3、1 交替)，digits 不含校验位
+func gs1CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		n := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			n *= 3
+		}
+		sum += n
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// NormalizeGtin 校验商品条码并返回 13 位 EAN-13: 12 位时补上校验位，13 位时检查校验位，
+// 14 位 GTIN 以 0 开头时去掉前导 0；可以包含空格和 -
+func NormalizeGtin(value string) (string, error) {
+	gtin := strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(value))
+	for _, r := range gtin {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("商品条码 %s 只能包含数字", value)
+		}
+	}
+	if len(gtin) == 14 && gtin[0] == '0' {
+		gtin = gtin[1:]
+	}
+	switch len(gtin) {
+	case 12:
+		return gtin + string(gs1CheckDigit(gtin)), nil
+	case 13:
+		if check := gs1CheckDigit(gtin[:12]); gtin[12] != check {
+			return "", fmt.Errorf("商品条码 %s 校验位错误，最后一位应为 %c", value, check)
+		}
+		return gtin, nil
+	}
+	return "", fmt.Errorf("商品条码 %s 应为 12 位(不含校验位)或 13 位数字", value)
+}
+
+// tagGtin 返回产品标签的商品条码: 单据中的 GTIN 优先，否则按条码类型查找 config.toml 的 [gtins]
+func tagGtin(excelData *ExcelData) string {
+	if excelData.Gtin != "" {
+		return excelData.Gtin
+	}
+	if config == nil {
+		return ""
+	}
+	return config.Gtins[strings.TrimSuffix(excelData.BarCode69Type, "-69.png")]
+}
+
+// ean13Png 生成 EAN-13 png 数据，样式与原 69 码图片相同: 起始、中间、终止符加长，下方印数字
+func ean13Png(content string, width, height int) ([]byte, error) {
+	gtin, err := NormalizeGtin(content)
+	if err != nil {
+		return nil, err
+	}
+	code, err := ean.Encode(gtin)
+	if err != nil {
+		return nil, err
+	}
+	// 模块宽度取整数像素，条宽才一致
+	module := width / ean13Modules
+	if module < 1 {
+		module = 1
+	}
+	width = module * ean13Modules
+	if height <= 0 {
+		height = width * 684 / ean13DefaultPixels
+	}
+
+	// 字号为图片高度的 1/5，数字宽度超过 6 个模块时缩小
+	face, err := barcodeTextFace(float64(height)/5, "0", module*6)
+	if err != nil {
+		return nil, err
+	}
+	metrics := face.Metrics()
+	digitHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	barHeight := height - digitHeight
+	guardHeight := height - digitHeight/2
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for x := 0; x < 95; x++ {
+		r, _, _, _ := code.At(x, 0).RGBA()
+		if r != 0 {
+			continue
+		}
+		h := barHeight
+		if x < 3 || (x >= 45 && x < 50) || x >= 92 {
+			h = guardHeight
+		}
+		left := (ean13LeftQuiet + x) * module
+		draw.Draw(img, image.Rect(left, 0, left+module, h), image.Black, image.Point{}, draw.Src)
+	}
+
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(color.Black), Face: face}
+	baseline := fixed.I(height) - metrics.Descent
+	// 第一位在起始符左侧，其余 12 位在左右两半，每位居中于 7 个模块
+	drawDigit := func(digit byte, center int) {
+		text := string(digit)
+		drawer.Dot = fixed.Point26_6{X: fixed.I(center) - font.MeasureString(face, text)/2, Y: baseline}
+		drawer.DrawString(text)
+	}
+	drawDigit(gtin[0], ean13LeftQuiet*module/2)
+	for i := 1; i <= 12; i++ {
+		start := ean13LeftQuiet + 3 + (i-1)*7
+		if i > 6 {
+			start += 5
+		}
+		drawDigit(gtin[i], start*module+module*7/2)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// barcodeTextFace 返回条码下方文字的字体(Go Bold，各工位一致)，size 为像素，text 宽度超过 maxWidth 时缩小
+func barcodeTextFace(size float64, text string, maxWidth int) (font.Face, error) {
+	f, err := loadFont("")
+	if err != nil {
+		return nil, err
+	}
+	options := &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone}
+	face, err := opentype.NewFace(f, options)
+	if err != nil {
+		return nil, err
+	}
+	if width := font.MeasureString(face, text).Ceil(); width > maxWidth {
+		options.Size = size * float64(maxWidth) / float64(width)
+		return opentype.NewFace(f, options)
+	}
+	return face, nil
+}
+
+// gs1AI GS1 应用标识符(AI)的数据格式
+type gs1AI struct {
+	title string
+	// 固定长度，为 0 时为可变长度，最长 max；可变长度的 AI 后面还有数据时需要 FNC1 分隔
+	length, max int
+	numeric     bool
+	// 最后一位为 GS1 校验位
+	check bool
+	// 日期 YYMMDD，日可以为 00
+	date bool
+}
+
+// gs1AIs 支持的应用标识符，310n/330n 见 lookupGs1AI
+var gs1AIs = map[string]gs1AI{
+	"00": {title: "SSCC", length: 18, numeric: true, check: true},
+	"01": {title: "GTIN", length: 14, numeric: true, check: true},
+	"02": {title: "箱内商品 GTIN", length: 14, numeric: true, check: true},
+	"10": {title: "批号", max: 20},
+	"11": {title: "生产日期", length: 6, numeric: true, date: true},
+	"13": {title: "包装日期", length: 6, numeric: true, date: true},
+	"15": {title: "保质期", length: 6, numeric: true, date: true},
+	"17": {title: "有效期", length: 6, numeric: true, date: true},
+	"21": {title: "序列号", max: 20},
+	"30": {title: "数量", max: 8, numeric: true},
+	"37": {title: "箱内商品数量", max: 8, numeric: true},
+}
+
+// GS1 AI 可编码字符集(82 个字符)
+const gs1Charset = `!"%&'()*+,-./0123456789:;<=>?ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz`
+
+// lookupGs1AI 查找应用标识符，310n 净重、330n 毛重(kg)的 n 为小数位数 0~5
+func lookupGs1AI(ai string) (gs1AI, bool) {
+	if spec, ok := gs1AIs[ai]; ok {
+		return spec, true
+	}
+	if len(ai) == 4 && ai[3] >= '0' && ai[3] <= '5' {
+		switch ai[:3] {
+		case "310":
+			return gs1AI{title: "净重(kg)", length: 6, numeric: true}, true
+		case "330":
+			return gs1AI{title: "毛重(kg)", length: 6, numeric: true}, true
+		}
+	}
+	return gs1AI{}, false
+}
+
+// Gs1Element GS1 条码中的一个数据项
+type Gs1Element struct {
+	AI    string
+	Value string
+}
+
+// ParseGs1 解析并校验 "(01)06979018510006(10)L2401" 形式的 GS1 数据
+func ParseGs1(text string) ([]Gs1Element, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "(") {
+		return nil, fmt.Errorf("GS1 数据应以 (AI) 开头，如 (01)06979018510006")
+	}
+	var elements []Gs1Element
+	for text != "" {
+		end := strings.Index(text, ")")
+		if !strings.HasPrefix(text, "(") || end < 0 {
+			return nil, fmt.Errorf("GS1 数据 %q 中的 AI 应写在括号中", text)
+		}
+		ai := text[1:end]
+		text = text[end+1:]
+		value := text
+		if next := strings.Index(text, "("); next >= 0 {
+			value = text[:next]
+		}
+		text = text[len(value):]
+		element := Gs1Element{AI: ai, Value: value}
+		if err := element.validate(); err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// validate 按 AI 检查长度、字符、校验位和日期
+func (e Gs1Element) validate() error {
+	spec, ok := lookupGs1AI(e.AI)
+	if !ok {
+		return fmt.Errorf("不支持的 GS1 应用标识符 (%s)，数据中不能包含括号", e.AI)
+	}
+	name := fmt.Sprintf("(%s)%s", e.AI, spec.title)
+	switch {
+	case e.Value == "":
+		return fmt.Errorf("%s 为空", name)
+	case spec.length > 0 && len(e.Value) != spec.length:
+		return fmt.Errorf("%s 应为 %d 位，实际为 %q", name, spec.length, e.Value)
+	case spec.length == 0 && len(e.Value) > spec.max:
+		return fmt.Errorf("%s 最长 %d 位，实际为 %q", name, spec.max, e.Value)
+	}
+	for _, r := range e.Value {
+		if spec.numeric && (r < '0' || r > '9') {
+			return fmt.Errorf("%s 只能包含数字，实际为 %q", name, e.Value)
+		}
+		if !strings.ContainsRune(gs1Charset, r) || r == '(' || r == ')' {
+			return fmt.Errorf("%s 不能包含字符 %q", name, r)
+		}
+	}
+	if spec.check {
+		body := e.Value[:len(e.Value)-1]
+		if check := gs1CheckDigit(body); e.Value[len(e.Value)-1] != check {
+			return fmt.Errorf("%s %s 校验位错误，最后一位应为 %c", name, e.Value, check)
+		}
+	}
+	if spec.date {
+		year, _ := strconv.Atoi(e.Value[:2])
+		month, _ := strconv.Atoi(e.Value[2:4])
+		day, _ := strconv.Atoi(e.Value[4:6])
+		if month < 1 || month > 12 || (day != 0 && day > time.Date(2000+year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()) {
+			return fmt.Errorf("%s 应为 YYMMDD 格式的日期，实际为 %q", name, e.Value)
+		}
+	}
+	return nil
+}
+
+// gs1Code128Content 返回 Code128 编码内容: 以 FNC1 开头，可变长度的数据项后面还有数据时用 FNC1 分隔
+func gs1Code128Content(elements []Gs1Element) string {
+	var b strings.Builder
+	b.WriteRune(code128.FNC1)
+	for i, e := range elements {
+		b.WriteString(e.AI)
+		b.WriteString(e.Value)
+		if spec, _ := lookupGs1AI(e.AI); spec.length == 0 && i < len(elements)-1 {
+			b.WriteRune(code128.FNC1)
+		}
+	}
+	return b.String()
+}
+
+// gs1HumanReadable 返回条码下方的人工识读文字，AI 写在括号中
+func gs1HumanReadable(elements []Gs1Element) string {
+	var b strings.Builder
+	for _, e := range elements {
+		b.WriteString("(" + e.AI + ")" + e.Value)
+	}
+	return b.String()
+}
+
+// encodeGs1128 按 GS1 数据生成 GS1-128 条码
+func encodeGs1128(content string) (barcode.Barcode, []Gs1Element, error) {
+	elements, err := ParseGs1(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	code, err := code128.Encode(gs1Code128Content(elements))
+	if err != nil {
+		return nil, nil, err
+	}
+	return code, elements, nil
+}
+
+// cartonGs1 按标签数据生成箱标 GS1 数据: (01)GTIN (10)批号 (11)生产日期 (3103)净重 (37)数量，没有填写的项省略；
+// 日期、重量无法换算时原样写入，生成条码时报错
+func cartonGs1(excelData *ExcelData, gtin string) string {
+	var b strings.Builder
+	add := func(ai, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			b.WriteString("(" + ai + ")" + value)
+		}
+	}
+	if gtin != "" {
+		// EAN-13 前补 0 为 14 位
+		if normalized, err := NormalizeGtin(gtin); err == nil {
+			gtin = "0" + normalized
+		}
+	}
+	add("01", gtin)
+	add("10", excelData.Lot)
+
+	date := strings.TrimSpace(excelData.ProductDate)
+	for _, layout := range dateInputLayouts {
+		if t, err := time.ParseInLocation(layout, date, time.Local); err == nil {
+			date = t.Format("060102")
+			break
+		}
+	}
+	add("11", date)
+
+	// 净重按 kg，默认 3 位小数(3103)，超过 6 位时减少小数位
+	weight := strings.TrimSpace(excelData.NetWeight)
+	ai := "3103"
+	if kg, err := strconv.ParseFloat(weight, 64); err == nil && kg >= 0 {
+		for decimals := 3; decimals >= 0; decimals-- {
+			if scaled := math.Round(kg * math.Pow10(decimals)); scaled < 1e6 {
+				ai, weight = "310"+strconv.Itoa(decimals), fmt.Sprintf("%06d", int(scaled))
+				break
+			}
+		}
+	}
+	add(ai, weight)
+	add("37", excelData.ProductNum)
+	return b.String()
+}
+
+// gs1128Png 生成 GS1-128 png 数据，两侧各留 10 个模块空白，下方印人工识读文字；
+// width 为 0 时每个模块 4 像素，ratio 为高宽比
+func gs1128Png(content string, width int, ratio float64) ([]byte, error) {
+	code, elements, err := encodeGs1128(content)
+	if err != nil {
+		return nil, err
+	}
+	modules := code.Bounds().Dx() + 20
+	module := 4
+	if width > 0 {
+		module = width / modules
+		if module < 1 {
+			module = 1
+		}
+	}
+	width = module * modules
+	height := int(float64(width)*ratio + 0.5)
+
+	text := gs1HumanReadable(elements)
+	face, err := barcodeTextFace(float64(height)/6, text, width-20*module)
+	if err != nil {
+		return nil, err
+	}
+	metrics := face.Metrics()
+	barHeight := height - (metrics.Ascent + metrics.Descent).Ceil()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for x := 0; x < code.Bounds().Dx(); x++ {
+		if r, _, _, _ := code.At(x, 0).RGBA(); r == 0 {
+			left := (10 + x) * module
+			draw.Draw(img, image.Rect(left, 0, left+module, barHeight), image.Black, image.Point{}, draw.Src)
+		}
+	}
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(color.Black), Face: face}
+	drawer.Dot = fixed.Point26_6{X: (fixed.I(width) - font.MeasureString(face, text)) / 2, Y: fixed.I(height) - metrics.Descent}
+	drawer.DrawString(text)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/boombuler/barcode/code128"
+)
+
+func TestGs1CheckDigit(t *testing.T) {
+	// 参考值来自 GS1 通用规范和 EAN-13 公开示例
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"400638133393", '1'},
+		{"629104150021", '3'},
+		{"697901851000", '6'},
+		{"10614141123456789", '7'},
+		{"000000000000", '0'},
+	}
+	for _, tt := range tests {
+		if got := gs1CheckDigit(tt.digits); got != tt.want {
+			t.Errorf("gs1CheckDigit(%q) = %c, want %c", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeGtin(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{value: "400638133393", want: "4006381333931"},
+		{value: "4006381333931", want: "4006381333931"},
+		{value: " 6 979018-510006 ", want: "6979018510006"},
+		{value: "06979018510006", want: "6979018510006"},
+		{value: "4006381333932", err: "最后一位应为 1"},
+		{value: "16979018510006", err: "应为 12 位"},
+		{value: "40063813339", err: "应为 12 位"},
+		{value: "40063813339A", err: "只能包含数字"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeGtin(tt.value)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("NormalizeGtin(%q) error = %v, want containing %q", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeGtin(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseGs1(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Gs1Element
+		err  string
+	}{
+		{text: "(01)06979018510006(10)L2401", want: []Gs1Element{{"01", "06979018510006"}, {"10", "L2401"}}},
+		{text: " (00)106141411234567897 ", want: []Gs1Element{{"00", "106141411234567897"}}},
+		{text: "(11)240229(17)000000", err: "YYMMDD"},
+		{text: "(11)240200(3103)001250(37)12", want: []Gs1Element{{"11", "240200"}, {"3103", "001250"}, {"37", "12"}}},
+		{text: "(11)230229", err: "YYMMDD"},
+		{text: "(11)241301", err: "YYMMDD"},
+		{text: "(01)06979018510007", err: "最后一位应为 6"},
+		{text: "(01)0697901851000", err: "应为 14 位"},
+		{text: "(10)ABCDEFGHIJKLMNOPQRSTU", err: "最长 20 位"},
+		{text: "(10)L 24", err: "不能包含字符"},
+		{text: "(30)12A", err: "只能包含数字"},
+		{text: "(3106)001250", err: "不支持的 GS1 应用标识符"},
+		{text: "(99)x", err: "不支持的 GS1 应用标识符"},
+		{text: "(10)", err: "为空"},
+		{text: "01)06979018510006", err: "应以 (AI) 开头"},
+		{text: "(01", err: "应写在括号中"},
+	}
+	for _, tt := range tests {
+		got, err := ParseGs1(tt.text)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseGs1(%q) error = %v, want containing %q", tt.text, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseGs1(%q) = %v, %v, want %v", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestGs1Code128Content(t *testing.T) {
+	const fnc1 = string(code128.FNC1)
+	tests := []struct {
+		text  string
+		want  string
+		human string
+	}{
+		// 固定长度的数据项后面不需要 FNC1
+		{"(01)06979018510006(11)240105", fnc1 + "0106979018510006" + "11240105", "(01)06979018510006(11)240105"},
+		// 可变长度的数据项后面还有数据时用 FNC1 分隔，最后一项不加
+		{"(10)L2401(37)12", fnc1 + "10L2401" + fnc1 + "3712", "(10)L2401(37)12"},
+		{"(01)06979018510006(10)L2401", fnc1 + "0106979018510006" + "10L2401", "(01)06979018510006(10)L2401"},
+	}
+	for _, tt := range tests {
+		elements, err := ParseGs1(tt.text)
+		if err != nil {
+			t.Fatalf("ParseGs1(%q): %v", tt.text, err)
+		}
+		if got := gs1Code128Content(elements); got != tt.want {
+			t.Errorf("gs1Code128Content(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if got := gs1HumanReadable(elements); got != tt.human {
+			t.Errorf("gs1HumanReadable(%q) = %q, want %q", tt.text, got, tt.human)
+		}
+	}
+}
+
+func TestCartonGs1(t *testing.T) {
+	excelData := &ExcelData{Lot: "L2401", ProductDate: "2024-01-05", NetWeight: "1234.5", ProductNum: "12"}
+	want := "(01)06979018510006(10)L2401(11)240105(3102)123450(37)12"
+	if got := cartonGs1(excelData, "697901851000"); got != want {
+		t.Errorf("cartonGs1() = %q, want %q", got, want)
+	}
+	if _, err := ParseGs1(want); err != nil {
+		t.Errorf("ParseGs1(%q): %v", want, err)
+	}
+}
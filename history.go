@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 打印记录文件，每行一条 JSON
+const historyFile = "jobs.jsonl"
+
+// 打印记录界面最多显示的条数
+const historyListLimit = 500
+
+// PrintJob 一次打印(或 Excel 生成)的记录，保存模板版本和字段，用于追溯和重打
+type PrintJob struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// 标签名，即首页 PDF 文件名
+	Name string `json:"name"`
+	// 使用的模板及版本
+	Template        string `json:"template"`
+	TemplateVersion string `json:"templateVersion"`
+	// 生成版面的字段，重打时按原字段重新生成
+	Fields map[string]string `json:"fields"`
+	Pages  int               `json:"pages"`
+	// 各页 PDF 的 sha256
+	Hashes []string `json:"hashes,omitempty"`
+	// false 表示只生成了 PDF，如 Excel 批量生成
+	Printed bool   `json:"printed"`
+	Error   string `json:"error,omitempty"`
+	// 重打时记录原打印记录的 ID
+	ReprintOf string `json:"reprintOf,omitempty"`
+
+	templateSnapshot []byte
+}
+
+var (
+	historyMu      sync.Mutex
+	lastJobTime    time.Time
+	historyWatchMu sync.Mutex
+	historyWatches []func()
+)
+
+// historyDir 打印记录目录，默认 ./history
+func historyDir() string {
+	if config.HistoryDir != "" {
+		return config.HistoryDir
+	}
+	return "./history"
+}
+
+// templateSnapshotPath 模板版本快照路径；legacyTemplateSnapshotPath 为只保存模板内容的旧快照
+func templateSnapshotPath(name, version string) string {
+	return filepath.Join(historyDir(), "templates", name+"_"+version+".json")
+}
+
+func legacyTemplateSnapshotPath(name, version string) string {
+	return filepath.Join(historyDir(), "templates", name+"_"+version+".toml")
+}
+
+// templateSnapshot 模板版本快照: 模板内容以及生成版面时读取的标题表和素材，任何一项变化都得到新的版本
+type templateSnapshot struct {
+	Template string `json:"template"`
+	// 使用的语言及各语言合并后的标题表
+	Language string                       `json:"language,omitempty"`
+	Catalogs map[string]map[string]string `json:"catalogs,omitempty"`
+	Assets   map[string]*snapshotAsset    `json:"assets,omitempty"`
+	// 生成版面时 config.toml 中影响版面的设置；旧快照没有此项，重打时使用当前设置
+	Settings *labelSettings `json:"settings,omitempty"`
+}
+
+// labelSettings 影响版面的 config.toml 设置: 设备号码制、二维码参数、拆分限制及箱标二维码格式。
+// 只记录与默认值不同的项，都没有修改时版本与模板内容的版本相同
+type labelSettings struct {
+	Device  *DeviceConfig  `json:"device,omitempty"`
+	Qrcode  *QrConfig      `json:"qrcode,omitempty"`
+	QrSplit *QrSplitConfig `json:"qrSplit,omitempty"`
+	BoxQr   *BoxQrConfig   `json:"boxQr,omitempty"`
+}
+
+// currentLabelSettings 返回当前 config.toml 中模板用到的设置
+func currentLabelSettings(template string) labelSettings {
+	var s labelSettings
+	if config == nil {
+		return s
+	}
+	kind := qrLabelKind(template)
+	if d := config.Device; kind == KindDevice && d.Symbology != "" && !strings.EqualFold(d.Symbology, TemplateQrcode) {
+		s.Device = &d
+	}
+	if c := config.Qrcode[kind]; c.Level != "" || c.QuietZone != nil || c.Mode != "" || c.Library != "" {
+		s.Qrcode = &c
+	}
+	if maxVersion, minModule := qrSplitLimits(); maxVersion != qrDefaultMaxVersion || minModule != qrDefaultMinModule {
+		s.QrSplit = &QrSplitConfig{MaxVersion: maxVersion, MinModule: minModule}
+	}
+	if b := config.BoxQr; kind == KindTag && (!strings.EqualFold(strings.TrimSpace(b.Format), boxQrDefaultFormat) && b.Format != "" ||
+		strings.TrimSuffix(b.LinkDomain, "/") != boxQrDefaultDomain && b.LinkDomain != "") {
+		s.BoxQr = &b
+	}
+	return s
+}
+
+// empty 是否全部为默认值
+func (s *labelSettings) empty() bool {
+	return s == nil || *s == labelSettings{}
+}
+
+// snapshotAsset 素材的索引信息和文件内容
+type snapshotAsset struct {
+	Asset
+	Data []byte `json:"data"`
+}
+
+// labelResources 生成一次版面时读取的标题表和素材；frozen 为 true 时来自快照，只从快照读取
+type labelResources struct {
+	snapshot templateSnapshot
+	frozen   bool
+}
+
+// catalog 读取语言的标题表并记录；r 为 nil 时直接读取
+func (r *labelResources) catalog(language string) (map[string]string, error) {
+	if r == nil {
+		return LoadCatalog(language)
+	}
+	if catalog, ok := r.snapshot.Catalogs[language]; ok {
+		return catalog, nil
+	}
+	if r.frozen {
+		return nil, fmt.Errorf("模板快照中没有语言 %s 的标题表", language)
+	}
+	catalog, err := LoadCatalog(language)
+	if err != nil {
+		return nil, err
+	}
+	if r.snapshot.Catalogs == nil {
+		r.snapshot.Catalogs = map[string]map[string]string{}
+	}
+	r.snapshot.Catalogs[language] = catalog
+	return catalog, nil
+}
+
+// asset 读取素材及文件内容并记录；r 为 nil 时直接读取
+func (r *labelResources) asset(name string) (*Asset, []byte, error) {
+	if r != nil {
+		if a, ok := r.snapshot.Assets[name]; ok {
+			return &a.Asset, a.Data, nil
+		}
+		if r.frozen {
+			return nil, nil, fmt.Errorf("模板快照中没有素材 %s", name)
+		}
+	}
+	a, err := FindAsset(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(a.Path())
+	if err != nil {
+		return nil, nil, err
+	}
+	if r != nil {
+		if r.snapshot.Assets == nil {
+			r.snapshot.Assets = map[string]*snapshotAsset{}
+		}
+		r.snapshot.Assets[name] = &snapshotAsset{Asset: *a, Data: data}
+	}
+	return a, data, nil
+}
+
+// settings 返回生成版面使用的设置: 快照中记录的，否则读取当前 config.toml 并记录
+func (r *labelResources) settings(template string) labelSettings {
+	if r.snapshot.Settings != nil {
+		return *r.snapshot.Settings
+	}
+	s := currentLabelSettings(template)
+	if !r.frozen {
+		r.snapshot.Settings = &s
+	}
+	return s
+}
+
+// settings 返回生成版面使用的设置，不是由模板生成的版面使用当前 config.toml
+func (l *Label) settings() labelSettings {
+	if l.resources != nil && l.resources.snapshot.Settings != nil {
+		return *l.resources.snapshot.Settings
+	}
+	return currentLabelSettings(l.Template)
+}
+
+// version 返回模板 t 与读取的资源、设置合起来的版本及快照内容；没有用到标题表、素材且设置都为默认值时版本即模板内容的版本
+func (r *labelResources) version(t *LabelTemplate) (string, []byte, error) {
+	snapshot := r.snapshot
+	snapshot.Template = string(t.source)
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(snapshot.Catalogs) == 0 && len(snapshot.Assets) == 0 && snapshot.Settings.empty() {
+		return t.version, data, nil
+	}
+	return templateVersion(data), data, nil
+}
+
+// OnPrintJobRecorded 注册写入打印记录后的回调，用于刷新界面
+func OnPrintJobRecorded(f func()) {
+	historyWatchMu.Lock()
+	defer historyWatchMu.Unlock()
+	historyWatches = append(historyWatches, f)
+}
+
+func notifyPrintJobRecorded() {
+	historyWatchMu.Lock()
+	watches := append([]func(){}, historyWatches...)
+	historyWatchMu.Unlock()
+	for _, f := range watches {
+		f()
+	}
+}
+
+// newPrintJob 按一次生成的标签创建打印记录，打印结束后调用 finish 写入
+func newPrintJob(labels []*Label) *PrintJob {
+	job := &PrintJob{Time: time.Now(), Pages: len(labels)}
+	if len(labels) > 0 {
+		l := labels[0]
+		job.Name = l.Name
+		job.Template = l.Template
+		job.TemplateVersion = l.TemplateVersion
+		job.Fields = l.Fields
+		job.templateSnapshot = l.templateSnapshot
+	}
+	return job
+}
+
+// finish 记录打印结果并写入打印记录，写入失败只输出提示，不影响打印
+func (job *PrintJob) finish(printed bool, err error) {
+	job.Printed = printed
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if err := recordPrintJob(job); err != nil {
+		fmt.Println("写入打印记录失败:", err.Error())
+		return
+	}
+	notifyPrintJobRecorded()
+}
+
+// recordPrintJob 追加打印记录，模板版本第一次使用时保存快照
+func recordPrintJob(job *PrintJob) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	// 记录 ID 取时间到毫秒，同一毫秒内的记录依次后延
+	at := job.Time.Truncate(time.Millisecond)
+	if !at.After(lastJobTime) {
+		at = lastJobTime.Add(time.Millisecond)
+	}
+	lastJobTime = at
+	job.ID = at.Format("20060102-150405.000")
+
+	if job.Template != "" && len(job.templateSnapshot) > 0 {
+		path := templateSnapshotPath(job.Template, job.TemplateVersion)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, job.templateSnapshot, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(historyDir(), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(historyDir(), historyFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// LoadPrintJobs 读取打印记录，最新的在前；无法解析的行跳过
+func LoadPrintJobs() ([]*PrintJob, error) {
+	historyMu.Lock()
+	data, err := os.ReadFile(filepath.Join(historyDir(), historyFile))
+	historyMu.Unlock()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*PrintJob
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		job := new(PrintJob)
+		if err := json.Unmarshal(scanner.Bytes(), job); err != nil {
+			fmt.Printf("打印记录第 %d 行无法解析: %s\n", line, err.Error())
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Time.After(jobs[j].Time)
+	})
+	return jobs, nil
+}
+
+// FindPrintJob 按 ID 查找打印记录
+func FindPrintJob(id string) (*PrintJob, error) {
+	jobs, err := LoadPrintJobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return nil, fmt.Errorf("找不到打印记录 %s", id)
+}
+
+// Matches 判断记录的 ID、标签名、模板或字段值是否包含 query(不区分大小写)
+func (job *PrintJob) Matches(query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return true
+	}
+	values := []string{job.ID, job.Name, job.Template, job.TemplateVersion}
+	for _, value := range job.Fields {
+		values = append(values, value)
+	}
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary 返回一行记录摘要
+func (job *PrintJob) Summary() string {
+	status := "✓"
+	if job.Error != "" {
+		status = "❌"
+	} else if !job.Printed {
+		status = "📄"
+	}
+	summary := fmt.Sprintf("%s %s  %s  %s@%s  %d 页", status, job.Time.Format("2006-01-02 15:04:05"), job.Name, job.Template, job.TemplateVersion, job.Pages)
+	if job.ReprintOf != "" {
+		summary += "  (重打)"
+	}
+	return summary
+}
+
+// Details 返回记录的详细内容，字段按名称排序
+func (job *PrintJob) Details() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "记录: %s\n时间: %s\n标签: %s (%d 页)\n模板: %s  版本: %s\n",
+		job.ID, job.Time.Format("2006-01-02 15:04:05"), job.Name, job.Pages, job.Template, job.TemplateVersion)
+	if !job.Printed {
+		b.WriteString("只生成 PDF，未打印\n")
+	}
+	if job.ReprintOf != "" {
+		fmt.Fprintf(&b, "重打自: %s\n", job.ReprintOf)
+	}
+	if job.Error != "" {
+		fmt.Fprintf(&b, "错误: %s\n", job.Error)
+	}
+	for i, hash := range job.Hashes {
+		fmt.Fprintf(&b, "第 %d 页 sha256: %s\n", i+1, hash)
+	}
+	b.WriteString("字段:\n")
+	for _, name := range fieldNames(job.Fields) {
+		fmt.Fprintf(&b, "  %s: %s\n", name, strings.ReplaceAll(job.Fields[name], "\n", ", "))
+	}
+	return b.String()
+}
+
+// VersionStatus 比较记录使用的模板版本与按当前模板、标题表和素材生成的版本
+func (job *PrintJob) VersionStatus() string {
+	if _, err := LoadTemplate(job.Template); err != nil {
+		return fmt.Sprintf("当前没有模板 %s，只能按原版本重打", job.Template)
+	}
+	labels, err := BuildJobLabels(job, true)
+	if err != nil || len(labels) == 0 {
+		return fmt.Sprintf("模板 %s 当前无法按记录的字段生成，只能按原版本重打", job.Template)
+	}
+	if current := labels[0].TemplateVersion; current != job.TemplateVersion {
+		return fmt.Sprintf("模板 %s 已修改(含标题表、素材): 原版本 %s，当前版本 %s", job.Template, job.TemplateVersion, current)
+	}
+	return fmt.Sprintf("模板 %s 未修改(版本 %s)", job.Template, job.TemplateVersion)
+}
+
+// LoadTemplateVersion 加载模板的指定版本，从打印记录保存的快照读取，生成时只使用快照中的标题表和素材；
+// 没有快照时，当前模板的内容未变且版本不含标题表、素材时使用当前模板
+func LoadTemplateVersion(name, version string) (*LabelTemplate, error) {
+	if data, err := os.ReadFile(templateSnapshotPath(name, version)); err == nil {
+		snapshot := templateSnapshot{}
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("模板 %s 的版本 %s 快照无法解析: %w", name, version, err)
+		}
+		t, err := parseTemplateWith(name, []byte(snapshot.Template), func(lang string) error {
+			if _, ok := snapshot.Catalogs[lang]; !ok {
+				return fmt.Errorf("模板快照中没有语言 %s 的标题表", lang)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		t.resources = &labelResources{snapshot: snapshot, frozen: true}
+		return t, nil
+	}
+	if t, err := LoadTemplate(name); err == nil && t.Version() == version {
+		return t, nil
+	}
+	data, err := os.ReadFile(legacyTemplateSnapshotPath(name, version))
+	if err != nil {
+		return nil, fmt.Errorf("找不到模板 %s 的版本 %s", name, version)
+	}
+	return ParseTemplate(name, data)
+}
+
+// BuildJobLabels 按记录的字段重新生成标签，current 为 true 时使用当前模板，否则使用原版本
+func BuildJobLabels(job *PrintJob, current bool) ([]*Label, error) {
+	var t *LabelTemplate
+	var err error
+	if current {
+		t, err = LoadTemplate(job.Template)
+	} else {
+		t, err = LoadTemplateVersion(job.Template, job.TemplateVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.Build(job.Name, job.Fields)
+}
+
+// ReprintJob 重打一条记录并写入新的打印记录
+func ReprintJob(job *PrintJob, current bool) error {
+	labels, err := BuildJobLabels(job, current)
+	if err != nil {
+		return err
+	}
+	record := newPrintJob(labels)
+	record.ReprintOf = job.ID
+	return printJobLabels(record, labels, config.AdobePath, config.PrintInterval)
+}
+
+// createHistoryTab 创建打印记录界面，可查看每次打印使用的模板版本并重打
+func createHistoryTab(logger *Logger) fyne.CanvasObject {
+	const (
+		originalVersion = "原模板版本"
+		currentVersion  = "当前模板"
+	)
+
+	var (
+		mu       sync.Mutex
+		jobs     []*PrintJob
+		selected *PrintJob
+	)
+
+	searchEntry := widget.NewEntry()
+	searchEntry.SetPlaceHolder("按箱号、设备号、产品名称、模板等搜索")
+
+	details := widget.NewLabel("选择一条记录查看详情")
+	details.Wrapping = fyne.TextWrapWord
+	versionStatus := widget.NewLabel("")
+	versionStatus.Wrapping = fyne.TextWrapWord
+	versionRadio := widget.NewRadioGroup([]string{originalVersion, currentVersion}, nil)
+	versionRadio.Horizontal = true
+	versionRadio.SetSelected(originalVersion)
+
+	selectedJob := func() *PrintJob {
+		mu.Lock()
+		defer mu.Unlock()
+		return selected
+	}
+
+	// 预览按所选版本重新生成的标签
+	preview := NewLabelPreview(logger, func() ([]*Label, error) {
+		job := selectedJob()
+		if job == nil {
+			return nil, nil
+		}
+		return BuildJobLabels(job, versionRadio.Selected == currentVersion)
+	})
+	versionRadio.OnChanged = func(string) { preview.Refresh() }
+
+	list := widget.NewList(
+		func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(jobs)
+		},
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			mu.Lock()
+			defer mu.Unlock()
+			if id < len(jobs) {
+				item.(*widget.Label).SetText(jobs[id].Summary())
+			}
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		mu.Lock()
+		if id >= len(jobs) {
+			mu.Unlock()
+			return
+		}
+		selected = jobs[id]
+		job := selected
+		mu.Unlock()
+		details.SetText(job.Details())
+		versionStatus.SetText(job.VersionStatus())
+		preview.Refresh()
+	}
+
+	reload := func() {
+		all, err := LoadPrintJobs()
+		if err != nil {
+			logger.Log(fmt.Sprintf("❌ 读取打印记录失败: %s", err.Error()))
+			return
+		}
+		var filtered []*PrintJob
+		for _, job := range all {
+			if job.Matches(searchEntry.Text) {
+				filtered = append(filtered, job)
+				if len(filtered) >= historyListLimit {
+					break
+				}
+			}
+		}
+		mu.Lock()
+		jobs = filtered
+		mu.Unlock()
+		list.UnselectAll()
+		list.Refresh()
+	}
+	searchEntry.OnChanged = func(string) { reload() }
+	OnPrintJobRecorded(reload)
+	OnTemplatesChanged(func() {
+		if job := selectedJob(); job != nil {
+			versionStatus.SetText(job.VersionStatus())
+			preview.Refresh()
+		}
+	})
+	reload()
+
+	refreshBtn := widget.NewButton("🔄 刷新", reload)
+	reprintBtn := widget.NewButton("🖨️ 重打", func() {
+		job := selectedJob()
+		if job == nil {
+			logger.Log("❌ 错误: 请选择要重打的记录")
+			return
+		}
+		current := versionRadio.Selected == currentVersion
+		logger.Log(fmt.Sprintf("✓ 开始重打: %s，使用%s", job.Name, versionRadio.Selected))
+		go func() {
+			if err := ReprintJob(job, current); err != nil {
+				logger.Log(fmt.Sprintf("❌ 重打失败: %s", err.Error()))
+				return
+			}
+			logger.Log(fmt.Sprintf("✓ 重打完成: %s", job.Name))
+		}()
+	})
+	reprintBtn.Importance = widget.HighImportance
+
+	title := widget.NewLabelWithStyle("🕘 打印记录", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	top := container.NewVBox(
+		title,
+		container.NewBorder(nil, nil, nil, refreshBtn, searchEntry),
+	)
+	detail := container.NewVBox(
+		details,
+		widget.NewSeparator(),
+		versionStatus,
+		container.NewBorder(nil, nil, widget.NewLabel("重打使用"), reprintBtn, versionRadio),
+		widget.NewSeparator(),
+		preview.Content(),
+	)
+	split := container.NewVSplit(list, container.NewScroll(detail))
+	split.SetOffset(0.35)
+	return container.NewBorder(top, nil, nil, nil, split)
+}
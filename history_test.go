@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+// 设备号标签按 Data Matrix 打印后改回二维码，重打原版本仍为 Data Matrix，版本与默认设置不同
+func TestReprintDeviceSymbology(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config = &Config{HistoryDir: t.TempDir(), Device: DeviceConfig{Symbology: "gs1-datamatrix"}}
+
+	labels, err := BuildDeviceLabel("SN2024000001", "SN2024000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := newPrintJob(labels)
+	if err := recordPrintJob(job); err != nil {
+		t.Fatal(err)
+	}
+	want := symbologies(labels[0])
+	if want[0] != "gs1-datamatrix" {
+		t.Fatalf("printed symbologies %v, want gs1-datamatrix", want)
+	}
+
+	config.Device = DeviceConfig{}
+	current, err := BuildDeviceLabel("SN2024000001", "SN2024000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current[0].TemplateVersion == job.TemplateVersion {
+		t.Errorf("version %s unchanged after changing [device]", job.TemplateVersion)
+	}
+	reprinted, err := BuildJobLabels(job, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := symbologies(reprinted[0]); len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("reprinted symbologies %v, want %v", got, want)
+	}
+	if reprinted[0].TemplateVersion != job.TemplateVersion {
+		t.Errorf("reprinted version %s, want %s", reprinted[0].TemplateVersion, job.TemplateVersion)
+	}
+	if got := symbologies(current[0]); got[0] != "qrcode" {
+		t.Errorf("current symbologies %v, want qrcode", got)
+	}
+}
+
+// symbologies 返回标签上条码的码制
+func symbologies(label *Label) []string {
+	var s []string
+	for _, e := range label.Elements {
+		if e.Symbology != "" {
+			s = append(s, e.Symbology)
+		}
+	}
+	return s
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/flopp/go-findfont"
+	"github.com/jung-kurt/gofpdf"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// 标签元素类型
+const (
+	ElementImage = "image"
+	ElementText  = "text"
+)
+
+// LabelElement 标签上的一个元素，坐标和尺寸单位均为 mm
+type LabelElement struct {
+	Kind string
+	X, Y float64
+	W, H float64
+
+	// 图片元素: 已编码的图片数据及类型(png/jpeg/svg)，ImageName 为图片来源(文件路径或 asset:素材名)
+	ImageName string
+	ImageType string
+	ImageData []byte
+	// 条码、二维码图片的码制(qrcode、code128、pdf417 等)，用于解码校验和打印质量分析；其他图片为空
+	Symbology string
+	// 条码应解码出的内容: GS1 数据含 FNC1，EAN-13、ITF-14 含校验位，Code 39 含校验字符
+	Content string
+
+	// 文字元素: FontSize 单位为 pt；W 为 0 时 (X, Y) 为基线起点
+	Text     string
+	FontSize float64
+
+	// 文字框: W > 0 时文字在以 (X, Y) 为左上角、W×H 的框内排版，见 layoutText
+	Wrap        bool    // 超出框宽时自动换行
+	MinFontSize float64 // 放不下时逐步缩小字号直到该值，0 表示不缩小
+	Ellipsis    bool    // 仍放不下时截断并加省略号
+	Align       string  // 水平对齐: L(默认)/C/R
+	VAlign      string  // 垂直对齐: T(默认)/M/B
+	LineSpacing float64 // 行高倍数，默认 1.2
+}
+
+// Label 一张标签的版面描述，打印用的 PDF 和界面预览图都由它渲染，保证两者一致
+type Label struct {
+	// 输出文件名(不含扩展名)
+	Name string
+	// 生成版面使用的模板名及版本
+	Template        string
+	TemplateVersion string
+	// 生成版面的字段(含 Now、Shift)，重打时按原字段重新生成
+	Fields map[string]string
+	// 与 gofpdf.InitType 一致: 方向 P/L 以及纸张尺寸
+	Orientation string
+	Size        gofpdf.SizeType
+	// 字体: FontPath 为空时使用 PDF 内置字体
+	FontFamily string
+	FontStyle  string
+	FontPath   string
+	// 主字体缺字时依次使用的后备字体，如英文字体中混排的中文
+	FallbackFonts []LabelFont
+	// 每个版面单位对应的实际打印毫米数，0 表示 1；素材按实际尺寸和分辨率换算时使用
+	PrintScale float64
+	Elements   []LabelElement
+
+	// 模板版本快照(模板内容及用到的标题表、素材)，打印时保存，重打原版本时读取
+	templateSnapshot []byte
+	// 生成版面时读取的标题表和素材，多页共用
+	resources *labelResources
+	// 已通过条码解码校验，同一标签打印、导出多次时不重复校验
+	verified bool
+}
+
+// PageSize 返回实际页面宽高(mm)，横向时宽高互换，与 gofpdf 的处理一致
+func (l *Label) PageSize() (w, h float64) {
+	if strings.EqualFold(l.Orientation, "L") {
+		return l.Size.Ht, l.Size.Wd
+	}
+	return l.Size.Wd, l.Size.Ht
+}
+
+// AddImage 添加图片元素
+func (l *Label) AddImage(name, imageType string, data []byte, x, y, w, h float64) {
+	l.Elements = append(l.Elements, LabelElement{
+		Kind:      ElementImage,
+		X:         x,
+		Y:         y,
+		W:         w,
+		H:         h,
+		ImageName: name,
+		ImageType: imageType,
+		ImageData: data,
+	})
+}
+
+// AddBarcode 添加条码或二维码图片，记录码制及应解码出的内容
+func (l *Label) AddBarcode(symbology, name, content string, data []byte, x, y, w, h float64) {
+	l.AddImage(name, "png", data, x, y, w, h)
+	l.Elements[len(l.Elements)-1].Symbology = symbology
+	l.Elements[len(l.Elements)-1].Content = content
+}
+
+// AddImageFile 添加静态图片文件，如 resources/images 下的 69 码图片；宽高为 0 时按 96 dpi 的原始尺寸
+func (l *Label) AddImageFile(path string, x, y, w, h float64) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	imageType := imageTypeOf(path)
+	if imageType == "" {
+		imageType = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if w <= 0 || h <= 0 {
+		naturalW, naturalH, err := imageNaturalSize(data, imageType, defaultImageDpi, defaultImageDpi)
+		if err != nil {
+			return err
+		}
+		w, h = fitImageSize(w, h, naturalW, naturalH)
+	}
+	l.AddImage(path, imageType, data, x, y, w, h)
+	return nil
+}
+
+// AddText 添加文字元素，(x, y) 为基线起点
+func (l *Label) AddText(x, y, fontSize float64, text string) {
+	l.Elements = append(l.Elements, LabelElement{
+		Kind:     ElementText,
+		X:        x,
+		Y:        y,
+		Text:     text,
+		FontSize: fontSize,
+	})
+}
+
+// AddTextBox 添加在框内排版的文字元素，放不下时换行、缩小字号并加省略号
+func (l *Label) AddTextBox(x, y, w, h, fontSize, minFontSize float64, text string) {
+	l.Elements = append(l.Elements, LabelElement{
+		Kind:        ElementText,
+		X:           x,
+		Y:           y,
+		W:           w,
+		H:           h,
+		Text:        text,
+		FontSize:    fontSize,
+		Wrap:        true,
+		MinFontSize: minFontSize,
+		Ellipsis:    true,
+	})
+}
+
+// labelPdfDate 写入 PDF 的固定创建/修改时间，同一标签每次渲染得到完全相同的文件
+var labelPdfDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// RenderLabelPdf 将标签渲染为 PDF 数据，输出是确定的: 相同的标签内容得到字节完全相同的 PDF
+func RenderLabelPdf(l *Label) ([]byte, error) {
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		OrientationStr: l.Orientation,
+		UnitStr:        "mm",
+		SizeStr:        "A4",
+		Size:           l.Size,
+		FontDirStr:     "",
+	})
+	// 固定元数据，并按名称排序字体、图片等资源，避免 map 遍历顺序不同导致输出变化
+	pdf.SetCreationDate(labelPdfDate)
+	pdf.SetModificationDate(labelPdfDate)
+	pdf.SetCatalogSort(true)
+	if l.FontPath != "" {
+		if err := addPdfFont(pdf, l.font()); err != nil {
+			return nil, err
+		}
+	}
+	pdf.AddPage()
+
+	m := &textMeasurer{label: l}
+	registered := map[LabelFont]bool{l.font(): true}
+	for i := range l.Elements {
+		e := &l.Elements[i]
+		switch e.Kind {
+		case ElementImage:
+			imageType, data := e.ImageType, e.ImageData
+			if imageType == "svg" {
+				// SVG 按实际打印尺寸栅格化
+				px := svgPdfDpi * l.printScale() / 25.4
+				img, err := rasterizeSvg(e.ImageData, int(e.W*px+0.5), int(e.H*px+0.5))
+				if err != nil {
+					return nil, err
+				}
+				var buf bytes.Buffer
+				if err := png.Encode(&buf, img); err != nil {
+					return nil, err
+				}
+				imageType, data = "png", buf.Bytes()
+			}
+			options := gofpdf.ImageOptions{ImageType: imageType, ReadDpi: false, AllowNegativePosition: true}
+			// 按内容命名图片，名称中的时间戳等不会影响资源顺序
+			imageID := labelImageID(imageType, data)
+			pdf.RegisterImageOptionsReader(imageID, options, bytes.NewReader(data))
+			pdf.ImageOptions(imageID, e.X, e.Y, e.W, e.H, false, options, 0, "")
+		case ElementText:
+			lines, err := layoutText(l, e)
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range lines {
+				// 按字体分段输出，后备字体第一次使用时才嵌入
+				x := line.X
+				for _, run := range l.textRuns(line.Text) {
+					if run.Font.Path != "" && !registered[run.Font] {
+						if err := addPdfFont(pdf, run.Font); err != nil {
+							return nil, err
+						}
+						registered[run.Font] = true
+					}
+					pdf.SetFont(run.Font.Family, run.Font.Style, line.FontSize)
+					pdf.Text(x, line.Y, run.Text)
+					w, err := m.runWidth(run, line.FontSize)
+					if err != nil {
+						return nil, err
+					}
+					x += w
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// labelImageID 返回图片在 PDF 中的稳定名称
+func labelImageID(imageType string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return imageType + "_" + hex.EncodeToString(sum[:16])
+}
+
+// ContentHash 返回渲染结果的 sha256，可用于归档去重和重打比对
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// RenderLabelImage 按每毫米像素数将标签渲染为位图，用于界面预览
+func RenderLabelImage(l *Label, pxPerMm float64) (*image.RGBA, error) {
+	pageW, pageH := l.PageSize()
+	return renderLabelRegion(l, pxPerMm, image.Rect(0, 0, int(pageW*pxPerMm+0.5), int(pageH*pxPerMm+0.5)))
+}
+
+// renderLabelRegion 只渲染页面中 region(按 pxPerMm 换算的像素坐标)内的部分，用于高分辨率下分析局部
+func renderLabelRegion(l *Label, pxPerMm float64, region image.Rectangle) (*image.RGBA, error) {
+	img := image.NewRGBA(region)
+	xdraw.Draw(img, img.Bounds(), image.White, image.Point{}, xdraw.Src)
+
+	for i := range l.Elements {
+		e := &l.Elements[i]
+		switch e.Kind {
+		case ElementImage:
+			rect := e.pixelRect(pxPerMm)
+			if !rect.Overlaps(region) {
+				continue
+			}
+			if e.ImageType == "svg" {
+				// SVG 直接按目标像素大小渲染，不经过缩放
+				src, err := rasterizeSvg(e.ImageData, rect.Dx(), rect.Dy())
+				if err != nil {
+					return nil, fmt.Errorf("渲染图片 %s 失败: %w", e.ImageName, err)
+				}
+				draw.Draw(img, rect, src, image.Point{}, draw.Over)
+				continue
+			}
+			src, _, err := image.Decode(bytes.NewReader(e.ImageData))
+			if err != nil {
+				return nil, fmt.Errorf("解码图片 %s 失败: %w", e.ImageName, err)
+			}
+			var scaler xdraw.Scaler = xdraw.NearestNeighbor
+			if rect.Dx() < src.Bounds().Dx() {
+				// 缩小时使用双线性插值，避免条码细节丢失成摩尔纹
+				scaler = xdraw.ApproxBiLinear
+			}
+			scaler.Scale(img, rect, src, src.Bounds(), xdraw.Over, nil)
+		case ElementText:
+			lines, err := layoutText(l, e)
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range lines {
+				d := font.Drawer{
+					Dst: img,
+					Src: image.NewUniform(color.Black),
+					Dot: fixed.P(int(line.X*pxPerMm+0.5), int(line.Y*pxPerMm+0.5)),
+				}
+				for _, run := range l.textRuns(line.Text) {
+					face, err := fontFace(run.Font, line.FontSize, pxPerMm)
+					if err != nil {
+						return nil, err
+					}
+					d.Face = face
+					d.DrawString(run.Text)
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// pixelRect 返回元素按每毫米像素数换算的像素区域
+func (e *LabelElement) pixelRect(pxPerMm float64) image.Rectangle {
+	return image.Rect(
+		int(e.X*pxPerMm+0.5), int(e.Y*pxPerMm+0.5),
+		int((e.X+e.W)*pxPerMm+0.5), int((e.Y+e.H)*pxPerMm+0.5),
+	)
+}
+
+// PrintLabel 渲染标签并按配置发送到打印机
+func PrintLabel(l *Label) error {
+	return printLabelsWith([]*Label{l}, config.AdobePath, config.PrintInterval)
+}
+
+// PrintPdfData 将已渲染的各页 PDF 数据原样写入 PdfDir，作为一次打印任务依次打印，用于打印预览中的文档；
+// 某页失败时继续打印其余各页，返回第一个错误
+func PrintPdfData(labels []*Label, pdfs [][]byte) error {
+	job := newPrintJob(labels)
+	var firstErr error
+	for i, l := range labels {
+		pdfPath := fmt.Sprintf("%s/%s.pdf", config.PdfDir, l.Name)
+		err := l.verifyBarcodes()
+		if err == nil {
+			err = os.WriteFile(pdfPath, pdfs[i], 0644)
+		}
+		if err == nil {
+			job.Hashes = append(job.Hashes, ContentHash(pdfs[i]))
+			err = printPdfFile(pdfPath, config.AdobePath, config.PrintInterval)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	job.finish(true, firstErr)
+	return firstErr
+}
+
+// bundledChineseFont 随程序分发的中文字体，系统中没有中文字体时使用
+const bundledChineseFont = "resources/fonts/PingFang Regular_0.ttf"
+
+// findChineseFont 查找系统中文字体，找不到时使用随程序分发的字体，都没有时返回空字符串
+func findChineseFont() string {
+	for _, path := range findfont.List() {
+		if strings.Contains(path, "msyh.ttf") || strings.Contains(path, "simhei.ttf") || strings.Contains(path, "simsun.ttc") || strings.Contains(path, "simkai.ttf") {
+			return path
+		}
+	}
+	if _, err := os.Stat(bundledChineseFont); err == nil {
+		return bundledChineseFont
+	}
+	return ""
+}
+
+// setChineseFont 设置标签使用的中文字体，找不到时退回 Arial 粗体
+func (l *Label) setChineseFont() {
+	if f, ok := chineseLabelFont(); ok {
+		l.FontFamily = f.Family
+		l.FontStyle = f.Style
+		l.FontPath = f.Path
+		return
+	}
+	l.FontFamily = "Arial"
+	l.FontStyle = "B"
+	l.FontPath = ""
+}
+
+// LabelFont 标签使用的一种字体，Path 为空时为 PDF 内置字体(如 Arial)
+type LabelFont struct {
+	Family string
+	Style  string
+	Path   string
+}
+
+// chineseLabelFont 返回系统或随程序分发的中文字体，都没有时 ok 为 false
+func chineseLabelFont() (LabelFont, bool) {
+	if fontPath := findChineseFont(); fontPath != "" {
+		return LabelFont{Family: "微软雅黑", Path: fontPath}, true
+	}
+	return LabelFont{}, false
+}
+
+// font 返回标签的主字体
+func (l *Label) font() LabelFont {
+	return LabelFont{Family: l.FontFamily, Style: l.FontStyle, Path: l.FontPath}
+}
+
+// fonts 返回主字体及后备字体
+func (l *Label) fonts() []LabelFont {
+	return append([]LabelFont{l.font()}, l.FallbackFonts...)
+}
+
+// has 判断字体中是否有该字符；PDF 内置字体只能显示 ASCII 字符
+func (f LabelFont) has(r rune) bool {
+	if f.Path == "" {
+		return r <= unicode.MaxASCII
+	}
+	loaded, err := loadFont(f.Path)
+	if err != nil {
+		return false
+	}
+	var buf sfnt.Buffer
+	index, err := loaded.GlyphIndex(&buf, r)
+	return err == nil && index != 0
+}
+
+// covers 判断标签的字体中是否有字体能显示该字符
+func (l *Label) covers(r rune) bool {
+	for _, f := range l.fonts() {
+		if f.has(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// textRun 使用同一字体的一段文字
+type textRun struct {
+	Text string
+	Font LabelFont
+}
+
+// textRuns 按字符拆分文字: 每个字符使用主字体和后备字体中第一个包含它的字体，都没有时使用主字体；空白跟随前一段
+func (l *Label) textRuns(text string) []textRun {
+	if len(l.FallbackFonts) == 0 {
+		return []textRun{{Text: text, Font: l.font()}}
+	}
+	fonts := l.fonts()
+	var runs []textRun
+	for _, r := range text {
+		f := fonts[0]
+		if unicode.IsSpace(r) && len(runs) > 0 {
+			f = runs[len(runs)-1].Font
+		} else {
+			for _, candidate := range fonts {
+				if candidate.has(r) {
+					f = candidate
+					break
+				}
+			}
+		}
+		if n := len(runs); n > 0 && runs[n-1].Font == f {
+			runs[n-1].Text += string(r)
+		} else {
+			runs = append(runs, textRun{Text: string(r), Font: f})
+		}
+	}
+	return runs
+}
+
+// addPdfFont 将字体文件嵌入 PDF，常规和粗体使用同一文件
+func addPdfFont(pdf *gofpdf.Fpdf, f LabelFont) error {
+	// 自行读取字体文件，gofpdf 会把绝对路径拼接到字体目录下
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return err
+	}
+	pdf.AddUTF8FontFromBytes(f.Family, "", data)
+	pdf.AddUTF8FontFromBytes(f.Family, "B", data)
+	return nil
+}
+
+var (
+	fontCacheMu sync.Mutex
+	fontCache   = map[string]*opentype.Font{}
+)
+
+// fontFace 返回与 PDF 字体一致的位图字体，测量和预览都使用；内置字体按字形使用对应的系统字体文件，
+// 没有时用 Go 字体代替
+func fontFace(f LabelFont, sizePt, pxPerMm float64) (font.Face, error) {
+	var loaded *opentype.Font
+	var err error
+	if f.Path != "" {
+		loaded, err = loadFont(f.Path)
+	} else {
+		file, data := builtinFontFile(f)
+		if found, findErr := findfont.Find(file); findErr == nil {
+			loaded, err = loadFont(found)
+		} else {
+			loaded, err = cachedFont("go:"+file, func() ([]byte, error) { return data, nil })
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// pt 换算为像素: 1pt = 25.4/72 mm
+	return opentype.NewFace(loaded, &opentype.FaceOptions{
+		Size:    sizePt,
+		DPI:     pxPerMm * 25.4,
+		Hinting: font.HintingNone,
+	})
+}
+
+// builtinFontFile 返回 PDF 内置字体(Arial/Helvetica、Times、Courier)按粗体、斜体对应的系统字体文件名，
+// 以及找不到时代替的 Go 字体
+func builtinFontFile(f LabelFont) (string, []byte) {
+	style := strings.ToUpper(f.Style)
+	i := 0
+	if strings.Contains(style, "B") {
+		i |= 1
+	}
+	if strings.Contains(style, "I") {
+		i |= 2
+	}
+	switch strings.ToLower(f.Family) {
+	case "courier":
+		files := [4]string{"cour.ttf", "courbd.ttf", "couri.ttf", "courbi.ttf"}
+		data := [4][]byte{gomono.TTF, gomonobold.TTF, gomonoitalic.TTF, gomonobolditalic.TTF}
+		return files[i], data[i]
+	case "times":
+		files := [4]string{"times.ttf", "timesbd.ttf", "timesi.ttf", "timesbi.ttf"}
+		data := [4][]byte{goregular.TTF, gobold.TTF, goitalic.TTF, gobolditalic.TTF}
+		return files[i], data[i]
+	}
+	files := [4]string{"arial.ttf", "arialbd.ttf", "ariali.ttf", "arialbi.ttf"}
+	data := [4][]byte{goregular.TTF, gobold.TTF, goitalic.TTF, gobolditalic.TTF}
+	return files[i], data[i]
+}
+
+// loadFont 加载字体文件，path 为空时使用 Go Bold，解析结果按路径缓存
+func loadFont(path string) (*opentype.Font, error) {
+	if path == "" {
+		return cachedFont("", func() ([]byte, error) { return gobold.TTF, nil })
+	}
+	return cachedFont(path, func() ([]byte, error) { return os.ReadFile(path) })
+}
+
+// cachedFont 按 key 缓存解析后的字体，第一次使用时调用 read 读取字体数据
+func cachedFont(key string, read func() ([]byte, error)) (*opentype.Font, error) {
+	fontCacheMu.Lock()
+	f, ok := fontCache[key]
+	fontCacheMu.Unlock()
+	if ok {
+		return f, nil
+	}
+	data, err := read()
+	if err != nil {
+		return nil, err
+	}
+	collection, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析字体 %s 失败: %w", key, err)
+	}
+	if f, err = collection.Font(0); err != nil {
+		return nil, err
+	}
+	fontCacheMu.Lock()
+	fontCache[key] = f
+	fontCacheMu.Unlock()
+	return f, nil
+}
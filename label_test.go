@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// 同一标签渲染两次、按相同字段重新生成后再渲染，PDF 都逐字节相同；覆盖内置字体和嵌入的主字体、后备字体
+func TestRenderLabelPdfDeterministic(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config = &Config{}
+
+	dir := t.TempDir()
+	regular, bold := filepath.Join(dir, "goregular.ttf"), filepath.Join(dir, "gobold.ttf")
+	if err := os.WriteFile(regular, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bold, gobold.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	build := func() *Label {
+		labels, err := BuildTagLabel(&ExcelData{
+			ProductName: "Earphone 耳机", ProductColor: "Black", ProductDate: "2024-01-05", ProductNum: "10",
+			NetWeight: "1.8", GrossWeight: "2", BarCode69Type: "401", Gtin: "697901851000", Lot: "L2401",
+			BoxNum: "B0001", DeviceNos: "SN2024000001,SN2024000002",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return labels[0]
+	}
+	fonts := []struct {
+		name     string
+		main     LabelFont
+		fallback []LabelFont
+	}{
+		{"builtin", LabelFont{Family: "Arial", Style: "B"}, nil},
+		{"embedded", LabelFont{Family: "goregular", Path: regular}, []LabelFont{{Family: "gobold", Path: bold}}},
+	}
+	for _, f := range fonts {
+		var rendered [][]byte
+		for _, label := range []*Label{build(), build()} {
+			label.FontFamily, label.FontStyle, label.FontPath = f.main.Family, f.main.Style, f.main.Path
+			label.FallbackFonts = f.fallback
+			for i := 0; i < 2; i++ {
+				data, err := RenderLabelPdf(label)
+				if err != nil {
+					t.Fatalf("%s: %v", f.name, err)
+				}
+				rendered = append(rendered, data)
+			}
+		}
+		for i, data := range rendered[1:] {
+			if !bytes.Equal(data, rendered[0]) {
+				t.Errorf("%s: render %d differs from the first (%s, %s)", f.name, i+2, ContentHash(data), ContentHash(rendered[0]))
+			}
+		}
+	}
+}
+
+// 预览中的多张标签作为一次打印任务: 每页都写入 PdfDir，只记一条打印记录；打印失败时各页都标记失败
+func TestPrintPdfDataOneJob(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	dir := t.TempDir()
+	config = &Config{PdfDir: dir, HistoryDir: filepath.Join(dir, "history"), AdobePath: filepath.Join(dir, "missing.exe")}
+
+	labels := []*Label{{Name: "multi_1", Template: TemplateMulti}, {Name: "multi_2", Template: TemplateMulti}}
+	pdfs := make([][]byte, len(labels))
+	for i := range labels {
+		pdfs[i] = []byte("%PDF-" + labels[i].Name)
+	}
+	if err := PrintPdfData(labels, pdfs); err == nil {
+		t.Fatal("printing without Adobe Reader: want error")
+	}
+	for i, label := range labels {
+		path := filepath.Join(dir, label.Name+".pdf")
+		if data, err := os.ReadFile(path); err != nil || string(data) != string(pdfs[i]) {
+			t.Errorf("page %d: %q, %v", i+1, data, err)
+		}
+		if _, err := os.Stat(path + failedSuffix); err != nil {
+			t.Errorf("page %d: no failure marker: %v", i+1, err)
+		}
+	}
+	jobs, err := LoadPrintJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Pages != len(labels) || len(jobs[0].Hashes) != len(labels) || !jobs[0].Printed || jobs[0].Error == "" {
+		t.Fatalf("jobs %+v, want one failed job with %d pages", jobs, len(labels))
+	}
+	for i, hash := range jobs[0].Hashes {
+		if hash != ContentHash(pdfs[i]) {
+			t.Errorf("page %d hash %s, want %s", i+1, hash, ContentHash(pdfs[i]))
+		}
+	}
+}
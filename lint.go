@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/image/font"
+)
+
+// 检查结果级别
+const (
+	IssueError   = "错误"
+	IssueWarning = "警告"
+)
+
+// 越界和重叠判断的容差(mm)
+const lintTolerance = 0.5
+
+// 检查时渲染预览图的分辨率(像素/mm)
+const lintPxPerMm = 2
+
+// TemplateIssue 模板检查发现的一个问题
+type TemplateIssue struct {
+	Level string
+	// 问题所在的元素，如 "第 2 个元素(text)"，页面或字体问题为空
+	Element string
+	Message string
+}
+
+func (i TemplateIssue) String() string {
+	if i.Element == "" {
+		return fmt.Sprintf("[%s] %s", i.Level, i.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", i.Level, i.Element, i.Message)
+}
+
+// HasLintErrors 检查结果中是否有错误级别的问题
+func HasLintErrors(issues []TemplateIssue) bool {
+	for _, issue := range issues {
+		if issue.Level == IssueError {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleTemplateFields 检查和设计模板时使用的示例数据，包含各内置模板的变量
+func sampleTemplateFields() map[string]string {
+	sample := &ExcelData{
+		ProductName:   "示例产品",
+		ProductColor:  "黑色",
+		ProductDate:   time.Now().Format("2006-01-02"),
+		ProductNum:    "100",
+		NetWeight:     "9.5",
+		GrossWeight:   "10.2",
+		DeviceNos:     "C0001\nD83BDA892614\nD83BDA892615",
+		BoxNum:        "C0001",
+		BarCode69Type: "401-69.png",
+		Gtin:          "6979018510006",
+		Lot:           "L2401",
+		Sscc:          "069790180000000019",
+		FileName:      "示例",
+	}
+	fields := excelDataFields(sample)
+	fields["GS1"] = cartonGs1(sample, sample.Gtin)
+	fields["Itf14"] = tagItf14(sample.Gtin)
+	fields["SSCC"] = sample.Sscc
+	fields["BoxQr"] = sample.DeviceNos
+	if boxQr, err := tagBoxQr(sample, fields); err == nil {
+		fields["BoxQr"] = boxQr
+	}
+	fields["DeviceList"] = "D83BDA892614\nD83BDA892615"
+	fields["DeviceCount"] = "2"
+	fields["DeviceNo"] = "D83BDA892614"
+	fields["DeviceNo1"] = "D83BDA892615"
+	return withBuiltinFields(fields)
+}
+
+// lintSampleFields 按模板用途返回打印时实际提供的变量，引用其他变量的模板会被检查出来
+func lintSampleFields(name string) map[string]string {
+	sample := sampleTemplateFields()
+	var names []string
+	switch name {
+	case TemplateDevice:
+		names = []string{"DeviceNo", "DeviceNo1"}
+	case TemplateMulti:
+		names = []string{"DeviceNos"}
+	default:
+		return sample
+	}
+	fields := map[string]string{}
+	for _, n := range names {
+		fields[n] = sample[n]
+	}
+	return withBuiltinFields(fields)
+}
+
+// LintTemplateFile 加载模板并用示例数据检查，language 为空时按模板的语言；模板无法解析时返回一条错误
+func LintTemplateFile(name, language string) []TemplateIssue {
+	t, err := LoadTemplate(name)
+	if err != nil {
+		return []TemplateIssue{{Level: IssueError, Message: err.Error()}}
+	}
+	fields := lintSampleFields(name)
+	fields["Language"] = language
+	return LintTemplate(t, fields)
+}
+
+// lintBox 元素占据的区域(mm)
+type lintBox struct {
+	name       string
+	x, y, w, h float64
+	// 元素的显示条件，用于判断两个元素是否会同时打印
+	when string
+}
+
+func (b lintBox) overlaps(o lintBox) bool {
+	return b.x+lintTolerance < o.x+o.w && o.x+lintTolerance < b.x+b.w &&
+		b.y+lintTolerance < o.y+o.h && o.y+lintTolerance < b.y+b.h
+}
+
+// contains 判断 o 是否在区域内，允许 lintTolerance 的误差
+func (b lintBox) contains(o lintBox) bool {
+	return o.x >= b.x-lintTolerance && o.y >= b.y-lintTolerance &&
+		o.x+o.w <= b.x+b.w+lintTolerance && o.y+o.h <= b.y+b.h+lintTolerance
+}
+
+// LintTemplate 用示例数据生成并渲染模板，检查越界、重叠(文字按笔画计算)、缺少图片等资源、变量错误和字体缺字
+func LintTemplate(t *LabelTemplate, fields map[string]string) []TemplateIssue {
+	l := &templateLinter{t: t, label: t.newLabel(t.name)}
+	fields = copyFields(fields)
+	fields["Page"] = "1"
+	fields["Pages"] = "1"
+	fields["QrPart"] = "1"
+	fields["QrParts"] = "1"
+
+	if t.Font == chineseFont && l.label.FontPath == "" {
+		l.add(IssueError, "", "找不到中文字体(系统字体或 "+bundledChineseFont+")，中文无法打印")
+	}
+	if isFontFile(t.Font) {
+		if _, err := loadFont(t.Font); err != nil {
+			l.add(IssueError, "", "无法加载字体文件: "+err.Error())
+		}
+	}
+
+	language := t.language(fields)
+	captioned, err := t.withCaptions(fields, nil)
+	if err != nil {
+		l.add(IssueError, "", err.Error())
+		return l.issues
+	}
+	fields = captioned
+	l.checkCaptions(language)
+
+	var boxes []lintBox
+	for i := range t.Elements {
+		name := fmt.Sprintf("第 %d 个元素(%s)", i+1, t.Elements[i].Type)
+		if box, ok := l.element(name, &t.Elements[i], fields, 0, 0); ok {
+			boxes = append(boxes, box)
+		}
+	}
+	for i := range t.Repeats {
+		r := &t.Repeats[i]
+		name := fmt.Sprintf("第 %d 个重复区域", i+1)
+		region := lintBox{name: name, x: r.X, y: r.Y, w: r.W, h: r.H}
+		l.checkPage(region)
+		boxes = append(boxes, region)
+		if _, err := evalCondition(r.When, fields); err != nil {
+			l.add(IssueError, name, err.Error())
+		}
+		if _, err := expandFields(r.Items, fields); err != nil {
+			l.add(IssueError, name, err.Error())
+		}
+
+		// 按最长的序号检查第一格和最后一格，每个元素应在所在格子内
+		capacity := r.capacity()
+		itemFields := copyFields(fields)
+		itemFields["Item"] = "D83BDA892614"
+		itemFields["Index"] = strconv.Itoa(capacity)
+		for j := range r.Elements {
+			elementName := fmt.Sprintf("%s第 %d 个元素(%s)", name, j+1, r.Elements[j].Type)
+			for _, index := range []int{0, capacity - 1} {
+				x, y := r.cell(index)
+				cell := lintBox{x: x, y: y, w: r.W / float64(r.columns()), h: r.RowHeight}
+				if box, ok := l.element(elementName, &r.Elements[j], itemFields, x, y); ok && !cell.contains(box) {
+					l.add(IssueWarning, elementName, fmt.Sprintf("超出格子(%s×%s mm)，会与相邻的项重叠", formatMm(cell.w), formatMm(cell.h)))
+					break
+				}
+			}
+		}
+	}
+
+	for i := range boxes {
+		for j := i + 1; j < len(boxes); j++ {
+			if boxes[i].overlaps(boxes[j]) && !exclusiveConditions(boxes[i].when, boxes[j].when) {
+				l.add(IssueWarning, boxes[i].name, "与"+boxes[j].name+"重叠")
+			}
+		}
+	}
+
+	// 元素都没有问题时按打印流程完整渲染一遍，确认 PDF 和预览都能生成
+	if !HasLintErrors(l.issues) {
+		labels, err := lintAssetTemplate(t).Build(t.name, fields)
+		if err != nil {
+			l.add(IssueError, "", err.Error())
+		}
+		for _, label := range labels {
+			if err := label.verifyBarcodes(); err != nil {
+				l.add(IssueError, "", err.Error())
+			}
+			if _, err := RenderLabelPdf(label); err != nil {
+				l.add(IssueError, "", "生成 PDF 失败: "+err.Error())
+			}
+			if _, err := RenderLabelImage(label, lintPxPerMm); err != nil {
+				l.add(IssueError, "", "生成预览图失败: "+err.Error())
+			}
+			l.checkPrintQuality(label)
+		}
+	}
+	return l.issues
+}
+
+// captionPattern 匹配模板中引用的标题变量 T.xxx
+var captionPattern = regexp.MustCompile(`\b` + regexp.QuoteMeta(captionPrefix) + `(\w+)`)
+
+// checkCaptions 检查模板引用的标题在各语言的标题表中是否都有翻译
+func (l *templateLinter) checkCaptions(language string) {
+	var texts []string
+	for _, e := range l.t.Elements {
+		texts = append(texts, e.Value, e.When)
+	}
+	for _, r := range l.t.Repeats {
+		for _, e := range r.Elements {
+			texts = append(texts, e.Value, e.When)
+		}
+	}
+	seen := map[string]bool{}
+	for _, lang := range splitLanguages(language) {
+		catalog, err := LoadCatalog(lang)
+		if err != nil || lang == defaultLanguage {
+			continue
+		}
+		for _, text := range texts {
+			for _, match := range captionPattern.FindAllStringSubmatch(text, -1) {
+				key := match[1]
+				if _, ok := catalog[key]; !ok && !seen[lang+key] {
+					seen[lang+key] = true
+					l.add(IssueWarning, "", fmt.Sprintf("标题 %s%s 没有 %s 翻译，将使用中文", captionPrefix, key, lang))
+				}
+			}
+		}
+	}
+}
+
+// templateLinter 收集检查结果
+type templateLinter struct {
+	t      *LabelTemplate
+	label  *Label
+	issues []TemplateIssue
+}
+
+func (l *templateLinter) add(level, element, message string) {
+	l.issues = append(l.issues, TemplateIssue{Level: level, Element: element, Message: message})
+}
+
+// element 生成单个元素并检查，when 条件不成立的元素同样检查；返回元素占据的区域
+func (l *templateLinter) element(name string, e *TemplateElement, fields map[string]string, dx, dy float64) (lintBox, bool) {
+	if _, err := evalCondition(e.When, fields); err != nil {
+		l.add(IssueError, name, err.Error())
+	}
+	always := *e
+	always.When = ""
+	if e.Type == TemplateImage {
+		value, err := lintAssetValue(e.Value)
+		if err != nil {
+			l.add(IssueError, name, err.Error())
+			return lintBox{}, false
+		}
+		always.Value = value
+	}
+	scratch := *l.label
+	scratch.Elements = nil
+	if err := always.build(&scratch, fields, dx, dy); err != nil {
+		l.add(IssueError, name, err.Error())
+		return lintBox{}, false
+	}
+
+	box := lintBox{name: name, when: e.When, x: math.Inf(1), y: math.Inf(1), w: math.Inf(-1), h: math.Inf(-1)}
+	found := false
+	for i := range scratch.Elements {
+		x0, y0, x1, y1, ok, err := l.bounds(name, &scratch.Elements[i])
+		if err != nil {
+			l.add(IssueError, name, err.Error())
+			return lintBox{}, false
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		// 先记录右下角坐标，最后换算为宽高
+		box.x, box.y = math.Min(box.x, x0), math.Min(box.y, y0)
+		box.w, box.h = math.Max(box.w, x1), math.Max(box.h, y1)
+	}
+	if !found {
+		return lintBox{}, false
+	}
+	box.w -= box.x
+	box.h -= box.y
+	l.checkPage(box)
+	return box, true
+}
+
+// bounds 返回标签元素左上角和右下角坐标，文字按实际笔画计算；文字还检查缺字和放不下被截断的情况
+func (l *templateLinter) bounds(name string, e *LabelElement) (x0, y0, x1, y1 float64, ok bool, err error) {
+	if e.Kind != ElementText {
+		l.checkResolution(name, e)
+		return e.X, e.Y, e.X + e.W, e.Y + e.H, e.W > 0 && e.H > 0, nil
+	}
+	if missing := missingGlyphs(l.label, e.Text); missing != "" {
+		l.add(IssueError, name, fmt.Sprintf("字体 %s 缺少字形: %s", fontNames(l.label), missing))
+	}
+	lines, err := layoutText(l.label, e)
+	if err != nil {
+		return 0, 0, 0, 0, false, err
+	}
+	truncated := e.IsTextBox() && strings.Join(strings.Fields(joinLines(lines)), "") != strings.Join(strings.Fields(e.Text), "")
+	if truncated {
+		l.add(IssueWarning, name, fmt.Sprintf("示例内容 %q 在框内放不下，已被截断", e.Text))
+	}
+
+	x0, y0, x1, y1 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	m := &textMeasurer{label: l.label}
+	for _, line := range lines {
+		x := line.X
+		for _, run := range l.label.textRuns(line.Text) {
+			// 每毫米 1 像素，测量结果即为毫米
+			face, err := fontFace(run.Font, line.FontSize, 1)
+			if err != nil {
+				return 0, 0, 0, 0, false, err
+			}
+			ink, _ := font.BoundString(face, run.Text)
+			if !ink.Empty() {
+				ok = true
+				x0 = math.Min(x0, x+float64(ink.Min.X)/64)
+				y0 = math.Min(y0, line.Y+float64(ink.Min.Y)/64)
+				x1 = math.Max(x1, x+float64(ink.Max.X)/64)
+				y1 = math.Max(y1, line.Y+float64(ink.Max.Y)/64)
+			}
+			w, err := m.runWidth(run, line.FontSize)
+			if err != nil {
+				return 0, 0, 0, 0, false, err
+			}
+			x += w
+		}
+	}
+	frame := lintBox{x: e.X, y: e.Y, w: e.W, h: e.H}
+	if frame.h <= 0 {
+		frame.h = math.Inf(1)
+	}
+	if ok && e.IsTextBox() && !truncated && !frame.contains(lintBox{x: x0, y: y0, w: x1 - x0, h: y1 - y0}) {
+		l.add(IssueWarning, name, fmt.Sprintf("示例内容 %q 超出文字框，可设置 wrap、minFontSize 或 ellipsis", e.Text))
+	}
+	return x0, y0, x1, y1, ok, nil
+}
+
+// exclusiveConditions 判断两个条件是否互斥，如 Gtin 与 !Gtin，互斥的元素不会同时打印
+func exclusiveConditions(a, b string) bool {
+	negated := func(cond string) (string, bool) {
+		cond = strings.TrimSpace(cond)
+		if strings.HasPrefix(cond, "!") {
+			return strings.TrimSpace(cond[1:]), true
+		}
+		if strings.HasPrefix(cond, "not ") {
+			return strings.TrimSpace(cond[4:]), true
+		}
+		return cond, false
+	}
+	condA, notA := negated(a)
+	condB, notB := negated(b)
+	return condA != "" && condA == condB && notA != notB
+}
+
+// lintAssetValue 素材名含变量时示例数据不一定有对应素材，换成第一个可能用到的素材检查；其余图片原样返回
+func lintAssetValue(value string) (string, error) {
+	asset := strings.TrimPrefix(value, assetPrefix)
+	if asset == value || !fieldPattern.MatchString(asset) {
+		return value, nil
+	}
+	pattern := fieldPattern.ReplaceAllString(asset, "*")
+	matched, err := matchAssets(pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(matched) == 0 {
+		return "", fmt.Errorf("素材库中没有匹配 %s 的素材", pattern)
+	}
+	return assetPrefix + matched[0].Name, nil
+}
+
+// lintAssetTemplate 返回素材名已按 lintAssetValue 替换的模板副本，用于完整渲染
+func lintAssetTemplate(t *LabelTemplate) *LabelTemplate {
+	resolve := func(elements []TemplateElement) []TemplateElement {
+		resolved := make([]TemplateElement, len(elements))
+		for i, e := range elements {
+			if e.Type == TemplateImage {
+				if value, err := lintAssetValue(e.Value); err == nil {
+					e.Value = value
+				}
+			}
+			resolved[i] = e
+		}
+		return resolved
+	}
+	copied := *t
+	copied.Elements = resolve(t.Elements)
+	copied.Repeats = make([]TemplateRepeat, len(t.Repeats))
+	for i, r := range t.Repeats {
+		r.Elements = resolve(r.Elements)
+		copied.Repeats[i] = r
+	}
+	return &copied
+}
+
+// checkPrintQuality 按打印机分辨率分析条码和二维码，低于规范时给出警告；模板没有写 printWidth 时无法换算实际尺寸，不分析
+func (l *templateLinter) checkPrintQuality(label *Label) {
+	if l.t.PrintWidth <= 0 {
+		return
+	}
+	dpi := printerDpi()
+	qualities, err := AnalyzeLabelQuality(label, dpi)
+	if err != nil {
+		l.add(IssueError, "", "打印质量分析失败: "+err.Error())
+		return
+	}
+	for _, q := range qualities {
+		name := fmt.Sprintf("%s 条码 %s", q.Symbology, q.Content())
+		for _, warning := range q.Warnings {
+			l.add(IssueWarning, name, fmt.Sprintf("按 %d dpi 打印估计等级 %s: %s", dpi, q.Grade, warning))
+		}
+	}
+}
+
+// checkResolution 检查位图素材按实际打印尺寸换算的分辨率
+func (l *templateLinter) checkResolution(name string, e *LabelElement) {
+	if !strings.HasPrefix(e.ImageName, assetPrefix) || e.ImageType == "svg" || e.W <= 0 {
+		return
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(e.ImageData))
+	if err != nil {
+		return
+	}
+	dpi := float64(cfg.Width) / (e.W * l.label.printScale() / 25.4)
+	if dpi >= minAssetDpi {
+		return
+	}
+	message := fmt.Sprintf("素材 %s 打印分辨率只有 %.0f dpi，可能模糊，建议使用 SVG 或更高分辨率的图片", strings.TrimPrefix(e.ImageName, assetPrefix), dpi)
+	if l.t.PrintWidth <= 0 {
+		message += "(模板未设置 printWidth，按页面尺寸计算)"
+	}
+	l.add(IssueWarning, name, message)
+}
+
+// checkPage 检查区域是否超出页面
+func (l *templateLinter) checkPage(box lintBox) {
+	if !(lintBox{w: l.t.Width, h: l.t.Height}).contains(box) {
+		l.add(IssueError, box.name, fmt.Sprintf("超出页面: 位置 (%s, %s) 大小 %s×%s mm，页面 %s×%s mm",
+			formatMm(box.x), formatMm(box.y), formatMm(box.w), formatMm(box.h), formatMm(l.t.Width), formatMm(l.t.Height)))
+	}
+}
+
+func joinLines(lines []textLine) string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	return strings.Join(texts, "")
+}
+
+// missingGlyphs 返回主字体和后备字体中都没有的字符(去重)；PDF 内置字体只能显示 ASCII 字符
+func missingGlyphs(l *Label, text string) string {
+	seen := map[rune]bool{}
+	var missing []rune
+	for _, r := range text {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || seen[r] {
+			continue
+		}
+		seen[r] = true
+		if !l.covers(r) {
+			missing = append(missing, r)
+		}
+	}
+	return string(missing)
+}
+
+// fontNames 返回标签使用的字体名称，多个字体用 "+" 连接
+func fontNames(l *Label) string {
+	var names []string
+	for _, f := range l.fonts() {
+		names = append(names, f.Family)
+	}
+	return strings.Join(names, "+")
+}
+
+// lintTemplates 按语言检查指定的模板，names 为空时检查全部模板，返回错误和警告的个数
+func lintTemplates(names []string, language string, logf func(string)) (errors, warnings int) {
+	if len(names) == 0 {
+		names = TemplateNames()
+	}
+	for _, name := range names {
+		issues := LintTemplateFile(name, language)
+		if len(issues) == 0 {
+			logf(fmt.Sprintf("✓ 模板 %s 没有发现问题", name))
+			continue
+		}
+		logf(fmt.Sprintf("模板 %s 发现 %d 个问题:", name, len(issues)))
+		for _, issue := range issues {
+			if issue.Level == IssueError {
+				errors++
+			} else {
+				warnings++
+			}
+			logf("  " + issue.String())
+		}
+	}
+	return errors, warnings
+}
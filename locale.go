@@ -0,0 +1,186 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// 默认语言，其他语言缺少的标题也使用该语言
+const defaultLanguage = "zh"
+
+// 模板中引用标题的变量前缀，如 {{T.ProductName}}
+const captionPrefix = "T."
+
+// 双语标签中各语言标题之间的分隔符，如 "产品名称 / Product Name"
+const captionSeparator = " / "
+
+// defaultLocales 随程序分发的标题表，localeDir 中的同名文件按条目覆盖
+//
+//go:embed locales/*.toml
+var defaultLocales embed.FS
+
+// localeDir 用户标题表目录，默认 ./locales
+func localeDir() string {
+	if config != nil && config.LocaleDir != "" {
+		return config.LocaleDir
+	}
+	return "./locales"
+}
+
+// LoadCatalog 读取一种语言的标题表，键为标题名，内置表与 localeDir 中的同名文件合并
+func LoadCatalog(language string) (map[string]string, error) {
+	catalog := map[string]string{}
+	found := false
+	file := language + ".toml"
+	if data, err := defaultLocales.ReadFile("locales/" + file); err == nil {
+		if _, err := toml.Decode(string(data), &catalog); err != nil {
+			return nil, fmt.Errorf("解析内置标题表 %s 失败: %w", file, err)
+		}
+		found = true
+	}
+	if data, err := os.ReadFile(filepath.Join(localeDir(), file)); err == nil {
+		user := map[string]string{}
+		if _, err := toml.Decode(string(data), &user); err != nil {
+			return nil, fmt.Errorf("解析标题表 %s 失败: %w", file, err)
+		}
+		for key, value := range user {
+			catalog[key] = value
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("没有语言 %s 的标题表", language)
+	}
+	return catalog, nil
+}
+
+// LanguageNames 返回所有有标题表的语言，包括内置和 localeDir 中的
+func LanguageNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(file string) {
+		if name := strings.TrimSuffix(file, ".toml"); strings.HasSuffix(file, ".toml") && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if entries, err := defaultLocales.ReadDir("locales"); err == nil {
+		for _, entry := range entries {
+			add(entry.Name())
+		}
+	}
+	if entries, err := os.ReadDir(localeDir()); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				add(entry.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LanguageOptions 返回界面中可选的语言: 各单一语言，以及中文与其他语言的双语组合
+func LanguageOptions() []string {
+	names := LanguageNames()
+	options := append([]string{}, names...)
+	for _, name := range names {
+		if name != defaultLanguage {
+			options = append(options, defaultLanguage+"+"+name)
+		}
+	}
+	return options
+}
+
+// splitLanguages 拆分语言设置，"zh+en" 表示中英双语
+func splitLanguages(language string) []string {
+	var languages []string
+	for _, part := range strings.Split(language, "+") {
+		if part = strings.TrimSpace(part); part != "" {
+			languages = append(languages, part)
+		}
+	}
+	return languages
+}
+
+// captionFields 返回语言对应的标题变量(T.键名)，双语时按顺序用 " / " 连接；某种语言缺少的标题使用中文，读取的标题表记入 res(可为 nil)
+func captionFields(language string, res *labelResources) (map[string]string, error) {
+	languages := splitLanguages(language)
+	if len(languages) == 0 {
+		languages = []string{defaultLanguage}
+	}
+	fallback, err := res.catalog(defaultLanguage)
+	if err != nil {
+		return nil, err
+	}
+	catalogs := make([]map[string]string, len(languages))
+	keys := map[string]bool{}
+	for i, lang := range languages {
+		if catalogs[i], err = res.catalog(lang); err != nil {
+			return nil, err
+		}
+		for key := range catalogs[i] {
+			keys[key] = true
+		}
+	}
+	for key := range fallback {
+		keys[key] = true
+	}
+
+	fields := map[string]string{}
+	for key := range keys {
+		var parts []string
+		for _, catalog := range catalogs {
+			value, ok := catalog[key]
+			if !ok {
+				value = fallback[key]
+			}
+			// 缺少翻译时两种语言可能相同，只保留一个
+			if len(parts) == 0 || parts[len(parts)-1] != value {
+				parts = append(parts, value)
+			}
+		}
+		fields[captionPrefix+key] = strings.Join(parts, captionSeparator)
+	}
+	return fields, nil
+}
+
+// language 返回生成标签使用的语言: 字段 Language(按单据) > 模板 language > 配置 language > 中文
+func (t *LabelTemplate) language(fields map[string]string) string {
+	if lang := strings.TrimSpace(fields["Language"]); lang != "" {
+		return lang
+	}
+	if t.Language != "" {
+		return t.Language
+	}
+	if config != nil && config.Language != "" {
+		return config.Language
+	}
+	return defaultLanguage
+}
+
+// withCaptions 加入标签语言对应的标题变量，读取的标题表记入 res(可为 nil)；从快照生成时按快照的语言
+func (t *LabelTemplate) withCaptions(fields map[string]string, res *labelResources) (map[string]string, error) {
+	language := t.language(fields)
+	if res != nil && res.frozen && res.snapshot.Language != "" && strings.TrimSpace(fields["Language"]) == "" {
+		language = res.snapshot.Language
+	}
+	if res != nil && !res.frozen {
+		res.snapshot.Language = language
+	}
+	captions, err := captionFields(language, res)
+	if err != nil {
+		return nil, fmt.Errorf("模板 %s: %w", t.name, err)
+	}
+	result := copyFields(fields)
+	for name, value := range captions {
+		result[name] = value
+	}
+	return result, nil
+}
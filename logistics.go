@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/twooffive"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// ITF-14 宽度(窄条模块): 两侧空白各 10，保护框(bearer bar)粗 5
+const (
+	itf14Quiet  = 10
+	itf14Bearer = 5
+)
+
+// SSCC 序列号分配记录文件，位于打印记录目录
+const ssccStateFile = "sscc.json"
+
+// Gs1Config GS1 厂商识别代码及物流条码配置
+type Gs1Config struct {
+	// 厂商识别代码(GS1 公司前缀)，7~10 位数字
+	CompanyPrefix string
+	// SSCC 扩展位 0~9，由企业自行分配，如按仓库区分
+	ExtensionDigit int `toml:"extensionDigit,omitzero"`
+	// 外箱 ITF-14 的包装指示符 1~8，0 表示使用 1
+	CartonIndicator int `toml:"cartonIndicator,omitzero"`
+}
+
+var ssccMu sync.Mutex
+
+// normalizeCheckDigits 校验带 GS1 校验位的数字编码: 少一位时补上校验位，位数相同时检查校验位；可以包含空格和 -
+func normalizeCheckDigits(value, title string, length int) (string, error) {
+	code := strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(value))
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%s %s 只能包含数字", title, value)
+		}
+	}
+	switch len(code) {
+	case length - 1:
+		return code + string(gs1CheckDigit(code)), nil
+	case length:
+		if check := gs1CheckDigit(code[:length-1]); code[length-1] != check {
+			return "", fmt.Errorf("%s %s 校验位错误，最后一位应为 %c", title, value, check)
+		}
+		return code, nil
+	}
+	return "", fmt.Errorf("%s %s 应为 %d 位(不含校验位)或 %d 位数字", title, value, length-1, length)
+}
+
+// NormalizeItf14 校验外箱 GTIN-14，13 位时补上校验位
+func NormalizeItf14(value string) (string, error) {
+	return normalizeCheckDigits(value, "ITF-14", 14)
+}
+
+// NormalizeSscc 校验 SSCC-18，17 位时补上校验位
+func NormalizeSscc(value string) (string, error) {
+	return normalizeCheckDigits(value, "SSCC", 18)
+}
+
+// CartonGtin14 按商品条码生成外箱 GTIN-14: 包装指示符 + EAN-13 前 12 位 + 校验位
+func CartonGtin14(gtin string, indicator int) (string, error) {
+	gtin, err := NormalizeGtin(gtin)
+	if err != nil {
+		return "", err
+	}
+	if indicator == 0 {
+		indicator = 1
+	}
+	if indicator < 1 || indicator > 8 {
+		return "", fmt.Errorf("包装指示符应为 1~8，当前为 %d", indicator)
+	}
+	return NormalizeItf14(fmt.Sprintf("%d%s", indicator, gtin[:12]))
+}
+
+// tagItf14 返回产品标签的外箱 GTIN-14，没有商品条码时为空
+func tagItf14(gtin string) string {
+	indicator := 0
+	if config != nil {
+		indicator = config.Gs1.CartonIndicator
+	}
+	itf14, err := CartonGtin14(gtin, indicator)
+	if err != nil {
+		return ""
+	}
+	return itf14
+}
+
+// encodeItf14 生成 ITF-14(交叉二五码，宽窄比 3:1)
+func encodeItf14(content string) (barcode.Barcode, error) {
+	itf14, err := NormalizeItf14(content)
+	if err != nil {
+		return nil, err
+	}
+	return twooffive.Encode(itf14, true)
+}
+
+// itf14Png 生成 ITF-14 png 数据: 两侧各留 10 个模块空白，四周加保护框，下方印数字；
+// width 为 0 时每个模块 4 像素，ratio 为高宽比
+func itf14Png(content string, width int, ratio float64) ([]byte, error) {
+	code, err := encodeItf14(content)
+	if err != nil {
+		return nil, err
+	}
+	modules := code.Bounds().Dx() + 2*(itf14Quiet+itf14Bearer)
+	module := 4
+	if width > 0 {
+		module = width / modules
+		if module < 1 {
+			module = 1
+		}
+	}
+	width = module * modules
+	height := int(float64(width)*ratio + 0.5)
+
+	text := code.Content()
+	face, err := barcodeTextFace(float64(height)/6, text, width)
+	if err != nil {
+		return nil, err
+	}
+	metrics := face.Metrics()
+	frameHeight := height - (metrics.Ascent + metrics.Descent).Ceil()
+	bearer := itf14Bearer * module
+	if frameHeight <= 3*bearer {
+		return nil, fmt.Errorf("ITF-14 高度不足，请增大元素高度")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, width, frameHeight), image.Black, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(bearer, bearer, width-bearer, frameHeight-bearer), image.White, image.Point{}, draw.Src)
+	for x := 0; x < code.Bounds().Dx(); x++ {
+		if r, _, _, _ := code.At(x, 0).RGBA(); r == 0 {
+			left := (itf14Bearer + itf14Quiet + x) * module
+			draw.Draw(img, image.Rect(left, bearer, left+module, frameHeight-bearer), image.Black, image.Point{}, draw.Src)
+		}
+	}
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(color.Black), Face: face}
+	drawer.Dot = fixed.Point26_6{X: (fixed.I(width) - font.MeasureString(face, text)) / 2, Y: fixed.I(height) - metrics.Descent}
+	drawer.DrawString(text)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ssccPrefix 返回 SSCC 的扩展位和厂商识别代码，以及序列号的位数
+func (c Gs1Config) ssccPrefix() (string, int, error) {
+	prefix := strings.TrimSpace(c.CompanyPrefix)
+	if prefix == "" {
+		return "", 0, fmt.Errorf("未配置厂商识别代码，请在 config.toml 的 [gs1] 中填写 companyPrefix")
+	}
+	for _, r := range prefix {
+		if r < '0' || r > '9' {
+			return "", 0, fmt.Errorf("厂商识别代码 %s 只能包含数字", prefix)
+		}
+	}
+	if len(prefix) < 7 || len(prefix) > 10 {
+		return "", 0, fmt.Errorf("厂商识别代码 %s 应为 7~10 位", prefix)
+	}
+	if c.ExtensionDigit < 0 || c.ExtensionDigit > 9 {
+		return "", 0, fmt.Errorf("SSCC 扩展位应为 0~9，当前为 %d", c.ExtensionDigit)
+	}
+	return fmt.Sprintf("%d%s", c.ExtensionDigit, prefix), 16 - len(prefix), nil
+}
+
+// AllocateSscc 按配置的扩展位和厂商识别代码分配 count 个连续的 SSCC，已分配的序列号记录在 history/sscc.json，
+// 不会重复使用；序列号用完时返回错误
+func AllocateSscc(count int) ([]string, error) {
+	ssccMu.Lock()
+	defer ssccMu.Unlock()
+	if config == nil || count < 1 {
+		return nil, fmt.Errorf("无法分配 SSCC")
+	}
+	prefix, digits, err := config.Gs1.ssccPrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(historyDir(), ssccStateFile)
+	state := map[string]int64{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("读取 SSCC 分配记录失败: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	limit := int64(1)
+	for i := 0; i < digits; i++ {
+		limit *= 10
+	}
+	last := state[prefix]
+	if last+int64(count) >= limit {
+		return nil, fmt.Errorf("厂商识别代码 %s 的 SSCC 序列号已用完(共 %d 位)", prefix[1:], digits)
+	}
+	codes := make([]string, count)
+	for i := range codes {
+		body := fmt.Sprintf("%s%0*d", prefix, digits, last+int64(i)+1)
+		codes[i] = body + string(gs1CheckDigit(body))
+	}
+	state[prefix] = last + int64(count)
+
+	// 先写临时文件再替换，避免中途失败损坏记录导致序列号重复
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(historyDir(), 0755); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// assignTagSscc 打印前为引用 SSCC 的模板分配 SSCC，单据中已填写时不分配；预览和导出不分配
+func assignTagSscc(excelData *ExcelData) error {
+	if excelData.Sscc != "" {
+		return nil
+	}
+	t, err := LoadTemplate(SelectTagTemplate(excelData))
+	if err != nil {
+		return err
+	}
+	if !t.usesField("SSCC") {
+		return nil
+	}
+	codes, err := AllocateSscc(1)
+	if err != nil {
+		return err
+	}
+	excelData.Sscc = codes[0]
+	fmt.Println("箱号[", excelData.BoxNum, "]分配 SSCC:", excelData.Sscc)
+	return nil
+}
+
+// usesField 判断模板的元素内容或显示条件是否引用了变量 name
+func (t *LabelTemplate) usesField(name string) bool {
+	pattern := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+	for _, r := range t.Repeats {
+		if pattern.MatchString(r.When) {
+			return true
+		}
+	}
+	for _, e := range t.allElements() {
+		if pattern.MatchString(e.Value) || pattern.MatchString(e.When) {
+			return true
+		}
+	}
+	return false
+}
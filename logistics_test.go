@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 校验位按 GS1 通用规范中的示例编码核对
+func TestNormalizeCheckDigits(t *testing.T) {
+	tests := []struct {
+		name  string
+		f     func(string) (string, error)
+		value string
+		want  string
+		err   string
+	}{
+		{"sscc append", NormalizeSscc, "10614141123456789", "106141411234567897", ""},
+		{"sscc valid", NormalizeSscc, "106141411234567897", "106141411234567897", ""},
+		{"sscc separators", NormalizeSscc, " 1 0614141-123456789 7 ", "106141411234567897", ""},
+		{"sscc check digit", NormalizeSscc, "106141411234567890", "", "最后一位应为 7"},
+		{"sscc length", NormalizeSscc, "1061414112345678", "", "17 位"},
+		{"sscc letters", NormalizeSscc, "10614141A23456789", "", "只能包含数字"},
+		{"sscc config", NormalizeSscc, "06979018123456789", "069790181234567897", ""},
+		{"itf14 append", NormalizeItf14, "1001234567890", "10012345678902", ""},
+		{"itf14 valid", NormalizeItf14, "00012345678905", "00012345678905", ""},
+		{"itf14 check digit", NormalizeItf14, "10012345678903", "", "最后一位应为 2"},
+	}
+	for _, tt := range tests {
+		got, err := tt.f(tt.value)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestCartonGtin14(t *testing.T) {
+	tests := []struct {
+		gtin      string
+		indicator int
+		want      string
+		err       string
+	}{
+		{"0012345678905", 1, "10012345678902", ""},
+		{"0012345678905", 0, "10012345678902", ""},
+		{"001234567890", 1, "10012345678902", ""},
+		{"0012345678905", 9, "", "1~8"},
+		{"0012345678900", 1, "", "校验位"},
+	}
+	for _, tt := range tests {
+		got, err := CartonGtin14(tt.gtin, tt.indicator)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("CartonGtin14(%s, %d) error = %v, want containing %q", tt.gtin, tt.indicator, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("CartonGtin14(%s, %d) = %q, %v, want %q", tt.gtin, tt.indicator, got, err, tt.want)
+		}
+	}
+}
+
+// 厂商识别代码越长，序列号位数越少，合起来总是 17 位
+func TestSsccPrefix(t *testing.T) {
+	tests := []struct {
+		c      Gs1Config
+		prefix string
+		digits int
+		err    string
+	}{
+		{Gs1Config{CompanyPrefix: "0614141", ExtensionDigit: 1}, "10614141", 9, ""},
+		{Gs1Config{CompanyPrefix: "69790181"}, "069790181", 8, ""},
+		{Gs1Config{CompanyPrefix: "697901812"}, "0697901812", 7, ""},
+		{Gs1Config{CompanyPrefix: "6979018123", ExtensionDigit: 9}, "96979018123", 6, ""},
+		{Gs1Config{}, "", 0, "未配置厂商识别代码"},
+		{Gs1Config{CompanyPrefix: "697901"}, "", 0, "7~10 位"},
+		{Gs1Config{CompanyPrefix: "69790181234"}, "", 0, "7~10 位"},
+		{Gs1Config{CompanyPrefix: "6979O181"}, "", 0, "只能包含数字"},
+		{Gs1Config{CompanyPrefix: "69790181", ExtensionDigit: 10}, "", 0, "扩展位"},
+	}
+	for _, tt := range tests {
+		prefix, digits, err := tt.c.ssccPrefix()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%+v: error = %v, want containing %q", tt.c, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || prefix != tt.prefix || digits != tt.digits || len(prefix)+digits != 17 {
+			t.Errorf("%+v: %q, %d, %v, want %q, %d", tt.c, prefix, digits, err, tt.prefix, tt.digits)
+		}
+	}
+}
+
+// 分配记录写入 history/sscc.json，重新读取后继续递增，不同厂商识别代码分别计数
+func TestAllocateSscc(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	dir := t.TempDir()
+	config = &Config{HistoryDir: dir, Gs1: Gs1Config{CompanyPrefix: "0614141", ExtensionDigit: 1}}
+
+	codes, err := AllocateSscc(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"106141410000000019", "106141410000000026"}; strings.Join(codes, ",") != strings.Join(want, ",") {
+		t.Errorf("first allocation %v, want %v", codes, want)
+	}
+	codes, err = AllocateSscc(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes[0] != "106141410000000033" {
+		t.Errorf("second allocation %v, want 106141410000000033", codes)
+	}
+	for _, code := range codes {
+		if _, err := NormalizeSscc(code); err != nil {
+			t.Errorf("allocated %s: %v", code, err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ssccStateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"10614141": 3`) {
+		t.Errorf("%s = %s, want last serial 3", ssccStateFile, data)
+	}
+
+	// 另一个厂商识别代码从 1 开始，不影响原来的计数
+	config.Gs1 = Gs1Config{CompanyPrefix: "69790181"}
+	if codes, err = AllocateSscc(1); err != nil || codes[0] != "069790181000000016" {
+		t.Errorf("other prefix %v, %v, want 069790181000000016", codes, err)
+	}
+	config.Gs1 = Gs1Config{CompanyPrefix: "0614141", ExtensionDigit: 1}
+	if codes, err = AllocateSscc(1); err != nil || codes[0] != "106141410000000040" {
+		t.Errorf("after reload %v, %v, want 106141410000000040", codes, err)
+	}
+}
+
+// 10 位厂商识别代码只剩 6 位序列号，用完后报错且不改动记录
+func TestAllocateSsccExhausted(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	dir := t.TempDir()
+	config = &Config{HistoryDir: dir, Gs1: Gs1Config{CompanyPrefix: "6979018123"}}
+	path := filepath.Join(dir, ssccStateFile)
+	if err := os.WriteFile(path, []byte(`{"06979018123": 999997}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AllocateSscc(3); err == nil || !strings.Contains(err.Error(), "已用完") {
+		t.Errorf("allocating past the range: error = %v, want exhausted", err)
+	}
+	codes, err := AllocateSscc(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("06979018123%06d", 999999); !strings.HasPrefix(codes[1], want) {
+		t.Errorf("last serial %s, want prefix %s", codes[1], want)
+	}
+	if _, err := AllocateSscc(1); err == nil || !strings.Contains(err.Error(), "已用完") {
+		t.Errorf("allocating after the last serial: error = %v, want exhausted", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"06979018123": 999999`) {
+		t.Errorf("%s = %s, want last serial 999999", ssccStateFile, data)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AllocateSscc(1); err == nil || !strings.Contains(err.Error(), "读取 SSCC 分配记录失败") {
+		t.Errorf("corrupt state: error = %v, want read failure", err)
+	}
+}
+
+// 逐像素检查 ITF-14 的保护框和两侧 10 个模块的空白
+func TestItf14PngRaster(t *testing.T) {
+	const module = 4
+	data, err := itf14Png("1001234567890", 0, 0.3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, err := decodeBarcodePng("itf14", data); err != nil || text != "10012345678902" {
+		t.Errorf("decoded %q, %v, want 10012345678902", text, err)
+	}
+	g, err := decodePngImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := g.img.Bounds()
+	width := bounds.Dx()
+	code, err := encodeItf14("10012345678902")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (code.Bounds().Dx() + 2*(itf14Quiet+itf14Bearer)) * module; width != want {
+		t.Fatalf("width %d, want %d", width, want)
+	}
+	bearer := itf14Bearer * module
+	quiet := itf14Quiet * module
+	frameBottom := 0
+	for y := 0; y < bounds.Dy(); y++ {
+		if g.dark(width/2, y) && g.dark(0, y) {
+			frameBottom = y + 1
+		}
+	}
+	if frameBottom <= 3*bearer {
+		t.Fatalf("frame height %d, want more than %d", frameBottom, 3*bearer)
+	}
+
+	// 上下保护框横贯全宽
+	for _, y := range []int{0, bearer - 1, frameBottom - bearer, frameBottom - 1} {
+		for x := 0; x < width; x++ {
+			if !g.dark(x, y) {
+				t.Fatalf("bearer bar row %d is light at x = %d", y, x)
+			}
+		}
+	}
+	// 中间一行: 左右保护框、10 个模块的空白，然后是起始符的窄条和终止符的窄条
+	y := frameBottom / 2
+	for x := 0; x < width; x++ {
+		var dark bool
+		switch {
+		case x < bearer || x >= width-bearer:
+			dark = true
+		case x < bearer+quiet || x >= width-bearer-quiet:
+			dark = false
+		default:
+			continue
+		}
+		if g.dark(x, y) != dark {
+			t.Fatalf("row %d at x = %d: dark = %v, want %v", y, x, !dark, dark)
+		}
+	}
+	if start := bearer + quiet; !g.dark(start, y) || g.dark(start+module, y) {
+		t.Errorf("start pattern does not begin with a narrow bar at x = %d", start)
+	}
+	if stop := width - bearer - quiet - 1; !g.dark(stop, y) || g.dark(stop-module, y) {
+		t.Errorf("stop pattern does not end with a narrow bar at x = %d", stop)
+	}
+
+	// 指定宽度时模块取整数像素，多余的宽度不会压缩空白
+	data, err = itf14Png("1001234567890", 900, 0.3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, err = decodePngImage(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := g.img.Bounds().Dx(); got%(width/module) != 0 || got > 900 {
+		t.Errorf("width %d for 900, want a multiple of %d modules", got, width/module)
+	}
+	if _, err := itf14Png("1001234567890", 0, 0.05); err == nil {
+		t.Error("short ITF-14: want error")
+	}
+}
@@ -115,6 +115,9 @@ func main() {
 		panic(err)
 	}
 
+	// 带子命令运行时(如 export)只执行命令行功能
+	exitIfCLI()
+
 	// 创建 Fyne 应用
 	myApp := app.New()
 
@@ -151,11 +154,19 @@ func main() {
 	// Tab 3: 产品标签打印
 	tab3Content := createTagPrintTab(logger)
 
+	// Tab 4: 标签模板设计
+	tab4Content := createDesignerTab(logger, myWindow)
+
+	// Tab 5: 打印记录与重打
+	tab5Content := createHistoryTab(logger)
+
 	// 创建 Tab 容器
 	tabs := container.NewAppTabs(
 		container.NewTabItem("设备号打印", tab1Content),
 		container.NewTabItem("批量打印", tab2Content),
 		container.NewTabItem("标签打印", tab3Content),
+		container.NewTabItem("模板设计", tab4Content),
+		container.NewTabItem("打印记录", tab5Content),
 	)
 
 	// 日志区域 - 放在右侧，支持滚动
@@ -177,6 +188,9 @@ func main() {
 
 	myWindow.SetContent(mainContent)
 	logger.Log("打印工具已启动")
+
+	// 启动时及定期清理生成的图片和 PDF
+	StartRetention(logger.Log)
 	myWindow.ShowAndRun()
 }
 
@@ -188,6 +202,19 @@ func createPrintTab(logger *Logger) fyne.CanvasObject {
 	deviceNosEntry.SetMinRowsVisible(6)         // 初始显示6行
 	deviceNosEntry.Wrapping = fyne.TextWrapWord // 启用换行
 
+	// 标签预览，与打印时生成的版面一致
+	preview := NewLabelPreview(logger, func() ([]*Label, error) {
+		deviceNos := strings.TrimSpace(deviceNosEntry.Text)
+		if deviceNos == "" {
+			return nil, nil
+		}
+		deviceNoArr := strings.Split(deviceNos, ",")
+		if duplicate := findDuplicate(deviceNoArr); len(duplicate) > 0 {
+			return nil, fmt.Errorf("设备号重复: %s", strings.Join(duplicate, ","))
+		}
+		return buildDeviceLabels(deviceNoArr)
+	})
+
 	// 监听内容变化，动态调整显示行数
 	deviceNosEntry.OnChanged = func(content string) {
 		lines := strings.Count(content, "\n") + 1
@@ -197,6 +224,7 @@ func createPrintTab(logger *Logger) fyne.CanvasObject {
 			deviceNosEntry.SetMinRowsVisible(6)
 		}
 		deviceNosEntry.Refresh()
+		preview.Refresh()
 	}
 
 	// 打印按钮
@@ -259,6 +287,8 @@ func createPrintTab(logger *Logger) fyne.CanvasObject {
 		container.NewPadded(
 			container.NewGridWithColumns(2, printBtn, clearBtn),
 		),
+		widget.NewSeparator(),
+		preview.Content(),
 	)
 
 	// 整个表单可以滚动，内容多时向下扩展
@@ -273,6 +303,15 @@ func createMultiPrintTab(logger *Logger) fyne.CanvasObject {
 	deviceNosEntry.SetMinRowsVisible(6)         // 初始显示6行
 	deviceNosEntry.Wrapping = fyne.TextWrapWord // 启用换行
 
+	// 标签预览，与打印时生成的版面一致
+	preview := NewLabelPreview(logger, func() ([]*Label, error) {
+		deviceNos := strings.TrimSpace(deviceNosEntry.Text)
+		if deviceNos == "" {
+			return nil, nil
+		}
+		return BuildMultiLabel(deviceNos)
+	})
+
 	// 监听内容变化，动态调整显示行数
 	deviceNosEntry.OnChanged = func(content string) {
 		lines := strings.Count(content, "\n") + 1
@@ -282,6 +321,7 @@ func createMultiPrintTab(logger *Logger) fyne.CanvasObject {
 			deviceNosEntry.SetMinRowsVisible(6)
 		}
 		deviceNosEntry.Refresh()
+		preview.Refresh()
 	}
 
 	// 打印按钮 - 设置为高优先级按钮
@@ -296,7 +336,10 @@ func createMultiPrintTab(logger *Logger) fyne.CanvasObject {
 
 		// 异步打印
 		go func() {
-			GenerateMultiPdf(deviceNos, config.AdobePath, config.PrintInterval)
+			if err := GenerateMultiPdf(deviceNos, config.AdobePath, config.PrintInterval); err != nil {
+				logger.Log("❌ " + err.Error())
+				return
+			}
 			logger.Log("✓ 批量打印完成")
 		}()
 	})
@@ -321,6 +364,8 @@ func createMultiPrintTab(logger *Logger) fyne.CanvasObject {
 		container.NewPadded(
 			container.NewGridWithColumns(2, printBtn, clearBtn),
 		),
+		widget.NewSeparator(),
+		preview.Content(),
 	)
 
 	// 整个表单可以滚动，内容多时向下扩展
@@ -356,6 +401,34 @@ func createTagPrintTab(logger *Logger) fyne.CanvasObject {
 	boxNumEntry := widget.NewEntry()
 	boxNumEntry.SetPlaceHolder("箱号")
 
+	gtinEntry := widget.NewEntry()
+	gtinEntry.SetPlaceHolder("商品条码 GTIN (可选，为空时按条码类型配置)")
+
+	lotEntry := widget.NewEntry()
+	lotEntry.SetPlaceHolder("批号 (可选，用于 GS1-128)")
+
+	customerEntry := widget.NewEntry()
+	customerEntry.SetPlaceHolder("客户 (可选，按规则选择模板)")
+
+	// 模板下拉框，自动选择时按 config.toml 中的 templateRules 匹配
+	const autoTemplate = "自动选择"
+	templateSelect := widget.NewSelect(append([]string{autoTemplate}, TagTemplateNames()...), nil)
+	templateSelect.SetSelected(autoTemplate)
+	OnTemplatesChanged(func() {
+		templateSelect.Options = append([]string{autoTemplate}, TagTemplateNames()...)
+		templateSelect.Refresh()
+	})
+
+	// 标题语言下拉框，模板默认时使用模板或配置中的语言
+	const templateLanguage = "模板默认语言"
+	languageSelect := widget.NewSelect(append([]string{templateLanguage}, LanguageOptions()...), nil)
+	languageSelect.SetSelected(templateLanguage)
+
+	// 箱标二维码格式下拉框，默认时使用 config.toml 中的 [boxQr]
+	const configQrFormat = "默认二维码格式"
+	qrFormatSelect := widget.NewSelect(append([]string{configQrFormat}, BoxQrFormats()...), nil)
+	qrFormatSelect.SetSelected(configQrFormat)
+
 	deviceNosEntry := widget.NewMultiLineEntry()
 	deviceNosEntry.SetPlaceHolder("设备号\n每行一个设备号，或用逗号、竖线等分隔\n例如:\n12345\n67890\n或: 12345,67890")
 	deviceNosEntry.SetMinRowsVisible(4)         // 初始显示4行，保证按钮可见
@@ -372,9 +445,8 @@ func createTagPrintTab(logger *Logger) fyne.CanvasObject {
 		deviceNosEntry.Refresh()
 	}
 
-	// 打印按钮 - 设置为高优先级按钮
-	printBtn := widget.NewButton("🏷️ 打印产品标签", func() {
-		// 验证输入
+	// 收集并校验输入，返回待打印的标签数据或错误提示
+	tagExcelData := func() (*ExcelData, string) {
 		excelData := &ExcelData{
 			ProductName:   strings.TrimSpace(productNameEntry.Text),
 			ProductColor:  strings.TrimSpace(productColorEntry.Text),
@@ -385,44 +457,52 @@ func createTagPrintTab(logger *Logger) fyne.CanvasObject {
 			BarCode69Type: strings.TrimSpace(barCode69TypeEntry.Text),
 			BoxNum:        strings.TrimSpace(boxNumEntry.Text),
 			DeviceNos:     strings.TrimSpace(deviceNosEntry.Text),
+			Customer:      strings.TrimSpace(customerEntry.Text),
+			Gtin:          strings.TrimSpace(gtinEntry.Text),
+			Lot:           strings.TrimSpace(lotEntry.Text),
+		}
+		if templateSelect.Selected != autoTemplate {
+			excelData.Template = templateSelect.Selected
+		}
+		if languageSelect.Selected != templateLanguage {
+			excelData.Language = languageSelect.Selected
+		}
+		if qrFormatSelect.Selected != configQrFormat {
+			excelData.QrFormat = qrFormatSelect.Selected
 		}
 
 		// 验证必填项
 		if excelData.ProductName == "" {
-			logger.Log("❌ 错误: 请输入产品名称")
-			return
+			return nil, "请输入产品名称"
 		}
 		if excelData.ProductColor == "" {
-			logger.Log("❌ 错误: 请输入产品颜色")
-			return
+			return nil, "请输入产品颜色"
 		}
 		if excelData.ProductDate == "" {
-			logger.Log("❌ 错误: 请输入生产日期")
-			return
+			return nil, "请输入生产日期"
 		}
 		if excelData.ProductNum == "" {
-			logger.Log("❌ 错误: 请输入产品数量")
-			return
+			return nil, "请输入产品数量"
 		}
 		if excelData.GrossWeight == "" {
-			logger.Log("❌ 错误: 请输入毛重")
-			return
+			return nil, "请输入毛重"
 		}
 		if excelData.NetWeight == "" {
-			logger.Log("❌ 错误: 请输入净重")
-			return
+			return nil, "请输入净重"
 		}
 		if excelData.BarCode69Type == "" {
-			logger.Log("❌ 错误: 请输入条码类型")
-			return
+			return nil, "请输入条码类型"
 		}
 		if excelData.BoxNum == "" {
-			logger.Log("❌ 错误: 请输入箱号")
-			return
+			return nil, "请输入箱号"
 		}
 		if excelData.DeviceNos == "" {
-			logger.Log("❌ 错误: 请输入设备号")
-			return
+			return nil, "请输入设备号"
+		}
+		if excelData.Gtin != "" {
+			if _, err := NormalizeGtin(excelData.Gtin); err != nil {
+				return nil, err.Error()
+			}
 		}
 
 		// 处理条码类型
@@ -439,12 +519,58 @@ func createTagPrintTab(logger *Logger) fyne.CanvasObject {
 			}
 		}
 		// 不做任何格式转换，完全使用用户输入的格式
+		return excelData, ""
+	}
+
+	// 标签预览，与打印时生成的版面一致
+	preview := NewLabelPreview(logger, func() ([]*Label, error) {
+		excelData, errMsg := tagExcelData()
+		if errMsg != "" {
+			return nil, fmt.Errorf("%s", errMsg)
+		}
+		return BuildTagLabel(excelData)
+	})
+	// 预览不分配 SSCC，打印托盘标签时与“打印产品标签”一样先分配再按分配结果生成
+	preview.SetBeforePrint(func() ([]*Label, error) {
+		excelData, errMsg := tagExcelData()
+		if errMsg != "" {
+			return nil, fmt.Errorf("%s", errMsg)
+		}
+		sscc := excelData.Sscc
+		if err := assignTagSscc(excelData); err != nil || excelData.Sscc == sscc {
+			return nil, err
+		}
+		return BuildTagLabel(excelData)
+	})
+	for _, entry := range []*widget.Entry{productNameEntry, productColorEntry, productDateEntry, productNumEntry, grossWeightEntry, netWeightEntry, barCode69TypeEntry, boxNumEntry, gtinEntry, lotEntry, customerEntry} {
+		entry.OnChanged = func(string) { preview.Refresh() }
+	}
+	templateSelect.OnChanged = func(string) { preview.Refresh() }
+	languageSelect.OnChanged = func(string) { preview.Refresh() }
+	qrFormatSelect.OnChanged = func(string) { preview.Refresh() }
+	resizeDeviceNos := deviceNosEntry.OnChanged
+	deviceNosEntry.OnChanged = func(content string) {
+		resizeDeviceNos(content)
+		preview.Refresh()
+	}
+
+	// 打印按钮 - 设置为高优先级按钮
+	printBtn := widget.NewButton("🏷️ 打印产品标签", func() {
+		// 验证输入
+		excelData, errMsg := tagExcelData()
+		if errMsg != "" {
+			logger.Log("❌ 错误: " + errMsg)
+			return
+		}
 
-		logger.Log(fmt.Sprintf("✓ 开始打印标签: 箱号 %s", excelData.BoxNum))
+		logger.Log(fmt.Sprintf("✓ 开始打印标签: 箱号 %s，模板 %s", excelData.BoxNum, SelectTagTemplate(excelData)))
 
 		// 异步打印
 		go func() {
-			GenerateMultiTagPdf(excelData)
+			if err := GenerateMultiTagPdf(excelData); err != nil {
+				logger.Log("❌ " + err.Error())
+				return
+			}
 			logger.Log(fmt.Sprintf("✓ 标签打印完成: 箱号 %s", excelData.BoxNum))
 		}()
 	})
@@ -462,7 +588,13 @@ func createTagPrintTab(logger *Logger) fyne.CanvasObject {
 		netWeightEntry.SetText("")
 		barCode69TypeEntry.SetText("401")
 		boxNumEntry.SetText("")
+		gtinEntry.SetText("")
+		lotEntry.SetText("")
 		deviceNosEntry.SetText("")
+		customerEntry.SetText("")
+		templateSelect.SetSelected(autoTemplate)
+		languageSelect.SetSelected(templateLanguage)
+		qrFormatSelect.SetSelected(configQrFormat)
 		logger.Log("✓ 已清空所有输入框")
 	})
 	clearBtn.Importance = widget.LowImportance
@@ -472,6 +604,7 @@ func createTagPrintTab(logger *Logger) fyne.CanvasObject {
 	weightInfoTitle := widget.NewLabelWithStyle("⚖️ 重量信息", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
 	barcodeInfoTitle := widget.NewLabelWithStyle("📊 条码和箱号", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
 	deviceInfoTitle := widget.NewLabelWithStyle("🔢 设备号", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	templateInfoTitle := widget.NewLabelWithStyle("🧩 标签模板", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
 
 	form := container.NewVBox(
 		productInfoTitle,
@@ -487,16 +620,24 @@ func createTagPrintTab(logger *Logger) fyne.CanvasObject {
 
 		barcodeInfoTitle,
 		container.NewGridWithColumns(2, barCode69TypeEntry, boxNumEntry),
+		container.NewGridWithColumns(2, gtinEntry, lotEntry),
 		widget.NewSeparator(),
 
 		deviceInfoTitle,
 		deviceNosEntry, // 输入框会随内容自动扩展
+		widget.NewSeparator(),
+
+		templateInfoTitle,
+		container.NewGridWithColumns(4, customerEntry, templateSelect, languageSelect, qrFormatSelect),
 
 		container.NewPadded(
 			container.NewGridWithColumns(2, printBtn, clearBtn),
 		),
+		widget.NewSeparator(),
+		preview.Content(),
 	)
 
 	// 整个表单可以滚动
 	return container.NewScroll(form)
 }
+
@@ -17,10 +17,12 @@ mkdir "%RELEASE_DIR%\pdfs"
 mkdir "%RELEASE_DIR%\resources"
 mkdir "%RELEASE_DIR%\resources\fonts"
 mkdir "%RELEASE_DIR%\resources\images"
+mkdir "%RELEASE_DIR%\resources\assets"
+mkdir "%RELEASE_DIR%\templates"
 
 echo.
 echo Compiling...
-go build -ldflags="-H windowsgui" -o "%RELEASE_DIR%\PrintTool.exe" main_desktop.go print_functions.go
+go build -ldflags="-H windowsgui" -o "%RELEASE_DIR%\PrintTool.exe" .
 
 if %ERRORLEVEL% NEQ 0 (
     echo Build failed!
@@ -35,6 +37,8 @@ copy config.toml "%RELEASE_DIR%\" >nul
 copy resources\images\*-69.png "%RELEASE_DIR%\resources\images\" >nul
 copy resources\images\favicon.ico "%RELEASE_DIR%\resources\images\" >nul
 copy resources\fonts\PingFang*.ttf "%RELEASE_DIR%\resources\fonts\" >nul
+copy templates\*.toml "%RELEASE_DIR%\templates\" >nul
+if exist resources\assets xcopy /e /i /q /y resources\assets "%RELEASE_DIR%\resources\assets" >nul
 
 echo Done copying basic files
 
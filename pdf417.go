@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"math/big"
+
+	"github.com/boombuler/barcode"
+)
+
+// PDF417 编码。boombuler/barcode 的 pdf417 自动决定行列数且最多 30 行，无法按标签区域指定，
+// 这里按 ISO/IEC 15438 实现，文本、字节、数字压缩的选择与 boombuler 相同；码字图案见 pdf417_table.go
+
+// PDF417 规格限制: 数据列 1~30，行 3~90，码字总数(含长度、填充、纠错)不超过 928
+const (
+	pdf417MaxColumns   = 30
+	pdf417MinRows      = 3
+	pdf417MaxRows      = 90
+	pdf417MaxCodewords = 928
+	pdf417MaxSecurity  = 8
+)
+
+// 行高为 3 个模块；图片四周留 2 个模块的空白
+const (
+	pdf417RowHeight = 3
+	pdf417QuietZone = 2
+)
+
+// 码字: 切换到文本、字节(余数不足 6 字节)、数字压缩，单字节切换，字节(6 的整数倍)，填充
+const (
+	pdf417LatchText    = 900
+	pdf417LatchByte    = 901
+	pdf417LatchNumeric = 902
+	pdf417ShiftByte    = 913
+	pdf417LatchByte6   = 924
+	pdf417Pad          = 900
+)
+
+// 连续数字达到 13 个时使用数字压缩
+const pdf417MinNumeric = 13
+
+// 文本压缩的子模式
+const (
+	pdf417Upper = iota
+	pdf417Lower
+	pdf417Mixed
+	pdf417Punct
+)
+
+// 文本压缩混合、标点子模式的字符，下标为值；0 表示该值是切换符
+var (
+	pdf417MixedChars = [30]byte{'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '&', '\r', '\t', ',', ':', '#', '-', '.', '$', '/', '+', '%', '*', '=', '^', 0, ' ', 0, 0, 0}
+	pdf417PunctChars = [30]byte{';', '<', '>', '@', '[', '\\', ']', '_', '`', '~', '!', '\r', '\t', ',', ':', '\n', '-', '.', '$', '/', '"', '|', '*', '(', ')', '?', '{', '}', '\'', 0}
+)
+
+// pdf417Code PDF417 符号
+type pdf417Code struct {
+	content                 string
+	columns, rows, security int
+	// 每行的条空，true 为条，不含空白
+	dark [][]bool
+}
+
+func (c *pdf417Code) Content() string { return c.content }
+
+func (c *pdf417Code) Metadata() barcode.Metadata {
+	return barcode.Metadata{CodeKind: barcode.TypePDF, Dimensions: 2}
+}
+
+func (c *pdf417Code) ColorModel() color.Model { return color.Gray16Model }
+
+// Bounds 不含空白，每行高 3 个模块
+func (c *pdf417Code) Bounds() image.Rectangle {
+	return image.Rect(0, 0, len(c.dark[0]), c.rows*pdf417RowHeight)
+}
+
+func (c *pdf417Code) At(x, y int) color.Color {
+	if c.dark[y/pdf417RowHeight][x] {
+		return color.Black
+	}
+	return color.White
+}
+
+// modules 返回含空白的宽度(模块)和行数
+func (c *pdf417Code) modules() (int, int) {
+	return len(c.dark[0]) + 2*pdf417QuietZone, c.rows
+}
+
+// pdf417Security 按数据码字数返回推荐的最低纠错等级
+func pdf417Security(dataWords int) int {
+	switch {
+	case dataWords <= 40:
+		return 2
+	case dataWords <= 160:
+		return 3
+	case dataWords <= 320:
+		return 4
+	}
+	return 5
+}
+
+// checkPdf417Options 检查 PDF417 的列数、行数和纠错等级
+func checkPdf417Options(columns, rows int, security *int) error {
+	if columns < 0 || columns > pdf417MaxColumns {
+		return fmt.Errorf("PDF417 列数 columns 应为 1~%d，0 表示自动", pdf417MaxColumns)
+	}
+	if rows != 0 && (rows < pdf417MinRows || rows > pdf417MaxRows) {
+		return fmt.Errorf("PDF417 行数 rows 应为 %d~%d，0 表示自动", pdf417MinRows, pdf417MaxRows)
+	}
+	if columns*rows > pdf417MaxCodewords {
+		return fmt.Errorf("PDF417 列数 × 行数不能超过 %d", pdf417MaxCodewords)
+	}
+	if security != nil && (*security < 0 || *security > pdf417MaxSecurity) {
+		return fmt.Errorf("PDF417 纠错等级 security 应为 0~%d", pdf417MaxSecurity)
+	}
+	return nil
+}
+
+// encodePdf417 编码 PDF417。columns、rows 为 0 时自动选择，使符号宽高比接近 ratio(宽/高)；security 为 nil 时按数据量选择
+func encodePdf417(content string, columns, rows int, security *int, ratio float64) (*pdf417Code, error) {
+	if err := checkPdf417Options(columns, rows, security); err != nil {
+		return nil, err
+	}
+	words := pdf417Compact([]byte(content))
+	level := pdf417Security(len(words))
+	if security != nil {
+		level = *security
+	}
+	ecCount := 2 << level
+	need := 1 + len(words) + ecCount
+	if need > pdf417MaxCodewords {
+		return nil, fmt.Errorf("内容过多: PDF417 最多 %d 个码字，需要 %d 个(纠错等级 %d)", pdf417MaxCodewords, need, level)
+	}
+	columns, rows, err := pdf417Dimensions(need, columns, rows, ratio)
+	if err != nil {
+		return nil, err
+	}
+
+	// 长度码字 + 数据 + 填充，最后是纠错码字
+	codewords := make([]int, 0, columns*rows)
+	codewords = append(codewords, columns*rows-ecCount)
+	codewords = append(codewords, words...)
+	for len(codewords) < columns*rows-ecCount {
+		codewords = append(codewords, pdf417Pad)
+	}
+	codewords = append(codewords, pdf417ErrorCorrection(codewords, ecCount)...)
+
+	code := &pdf417Code{content: content, columns: columns, rows: rows, security: level}
+	for r := 0; r < rows; r++ {
+		cluster := r % 3
+		// 行指示码字: 依次记录行数、纠错等级及行数余数、列数
+		base := 30 * (r / 3)
+		indicators := [3]int{base + (rows-1)/3, base + level*3 + (rows-1)%3, base + columns - 1}
+		left, right := indicators[cluster], indicators[(cluster+2)%3]
+		row := make([]bool, 0, (columns+4)*17+1)
+		row = appendPdf417Bits(row, pdf417StartPattern, 17)
+		row = appendPdf417Bits(row, pdf417Patterns[cluster][left], 17)
+		for _, w := range codewords[r*columns : (r+1)*columns] {
+			row = appendPdf417Bits(row, pdf417Patterns[cluster][w], 17)
+		}
+		row = appendPdf417Bits(row, pdf417Patterns[cluster][right], 17)
+		row = appendPdf417Bits(row, pdf417StopPattern, 18)
+		code.dark = append(code.dark, row)
+	}
+	return code, nil
+}
+
+func appendPdf417Bits(row []bool, pattern, n int) []bool {
+	for i := n - 1; i >= 0; i-- {
+		row = append(row, pattern>>uint(i)&1 == 1)
+	}
+	return row
+}
+
+// pdf417Dimensions 确定列数和行数，need 为长度、数据和纠错码字数之和
+func pdf417Dimensions(need, columns, rows int, ratio float64) (int, int, error) {
+	switch {
+	case columns > 0 && rows > 0:
+		if columns*rows < need {
+			return 0, 0, fmt.Errorf("PDF417 %d 列 × %d 行放不下，需要 %d 个码字", columns, rows, need)
+		}
+		return columns, rows, nil
+	case columns > 0:
+		rows = (need + columns - 1) / columns
+		if rows < pdf417MinRows {
+			rows = pdf417MinRows
+		}
+		if rows > pdf417MaxRows || columns*rows > pdf417MaxCodewords {
+			return 0, 0, fmt.Errorf("PDF417 %d 列放不下，需要 %d 个码字，请增加列数", columns, need)
+		}
+		return columns, rows, nil
+	case rows > 0:
+		columns = (need + rows - 1) / rows
+		if columns > pdf417MaxColumns {
+			return 0, 0, fmt.Errorf("PDF417 %d 行放不下，需要 %d 个码字，请增加行数", rows, need)
+		}
+		return columns, rows, nil
+	}
+	if ratio <= 0 {
+		ratio = 3
+	}
+	best := math.Inf(1)
+	for c := 1; c <= pdf417MaxColumns; c++ {
+		r := (need + c - 1) / c
+		if r < pdf417MinRows {
+			r = pdf417MinRows
+		}
+		if r > pdf417MaxRows || c*r > pdf417MaxCodewords {
+			continue
+		}
+		width := float64((c+4)*17 + 1)
+		diff := math.Abs(math.Log(width / float64(r*pdf417RowHeight) / ratio))
+		if diff < best {
+			best, columns, rows = diff, c, r
+		}
+	}
+	if columns == 0 {
+		return 0, 0, fmt.Errorf("内容过多，无法放入 PDF417")
+	}
+	return columns, rows, nil
+}
+
+// pdf417ErrorCorrection 计算 Reed-Solomon 纠错码字(GF(929)，生成多项式的根为 3^1..3^count)
+func pdf417ErrorCorrection(data []int, count int) []int {
+	// 生成多项式系数，factors[i] 为 x^i 的系数
+	factors := make([]int, count+1)
+	factors[0] = 1
+	root := 1
+	for i := 1; i <= count; i++ {
+		root = root * 3 % 929
+		for j := i; j >= 0; j-- {
+			v := factors[j] * (929 - root) % 929
+			if j > 0 {
+				v += factors[j-1]
+			}
+			factors[j] = v % 929
+		}
+	}
+	ec := make([]int, count)
+	for _, d := range data {
+		t := (d + ec[count-1]) % 929
+		for j := count - 1; j > 0; j-- {
+			ec[j] = (ec[j-1] + 929 - t*factors[j]%929) % 929
+		}
+		ec[0] = (929 - t*factors[0]%929) % 929
+	}
+	result := make([]int, count)
+	for i := range result {
+		if v := ec[count-1-i]; v != 0 {
+			result[i] = 929 - v
+		}
+	}
+	return result
+}
+
+// pdf417Compact 把内容转为数据码字: 13 个以上连续数字用数字压缩，5 个以上连续可打印 ASCII 字符用文本压缩，
+// 其余(含中文的 UTF-8 字节)用字节压缩
+func pdf417Compact(data []byte) []int {
+	var words []int
+	text, submode := true, pdf417Upper
+	for len(data) > 0 {
+		if n := pdf417DigitCount(data); n >= pdf417MinNumeric || n == len(data) {
+			words = append(words, pdf417LatchNumeric)
+			words = append(words, pdf417Numeric(data[:n])...)
+			text = false
+			data = data[n:]
+			continue
+		}
+		if n := pdf417TextCount(data); n >= 5 || n == len(data) {
+			if !text {
+				words = append(words, pdf417LatchText)
+				text, submode = true, pdf417Upper
+			}
+			var w []int
+			submode, w = pdf417Text(data[:n], submode)
+			words = append(words, w...)
+			data = data[n:]
+			continue
+		}
+		n := pdf417ByteCount(data)
+		if n == 0 {
+			n = 1
+		}
+		// 文本压缩中的单个字节用切换符，之后仍为文本压缩
+		if n == 1 && text {
+			words = append(words, pdf417ShiftByte, int(data[0]))
+			data = data[1:]
+			continue
+		}
+		words = append(words, pdf417Bytes(data[:n])...)
+		text = false
+		data = data[n:]
+	}
+	return words
+}
+
+func pdf417IsText(b byte) bool {
+	return b == '\t' || b == '\n' || b == '\r' || (b >= ' ' && b <= '~')
+}
+
+// pdf417DigitCount 返回开头连续数字的个数
+func pdf417DigitCount(data []byte) int {
+	n := 0
+	for n < len(data) && data[n] >= '0' && data[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// pdf417TextCount 返回开头适合文本压缩的字符数，遇到 13 个以上连续数字时停止
+func pdf417TextCount(data []byte) int {
+	n := 0
+	for n < len(data) {
+		digits := pdf417DigitCount(data[n:])
+		if digits >= pdf417MinNumeric || (digits == 0 && !pdf417IsText(data[n])) {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// pdf417ByteCount 返回开头适合字节压缩的字节数，遇到适合数字或文本压缩的内容时停止
+func pdf417ByteCount(data []byte) int {
+	n := 0
+	for n < len(data) {
+		if pdf417DigitCount(data[n:]) >= pdf417MinNumeric || pdf417TextCount(data[n:]) > 5 {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// pdf417Numeric 数字压缩: 每 44 位数字前加 1 后转为 900 进制
+func pdf417Numeric(digits []byte) []int {
+	var words []int
+	for start := 0; start < len(digits); start += 44 {
+		end := start + 44
+		if end > len(digits) {
+			end = len(digits)
+		}
+		n, _ := new(big.Int).SetString("1"+string(digits[start:end]), 10)
+		var group []int
+		base, mod := big.NewInt(900), new(big.Int)
+		for n.Sign() > 0 {
+			n.DivMod(n, base, mod)
+			group = append([]int{int(mod.Int64())}, group...)
+		}
+		words = append(words, group...)
+	}
+	return words
+}
+
+// pdf417Bytes 字节压缩: 每 6 字节转为 5 个 900 进制码字，剩余字节每字节一个码字
+func pdf417Bytes(data []byte) []int {
+	words := []int{pdf417LatchByte}
+	if len(data)%6 == 0 {
+		words[0] = pdf417LatchByte6
+	}
+	i := 0
+	for ; len(data)-i >= 6; i += 6 {
+		var t int64
+		for _, b := range data[i : i+6] {
+			t = t<<8 | int64(b)
+		}
+		group := make([]int, 5)
+		for j := 4; j >= 0; j-- {
+			group[j] = int(t % 900)
+			t /= 900
+		}
+		words = append(words, group...)
+	}
+	for _, b := range data[i:] {
+		words = append(words, int(b))
+	}
+	return words
+}
+
+// pdf417Text 文本压缩: 每个字符按子模式转为 0~29 的值(必要时先加切换符)，每两个值组成一个码字；返回结束时的子模式
+func pdf417Text(text []byte, submode int) (int, []int) {
+	var values []int
+	for i := 0; i < len(text); {
+		ch := text[i]
+		upper := ch == ' ' || (ch >= 'A' && ch <= 'Z')
+		lower := ch == ' ' || (ch >= 'a' && ch <= 'z')
+		mixed := pdf417CharValue(&pdf417MixedChars, ch) >= 0
+		switch submode {
+		case pdf417Upper:
+			switch {
+			case upper:
+				values = append(values, pdf417AlphaValue(ch, 'A'))
+			case lower:
+				values, submode = append(values, 27), pdf417Lower
+				continue
+			case mixed:
+				values, submode = append(values, 28), pdf417Mixed
+				continue
+			default:
+				values = append(values, 29, pdf417CharValue(&pdf417PunctChars, ch))
+			}
+		case pdf417Lower:
+			switch {
+			case lower:
+				values = append(values, pdf417AlphaValue(ch, 'a'))
+			case upper:
+				values = append(values, 27, pdf417AlphaValue(ch, 'A'))
+			case mixed:
+				values, submode = append(values, 28), pdf417Mixed
+				continue
+			default:
+				values = append(values, 29, pdf417CharValue(&pdf417PunctChars, ch))
+			}
+		case pdf417Mixed:
+			switch {
+			case mixed:
+				values = append(values, pdf417CharValue(&pdf417MixedChars, ch))
+			case upper:
+				values, submode = append(values, 28), pdf417Upper
+				continue
+			case lower:
+				values, submode = append(values, 27), pdf417Lower
+				continue
+			case i+1 < len(text) && pdf417CharValue(&pdf417PunctChars, text[i+1]) >= 0:
+				values, submode = append(values, 25), pdf417Punct
+				continue
+			default:
+				values = append(values, 29, pdf417CharValue(&pdf417PunctChars, ch))
+			}
+		default:
+			if v := pdf417CharValue(&pdf417PunctChars, ch); v >= 0 {
+				values = append(values, v)
+			} else {
+				values, submode = append(values, 29), pdf417Upper
+				continue
+			}
+		}
+		i++
+	}
+	// 奇数个值时用 29 补齐；标点子模式中 29 为切换到大写字母
+	if len(values)%2 != 0 {
+		values = append(values, 29)
+		if submode == pdf417Punct {
+			submode = pdf417Upper
+		}
+	}
+	words := make([]int, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		words = append(words, values[i]*30+values[i+1])
+	}
+	return submode, words
+}
+
+// pdf417AlphaValue 大小写字母子模式的值，空格为 26
+func pdf417AlphaValue(ch, first byte) int {
+	if ch == ' ' {
+		return 26
+	}
+	return int(ch - first)
+}
+
+// pdf417CharValue 返回字符在混合或标点子模式中的值，不在其中时返回 -1
+func pdf417CharValue(chars *[30]byte, ch byte) int {
+	for v, c := range chars {
+		if c != 0 && c == ch {
+			return v
+		}
+	}
+	return -1
+}
+
+// pdf417Png 生成 PDF417 png 数据: 宽度不超过 pixels(默认 1000)，模块为整数像素；
+// 行高至少 3 个模块，ratio(高/宽)大于此时加高各行以填满元素区域
+func pdf417Png(code *pdf417Code, pixels int, ratio float64) ([]byte, error) {
+	if pixels <= 0 {
+		pixels = 1000
+	}
+	cols, rows := code.modules()
+	module := pixels / cols
+	if module < 1 {
+		module = 1
+	}
+	width := cols * module
+	rowHeight := pdf417RowHeight * module
+	if ratio > 0 {
+		if h := int(float64(width)*ratio+0.5) - 2*pdf417QuietZone*module; h/rows > rowHeight {
+			rowHeight = h / rows
+		}
+	}
+	quiet := pdf417QuietZone * module
+	img := image.NewRGBA(image.Rect(0, 0, width, rows*rowHeight+2*quiet))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for y, row := range code.dark {
+		top := quiet + y*rowHeight
+		for x, dark := range row {
+			if dark {
+				left := quiet + x*module
+				draw.Draw(img, image.Rect(left, top, left+module, top+rowHeight), image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	bpdf "github.com/boombuler/barcode/pdf417"
+)
+
+// ISO/IEC 15438 附录中的示例数据码字及各纠错等级的纠错码字
+func TestPdf417ErrorCorrection(t *testing.T) {
+	data := []int{16, 902, 1, 278, 827, 900, 295, 902, 2, 326, 823, 544, 900, 149, 900, 900}
+	tests := []struct {
+		level int
+		want  []int
+	}{
+		{0, []int{156, 765}},
+		{1, []int{168, 875, 63, 355}},
+		{2, []int{628, 715, 393, 299, 863, 601, 169, 708}},
+		{3, []int{232, 176, 793, 616, 476, 406, 855, 445, 84, 518, 522, 721, 607, 2, 42, 578}},
+	}
+	for _, tt := range tests {
+		if got := pdf417ErrorCorrection(data, 2<<tt.level); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("level %d: %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestPdf417Compact(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []int
+	}{
+		// 文本压缩: P D F 为大写子模式 15 3 5，ml(28) 切换到混合子模式 4 1 7，不足一对时补 ps(29)
+		{"PDF417", []int{15*30 + 3, 5*30 + 28, 4*30 + 1, 7*30 + 29}},
+		// 数字压缩: 前面加 1 后按 900 进制
+		{"1234567890123", []int{902, 17, 110, 836, 811, 223}},
+		// 字节压缩: 6 字节为一组按 900 进制转为 5 个码字
+		{"设备", []int{924, 389, 842, 625, 471, 539}},
+	}
+	for _, tt := range tests {
+		if got := pdf417Compact([]byte(tt.content)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pdf417Compact(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+// 按 boombuler/barcode 选择的行列数和纠错等级编码，逐模块比较；再用本项目的解码器解码 boombuler 的图片。
+// boombuler 第 0、3、6… 行的左侧行指示码字按 (行数-3)/3 计算，与 ISO/IEC 15438 的 (行数-1)/3 只在行数为 3 的倍数时一致，
+// 这里只选行数为 3 的倍数的内容
+func TestPdf417MatchesReferenceEncoder(t *testing.T) {
+	tests := []struct {
+		content  string
+		security int
+	}{
+		{"SN2024000001,SN2024000002,SN2024000003", 1},
+		{"SN2024000001,SN2024000002,SN2024000003", 5},
+		{"Box B0001 / 12 PCS / 1.80KG", 3},
+		{"0123456789012345678901234567890123456789", 4},
+		{"设备号 SN2024000001 耳机 黑色", 3},
+		{"https://id.gs1.org/01/06979018510006?box=B0001&sn=SN1,SN2", 2},
+	}
+	for _, tt := range tests {
+		ref, err := bpdf.Encode(tt.content, byte(tt.security))
+		if err != nil {
+			t.Fatalf("reference Encode(%q): %v", tt.content, err)
+		}
+		// boombuler 每行高 2 个模块
+		columns := (ref.Bounds().Dx()-1)/17 - 4
+		rows := ref.Bounds().Dy() / 2
+		if rows%3 != 0 {
+			t.Fatalf("%q: reference has %d rows", tt.content, rows)
+		}
+		security := tt.security
+		code, err := encodePdf417(tt.content, columns, rows, &security, 0)
+		if err != nil {
+			t.Fatalf("encodePdf417(%q): %v", tt.content, err)
+		}
+		if code.columns != columns || code.rows != rows {
+			t.Errorf("%q: %dx%d, reference %dx%d", tt.content, code.columns, code.rows, columns, rows)
+			continue
+		}
+		mismatch := 0
+		for r := 0; r < rows; r++ {
+			for x := 0; x < ref.Bounds().Dx(); x++ {
+				if code.At(x, r*pdf417RowHeight) != ref.At(x, r*2) {
+					mismatch++
+				}
+			}
+		}
+		if mismatch > 0 {
+			t.Errorf("%q: %d modules differ from reference", tt.content, mismatch)
+		}
+
+		got, err := decodeSymbol("pdf417", referenceImage(t, ref, nil, ref.Bounds().Dx()*3, ref.Bounds().Dy()*3))
+		if err != nil || got != tt.content {
+			t.Errorf("decode reference %q = %q, %v", tt.content, got, err)
+		}
+	}
+}
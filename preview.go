@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// 预览图宽度(像素)，按标签页面宽度换算每毫米像素数
+const previewWidthPx = 960
+
+// 输入停止变化后多久刷新预览
+const previewDelay = 400 * time.Millisecond
+
+// previewDoc 预览中的一张标签，PDF 只渲染一次，打印时原样发送；未翻到的页打印时再渲染
+type previewDoc struct {
+	label *Label
+	pdf   []byte
+}
+
+// LabelPreview 标签预览面板: 字段变化时按打印流程重新渲染，并可把预览中的文档原样打印
+type LabelPreview struct {
+	logger *Logger
+	build  func() ([]*Label, error)
+	// 打印前调用，返回需要重新生成的标签(如打印时分配了 SSCC)；返回 nil 时原样打印预览中的 PDF
+	beforePrint func() ([]*Label, error)
+
+	image     *canvas.Image
+	status    *widget.Label
+	prevBtn   *widget.Button
+	nextBtn   *widget.Button
+	printBtn  *widget.Button
+	pngBtn    *widget.Button
+	svgBtn    *widget.Button
+	dpiSelect *widget.Select
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	version int
+	docs    []*previewDoc
+	index   int
+}
+
+// NewLabelPreview 创建预览面板，build 按当前输入生成待打印的标签
+func NewLabelPreview(logger *Logger, build func() ([]*Label, error)) *LabelPreview {
+	p := &LabelPreview{logger: logger, build: build}
+
+	p.image = canvas.NewImageFromImage(nil)
+	p.image.FillMode = canvas.ImageFillContain
+	p.image.ScaleMode = canvas.ImageScaleSmooth
+	p.image.SetMinSize(fyne.NewSize(480, 260))
+
+	p.status = widget.NewLabel("请输入内容后查看预览")
+	p.status.Wrapping = fyne.TextWrapWord
+
+	p.prevBtn = widget.NewButton("◀ 上一张", func() { p.show(-1) })
+	p.nextBtn = widget.NewButton("下一张 ▶", func() { p.show(1) })
+	p.printBtn = widget.NewButton("🖨️ 打印预览内容(全部)", p.printAll)
+	p.printBtn.Importance = widget.HighImportance
+
+	p.dpiSelect = widget.NewSelect([]string{"150", "203", "300", "600"}, nil)
+	p.dpiSelect.SetSelected(strconv.Itoa(exportDpi(0)))
+	p.pngBtn = widget.NewButton("🖼️ 导出 PNG", func() { p.exportCurrent(FormatPng) })
+	p.svgBtn = widget.NewButton("📐 导出 SVG", func() { p.exportCurrent(FormatSvg) })
+	p.updateButtons()
+	return p
+}
+
+// SetBeforePrint 设置打印前的处理，预览中不能确定的内容(如 SSCC)在打印时生成
+func (p *LabelPreview) SetBeforePrint(f func() ([]*Label, error)) {
+	p.beforePrint = f
+}
+
+// Content 返回预览面板的界面
+func (p *LabelPreview) Content() fyne.CanvasObject {
+	title := widget.NewLabelWithStyle("👁️ 标签预览", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	return container.NewVBox(
+		title,
+		widget.NewSeparator(),
+		p.image,
+		p.status,
+		container.NewGridWithColumns(3, p.prevBtn, p.nextBtn, p.printBtn),
+		container.NewBorder(nil, nil, widget.NewLabel("PNG 分辨率(DPI)"), nil,
+			container.NewGridWithColumns(3, p.dpiSelect, p.pngBtn, p.svgBtn)),
+	)
+}
+
+// Refresh 在输入停止变化一段时间后重新生成预览
+func (p *LabelPreview) Refresh() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.version++
+	version := p.version
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(previewDelay, func() { p.render(version) })
+}
+
+func (p *LabelPreview) render(version int) {
+	labels, err := p.build()
+
+	p.mu.Lock()
+	if version != p.version {
+		// 输入又发生了变化，等待下一次渲染
+		p.mu.Unlock()
+		return
+	}
+	p.docs = nil
+	p.index = 0
+	if err == nil {
+		for _, label := range labels {
+			p.docs = append(p.docs, &previewDoc{label: label})
+		}
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		p.clear(err.Error())
+		return
+	}
+	if len(labels) == 0 {
+		p.clear("请输入内容后查看预览")
+		return
+	}
+	p.show(0)
+}
+
+func (p *LabelPreview) clear(msg string) {
+	p.image.Image = nil
+	p.image.Refresh()
+	p.status.SetText(msg)
+	p.updateButtons()
+}
+
+// show 切换到相对当前位置 step 张的标签并渲染
+func (p *LabelPreview) show(step int) {
+	p.mu.Lock()
+	if len(p.docs) == 0 {
+		p.mu.Unlock()
+		return
+	}
+	index := p.index + step
+	if index < 0 || index >= len(p.docs) {
+		p.mu.Unlock()
+		return
+	}
+	p.index = index
+	doc := p.docs[index]
+	total := len(p.docs)
+	p.mu.Unlock()
+
+	data, err := RenderLabelPdf(doc.label)
+	if err != nil {
+		p.clear(fmt.Sprintf("❌ 生成预览失败: %s", err.Error()))
+		return
+	}
+	pageW, _ := doc.label.PageSize()
+	img, err := RenderLabelImage(doc.label, previewWidthPx/pageW)
+	if err != nil {
+		p.clear(fmt.Sprintf("❌ 生成预览失败: %s", err.Error()))
+		return
+	}
+
+	p.mu.Lock()
+	doc.pdf = data
+	p.mu.Unlock()
+
+	p.image.Image = img
+	p.image.Refresh()
+	p.status.SetText(fmt.Sprintf("%s (%d/%d)", doc.label.Name, index+1, total))
+	p.updateButtons()
+}
+
+func (p *LabelPreview) updateButtons() {
+	p.mu.Lock()
+	total, index := len(p.docs), p.index
+	ready := total > 0 && p.docs[index].pdf != nil
+	p.mu.Unlock()
+
+	setEnabled(p.prevBtn, index > 0)
+	setEnabled(p.nextBtn, index < total-1)
+	setEnabled(p.printBtn, ready)
+	setEnabled(p.pngBtn, ready)
+	setEnabled(p.svgBtn, ready)
+}
+
+// printAll 将预览中的全部标签作为一次打印任务打印，不重新生成: 已预览的页原样发送，未翻到的页按同一流程渲染，
+// 输出与预览相同；打印前的处理分配了新内容时按新生成的标签打印
+func (p *LabelPreview) printAll() {
+	p.mu.Lock()
+	total := len(p.docs)
+	labels := make([]*Label, total)
+	pdfs := make([][]byte, total)
+	for i, doc := range p.docs {
+		labels[i], pdfs[i] = doc.label, doc.pdf
+	}
+	p.mu.Unlock()
+	if total == 0 {
+		return
+	}
+
+	p.logger.Log(fmt.Sprintf("✓ 开始打印预览内容: %s 共 %d 张", labels[0].Name, total))
+	go func() {
+		if p.beforePrint != nil {
+			rebuilt, err := p.beforePrint()
+			if err != nil {
+				p.logger.Log(fmt.Sprintf("❌ 打印失败: %s", err.Error()))
+				return
+			}
+			if len(rebuilt) > 0 {
+				if len(rebuilt) != total {
+					p.logger.Log("❌ 打印失败: 重新生成的标签页数与预览不一致，请刷新预览后重试")
+					return
+				}
+				labels, pdfs = rebuilt, make([][]byte, total)
+				p.logger.Log(fmt.Sprintf("✓ 已按打印时分配的内容重新生成: %s", labels[0].Name))
+			}
+		}
+		for i, label := range labels {
+			if pdfs[i] != nil {
+				continue
+			}
+			var err error
+			if pdfs[i], err = RenderLabelPdf(label); err != nil {
+				p.logger.Log(fmt.Sprintf("❌ 打印失败: %s", err.Error()))
+				return
+			}
+		}
+		if err := PrintPdfData(labels, pdfs); err != nil {
+			p.logger.Log(fmt.Sprintf("❌ 打印失败: %s", err.Error()))
+			return
+		}
+		p.logger.Log(fmt.Sprintf("✓ 预览内容打印完成: %s 共 %d 张", labels[0].Name, total))
+	}()
+}
+
+// exportCurrent 将预览中的标签按同一版面导出为图片
+func (p *LabelPreview) exportCurrent(format string) {
+	p.mu.Lock()
+	if len(p.docs) == 0 {
+		p.mu.Unlock()
+		return
+	}
+	label := p.docs[p.index].label
+	p.mu.Unlock()
+
+	dpi, _ := strconv.Atoi(p.dpiSelect.Selected)
+	go func() {
+		path, err := ExportLabel(label, format, dpi)
+		if err != nil {
+			p.logger.Log(fmt.Sprintf("❌ 导出失败: %s", err.Error()))
+			return
+		}
+		p.logger.Log(fmt.Sprintf("✓ 已导出: %s", path))
+	}()
+}
+
+func setEnabled(btn *widget.Button, enabled bool) {
+	if enabled {
+		btn.Enable()
+	} else {
+		btn.Disable()
+	}
+}
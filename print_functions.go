@@ -6,18 +6,12 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/boombuler/barcode"
 	"github.com/boombuler/barcode/code128"
-	"github.com/boombuler/barcode/ean"
-	"github.com/boombuler/barcode/qr"
-	"github.com/flopp/go-findfont"
-	"github.com/jung-kurt/gofpdf"
-	"github.com/skip2/go-qrcode"
-	qrcode2 "github.com/skip2/go-qrcode"
 	"github.com/tealeg/xlsx"
-	"image/jpeg"
 	"image/png"
 	"math"
 	"math/rand"
 	"net/http"
+	"net/url"
 
 	"image"
 	"image/draw"
@@ -28,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 type Config struct {
@@ -37,6 +32,88 @@ type Config struct {
 	Baud          int
 	ImageDir      string
 	PdfDir        string
+	// 标签导出目录及 PNG 默认分辨率
+	ExportDir string
+	ExportDpi int
+	// 打印机分辨率(dpi)，打印质量分析按此换算条码模块的打印点数
+	PrinterDpi int
+	// 用户模板目录，同名文件覆盖内置模板
+	TemplateDir string
+	// 产品标签模板选择规则，按顺序匹配
+	TemplateRules []TemplateRule
+	// 班次，模板中可用 {{Shift}} 引用当前班次
+	Shifts []ShiftConfig
+	// 打印记录及模板版本快照目录
+	HistoryDir string
+	// 标签默认语言(如 zh、en、zh+en)及用户标题表目录
+	Language  string
+	LocaleDir string
+	// 素材库目录(logo、认证标志等)，索引文件为 assets.toml
+	AssetDir string
+	// 条码类型对应的商品条码(GTIN)，如 401 = "6979018510006"
+	Gtins map[string]string
+	// 厂商识别代码、SSCC 扩展位及外箱包装指示符
+	Gs1 Gs1Config
+	// 各类标签(device、multi、tag)的二维码纠错等级、空白、编码模式及编码库
+	Qrcode map[string]QrConfig
+	// 箱标二维码内容格式
+	BoxQr BoxQrConfig
+	// 二维码密度限制，超出时按模板的 split 拆分
+	QrSplit QrSplitConfig
+	// 设备号标签使用的码制
+	Device DeviceConfig
+	// 生成文件保留策略
+	Retention RetentionConfig
+}
+
+// DeviceConfig 设备号标签码制配置，小标签可改用 Data Matrix
+type DeviceConfig struct {
+	// qrcode(默认)、datamatrix 或 gs1-datamatrix
+	Symbology string
+	// Data Matrix 规格: square(默认)、rect 或指定如 16x16
+	Size string
+	// Data Matrix 模块宽度(mm)，0 表示按模板中二维码区域缩放
+	Module float64 `toml:"module,omitzero"`
+}
+
+// withDevice 返回按设备号码制替换二维码后的模板副本，原模板不变
+func (t *LabelTemplate) withDevice(c DeviceConfig) (*LabelTemplate, error) {
+	copied := *t
+	copied.Elements = append([]TemplateElement(nil), t.Elements...)
+	if err := c.apply(&copied); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+// apply 将设备号模板中的二维码替换为配置的码制；GS1 DataMatrix 内容未写 AI 时按序列号 (21) 编码
+func (c DeviceConfig) apply(t *LabelTemplate) error {
+	symbology := strings.ToLower(c.Symbology)
+	switch symbology {
+	case "", TemplateQrcode:
+		return nil
+	case "datamatrix", "gs1-datamatrix":
+	default:
+		return fmt.Errorf("设备号标签不支持码制 %s", c.Symbology)
+	}
+	if err := checkDataMatrixSize(c.Size); err != nil {
+		return err
+	}
+	for i := range t.Elements {
+		e := &t.Elements[i]
+		if e.Type != TemplateQrcode {
+			continue
+		}
+		e.Type = TemplateBarcode
+		e.Symbology = symbology
+		e.Size = c.Size
+		e.Module = c.Module
+		e.Pixels = 0
+		if symbology == "gs1-datamatrix" && !strings.HasPrefix(e.Value, "(") {
+			e.Value = "(21)" + e.Value
+		}
+	}
+	return nil
 }
 
 var config *Config
@@ -51,6 +128,10 @@ func mainWeb() {
 	http.HandleFunc("/print", printHandler)
 	http.HandleFunc("/printMulti", printMultiHandler)
 	http.HandleFunc("/printMultiTag", printMultiTagHandler)
+	http.HandleFunc("/export", exportHandler)
+
+	// 启动生成文件定期清理
+	StartRetention(func(msg string) { fmt.Println(msg) })
 
 	// 启动Web服务器，监听在13008端口
 	fmt.Println("Starting server on port 13008...")
@@ -79,6 +160,10 @@ func mainExcel() {
 	for _, excelData := range data {
 		GenerateMultiPdfByExcel(excelData)
 	}
+	// 批量生成结束后按保留策略清理一次
+	if _, _, err := RunRetention(time.Now()); err != nil {
+		fmt.Println("清理生成文件失败:", err.Error())
+	}
 }
 
 // Response 结构体保持不变
@@ -157,193 +242,161 @@ func printHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GenerateDoublePdf(deviceNo, deviceNo1, adobePath string, printInterval int) {
-	imagePath := fmt.Sprintf("%s/%s.jpeg", config.ImageDir, deviceNo)
-	// Create the barcode
-	qrCode, _ := qr.Encode(deviceNo, qr.H, qr.Auto)
-
-	// Scale the barcode to 200x200 pixels
-	qrCode, _ = barcode.Scale(qrCode, 320, 320)
-
-	// create the output file
-	file, _ := os.Create(imagePath)
-	defer file.Close()
-
-	// encode the barcode as png
-	jpeg.Encode(file, qrCode, nil)
-
-	imagePath1 := fmt.Sprintf("%s/%s.jpeg", config.ImageDir, deviceNo1)
-	// Create the barcode
-	qrCode1, _ := qr.Encode(deviceNo1, qr.H, qr.Auto)
-
-	// Scale the barcode to 200x200 pixels
-	qrCode1, _ = barcode.Scale(qrCode1, 320, 320)
-
-	// create the output file
-	file1, _ := os.Create(imagePath1)
-	defer file1.Close()
-
-	// encode the barcode as png
-	jpeg.Encode(file1, qrCode1, nil)
-
-	// 初始化一个pdf
-	// param1: P/L 横屏或者竖屏
-	// param2: mm, cm ... 间距单位,一般是mm
-	// param3: A4,A3,A5 纸张大小
-	// param4: 特定的字体样式
-	pdf := gofpdf.NewCustom(&gofpdf.InitType{
-		OrientationStr: "L",
-		UnitStr:        "mm",
-		SizeStr:        "A4",
-		Size: gofpdf.SizeType{
-			Wd: 400,
-			Ht: 800,
-		},
-		FontDirStr: "",
-	})
-	// 添加新的空白页,在写入内容之前,一定要添加一个空白页
-	pdf.AddPage()
-	// 设置特定的字体,如果是中文字体的话,需要使用其它方法,下面介绍
-	// param1: 字体样式名称,可以引入自己下载的
-	// param2: 字体样式,B,I,U,S,分别是粗体,斜体,下划线,删除线,或者其它
-	// param3: 字体大小
-	pdf.SetFont("Arial", "B", 112)
-	// 新建一个表格单元,也就是一块区域,可以理解为一行
-	// param1: 单元格宽,这里40表示40mm,与new里面的单位有关
-	// param2: 单元格高
-	// param3: 显示的内容
-	// 实际例子中使用的是pdf.CellFormat() 这个api,可以在一行画多个单元格
-	//pdf.Cell(40, 10, "Hello, world")
-
-	//将图片放入到 pdf 文档中
-	//ImageOptions(src, x, y, width, height, flow, options, link, linkStr)
-	pdf.ImageOptions(
-		imagePath,
-		20, 0,
-		320, 320,
-		false,
-		gofpdf.ImageOptions{ImageType: "jpeg", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-	pdf.Text(45, 370, deviceNo)
-	pdf.ImageOptions(
-		imagePath1,
-		460, 0,
-		320, 320,
-		false,
-		gofpdf.ImageOptions{ImageType: "jpeg", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-	pdf.Text(485, 370, deviceNo1)
-	pdfPath := fmt.Sprintf("%s/%s_%s.pdf", config.PdfDir, deviceNo, deviceNo1)
-	herr := pdf.OutputFileAndClose(pdfPath)
-	if herr != nil {
-		fmt.Println(herr.Error())
+	labels, err := BuildDeviceLabel(deviceNo, deviceNo1)
+	if err != nil {
+		fmt.Println("生成二维码失败:", err.Error())
+		return
 	}
 
 	fmt.Println("设备号[", deviceNo, deviceNo1, "]开始打印")
-	pwd, _ := os.Getwd()
-	// 打印二维码
-	//cmd := exec.Command(adobePath, "/p", "/h", "/n", "/s", "/o", pdfPath)
-	CmdBlockExec("cmd", "/k", "start", adobePath, "/p", "/h", filepath.Join(pwd, pdfPath))
-	//CmdSyncExec("cmd", "/k", "start", adobePath, "/p", "/h", pdfPath)
-	time.Sleep(time.Duration(printInterval) * time.Second)
-
-	// 删除pdf
-	//os.Remove(filepath.Join(pwd, pdfPath))
-	// 删除图片
-	//os.Remove(filepath.Join(pwd, imagePath))
-	// 删除图片
-	//os.Remove(filepath.Join(pwd, imagePath1))
+	if err := printLabelsWith(labels, adobePath, printInterval); err != nil {
+		fmt.Println(err.Error())
+	}
+	// 生成的 pdf 由保留策略统一清理，见 RunRetention
 	fmt.Println("设备号[", deviceNo, deviceNo1, "]打印完成")
 }
 
 func GeneratePdf(deviceNo, adobePath string, printInterval int) {
-	imagePath := fmt.Sprintf("%s/%s.jpeg", config.ImageDir, deviceNo)
-	// Create the barcode
-	qrCode, _ := qr.Encode(deviceNo, qr.H, qr.Auto)
+	labels, err := BuildDeviceLabel(deviceNo, "")
+	if err != nil {
+		fmt.Println("生成二维码失败:", err.Error())
+		return
+	}
+
+	fmt.Println("设备号[", deviceNo, "]开始打印")
+	if err := printLabelsWith(labels, adobePath, printInterval); err != nil {
+		fmt.Println(err.Error())
+	}
+	// 生成的 pdf 由保留策略统一清理，见 RunRetention
+	fmt.Println("设备号[", deviceNo, "]打印完成")
+}
 
-	// Scale the barcode to 200x200 pixels
-	qrCode, _ = barcode.Scale(qrCode, 320, 320)
+// BuildDeviceLabel 生成设备号标签版面，左右各一个二维码；deviceNo1 为空时两侧都打印 deviceNo。
+// 模板含重复区域时可能有多页
+func BuildDeviceLabel(deviceNo, deviceNo1 string) ([]*Label, error) {
+	name := deviceNo
+	if deviceNo1 == "" {
+		deviceNo1 = deviceNo
+	} else {
+		name = fmt.Sprintf("%s_%s", deviceNo, deviceNo1)
+	}
 
-	// create the output file
-	file, _ := os.Create(imagePath)
-	defer file.Close()
+	// 码制按 config.toml 的 [device] 在 Build 中替换，与重打共用
+	t, err := LoadTemplate(TemplateDevice)
+	if err != nil {
+		return nil, err
+	}
+	return t.Build(name, map[string]string{"DeviceNo": deviceNo, "DeviceNo1": deviceNo1})
+}
 
-	// encode the barcode as png
-	jpeg.Encode(file, qrCode, nil)
-
-	// 初始化一个pdf
-	// param1: P/L 横屏或者竖屏
-	// param2: mm, cm ... 间距单位,一般是mm
-	// param3: A4,A3,A5 纸张大小
-	// param4: 特定的字体样式
-	pdf := gofpdf.NewCustom(&gofpdf.InitType{
-		OrientationStr: "L",
-		UnitStr:        "mm",
-		SizeStr:        "A4",
-		Size: gofpdf.SizeType{
-			Wd: 400,
-			Ht: 800,
-		},
-		FontDirStr: "",
-	})
-	// 添加新的空白页,在写入内容之前,一定要添加一个空白页
-	pdf.AddPage()
-	// 设置特定的字体,如果是中文字体的话,需要使用其它方法,下面介绍
-	// param1: 字体样式名称,可以引入自己下载的
-	// param2: 字体样式,B,I,U,S,分别是粗体,斜体,下划线,删除线,或者其它
-	// param3: 字体大小
-	pdf.SetFont("Arial", "B", 112)
-	// 新建一个表格单元,也就是一块区域,可以理解为一行
-	// param1: 单元格宽,这里40表示40mm,与new里面的单位有关
-	// param2: 单元格高
-	// param3: 显示的内容
-	// 实际例子中使用的是pdf.CellFormat() 这个api,可以在一行画多个单元格
-	//pdf.Cell(40, 10, "Hello, world")
-
-	//将图片放入到 pdf 文档中
-	//ImageOptions(src, x, y, width, height, flow, options, link, linkStr)
-	pdf.ImageOptions(
-		imagePath,
-		20, 0,
-		320, 320,
-		false,
-		gofpdf.ImageOptions{ImageType: "jpeg", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-	pdf.Text(45, 370, deviceNo)
-	pdf.ImageOptions(
-		imagePath,
-		460, 0,
-		320, 320,
-		false,
-		gofpdf.ImageOptions{ImageType: "jpeg", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-	pdf.Text(485, 370, deviceNo)
-	pdfPath := fmt.Sprintf("%s/%s.pdf", config.PdfDir, deviceNo)
-	herr := pdf.OutputFileAndClose(pdfPath)
-	if herr != nil {
-		fmt.Println(herr.Error())
+// buildDeviceLabels 按打印流程将设备号两两成对生成标签，奇数个时最后一个单独成张
+func buildDeviceLabels(deviceNoArr []string) ([]*Label, error) {
+	var labels []*Label
+	length := len(deviceNoArr)
+	for i := 0; i+1 < length; i += 2 {
+		pages, err := BuildDeviceLabel(strings.TrimSpace(deviceNoArr[i]), strings.TrimSpace(deviceNoArr[i+1]))
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, pages...)
+	}
+	if length%2 == 1 {
+		pages, err := BuildDeviceLabel(strings.TrimSpace(deviceNoArr[length-1]), "")
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, pages...)
 	}
+	return labels, nil
+}
 
-	fmt.Println("设备号[", deviceNo, "]开始打印")
-	pwd, _ := os.Getwd()
-	// 打印二维码
-	//cmd := exec.Command(adobePath, "/p", "/h", "/n", "/s", "/o", pdfPath)
-	//go CmdBlockExec("cmd", "/k", "start", adobePath, "/p", "/h", pdfPath)
-	CmdBlockExec("cmd", "/k", "start", adobePath, "/p", "/h", filepath.Join(pwd, pdfPath))
-	time.Sleep(time.Duration(printInterval) * time.Second)
-
-	// 删除pdf
-	//os.Remove(filepath.Join(pwd, pdfPath))
-	// 删除图片
-	//os.Remove(filepath.Join(pwd, imagePath))
-	fmt.Println("设备号[", deviceNo, "]打印完成")
+// printLabelWith 使用指定的 Adobe Reader 路径和间隔打印标签，返回 PDF 的 sha256
+func printLabelWith(label *Label, adobePath string, printInterval int) (string, error) {
+	pdfPath, hash, err := writeLabelPdf(label)
+	if err != nil {
+		return "", err
+	}
+	return hash, printPdfFile(pdfPath, adobePath, printInterval)
+}
+
+// writeLabelPdf 渲染标签并写入 PdfDir，返回文件路径和 sha256
+func writeLabelPdf(label *Label) (string, string, error) {
+	if err := label.verifyBarcodes(); err != nil {
+		return "", "", err
+	}
+	data, err := RenderLabelPdf(label)
+	if err != nil {
+		return "", "", err
+	}
+	pdfPath := fmt.Sprintf("%s/%s.pdf", config.PdfDir, label.Name)
+	if err := os.WriteFile(pdfPath, data, 0644); err != nil {
+		return "", "", err
+	}
+	hash := ContentHash(data)
+	fmt.Println("[", label.Name, "] sha256:", hash)
+	return pdfPath, hash, nil
+}
+
+// printLabelsWith 依次打印多页标签并写入打印记录，某一页失败时继续打印其余页并返回第一个错误
+func printLabelsWith(labels []*Label, adobePath string, printInterval int) error {
+	return printJobLabels(newPrintJob(labels), labels, adobePath, printInterval)
+}
+
+func printJobLabels(job *PrintJob, labels []*Label, adobePath string, printInterval int) error {
+	var firstErr error
+	for _, label := range labels {
+		hash, err := printLabelWith(label, adobePath, printInterval)
+		if hash != "" {
+			job.Hashes = append(job.Hashes, hash)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	job.finish(true, firstErr)
+	return firstErr
+}
+
+// printPdfFile 调用 Adobe Reader 静默打印 PDF 并等待打印间隔；Adobe Reader 无法启动或在间隔内异常退出时标记文件以便保留
+func printPdfFile(pdfPath, adobePath string, printInterval int) error {
+	interval := time.Duration(printInterval) * time.Second
+	start := time.Now()
+	if err := runAdobePrint(pdfPath, adobePath, interval); err != nil {
+		MarkPrintFailed(pdfPath)
+		return err
+	}
+	clearPrintFailed(pdfPath)
+	time.Sleep(interval - time.Since(start))
+	return nil
+}
+
+// runAdobePrint 启动 Adobe Reader 打印；Reader 打印后通常常驻不退出，等满 wait 仍在运行时视为已交给打印队列
+func runAdobePrint(pdfPath, adobePath string, wait time.Duration) error {
+	absPath, err := filepath.Abs(pdfPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(adobePath); err != nil {
+		return fmt.Errorf("找不到 Adobe Reader(%s): %w", adobePath, err)
+	}
+	cmd := exec.Command(adobePath, "/p", "/h", absPath)
+	fmt.Println(cmd.String())
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动 Adobe Reader 失败: %w", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("Adobe Reader 打印 %s 失败: %w", pdfPath, err)
+		}
+	case <-time.After(wait):
+	}
+	return nil
 }
 
 // printHandler 是处理GET请求的函数
@@ -375,98 +428,33 @@ func printMultiHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func GenerateMultiPdf(deviceNo, adobePath string, printInterval int) {
-	// 将设备号的逗号替换为换行符
-	deviceNo = strings.ReplaceAll(deviceNo, ",", "\n")
-	// 创建二维码图片的文件名
-	fileName := fmt.Sprintf("multiCode_%d", time.Now().UnixMilli())
-	imagePath := fmt.Sprintf("%s/%s.jpeg", config.ImageDir, fileName)
-	// Create the barcode
-	qrCode, err := qr.Encode(deviceNo, qr.H, qr.Auto)
+// GenerateMultiPdf 生成并打印批量二维码，失败时输出并返回错误，便于界面显示
+func GenerateMultiPdf(deviceNo, adobePath string, printInterval int) error {
+	labels, err := BuildMultiLabel(deviceNo)
 	if err != nil {
 		fmt.Println("生成二维码失败:", err.Error())
+		return fmt.Errorf("生成二维码失败: %w", err)
 	}
 
-	// Scale the barcode to 200x200 pixels
-	qrCode, _ = barcode.Scale(qrCode, 600, 600) // 800，800
-
-	// create the output file
-	file, _ := os.Create(imagePath)
-	defer file.Close()
+	fmt.Println("设备号[", labels[0].Name, "]开始打印，共", len(labels), "张")
+	if err := printLabelsWith(labels, adobePath, printInterval); err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
+	// 生成的 pdf 由保留策略统一清理，见 RunRetention
+	fmt.Println("设备号[", labels[0].Name, "]打印完成")
+	return nil
+}
 
-	// encode the barcode as png
-	jpeg.Encode(file, qrCode, nil)
-
-	// 初始化一个pdf
-	// param1: P/L 横屏或者竖屏
-	// param2: mm, cm ... 间距单位,一般是mm
-	// param3: A4,A3,A5 纸张大小
-	// param4: 特定的字体样式
-	pdf := gofpdf.NewCustom(&gofpdf.InitType{
-		OrientationStr: "L",
-		UnitStr:        "mm",
-		SizeStr:        "A4",
-		Size: gofpdf.SizeType{
-			Wd: 840,
-			Ht: 840,
-		},
-		FontDirStr: "",
-	})
-	// 添加新的空白页,在写入内容之前,一定要添加一个空白页
-	pdf.AddPage()
-	// 设置特定的字体,如果是中文字体的话,需要使用其它方法,下面介绍
-	// param1: 字体样式名称,可以引入自己下载的
-	// param2: 字体样式,B,I,U,S,分别是粗体,斜体,下划线,删除线,或者其它
-	// param3: 字体大小
-	pdf.SetFont("Arial", "B", 112)
-	// 新建一个表格单元,也就是一块区域,可以理解为一行
-	// param1: 单元格宽,这里40表示40mm,与new里面的单位有关
-	// param2: 单元格高
-	// param3: 显示的内容
-	// 实际例子中使用的是pdf.CellFormat() 这个api,可以在一行画多个单元格
-	//pdf.Cell(40, 10, "Hello, world")
-
-	//将图片放入到 pdf 文档中
-	//ImageOptions(src, x, y, width, height, flow, options, link, linkStr)
-	pdf.ImageOptions(
-		imagePath,
-		120, 120, // 20，20
-		600, 600, // 800，800
-		false,
-		gofpdf.ImageOptions{ImageType: "jpeg", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-	//pdf.Text(45, 370, deviceNo)
-	//pdf.ImageOptions(
-	//	imagePath,
-	//	460, 0,
-	//	320, 320,
-	//	false,
-	//	gofpdf.ImageOptions{ImageType: "jpeg", ReadDpi: false, AllowNegativePosition: true},
-	//	0,
-	//	"",
-	//)
-	//pdf.Text(485, 370, deviceNo)
-	pdfPath := fmt.Sprintf("%s/%s.pdf", config.PdfDir, fileName)
-	herr := pdf.OutputFileAndClose(pdfPath)
-	if herr != nil {
-		fmt.Println(herr.Error())
-	}
-
-	fmt.Println("设备号[", fileName, "]开始打印")
-	pwd, _ := os.Getwd()
-	// 打印二维码
-	//cmd := exec.Command(adobePath, "/p", "/h", "/n", "/s", "/o", pdfPath)
-	//go CmdBlockExec("cmd", "/k", "start", adobePath, "/p", "/h", pdfPath)
-	CmdBlockExec("cmd", "/k", "start", adobePath, "/p", "/h", filepath.Join(pwd, pdfPath))
-	time.Sleep(time.Duration(printInterval) * time.Second)
-
-	// 删除pdf
-	//os.Remove(filepath.Join(pwd, pdfPath))
-	// 删除图片
-	//os.Remove(filepath.Join(pwd, imagePath))
-	fmt.Println("设备号[", fileName, "]打印完成")
+// BuildMultiLabel 生成批量二维码版面，所有设备号放在一个大二维码中，超出密度限制时按模板拆分
+func BuildMultiLabel(deviceNo string) ([]*Label, error) {
+	t, err := LoadTemplate(TemplateMulti)
+	if err != nil {
+		return nil, err
+	}
+	// 将设备号的逗号替换为换行符
+	deviceNo = strings.ReplaceAll(deviceNo, ",", "\n")
+	return t.Build(fmt.Sprintf("multiCode_%d", time.Now().UnixMilli()), map[string]string{"DeviceNos": deviceNo})
 }
 
 // printHandler 是处理GET请求的函数
@@ -474,9 +462,29 @@ func printMultiTagHandler(w http.ResponseWriter, r *http.Request) {
 	// 设置响应的内容类型为JSON
 	w.Header().Set("Content-Type", "application/json")
 
+	excelData := tagDataFromQuery(r.URL.Query())
+
+	// 创建一个Response实例
+	resp := &Response{
+		Code:    0,
+		Message: validateTagData(excelData),
+	}
+	if resp.Message != "" {
+		resp.Code = -1
+		json.NewEncoder(w).Encode(resp)
+	} else {
+		normalizeTagData(excelData)
+		//生成二维码
+		go GenerateMultiTagPdf(excelData)
+
+		// 将Response实例编码为JSON并写入响应体
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// tagDataFromQuery 从查询字符串读取标签数据
+func tagDataFromQuery(queryParams url.Values) *ExcelData {
 	excelData := new(ExcelData)
-	// 获取查询字符串
-	queryParams := r.URL.Query()
 	excelData.ProductName = queryParams.Get("productName")
 	excelData.ProductColor = queryParams.Get("productColor")
 	excelData.ProductDate = queryParams.Get("productDate")
@@ -486,329 +494,213 @@ func printMultiTagHandler(w http.ResponseWriter, r *http.Request) {
 	excelData.BarCode69Type = queryParams.Get("barCode69Type")
 	excelData.BoxNum = queryParams.Get("boxNum")
 	excelData.DeviceNos = queryParams.Get("deviceNos") // 通过键名获取参数值，如果不存在则返回空字符串
+	excelData.Customer = queryParams.Get("customer")
+	excelData.Template = queryParams.Get("template")
+	excelData.Language = queryParams.Get("language")
+	excelData.Gtin = queryParams.Get("gtin")
+	excelData.Lot = queryParams.Get("lot")
+	excelData.Sscc = queryParams.Get("sscc")
+	excelData.QrFormat = queryParams.Get("qrFormat")
+	return excelData
+}
 
-	// 创建一个Response实例
-	resp := &Response{
-		Code:    0,
-		Message: "",
-	}
+// validateTagData 校验标签必填项，返回错误提示，全部填写时返回空字符串
+func validateTagData(excelData *ExcelData) string {
 	if excelData.ProductName == "" {
-		resp.Message = "请输入产品名称"
+		return "请输入产品名称"
 	} else if excelData.ProductColor == "" {
-		resp.Message = "请输入产品颜色"
+		return "请输入产品颜色"
 	} else if excelData.ProductDate == "" {
-		resp.Message = "请输入产品生产日期"
+		return "请输入产品生产日期"
 	} else if excelData.ProductNum == "" {
-		resp.Message = "请输入产品数量"
+		return "请输入产品数量"
 	} else if excelData.GrossWeight == "" {
-		resp.Message = "请输入产品毛重"
+		return "请输入产品毛重"
 	} else if excelData.NetWeight == "" {
-		resp.Message = "请输入产品净重"
+		return "请输入产品净重"
 	} else if excelData.BarCode69Type == "" {
-		resp.Message = "请输入条码类型"
+		return "请输入条码类型"
+	} else if !isBarCode69Type(excelData.BarCode69Type) {
+		return fmt.Sprintf("条码类型 %q 只能包含字母、数字、下划线和 -", excelData.BarCode69Type)
 	} else if excelData.BoxNum == "" {
-		resp.Message = "请输入箱数"
+		return "请输入箱数"
 	} else if excelData.DeviceNos == "" {
-		resp.Message = "请输入设备号"
+		return "请输入设备号"
 	}
-	if resp.Message != "" {
-		resp.Code = -1
-		json.NewEncoder(w).Encode(resp)
-	} else {
-		excelData.BarCode69Type = fmt.Sprintf("%s-69.png", excelData.BarCode69Type)
-
-		//设备号前面拼接箱号，连接符取设备号的连接符,或者\n,没有箱号时，则使用设备号
-		if excelData.BoxNum != "" {
-			if strings.Contains(excelData.DeviceNos, "|") {
-				excelData.DeviceNos = fmt.Sprintf("%s|%s", excelData.BoxNum, excelData.DeviceNos)
-			} else {
-				excelData.DeviceNos = fmt.Sprintf("%s,%s", excelData.BoxNum, excelData.DeviceNos)
-			}
+	if excelData.Gtin != "" {
+		if _, err := NormalizeGtin(excelData.Gtin); err != nil {
+			return err.Error()
 		}
-		excelData.DeviceNos = strings.ReplaceAll(excelData.DeviceNos, "|", "\n")
-		//生成二维码
-		go GenerateMultiTagPdf(excelData)
-
-		// 将Response实例编码为JSON并写入响应体
-		json.NewEncoder(w).Encode(resp)
 	}
-}
-
-func GenerateMultiTagPdf(excelData *ExcelData) {
-	barcodePath, err := BarCode(excelData.BoxNum)
-	if err != nil {
-		fmt.Println("生成条形码失败:", err.Error())
-		return
+	if excelData.Sscc != "" {
+		if _, err := NormalizeSscc(excelData.Sscc); err != nil {
+			return err.Error()
+		}
 	}
+	return ""
+}
 
-	// 创建二维码图片的文件名
-	codeFileName := fmt.Sprintf("qrcode_%s", excelData.BoxNum)
-	imagePath := fmt.Sprintf("%s/%s.png", config.ImageDir, codeFileName)
+// normalizeTagData 处理接口传入的条码类型和设备号
+func normalizeTagData(excelData *ExcelData) {
+	excelData.BarCode69Type = fmt.Sprintf("%s-69.png", excelData.BarCode69Type)
 
-	// 1. 创建二维码对象
-	qr2, err := qrcode2.New(excelData.DeviceNos, qrcode.Medium) // Medium 纠错等级
-	if err != nil {
-		fmt.Println("生成二维码失败:", err.Error())
-		return
+	//设备号前面拼接箱号，连接符取设备号的连接符,或者\n,没有箱号时，则使用设备号
+	if excelData.BoxNum != "" {
+		if strings.Contains(excelData.DeviceNos, "|") {
+			excelData.DeviceNos = fmt.Sprintf("%s|%s", excelData.BoxNum, excelData.DeviceNos)
+		} else {
+			excelData.DeviceNos = fmt.Sprintf("%s,%s", excelData.BoxNum, excelData.DeviceNos)
+		}
 	}
+	excelData.DeviceNos = strings.ReplaceAll(excelData.DeviceNos, "|", "\n")
+}
 
-	// 2. 去掉边距（默认是 4 模块宽）
-	qr2.DisableBorder = true
+// exportHandler 导出标签图片，参数与打印接口相同，另加 kind(device/multi/tag)、format(png/svg/pdf)、dpi 和 page
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	kind := queryParams.Get("kind")
+	format := strings.ToLower(queryParams.Get("format"))
+	if format == "" {
+		format = FormatPng
+	}
+	dpi := StringToInt(queryParams.Get("dpi"))
+	page := StringToInt(queryParams.Get("page"))
+
+	excelData := tagDataFromQuery(queryParams)
+	resp := &Response{Code: -1}
+	if kind == KindTag {
+		if resp.Message = validateTagData(excelData); resp.Message == "" {
+			normalizeTagData(excelData)
+		}
+	} else if excelData.DeviceNos == "" {
+		resp.Message = "请输入设备号"
+	}
+	if resp.Message == "" {
+		labels, err := BuildLabels(kind, excelData)
+		if err == nil && (page < 0 || page >= len(labels)) {
+			err = fmt.Errorf("页码超出范围: 共 %d 张", len(labels))
+		}
+		if err == nil {
+			var data []byte
+			if data, err = RenderLabel(labels[page], format, dpi); err == nil {
+				w.Header().Set("Content-Type", contentTypeOf(format))
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", labels[page].Name+"."+format))
+				w.Write(data)
+				return
+			}
+		}
+		resp.Message = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
 
-	// 3. 写入文件，指定图片像素大小
-	err = qr2.WriteFile(1000, imagePath)
+// GenerateMultiTagPdf 生成并打印产品标签，失败时输出并返回错误，便于界面显示
+func GenerateMultiTagPdf(excelData *ExcelData) error {
+	if err := assignTagSscc(excelData); err != nil {
+		fmt.Println("生成标签失败:", err.Error())
+		return fmt.Errorf("生成标签失败: %w", err)
+	}
+	labels, err := BuildTagLabel(excelData)
 	if err != nil {
-		fmt.Println("生成二维码失败:", err.Error())
-		return
+		fmt.Println("生成标签失败:", err.Error())
+		return fmt.Errorf("生成标签失败: %w", err)
 	}
 
-	//err = qrcode2.WriteFile(excelData.DeviceNos, qrcode.Medium, 1000, imagePath)
-	//if err != nil {
-	//	fmt.Println("生成二维码失败:", err.Error())
-	//	return
-	//}
-
-	// 初始化一个pdf
-	// param1: P/L 横屏或者竖屏
-	// param2: mm, cm ... 间距单位,一般是mm
-	// param3: A4,A3,A5 纸张大小
-	// param4: 特定的字体样式
-	pdf := gofpdf.NewCustom(&gofpdf.InitType{
-		OrientationStr: "P",
-		UnitStr:        "mm",
-		SizeStr:        "A4",
-		Size: gofpdf.SizeType{
-			Wd: 1000,
-			Ht: 600,
-		},
-		FontDirStr: "",
-	})
-
-	// 添加中文字体支持
-	fontPaths := findfont.List()
-	var fontPath string
-	for _, path := range fontPaths {
-		if strings.Contains(path, "msyh.ttf") || strings.Contains(path, "simhei.ttf") || strings.Contains(path, "simsun.ttc") || strings.Contains(path, "simkai.ttf") {
-			fontPath = path
-			break
-		}
+	fmt.Println("箱号[", excelData.BoxNum, "]开始打印，模板:", labels[0].Template, "共", len(labels), "页")
+	if err := printLabelsWith(labels, config.AdobePath, config.PrintInterval); err != nil {
+		fmt.Println(err.Error())
+		return err
 	}
-	//fontPath = "./PingFang Regular_0.ttf"
-
-	if fontPath != "" {
-		// 添加UTF-8字体支持
-		pdf.AddUTF8Font("微软雅黑", "", fontPath)
-		pdf.AddUTF8Font("微软雅黑", "B", fontPath)
-		// 设置字体为微软雅黑
-		pdf.SetFont("微软雅黑", "", 100)
-	} else {
-		// 如果找不到中文字体，则使用默认字体
-		pdf.SetFont("Arial", "B", 100)
-	}
-
-	// 添加新的空白页,在写入内容之前,一定要添加一个空白页
-	pdf.AddPage()
-
-	pdf.ImageOptions(
-		imagePath,
-		640, 240, // 20，20
-		340, 340, // 800，800
-		false,
-		gofpdf.ImageOptions{ImageType: "png", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-
-	pdf.ImageOptions(
-		"resources/images/"+excelData.BarCode69Type,
-		20, 230,
-		580, 165, // 600，170
-		false,
-		gofpdf.ImageOptions{ImageType: "png", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-
-	pdf.ImageOptions(
-		barcodePath,
-		20, 410, // 20，20
-		560, 110, // 800，800
-		false,
-		gofpdf.ImageOptions{ImageType: "png", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-
-	pdf.Text(40, 60, "产品名称: "+excelData.ProductName)
-	pdf.Text(40, 120, "产品颜色: "+excelData.ProductColor)
-	pdf.Text(40, 180, "产品日期: "+excelData.ProductDate)
-
-	pdf.Text(570, 60, "产品数量: "+excelData.ProductNum+"PCS")
-	pdf.Text(570, 120, "净    重: "+excelData.NetWeight+"KG")
-	pdf.Text(570, 180, "毛    重: "+excelData.GrossWeight+"KG")
-
-	pdf.Text(640, 230, "SN:")
-
-	pdf.Text(90, 560, "箱号:"+excelData.BoxNum)
-
-	pdfPath := fmt.Sprintf("%s/%s.pdf", config.PdfDir, excelData.BoxNum)
-	herr := pdf.OutputFileAndClose(pdfPath)
-	if herr != nil {
-		fmt.Println(herr.Error())
-	}
-
-	fmt.Println("箱号[", excelData.BoxNum, "]开始打印")
-	pwd, _ := os.Getwd()
-	// 打印二维码
-	CmdBlockExec("cmd", "/k", "start", config.AdobePath, "/p", "/h", filepath.Join(pwd, pdfPath))
-	time.Sleep(time.Duration(config.PrintInterval) * time.Second)
 	fmt.Println("箱号[", excelData.BoxNum, "]标签生成成功")
+	return nil
+}
+
+// BuildTagLabel 按产品标签模板生成版面，模板含重复区域(如装箱单)时可能有多页
+func BuildTagLabel(excelData *ExcelData) ([]*Label, error) {
+	return buildTagLabel(excelData.BoxNum, excelData)
 }
 
 func GenerateMultiPdfByExcel(excelData *ExcelData) {
-	barcodePath, err := BarCode(excelData.BoxNum)
-	if err != nil {
-		fmt.Println("生成条形码失败:", err.Error())
+	if err := assignTagSscc(excelData); err != nil {
+		fmt.Println("生成标签失败:", err.Error())
 		return
 	}
-
-	// 创建二维码图片的文件名
-	codeFileName := fmt.Sprintf("qrcode_%s", excelData.BoxNum)
-	imagePath := fmt.Sprintf("%s/%s.png", config.ImageDir, codeFileName)
-
-	// 1. 创建二维码对象
-	qr2, err := qrcode2.New(excelData.DeviceNos, qrcode.Medium) // Medium 纠错等级
+	labels, err := BuildExcelTagLabel(excelData)
 	if err != nil {
-		fmt.Println("生成二维码失败:", err.Error())
+		fmt.Println("生成标签失败:", err.Error())
 		return
 	}
+	job := newPrintJob(labels)
+	for _, label := range labels {
+		_, hash, err := writeLabelPdf(label)
+		if err != nil {
+			fmt.Println(err.Error())
+			job.finish(false, err)
+			return
+		}
+		job.Hashes = append(job.Hashes, hash)
+	}
+	job.finish(false, nil)
 
-	// 2. 去掉边距（默认是 4 模块宽）
-	qr2.DisableBorder = true
+	// Excel 批量生成只输出 PDF，由人工到 pdfs 目录打印
+	// 生成的 pdf 由保留策略统一清理，见 RunRetention
+	fmt.Println("箱号[", excelData.BoxNum, "]标签生成成功")
+}
 
-	// 3. 写入文件，指定图片像素大小
-	err = qr2.WriteFile(1000, imagePath)
-	if err != nil {
-		fmt.Println("生成二维码失败:", err.Error())
-		return
+// BuildExcelTagLabel 生成 Excel 导入的产品标签版面，与界面打印使用同一模板，文件名带上 Excel 文件名
+func BuildExcelTagLabel(excelData *ExcelData) ([]*Label, error) {
+	return buildTagLabel(excelData.FileName+"_"+excelData.BoxNum, excelData)
+}
+
+func buildTagLabel(name string, excelData *ExcelData) ([]*Label, error) {
+	// 条码类型拼接为 resources/images 下的图片路径
+	if !isBarCode69Type(excelData.BarCode69Type) {
+		return nil, fmt.Errorf("条码类型 %q 只能包含字母、数字、下划线和 -", strings.TrimSuffix(excelData.BarCode69Type, "-69.png"))
 	}
+	t, err := LoadTemplate(SelectTagTemplate(excelData))
+	if err != nil {
+		return nil, err
+	}
+	devices := deviceList(excelData)
+	fields := excelDataFields(excelData)
+	fields["DeviceList"] = strings.Join(devices, "\n")
+	fields["DeviceCount"] = strconv.Itoa(len(devices))
+	fields["Gtin"] = tagGtin(excelData)
+	if gtin, err := NormalizeGtin(fields["Gtin"]); err == nil {
+		fields["Gtin"] = gtin
+	}
+	fields["GS1"] = cartonGs1(excelData, fields["Gtin"])
+	fields["Itf14"] = tagItf14(fields["Gtin"])
+	// 没有分配 SSCC 时为空，模板按 when = "SSCC" 判断
+	fields["SSCC"] = ""
+	if sscc, err := NormalizeSscc(excelData.Sscc); err == nil {
+		fields["SSCC"] = sscc
+	}
+	if fields["BoxQr"], err = tagBoxQr(excelData, fields); err != nil {
+		return nil, err
+	}
+	return t.Build(name, fields)
+}
 
-	//err = qrcode2.WriteFile(excelData.DeviceNos, qrcode.Medium, 1000, imagePath)
-	//if err != nil {
-	//	fmt.Println("生成二维码失败:", err.Error())
-	//	return
-	//}
-
-	// 初始化一个pdf
-	// param1: P/L 横屏或者竖屏
-	// param2: mm, cm ... 间距单位,一般是mm
-	// param3: A4,A3,A5 纸张大小
-	// param4: 特定的字体样式
-	pdf := gofpdf.NewCustom(&gofpdf.InitType{
-		OrientationStr: "P",
-		UnitStr:        "mm",
-		SizeStr:        "A4",
-		Size: gofpdf.SizeType{
-			Wd: 1000,
-			Ht: 600,
-		},
-		FontDirStr: "",
-	})
-
-	// 添加中文字体支持
-	fontPaths := findfont.List()
-	var fontPath string
-	for _, path := range fontPaths {
-		if strings.Contains(path, "msyh.ttf") || strings.Contains(path, "simhei.ttf") || strings.Contains(path, "simsun.ttc") || strings.Contains(path, "simkai.ttf") {
-			fontPath = path
-			break
+// isBarCode69Type 条码类型(可带 -69.png 后缀)是否只由字母、数字、下划线和 - 组成
+func isBarCode69Type(value string) bool {
+	value = strings.TrimSuffix(value, "-69.png")
+	for _, r := range value {
+		if !(r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return false
 		}
 	}
-	//fontPath = "./PingFang Regular_0.ttf"
+	return value != ""
+}
 
-	if fontPath != "" {
-		// 添加UTF-8字体支持
-		pdf.AddUTF8Font("微软雅黑", "", fontPath)
-		pdf.AddUTF8Font("微软雅黑", "B", fontPath)
-		// 设置字体为微软雅黑
-		pdf.SetFont("微软雅黑", "", 100)
-	} else {
-		// 如果找不到中文字体，则使用默认字体
-		pdf.SetFont("Arial", "B", 100)
-	}
-
-	// 添加新的空白页,在写入内容之前,一定要添加一个空白页
-	pdf.AddPage()
-
-	pdf.ImageOptions(
-		imagePath,
-		640, 240, // 20，20
-		340, 340, // 800，800
-		false,
-		gofpdf.ImageOptions{ImageType: "png", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-
-	pdf.ImageOptions(
-		"resources/images/"+excelData.BarCode69Type,
-		10, 230,
-		580, 165, // 600，170
-		false,
-		gofpdf.ImageOptions{ImageType: "png", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-
-	pdf.ImageOptions(
-		barcodePath,
-		26, 410, // 20，20
-		560, 110, // 800，800
-		false,
-		gofpdf.ImageOptions{ImageType: "png", ReadDpi: false, AllowNegativePosition: true},
-		0,
-		"",
-	)
-
-	pdf.Text(40, 60, "产品名称："+excelData.ProductName)
-	pdf.Text(40, 120, "产品颜色："+excelData.ProductColor)
-	pdf.Text(40, 180, "产品日期："+excelData.ProductDate)
-
-	pdf.Text(570, 60, "产品数量："+excelData.ProductNum+"PCS")
-	pdf.Text(570, 120, "净    重："+excelData.NetWeight+"KG")
-	pdf.Text(570, 180, "毛    重："+excelData.GrossWeight+"KG")
-
-	pdf.Text(640, 230, "SN：")
-
-	pdf.Text(90, 560, "箱号："+excelData.BoxNum)
-
-	pdfPath := fmt.Sprintf("%s/%s.pdf", config.PdfDir, excelData.FileName+"_"+excelData.BoxNum)
-	herr := pdf.OutputFileAndClose(pdfPath)
-	if herr != nil {
-		fmt.Println(herr.Error())
-	}
-
-	//fmt.Println("设备号[", fileName, "]开始打印")
-	//pwd, _ := os.Getwd()
-	// 打印二维码
-	//CmdBlockExec("cmd", "/k", "start", config.AdobePath, "/p", "/h", filepath.Join(pwd, pdfPath))
-	//time.Sleep(time.Duration(config.PrintInterval) * time.Second)
-
-	////cmd := exec.Command(adobePath, "/p", "/h", "/n", "/s", "/o", pdfPath)
-	////go CmdBlockExec("cmd", "/k", "start", adobePath, "/p", "/h", pdfPath)
-
-	//后台打印二维码
-	////cmd := exec.Command("cmd","/c", "start","/b","", config.AdobePath, "/p", "/h", filepath.Join(pwd, pdfPath))
-	////err = cmd.Start() // Start 不会阻塞
-	////if err != nil {
-	////	fmt.Println("打印启动失败:", err)
-	////}
-
-	// 删除pdf
-	//os.Remove(filepath.Join(pwd, pdfPath))
-	// 删除图片
-	//os.Remove(filepath.Join(pwd, imagePath))
-	fmt.Println("箱号[", excelData.BoxNum, "]标签生成成功")
+// deviceList 返回设备号列表，接口和界面打印时设备号前拼接的箱号不计入
+func deviceList(excelData *ExcelData) []string {
+	items := splitList(excelData.DeviceNos)
+	if len(items) > 0 && excelData.BoxNum != "" && items[0] == excelData.BoxNum {
+		items = items[1:]
+	}
+	return items
 }
 
 // CmdSyncExec 协程执行命令
@@ -827,14 +719,18 @@ func CmdSyncExec(name string, arg ...string) {
 }
 
 // CmdBlockExec 阻塞执行命令
-func CmdBlockExec(name string, arg ...string) {
+func CmdBlockExec(name string, arg ...string) error {
 	cmd := exec.Command(name, arg...)
-	if err := cmd.Run(); err != nil {
-		//fmt.Println(err.Error())
+	err := cmd.Run()
+	if err != nil {
+		fmt.Println(err.Error())
 	}
 	fmt.Println(cmd.String())
 
-	defer cmd.Process.Kill()
+	if cmd.Process != nil {
+		defer cmd.Process.Kill()
+	}
+	return err
 }
 
 // StringToInt string 转 int
@@ -847,19 +743,8 @@ func StringToInt(str string) int {
 }
 
 func BarCode(content string) (imagePath string, err error) {
-
-	// 生成条形码
-	var barCode barcode.Barcode
-	barCode, err = code128.Encode(content)
-	if err != nil {
-		fmt.Println("生成条形码失败：", err.Error())
-		return "", err
-	}
-
-	// 可选：调整条形码大小
-	barCode, err = barcode.Scale(barCode, 200, 50) // 宽200px，高50px
+	img, err := barCodeImage(content)
 	if err != nil {
-		fmt.Println("调整条形码大小失败：", err.Error())
 		return "", err
 	}
 
@@ -879,11 +764,6 @@ func BarCode(content string) (imagePath string, err error) {
 	}
 	defer file.Close()
 
-	// 将条形码转换为标准RGBA图像以避免16位色深问题
-	bounds := barCode.Bounds()
-	img := image.NewRGBA(bounds)
-	draw.Draw(img, bounds, barCode, bounds.Min, draw.Src)
-
 	// 将条形码编码为 PNG 并写入文件
 	err = png.Encode(file, img)
 	if err != nil {
@@ -895,66 +775,55 @@ func BarCode(content string) (imagePath string, err error) {
 	return filePath, nil
 }
 
-// BarCode69 生成69码(EAN-13)条形码
-func BarCode69(content string) (imagePath string, err error) {
-	// 验证输入
-	if len(content) != 13 {
-		return "", fmt.Errorf("69码内容必须是13位数字")
+// barCodeImage 生成箱号 Code128 条形码图片
+func barCodeImage(content string) (*image.RGBA, error) {
+	// 生成条形码
+	var barCode barcode.Barcode
+	barCode, err := code128.Encode(content)
+	if err != nil {
+		fmt.Println("生成条形码失败：", err.Error())
+		return nil, err
 	}
 
-	if !strings.HasPrefix(content, "69") {
-		return "", fmt.Errorf("69码必须以69开头")
+	// 可选：调整条形码大小
+	barCode, err = barcode.Scale(barCode, 200, 50) // 宽200px，高50px
+	if err != nil {
+		fmt.Println("调整条形码大小失败：", err.Error())
+		return nil, err
 	}
 
-	// 验证是否全部为数字
-	for _, r := range content {
-		if r < '0' || r > '9' {
-			return "", fmt.Errorf("69码只能包含数字")
-		}
-	}
+	// 将条形码转换为标准RGBA图像以避免16位色深问题
+	bounds := barCode.Bounds()
+	img := image.NewRGBA(bounds)
+	draw.Draw(img, bounds, barCode, bounds.Min, draw.Src)
+	return img, nil
+}
 
-	// 生成EAN-13条形码
-	var barCode barcode.Barcode
-	barCode, err = ean.Encode(content)
+// BarCode69 生成69码(EAN-13)条形码图片，content 为 12 或 13 位 GTIN，样式和大小与原 69 码图片相同
+func BarCode69(content string) (imagePath string, err error) {
+	gtin, err := NormalizeGtin(content)
 	if err != nil {
 		fmt.Println("生成69码失败：", err.Error())
 		return "", err
 	}
-
-	// 调整条形码大小
-	barCode, err = barcode.Scale(barCode, 300, 100) // 宽300px，高100px
+	data, err := ean13Png(gtin, ean13DefaultPixels, 0)
 	if err != nil {
-		fmt.Println("调整69码大小失败：", err.Error())
+		fmt.Println("生成69码失败：", err.Error())
 		return "", err
 	}
 
 	// 创建输出文件
-	filePath := "barcode/69_" + content + ".png"
+	filePath := "barcode/69_" + gtin + ".png"
 	// 确保目录存在
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		fmt.Println("创建目录失败：", err.Error())
 		return "", err
 	}
-
-	file, err := os.Create(filePath)
-	if err != nil {
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
 		fmt.Println("创建输出文件失败：", err.Error())
 		return "", err
 	}
-	defer file.Close()
-
-	// 将条形码转换为标准RGBA图像以避免16位色深问题
-	bounds := barCode.Bounds()
-	img := image.NewRGBA(bounds)
-	draw.Draw(img, bounds, barCode, bounds.Min, draw.Src)
-
-	// 将条形码编码为 PNG 并写入文件
-	err = png.Encode(file, img)
-	if err != nil {
-		fmt.Println("将69码编码为 PNG 失败：", err.Error())
-		return "", err
-	}
 
 	println("69码已生成：" + filePath)
 	return filePath, nil
@@ -979,8 +848,22 @@ type ExcelData struct {
 	BoxNum string `json:"boxNum"`
 	//69码类型
 	BarCode69Type string `json:"barCode69Type"`
+	//商品条码(GTIN/EAN-13)，为空时按条码类型查找 config.toml 的 [gtins]
+	Gtin string `json:"gtin"`
+	//批号，用于 GS1-128 的 (10)
+	Lot string `json:"lot"`
+	//托盘 SSCC，为空时打印引用 SSCC 的模板会自动分配
+	Sscc string `json:"sscc"`
 	//文件名
 	FileName string `json:"fileName"`
+	//客户，用于按规则选择模板
+	Customer string `json:"customer"`
+	//指定模板，为空时按 templateRules 选择
+	Template string `json:"template"`
+	//标题语言，如 en、zh+en，为空时使用模板或配置的语言
+	Language string `json:"language"`
+	//箱标二维码格式 legacy/lines/csv/json/link，为空时使用 config.toml 的 [boxQr]
+	QrFormat string `json:"qrFormat"`
 }
 
 // ParseExcel 解析导入excel文件
@@ -1029,6 +912,18 @@ func ParseExcel(fileName string) (data []*ExcelData, err error) {
 					excelData.GrossWeight = value
 				case 7: //设备号
 					excelData.DeviceNos = value
+				case 8: //客户(可选)
+					excelData.Customer = value
+				case 9: //模板(可选)
+					excelData.Template = value
+				case 10: //语言(可选)
+					excelData.Language = value
+				case 11: //商品条码(可选)
+					excelData.Gtin = value
+				case 12: //批号(可选)
+					excelData.Lot = value
+				case 13: //箱标二维码格式(可选)
+					excelData.QrFormat = value
 				}
 			}
 			if excelData.BoxNum == "" {
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"github.com/boombuler/barcode/qr"
+	"github.com/skip2/go-qrcode"
+)
+
+// 二维码编码库
+const (
+	qrLibrarySkip2     = "skip2"
+	qrLibraryBoombuler = "boombuler"
+)
+
+// 二维码编码模式: auto 自动选择，numeric 纯数字，alphanumeric 数字、大写字母及 空格$%*+-./:，byte 任意内容(UTF-8)
+const (
+	qrModeAuto         = "auto"
+	qrModeNumeric      = "numeric"
+	qrModeAlphanumeric = "alphanumeric"
+	qrModeByte         = "byte"
+)
+
+// 默认四周空白 4 个模块，为二维码标准要求的最小值，无空白时部分扫码枪无法识别
+const qrDefaultQuietZone = 4
+
+// QrConfig 某类标签的二维码参数，未设置的项使用默认值；模板元素中设置的项优先
+type QrConfig struct {
+	// 纠错等级 L/M/Q/H
+	Level string
+	// 四周空白(模块数)，未设置时为 4，0 表示不留空白
+	QuietZone *int
+	// 编码模式 auto/numeric/alphanumeric/byte，只有 boombuler 能指定，skip2 只能为 auto
+	Mode string
+	// 编码库 skip2/boombuler
+	Library string
+}
+
+// qrcodeLevels 二维码纠错等级
+var qrcodeLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// qrKindLevels 各类标签默认的纠错等级: 设备号和批量二维码用 H，产品标签用 M
+var qrKindLevels = map[string]string{
+	KindDevice: "H",
+	KindMulti:  "H",
+	KindTag:    "M",
+}
+
+// qrOptions 生成二维码时实际使用的参数；maxVersion、minModule 为拆分时的密度限制，为 0 时使用默认值
+type qrOptions struct {
+	level     string
+	quietZone int
+	mode      string
+	library   string
+
+	maxVersion int
+	minModule  float64
+}
+
+// qrLabelKind 按模板名返回标签类型，设备号和批量二维码以外的模板都是产品标签
+func qrLabelKind(template string) string {
+	switch template {
+	case TemplateDevice:
+		return KindDevice
+	case TemplateMulti:
+		return KindMulti
+	}
+	return KindTag
+}
+
+// qrOptions 按模板元素、生成版面时的设置(config.toml 的 [qrcode.<标签类型>]、[qrSplit])、默认值的顺序确定二维码参数
+func (e *TemplateElement) qrOptions(template string, s labelSettings) qrOptions {
+	kind := qrLabelKind(template)
+	opt := qrOptions{level: qrKindLevels[kind], quietZone: qrDefaultQuietZone, mode: qrModeAuto, library: qrLibrarySkip2}
+	if s.QrSplit != nil {
+		opt.maxVersion, opt.minModule = s.QrSplit.MaxVersion, s.QrSplit.MinModule
+	}
+	if s.Qrcode != nil {
+		c := *s.Qrcode
+		if c.Level != "" {
+			opt.level = c.Level
+		}
+		if c.QuietZone != nil {
+			opt.quietZone = *c.QuietZone
+		}
+		if c.Mode != "" {
+			opt.mode = c.Mode
+		}
+		if c.Library != "" {
+			opt.library = c.Library
+		}
+	}
+	if e.Level != "" {
+		opt.level = e.Level
+	}
+	if e.QuietZone != nil {
+		opt.quietZone = *e.QuietZone
+	} else if e.Border && opt.quietZone < qrDefaultQuietZone {
+		opt.quietZone = qrDefaultQuietZone
+	}
+	if e.Mode != "" {
+		opt.mode = e.Mode
+	}
+	if e.Library != "" {
+		opt.library = e.Library
+	}
+	opt.level = strings.ToUpper(opt.level)
+	opt.mode = strings.ToLower(opt.mode)
+	opt.library = strings.ToLower(opt.library)
+	return opt
+}
+
+// check 检查二维码参数
+func (o qrOptions) check() error {
+	if _, ok := qrcodeLevels[o.level]; !ok {
+		return fmt.Errorf("不支持的纠错等级 %s，可选 L、M、Q、H", o.level)
+	}
+	if o.quietZone < 0 {
+		return fmt.Errorf("二维码空白 quietZone 不能为负数")
+	}
+	switch o.mode {
+	case qrModeAuto, qrModeNumeric, qrModeAlphanumeric, qrModeByte:
+	default:
+		return fmt.Errorf("不支持的编码模式 %s，可选 auto、numeric、alphanumeric、byte", o.mode)
+	}
+	switch o.library {
+	case qrLibrarySkip2, qrLibraryBoombuler:
+	default:
+		return fmt.Errorf("不支持的二维码编码库 %s，可选 skip2、boombuler", o.library)
+	}
+	// skip2 总是按内容自动选择编码模式，无法指定
+	if o.library == qrLibrarySkip2 && o.mode != qrModeAuto {
+		return fmt.Errorf("skip2 会自动选择编码模式，指定 %s 模式请使用 library = \"boombuler\"", o.mode)
+	}
+	return nil
+}
+
+// checkQrMode 检查内容能否按指定模式编码
+func checkQrMode(content, mode string) error {
+	for _, r := range content {
+		switch {
+		case mode == qrModeNumeric && (r < '0' || r > '9'):
+			return fmt.Errorf("numeric 模式只能编码数字，内容中有 %q", r)
+		case mode == qrModeAlphanumeric && !strings.ContainsRune("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:", r):
+			return fmt.Errorf("alphanumeric 模式只能编码数字、大写字母和 空格$%%*+-./:，内容中有 %q", r)
+		}
+	}
+	return nil
+}
+
+// qrMatrix 按参数编码二维码，返回不含空白的模块矩阵，true 为深色；所有二维码都经过这里生成
+func qrMatrix(content string, opt qrOptions) ([][]bool, error) {
+	if err := opt.check(); err != nil {
+		return nil, err
+	}
+	if err := checkQrMode(content, opt.mode); err != nil {
+		return nil, err
+	}
+	if opt.library == qrLibraryBoombuler {
+		modes := map[string]qr.Encoding{qrModeAuto: qr.Auto, qrModeNumeric: qr.Numeric, qrModeAlphanumeric: qr.AlphaNumeric, qrModeByte: qr.Unicode}
+		levels := map[string]qr.ErrorCorrectionLevel{"L": qr.L, "M": qr.M, "Q": qr.Q, "H": qr.H}
+		code, err := qr.Encode(content, levels[opt.level], modes[opt.mode])
+		if err != nil {
+			return nil, err
+		}
+		n := code.Bounds().Dx()
+		matrix := make([][]bool, n)
+		for y := range matrix {
+			matrix[y] = make([]bool, n)
+			for x := range matrix[y] {
+				r, _, _, _ := code.At(x, y).RGBA()
+				matrix[y][x] = r == 0
+			}
+		}
+		return matrix, nil
+	}
+	// skip2 按内容自动分段选择数字、字母数字或字节模式
+	code, err := qrcode.New(content, qrcodeLevels[opt.level])
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	return code.Bitmap(), nil
+}
+
+// qrVersion 由模块数换算二维码版本
+func qrVersion(matrix [][]bool) int {
+	return (len(matrix) - 17) / 4
+}
+
+// qrPng 生成二维码 png 数据，四周加 quietZone 个模块的空白；每个模块为整数像素，图片边长不超过 pixels
+func qrPng(content string, opt qrOptions, pixels int) ([]byte, error) {
+	matrix, err := qrMatrix(content, opt)
+	if err != nil {
+		return nil, err
+	}
+	modules := len(matrix) + 2*opt.quietZone
+	module := pixels / modules
+	if module < 1 {
+		module = 1
+	}
+	size := module * modules
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for y, row := range matrix {
+		for x, dark := range row {
+			if dark {
+				left, top := (opt.quietZone+x)*module, (opt.quietZone+y)*module
+				draw.Draw(img, image.Rect(left, top, left+module, top+module), image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQrOptionsCheck(t *testing.T) {
+	tests := []struct {
+		opt qrOptions
+		err string
+	}{
+		{opt: qrOptions{level: "M", mode: qrModeAuto, library: qrLibrarySkip2}},
+		{opt: qrOptions{level: "H", quietZone: 4, mode: qrModeNumeric, library: qrLibraryBoombuler}},
+		{opt: qrOptions{level: "L", mode: qrModeByte, library: qrLibraryBoombuler}},
+		{opt: qrOptions{level: "M", mode: qrModeNumeric, library: qrLibrarySkip2}, err: "skip2 会自动选择编码模式"},
+		{opt: qrOptions{level: "M", mode: qrModeByte, library: qrLibrarySkip2}, err: "skip2 会自动选择编码模式"},
+		{opt: qrOptions{level: "X", mode: qrModeAuto, library: qrLibrarySkip2}, err: "纠错等级"},
+		{opt: qrOptions{level: "M", quietZone: -1, mode: qrModeAuto, library: qrLibrarySkip2}, err: "不能为负数"},
+		{opt: qrOptions{level: "M", mode: "kanji", library: qrLibraryBoombuler}, err: "不支持的编码模式"},
+		{opt: qrOptions{level: "M", mode: qrModeAuto, library: "zxing"}, err: "不支持的二维码编码库"},
+	}
+	for _, tt := range tests {
+		err := tt.opt.check()
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%+v: %v", tt.opt, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%+v: error = %v, want containing %q", tt.opt, err, tt.err)
+		}
+	}
+}
+
+func TestQrMatrixMode(t *testing.T) {
+	tests := []struct {
+		content string
+		mode    string
+		err     bool
+	}{
+		{content: "0123456789", mode: qrModeNumeric},
+		{content: "SN-001 A", mode: qrModeAlphanumeric},
+		{content: "sn-001", mode: qrModeAlphanumeric, err: true},
+		{content: "12a", mode: qrModeNumeric, err: true},
+		{content: "设备 sn-001", mode: qrModeByte},
+	}
+	for _, tt := range tests {
+		opt := qrOptions{level: "M", mode: tt.mode, library: qrLibraryBoombuler}
+		matrix, err := qrMatrix(tt.content, opt)
+		if (err != nil) != tt.err {
+			t.Errorf("qrMatrix(%q, %s) error = %v, want error %v", tt.content, tt.mode, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, err := decodeQrMatrix(matrix); err != nil || got != tt.content {
+			t.Errorf("qrMatrix(%q, %s) decodes to %q, %v", tt.content, tt.mode, got, err)
+		}
+	}
+}
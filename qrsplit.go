@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// 二维码拆分方式: page 拆分到多张标签，grid 在元素区域内放多个二维码
+const (
+	qrSplitPage = "page"
+	qrSplitGrid = "grid"
+)
+
+// 默认密度限制: 版本 20(97×97 模块)，模块宽度 0.3mm(203 dpi 打印机约 2.4 点，不低于打印质量分析要求的 2 点)
+const (
+	qrDefaultMaxVersion = 20
+	qrDefaultMinModule  = 0.3
+)
+
+// QrSplitConfig 二维码密度限制，模板中设置了 split 的二维码超出时拆分
+type QrSplitConfig struct {
+	// 最大版本 1~40，版本越高模块越密
+	MaxVersion int `toml:"maxVersion,omitzero"`
+	// 最小模块宽度(实际 mm)，模板写了 printWidth 时才能按实际尺寸计算
+	MinModule float64 `toml:"minModule,omitzero"`
+}
+
+// qrSplitLimits 返回配置的密度限制，没有配置时使用默认值
+func qrSplitLimits() (int, float64) {
+	if config == nil {
+		return qrDefaultMaxVersion, qrDefaultMinModule
+	}
+	return qrOptions{maxVersion: config.QrSplit.MaxVersion, minModule: config.QrSplit.MinModule}.splitLimits()
+}
+
+// splitLimits 返回二维码参数中的密度限制，未设置或超出范围时使用默认值
+func (o qrOptions) splitLimits() (int, float64) {
+	maxVersion, minModule := qrDefaultMaxVersion, qrDefaultMinModule
+	if o.maxVersion > 0 && o.maxVersion <= 40 {
+		maxVersion = o.maxVersion
+	}
+	if o.minModule > 0 {
+		minModule = o.minModule
+	}
+	return maxVersion, minModule
+}
+
+// qrFits 判断内容编码后的版本和模块宽度是否满足密度限制，side 为二维码连同空白的边长(实际 mm)
+func qrFits(content string, opt qrOptions, side float64) bool {
+	matrix, err := qrMatrix(content, opt)
+	if err != nil {
+		return false
+	}
+	maxVersion, minModule := opt.splitLimits()
+	if qrVersion(matrix) > maxVersion {
+		return false
+	}
+	modules := len(matrix) + 2*opt.quietZone
+	return side/float64(modules) >= minModule
+}
+
+// qrChunker 返回内容的拆分单位及把若干单位组成第 part 段(共 parts 段)的方法: 箱标二维码按设备号拆分，
+// 每段保留版本头并标注序号；其他内容按行拆分
+func qrChunker(content string) ([]string, func(items []string, part, parts int) (string, error)) {
+	if p, ok := parseBoxQr(content); ok {
+		return p.Devices, p.chunk
+	}
+	return splitList(content), func(items []string, _, _ int) (string, error) {
+		return strings.Join(items, "\n"), nil
+	}
+}
+
+// planQrChunks 将内容拆成尽量少的几段，每段满足密度限制，一行(如一个设备号)不会被拆开；
+// side 返回分成 n 段时每个二维码的边长(实际 mm)
+func planQrChunks(content string, opt qrOptions, side func(n int) float64) ([]string, error) {
+	// 参数或编码模式不对时直接报错，不按超出密度处理
+	if err := opt.check(); err != nil {
+		return nil, err
+	}
+	if err := checkQrMode(content, opt.mode); err != nil {
+		return nil, err
+	}
+	items, join := qrChunker(content)
+	if len(items) == 0 {
+		return []string{content}, nil
+	}
+	// split 按段数 n 均分，每段的单位数相同(最后一段可能较少)，实际段数可能少于 n
+	split := func(n int) ([]string, error) {
+		size := (len(items) + n - 1) / n
+		parts := (len(items) + size - 1) / size
+		var chunks []string
+		for start := 0; start < len(items); start += size {
+			end := start + size
+			if end > len(items) {
+				end = len(items)
+			}
+			chunk, err := join(items[start:end], len(chunks)+1, parts)
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, chunk)
+		}
+		return chunks, nil
+	}
+	fits := func(chunks []string, side float64) bool {
+		for _, chunk := range chunks {
+			if !qrFits(chunk, opt, side) {
+				return false
+			}
+		}
+		return true
+	}
+	// 段数越多每段越短，版本不会变大: 先二分出满足版本限制的最少段数，不必从 1 段逐个编码
+	lo, hi := 1, len(items)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		chunks, err := split(mid)
+		if err != nil {
+			return nil, err
+		}
+		if fits(chunks, math.Inf(1)) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	// 网格中段数越多每格越小，再从该段数起检查模块宽度
+	maxVersion, minModule := opt.splitLimits()
+	for n := lo; n <= len(items); n++ {
+		edge := side(n)
+		// 连版本 1(21×21 模块)的模块宽度都不够时，段数更多只会更小
+		if edge/float64(21+2*opt.quietZone) < minModule {
+			break
+		}
+		chunks, err := split(n)
+		if err != nil {
+			return nil, err
+		}
+		// 段数少于 n 时与按实际段数拆分相同，已经检查过
+		if len(chunks) < n {
+			continue
+		}
+		if fits(chunks, edge) {
+			return chunks, nil
+		}
+	}
+	return nil, fmt.Errorf("单行内容放不进一个二维码(版本不超过 %d，模块不小于 %gmm)，请增大二维码或放宽 [qrSplit] 限制", maxVersion, minModule)
+}
+
+// qrSide 二维码元素的边长，高度为 0 时使用宽度
+func (e *TemplateElement) qrSide() float64 {
+	if e.H > 0 && e.H < e.W {
+		return e.H
+	}
+	return e.W
+}
+
+// qrGrid 返回 n 个二维码排成的列数、行数，尽量接近正方形
+func qrGrid(n int) (int, int) {
+	cols := int(math.Ceil(math.Sqrt(float64(n))))
+	return cols, (n + cols - 1) / cols
+}
+
+// gridCell 分成 n 个二维码时每格的边长
+func (e *TemplateElement) gridCell(n int) float64 {
+	cols, rows := qrGrid(n)
+	cell := e.W / float64(cols)
+	if e.H > 0 && e.H/float64(rows) < cell {
+		cell = e.H / float64(rows)
+	}
+	return cell
+}
+
+// addQrGrid 在元素区域内按网格放置拆分后的二维码，每个二维码保留四周空白以便分别扫描
+func (e *TemplateElement) addQrGrid(label *Label, value string) error {
+	// 每个二维码至少保留标准要求的空白，否则相邻的二维码无法分别扫描
+	opt := e.qrOptions(label.Template, label.settings())
+	if opt.quietZone < qrDefaultQuietZone {
+		opt.quietZone = qrDefaultQuietZone
+	}
+	chunks, err := planQrChunks(value, opt, func(n int) float64 { return e.gridCell(n) * label.printScale() })
+	if err != nil {
+		return fmt.Errorf("生成二维码失败: %w", err)
+	}
+	cols, _ := qrGrid(len(chunks))
+	cell := e.gridCell(len(chunks))
+	pixels := e.Pixels
+	if pixels <= 0 {
+		pixels = 1000
+	}
+	for i, chunk := range chunks {
+		part := *e
+		part.Pixels = pixels / cols
+		data, err := part.qrcodePng(chunk, opt)
+		if err != nil {
+			return fmt.Errorf("生成二维码失败: %w", err)
+		}
+		x := e.X + float64(i%cols)*cell
+		y := e.Y + float64(i/cols)*cell
+		label.AddBarcode(TemplateQrcode, fmt.Sprintf("qrcode_%d_%s", i+1, chunk), chunk, data, x, y, cell, cell)
+	}
+	return nil
+}
+
+// planQrPages 计算设置了 split = "page" 的二维码在各页的内容，返回元素序号到各页内容的映射及所需页数
+func (t *LabelTemplate) planQrPages(render map[string]string, s labelSettings) (map[int][]string, int, error) {
+	scale := 1.0
+	if t.PrintWidth > 0 {
+		scale = t.PrintWidth / t.Width
+	}
+	plans := map[int][]string{}
+	pages := 1
+	for i := range t.Elements {
+		e := &t.Elements[i]
+		if e.Type != TemplateQrcode || e.Split != qrSplitPage {
+			continue
+		}
+		show, err := evalCondition(e.When, render)
+		if err != nil {
+			return nil, 0, t.elementError(i, err)
+		}
+		if !show {
+			continue
+		}
+		value, err := expandFields(e.Value, render)
+		if err != nil {
+			return nil, 0, t.elementError(i, err)
+		}
+		side := e.qrSide() * scale
+		chunks, err := planQrChunks(value, e.qrOptions(t.name, s), func(int) float64 { return side })
+		if err != nil {
+			return nil, 0, t.elementError(i, err)
+		}
+		plans[i] = chunks
+		if len(chunks) > pages {
+			pages = len(chunks)
+		}
+	}
+	return plans, pages, nil
+}
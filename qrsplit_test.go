@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQrGrid(t *testing.T) {
+	tests := []struct {
+		n, cols, rows int
+	}{
+		{1, 1, 1},
+		{2, 2, 1},
+		{3, 2, 2},
+		{4, 2, 2},
+		{5, 3, 2},
+		{9, 3, 3},
+		{10, 4, 3},
+	}
+	for _, tt := range tests {
+		if cols, rows := qrGrid(tt.n); cols != tt.cols || rows != tt.rows {
+			t.Errorf("qrGrid(%d) = %d, %d, want %d, %d", tt.n, cols, rows, tt.cols, tt.rows)
+		}
+	}
+}
+
+func TestPlanQrChunks(t *testing.T) {
+	devices := func(n int) []string {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = fmt.Sprintf("SN2024%06d", i+1)
+		}
+		return items
+	}
+	opt := qrOptions{level: "M", quietZone: 4, mode: qrModeAuto, library: qrLibrarySkip2, maxVersion: 5, minModule: 0.1}
+	box := "BOXQR/1;lines\nB0001\n" + strings.Join(devices(30), "\n")
+	tests := []struct {
+		name    string
+		content string
+		opt     qrOptions
+		side    float64
+		// 期望段数，0 表示应报错
+		parts int
+		err   string
+	}{
+		{name: "fits", content: strings.Join(devices(3), "\n"), opt: opt, side: 50, parts: 1},
+		{name: "version", content: strings.Join(devices(30), "\n"), opt: opt, side: 50, parts: 4},
+		{name: "module", content: strings.Join(devices(3), "\n"), opt: opt, side: 2, err: "单行内容放不进"},
+		{name: "box", content: box, opt: opt, side: 50, parts: 6},
+		{name: "long line", content: strings.Repeat("A", 200), opt: opt, side: 50, err: "单行内容放不进"},
+		{name: "mode", content: "sn-1", opt: qrOptions{level: "M", mode: qrModeNumeric, library: qrLibraryBoombuler}, side: 50, err: "numeric 模式只能编码数字"},
+		{name: "level", content: "1", opt: qrOptions{level: "X", mode: qrModeAuto, library: qrLibrarySkip2}, side: 50, err: "纠错等级"},
+	}
+	for _, tt := range tests {
+		chunks, err := planQrChunks(tt.content, tt.opt, func(int) float64 { return tt.side })
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(chunks) != tt.parts {
+			t.Errorf("%s: %d chunks, want %d", tt.name, len(chunks), tt.parts)
+		}
+		// 每段都满足限制，按顺序合起来正好是原来的各行
+		items, _ := qrChunker(tt.content)
+		var joined []string
+		for i, chunk := range chunks {
+			if !qrFits(chunk, tt.opt, tt.side) {
+				t.Errorf("%s: chunk %d does not fit", tt.name, i+1)
+			}
+			part, _ := qrChunker(chunk)
+			joined = append(joined, part...)
+			if p, ok := parseBoxQr(chunk); ok && len(chunks) > 1 {
+				if header := fmt.Sprintf("BOXQR/1;lines;part=%d/%d", i+1, len(chunks)); !strings.HasPrefix(chunk, header+"\nB0001\n") {
+					t.Errorf("%s: chunk %d starts with %q, want %q", tt.name, i+1, strings.SplitN(chunk, "\n", 2)[0], header)
+				}
+				if p.Box != "B0001" {
+					t.Errorf("%s: chunk %d box = %q", tt.name, i+1, p.Box)
+				}
+			}
+		}
+		if !reflect.DeepEqual(joined, items) {
+			t.Errorf("%s: chunks join to %v, want %v", tt.name, joined, items)
+		}
+	}
+}
+
+// 二分查找的段数与从 1 段逐个尝试的结果相同；网格中段数越多每格越小
+func TestPlanQrChunksMinimal(t *testing.T) {
+	opt := qrOptions{level: "M", quietZone: 4, mode: qrModeAuto, library: qrLibrarySkip2, maxVersion: 5, minModule: 0.3}
+	sides := map[string]func(int) float64{
+		"page":       func(int) float64 { return 40 },
+		"grid":       (&TemplateElement{W: 48, H: 48}).gridCell,
+		"small grid": (&TemplateElement{W: 36, H: 36}).gridCell,
+	}
+	for _, count := range []int{1, 7, 30, 64} {
+		items := make([]string, count)
+		for i := range items {
+			items[i] = fmt.Sprintf("SN2024%06d", i+1)
+		}
+		for _, content := range []string{strings.Join(items, "\n"), "BOXQR/1;lines\nB0001\n" + strings.Join(items, "\n")} {
+			for name, side := range sides {
+				chunks, err := planQrChunks(content, opt, side)
+				// 逐个尝试段数，找到第一个每段都满足限制的拆分
+				want := 0
+				for n := 1; n <= count && want == 0; n++ {
+					size := (count + n - 1) / n
+					parts := (count + size - 1) / size
+					if parts != n {
+						continue
+					}
+					all, join := qrChunker(content)
+					fits := true
+					for start, part := 0, 1; start < count && fits; start, part = start+size, part+1 {
+						end := start + size
+						if end > count {
+							end = count
+						}
+						chunk, _ := join(all[start:end], part, parts)
+						fits = qrFits(chunk, opt, side(parts))
+					}
+					if fits {
+						want = n
+					}
+				}
+				if want == 0 {
+					if err == nil {
+						t.Errorf("%s %d items: %d chunks, want error", name, count, len(chunks))
+					}
+					continue
+				}
+				if err != nil || len(chunks) != want {
+					t.Errorf("%s %d items: %d chunks, %v, want %d", name, count, len(chunks), err, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetentionConfig 生成文件保留策略
+type RetentionConfig struct {
+	// 文件最长保留天数，0 表示不按时间清理
+	MaxAgeDays int
+	// images、pdfs 与归档目录合计大小上限(MB)，0 表示不限制
+	MaxTotalSizeMB int
+	// 打印失败的文件是否保留
+	KeepOnFailure bool
+	// 定期清理间隔(分钟)，0 表示只在启动时清理
+	IntervalMinutes int
+	// 删除 PDF 前是否按天打包归档
+	ArchivePdfs bool
+	// PDF 归档目录，默认 PdfDir/archive
+	ArchiveDir string
+	// 归档文件从最后写入起的保留天数，0 表示与 MaxAgeDays 相同
+	ArchiveMaxAgeDays int
+}
+
+// failedSuffix 打印失败标记文件后缀
+const failedSuffix = ".failed"
+
+// retentionMu 避免定时清理与手动清理同时执行
+var retentionMu sync.Mutex
+
+// retentionFile 待清理的生成文件
+type retentionFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	isPdf   bool
+	// PDF 归档 zip，按 ArchiveMaxAgeDays 清理
+	isArchive bool
+}
+
+// MarkPrintFailed 为打印失败的文件写入标记，开启 keepOnFailure 时清理会跳过这些文件
+func MarkPrintFailed(paths ...string) {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := os.WriteFile(path+failedSuffix, []byte(time.Now().Format(time.RFC3339)), 0644); err != nil {
+			fmt.Println("写入失败标记失败:", err.Error())
+		}
+	}
+}
+
+// clearPrintFailed 重新打印成功后删除之前的失败标记
+func clearPrintFailed(path string) {
+	if err := os.Remove(path + failedSuffix); err != nil && !os.IsNotExist(err) {
+		fmt.Println("删除失败标记失败:", err.Error())
+	}
+}
+
+// StartRetention 启动时执行一次清理，并按配置的间隔定期清理
+func StartRetention(logf func(string)) {
+	go func() {
+		runRetentionAndLog(logf)
+		if config.Retention.IntervalMinutes <= 0 {
+			return
+		}
+		ticker := time.NewTicker(time.Duration(config.Retention.IntervalMinutes) * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			runRetentionAndLog(logf)
+		}
+	}()
+}
+
+func runRetentionAndLog(logf func(string)) {
+	removed, archived, err := RunRetention(time.Now())
+	if err != nil {
+		logf(fmt.Sprintf("❌ 清理生成文件失败: %s", err.Error()))
+		return
+	}
+	if removed > 0 {
+		logf(fmt.Sprintf("✓ 已清理 %d 个生成文件，其中 %d 个 PDF 已归档", removed, archived))
+	}
+}
+
+// RunRetention 按保留策略清理 ImageDir 与 PdfDir，返回删除和归档的文件数
+func RunRetention(now time.Time) (removed, archived int, err error) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	policy := config.Retention
+	if policy.MaxAgeDays <= 0 && policy.MaxTotalSizeMB <= 0 {
+		return 0, 0, nil
+	}
+
+	var files []retentionFile
+	var total int64
+	for _, dir := range []string{config.ImageDir, config.PdfDir} {
+		list, err := collectRetentionFiles(dir, policy.KeepOnFailure)
+		if err != nil {
+			return removed, archived, err
+		}
+		for _, f := range list {
+			total += f.size
+		}
+		files = append(files, list...)
+	}
+	// 归档同样计入大小上限并按时间清理
+	archives, err := collectArchives()
+	if err != nil {
+		return removed, archived, err
+	}
+	for _, f := range archives {
+		total += f.size
+	}
+	files = append(files, archives...)
+	// 最旧的文件优先清理
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	var expired []retentionFile
+	limit := int64(policy.MaxTotalSizeMB) * 1024 * 1024
+	deadline := now.AddDate(0, 0, -policy.MaxAgeDays)
+	archiveAge := policy.ArchiveMaxAgeDays
+	if archiveAge <= 0 {
+		archiveAge = policy.MaxAgeDays
+	}
+	archiveDeadline := now.AddDate(0, 0, -archiveAge)
+	for _, f := range files {
+		tooOld := policy.MaxAgeDays > 0 && f.modTime.Before(deadline)
+		if f.isArchive {
+			tooOld = archiveAge > 0 && f.modTime.Before(archiveDeadline)
+		}
+		tooBig := limit > 0 && total > limit
+		if !tooOld && !tooBig {
+			continue
+		}
+		expired = append(expired, f)
+		total -= f.size
+	}
+	if len(expired) == 0 {
+		return 0, 0, nil
+	}
+
+	// 先删除过期的归档，本次归档的 PDF 写入同名归档时不会被一起删掉
+	remove := func(archives bool) {
+		for _, f := range expired {
+			if f.isArchive != archives {
+				continue
+			}
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				fmt.Println("删除文件失败:", err.Error())
+				continue
+			}
+			removed++
+		}
+	}
+	remove(true)
+	if policy.ArchivePdfs {
+		archived, err = archivePdfs(expired)
+		if err != nil {
+			// 归档失败时不删除 PDF，避免丢失
+			return removed, archived, err
+		}
+	}
+	remove(false)
+	return removed, archived, nil
+}
+
+// archiveDir 返回 PDF 归档目录
+func archiveDir() string {
+	if config.Retention.ArchiveDir != "" {
+		return config.Retention.ArchiveDir
+	}
+	return filepath.Join(config.PdfDir, "archive")
+}
+
+// collectArchives 列出归档目录中的 pdfs_*.zip；归档目录与 images、pdfs 相同时已在其中统计，不重复列出
+func collectArchives() ([]retentionFile, error) {
+	dir := filepath.Clean(archiveDir())
+	if dir == filepath.Clean(config.ImageDir) || dir == filepath.Clean(config.PdfDir) {
+		return nil, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "pdfs_*.zip"))
+	if err != nil {
+		return nil, err
+	}
+	var files []retentionFile
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, retentionFile{path: path, size: info.Size(), modTime: info.ModTime(), isArchive: true})
+	}
+	return files, nil
+}
+
+// isGeneratedFile 是否为程序生成的标签图片或 PDF，目录中的其他文件(如 .gitkeep)不清理
+func isGeneratedFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".png" || ext == ".pdf"
+}
+
+// collectRetentionFiles 列出目录下的生成文件及其失败标记，不递归子目录；
+// 归档目录与该目录相同时，一并列出其中的 pdfs_*.zip
+func collectRetentionFiles(dir string, keepOnFailure bool) ([]retentionFile, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+	withArchives := filepath.Clean(dir) == filepath.Clean(archiveDir())
+
+	var files []retentionFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, failedSuffix) {
+			// 对应的文件已不存在时，顺带删除标记
+			if file := strings.TrimSuffix(name, failedSuffix); isGeneratedFile(file) && !names[file] {
+				os.Remove(path)
+			}
+			continue
+		}
+		isArchive := false
+		if !isGeneratedFile(name) {
+			if isArchive, _ = filepath.Match("pdfs_*.zip", name); !isArchive || !withArchives {
+				continue
+			}
+		}
+		if keepOnFailure && names[name+failedSuffix] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, retentionFile{
+			path:      path,
+			size:      info.Size(),
+			modTime:   info.ModTime(),
+			isPdf:     strings.EqualFold(filepath.Ext(name), ".pdf"),
+			isArchive: isArchive,
+		})
+	}
+	return files, nil
+}
+
+// archivePdfs 将待删除的 PDF 按修改日期打包到 ArchiveDir/pdfs_YYYY-MM-DD.zip
+func archivePdfs(files []retentionFile) (int, error) {
+	byDay := map[string][]retentionFile{}
+	for _, f := range files {
+		if f.isPdf {
+			day := f.modTime.Format("2006-01-02")
+			byDay[day] = append(byDay[day], f)
+		}
+	}
+	if len(byDay) == 0 {
+		return 0, nil
+	}
+
+	dir := archiveDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	archived := 0
+	for day, list := range byDay {
+		zipPath := filepath.Join(dir, fmt.Sprintf("pdfs_%s.zip", day))
+		if err := appendToZip(zipPath, list); err != nil {
+			return archived, fmt.Errorf("归档 %s 失败: %w", zipPath, err)
+		}
+		archived += len(list)
+	}
+	return archived, nil
+}
+
+// appendToZip 将文件追加到 zip，已存在的归档会保留原有内容
+func appendToZip(zipPath string, files []retentionFile) error {
+	tmpPath := zipPath + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := zip.NewWriter(out)
+
+	written := map[string]*zip.FileHeader{}
+	if old, err := zip.OpenReader(zipPath); err == nil {
+		for _, entry := range old.File {
+			if err := copyZipEntry(w, entry); err != nil {
+				old.Close()
+				w.Close()
+				out.Close()
+				os.Remove(tmpPath)
+				return err
+			}
+			written[entry.Name] = &entry.FileHeader
+		}
+		old.Close()
+	}
+
+	for _, f := range files {
+		name := filepath.Base(f.path)
+		if existing, ok := written[name]; ok {
+			// 标签 PDF 的输出是确定的，内容相同的重打无需重复归档
+			if sameContent(f.path, existing) {
+				continue
+			}
+			// 同名但内容不同的文件加上时间避免覆盖
+			name = fmt.Sprintf("%s_%s%s", strings.TrimSuffix(name, ".pdf"), f.modTime.Format("150405"), filepath.Ext(name))
+		}
+		header, err := addFileToZip(w, f, name)
+		if err != nil {
+			w.Close()
+			out.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		written[name] = header
+	}
+
+	if err := w.Close(); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, zipPath)
+}
+
+func copyZipEntry(w *zip.Writer, entry *zip.File) error {
+	dst, err := w.CreateRaw(&entry.FileHeader)
+	if err != nil {
+		return err
+	}
+	src, err := entry.OpenRaw()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func addFileToZip(w *zip.Writer, f retentionFile, name string) (*zip.FileHeader, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: f.modTime,
+	}
+	dst, err := w.CreateHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = dst.Write(data); err != nil {
+		return nil, err
+	}
+	// CreateHeader 不会回填校验值，记录下来供后续去重比对
+	header.CRC32 = crc32.ChecksumIEEE(data)
+	header.UncompressedSize64 = uint64(len(data))
+	return header, nil
+}
+
+// sameContent 判断文件与归档中的条目内容是否一致
+func sameContent(path string, header *zip.FileHeader) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return uint64(len(data)) == header.UncompressedSize64 && crc32.ChecksumIEEE(data) == header.CRC32
+}
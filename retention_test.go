@@ -0,0 +1,163 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 在临时目录按指定大小和修改时间创建 images、pdfs 下的文件，清理后检查留下的文件和归档内容
+func TestRunRetention(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+	type file struct {
+		path string
+		// 距 now 的天数
+		age  float64
+		size int
+	}
+	const kb = 1024
+	tests := []struct {
+		name   string
+		policy RetentionConfig
+		files  []file
+		// 清理后留下的文件
+		kept []string
+		// 归档 zip 及其中的文件名
+		archives map[string][]string
+		removed  int
+		archived int
+	}{
+		{
+			name:   "age",
+			policy: RetentionConfig{MaxAgeDays: 7},
+			files: []file{
+				{"images/old.png", 8, kb}, {"images/new.png", 6, kb}, {"pdfs/old.PDF", 30, kb},
+				{"images/.gitkeep", 30, 0}, {"pdfs/.gitkeep", 30, 0}, {"pdfs/notes.txt", 30, kb}, {"pdfs/sub/old.pdf", 30, kb},
+			},
+			kept:    []string{"images/.gitkeep", "images/new.png", "pdfs/.gitkeep", "pdfs/notes.txt", "pdfs/sub/old.pdf"},
+			removed: 2,
+		},
+		{
+			name:   "size",
+			policy: RetentionConfig{MaxTotalSizeMB: 1},
+			files: []file{
+				{"images/a.png", 3, 512 * kb}, {"pdfs/b.pdf", 2, 512 * kb}, {"images/c.png", 1, 512 * kb},
+				{"pdfs/big.txt", 5, 2048 * kb}, {"images/.gitkeep", 5, 0},
+			},
+			kept:    []string{"images/.gitkeep", "images/c.png", "pdfs/b.pdf", "pdfs/big.txt"},
+			removed: 1,
+		},
+		{
+			name:   "keep on failure",
+			policy: RetentionConfig{MaxAgeDays: 7, KeepOnFailure: true},
+			files: []file{
+				{"pdfs/failed.pdf", 30, kb}, {"pdfs/failed.pdf.failed", 30, 10}, {"pdfs/done.pdf", 30, kb},
+				{"pdfs/gone.pdf.failed", 30, 10}, {"pdfs/notes.txt.failed", 30, 10},
+			},
+			kept:    []string{"pdfs/failed.pdf", "pdfs/failed.pdf.failed", "pdfs/notes.txt.failed"},
+			removed: 1,
+		},
+		{
+			name:   "remove failed",
+			policy: RetentionConfig{MaxAgeDays: 7},
+			files:  []file{{"pdfs/failed.pdf", 30, kb}, {"pdfs/failed.pdf.failed", 30, 10}},
+			kept:   []string{"pdfs/failed.pdf.failed"},
+			// 标记在下次清理时随文件不存在一起删除
+			removed: 1,
+		},
+		{
+			name:   "daily archive",
+			policy: RetentionConfig{MaxAgeDays: 7, ArchivePdfs: true, ArchiveMaxAgeDays: 30},
+			files: []file{
+				{"pdfs/a.pdf", 9.4, kb}, {"pdfs/b.pdf", 9.3, kb}, {"pdfs/c.pdf", 8.4, kb}, {"pdfs/d.pdf", 1, kb},
+				{"images/a.png", 9, kb}, {"pdfs/archive/pdfs_2023-11-01.zip", 31, kb}, {"pdfs/archive/pdfs_2023-12-20.zip", 21, kb},
+				{"pdfs/archive/.gitkeep", 60, 0},
+			},
+			kept: []string{"pdfs/archive/.gitkeep", "pdfs/archive/pdfs_2023-12-20.zip", "pdfs/archive/pdfs_2024-01-01.zip",
+				"pdfs/archive/pdfs_2024-01-02.zip", "pdfs/d.pdf"},
+			archives: map[string][]string{
+				"pdfs/archive/pdfs_2024-01-01.zip": {"a.pdf", "b.pdf"},
+				"pdfs/archive/pdfs_2024-01-02.zip": {"c.pdf"},
+			},
+			removed:  5,
+			archived: 3,
+		},
+		{
+			name:   "archive in pdfs",
+			policy: RetentionConfig{MaxAgeDays: 7, ArchivePdfs: true, ArchiveDir: "pdfs", ArchiveMaxAgeDays: 30},
+			files:  []file{{"pdfs/a.pdf", 9.4, kb}, {"pdfs/pdfs_2023-12-01.zip", 40, kb}, {"pdfs/pdfs_2023-12-20.zip", 21, kb}},
+			kept:   []string{"pdfs/pdfs_2023-12-20.zip", "pdfs/pdfs_2024-01-01.zip"},
+			archives: map[string][]string{
+				"pdfs/pdfs_2024-01-01.zip": {"a.pdf"},
+			},
+			removed:  2,
+			archived: 1,
+		},
+	}
+
+	saved := config
+	defer func() { config = saved }()
+	for _, tt := range tests {
+		dir := t.TempDir()
+		policy := tt.policy
+		if policy.ArchiveDir != "" {
+			policy.ArchiveDir = filepath.Join(dir, policy.ArchiveDir)
+		}
+		config = &Config{ImageDir: filepath.Join(dir, "images"), PdfDir: filepath.Join(dir, "pdfs"), Retention: policy}
+		for _, f := range tt.files {
+			path := filepath.Join(dir, f.path)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(strings.Repeat("x", f.size)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			mtime := now.Add(-time.Duration(f.age * float64(24*time.Hour)))
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		removed, archived, err := RunRetention(now)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if removed != tt.removed || archived != tt.archived {
+			t.Errorf("%s: removed %d, archived %d, want %d, %d", tt.name, removed, archived, tt.removed, tt.archived)
+		}
+		var kept []string
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(dir, path)
+				kept = append(kept, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		sort.Strings(kept)
+		if !reflect.DeepEqual(kept, tt.kept) {
+			t.Errorf("%s: kept %v, want %v", tt.name, kept, tt.kept)
+		}
+		for archive, want := range tt.archives {
+			r, err := zip.OpenReader(filepath.Join(dir, archive))
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			var names []string
+			for _, f := range r.File {
+				names = append(names, f.Name)
+			}
+			r.Close()
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("%s: %s contains %v, want %v", tt.name, archive, names, want)
+			}
+		}
+	}
+}
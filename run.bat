@@ -6,6 +6,6 @@ echo ====================================
 echo.
 
 echo 正在启动...
-go run main_desktop.go print_functions.go
+go run .
 
 pause
@@ -0,0 +1,976 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/ean"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// 模板元素类型
+const (
+	TemplateText    = "text"
+	TemplateImage   = "image"
+	TemplateQrcode  = "qrcode"
+	TemplateBarcode = "barcode"
+)
+
+// 内置模板
+const (
+	TemplateDevice = "device"
+	TemplateMulti  = "multi"
+	TemplateTag    = "tag"
+)
+
+// 中文字体标记，模板中 font = "chinese" 时查找系统中文字体
+const chineseFont = "chinese"
+
+// defaultTemplates 随程序分发的默认模板，templateDir 中有同名文件时以文件为准
+//
+//go:embed templates/*.toml
+var defaultTemplates embed.FS
+
+// LabelTemplate 声明式标签模板，描述页面大小、字体和各元素的位置，由 Build 按字段生成版面
+type LabelTemplate struct {
+	// 模板说明，显示在界面中
+	Description string `toml:"description,omitempty"`
+	// 页面宽高(mm)
+	Width  float64 `toml:"width"`
+	Height float64 `toml:"height"`
+	// 实际打印宽度(mm)，页面按比例缩放打印时填写，素材按实际尺寸和分辨率换算；为 0 时与 width 相同
+	PrintWidth float64 `toml:"printWidth,omitzero"`
+	// 字体: chinese 表示使用中文字体，.ttf/.otf 结尾时为字体文件路径，其余为 PDF 内置字体名，如 Arial；
+	// 非中文字体缺字(如中文)时自动使用中文字体
+	Font      string `toml:"font,omitempty"`
+	FontStyle string `toml:"fontStyle,omitempty"`
+	// 标题语言，如 en、zh+en；为空时使用配置的语言，单据中指定的语言优先
+	Language string            `toml:"language,omitempty"`
+	Elements []TemplateElement `toml:"element"`
+	// 重复区域，如装箱单的设备号列表
+	Repeats []TemplateRepeat `toml:"repeat,omitempty"`
+
+	// 模板名，即文件名(不含扩展名)
+	name string
+	// 模板文件内容及其版本(内容哈希)，打印记录据此保存和找回当时的模板
+	source  []byte
+	version string
+	// 从版本快照加载时为快照中的标题表和素材，生成时不读取当前文件
+	resources *labelResources
+}
+
+// TemplateElement 模板中的一个元素，坐标和尺寸单位均为 mm
+type TemplateElement struct {
+	Type string `toml:"type"`
+	// 显示条件，为空时总是显示，语法见 evalCondition
+	When string  `toml:"when,omitempty"`
+	X    float64 `toml:"x"`
+	Y    float64 `toml:"y"`
+	W    float64 `toml:"w,omitzero"`
+	H    float64 `toml:"h,omitzero"`
+
+	// 元素内容，可用 {{字段}} 或 {{字段 | 过滤器}} 引用数据: 文字元素为显示的文字，二维码和条码为编码内容，图片为文件路径
+	Value string `toml:"value"`
+
+	// 文字元素，含义与 LabelElement 相同
+	FontSize    float64 `toml:"fontSize,omitzero"`
+	MinFontSize float64 `toml:"minFontSize,omitzero"`
+	Wrap        bool    `toml:"wrap,omitempty"`
+	Ellipsis    bool    `toml:"ellipsis,omitempty"`
+	Align       string  `toml:"align,omitempty"`
+	VAlign      string  `toml:"valign,omitempty"`
+	LineSpacing float64 `toml:"lineSpacing,omitzero"`
+
+	// 二维码: 纠错等级 L/M/Q/H，四周空白(模块数)，编码模式 auto/numeric/alphanumeric/byte，编码库 skip2/boombuler；
+	// 为空时使用 config.toml 中 [qrcode.<标签类型>] 的设置
+	Level     string `toml:"level,omitempty"`
+	QuietZone *int   `toml:"quietZone,omitempty"`
+	Mode      string `toml:"mode,omitempty"`
+	Library   string `toml:"library,omitempty"`
+	// 旧模板的保留空白开关，未设置 quietZone 时保证至少 4 个模块的空白
+	Border bool `toml:"border,omitempty"`
+	// 二维码超出密度限制时的拆分方式: page 拆分到多张标签，grid 在区域内放多个二维码；为空时不拆分
+	Split string `toml:"split,omitempty"`
+	// 条码类型，默认 code128
+	Symbology string `toml:"symbology,omitempty"`
+	// 二维码边长或条码宽度(像素)，条码高度按元素宽高比计算
+	Pixels int `toml:"pixels,omitzero"`
+	// Data Matrix 规格: square(默认)、rect 或指定如 16x16、12x36
+	Size string `toml:"size,omitempty"`
+	// Data Matrix 模块宽度(实际 mm)，设置后按模块数计算元素宽高，不再使用 w/h
+	Module float64 `toml:"module,omitzero"`
+	// PDF417 数据列数(1-30)、行数(3-90)，为 0 时按元素宽高比选择；纠错等级 0-8，未设置时按数据量选择
+	Columns  int  `toml:"columns,omitzero"`
+	Rows     int  `toml:"rows,omitzero"`
+	Security *int `toml:"security,omitempty"`
+	// Code 39 加模 43 校验字符
+	CheckChar bool `toml:"checkChar,omitempty"`
+}
+
+// TemplateRepeat 重复区域: 将列表逐项放入 W×H 的区域，按行列排布，放不下时续到下一页
+type TemplateRepeat struct {
+	// 列表内容，按换行、逗号或竖线拆分，如 {{DeviceList}}
+	Items string `toml:"items"`
+	// 显示条件，为空时总是显示
+	When string  `toml:"when,omitempty"`
+	X    float64 `toml:"x"`
+	Y    float64 `toml:"y"`
+	W    float64 `toml:"w"`
+	H    float64 `toml:"h"`
+	// 列数(默认 1)和每行高度(mm)
+	Columns   int     `toml:"columns,omitzero"`
+	RowHeight float64 `toml:"rowHeight"`
+	// 排列方向: row 先横向排满一行(默认)，column 先纵向排满一列
+	Direction string `toml:"direction,omitempty"`
+	// 每一项的元素，坐标相对于所在格子左上角，可使用 {{Item}} 和 {{Index}}(从 1 开始)
+	Elements []TemplateElement `toml:"element"`
+}
+
+// columns 返回列数
+func (r *TemplateRepeat) columns() int {
+	if r.Columns <= 0 {
+		return 1
+	}
+	return r.Columns
+}
+
+// capacity 返回一页能放下的项数
+func (r *TemplateRepeat) capacity() int {
+	if r.RowHeight <= 0 {
+		return 0
+	}
+	return r.columns() * int((r.H+0.01)/r.RowHeight)
+}
+
+// cell 返回第 i 项(页内序号)所在格子的左上角
+func (r *TemplateRepeat) cell(i int) (x, y float64) {
+	columns := r.columns()
+	rows := int((r.H + 0.01) / r.RowHeight)
+	row, col := i/columns, i%columns
+	if r.Direction == "column" {
+		row, col = i%rows, i/rows
+	}
+	return r.X + float64(col)*r.W/float64(columns), r.Y + float64(row)*r.RowHeight
+}
+
+// Code 128 两侧空白(模块)
+const code128Quiet = 10
+
+// barcodeEncoders 模板支持的条码类型
+var barcodeEncoders = map[string]func(content string) (barcode.Barcode, error){
+	"code128": func(content string) (barcode.Barcode, error) {
+		return code128.Encode(content)
+	},
+	// 商品条码，内容为 GTIN，12 位时自动补校验位
+	"ean13": func(content string) (barcode.Barcode, error) {
+		gtin, err := NormalizeGtin(content)
+		if err != nil {
+			return nil, err
+		}
+		return ean.Encode(gtin)
+	},
+	// 箱标，内容为 (AI)数据 形式的 GS1 数据，如 {{GS1}}
+	"gs1-128": func(content string) (barcode.Barcode, error) {
+		code, _, err := encodeGs1128(content)
+		return code, err
+	},
+	// 外箱条码，内容为 GTIN-14(如 {{Itf14}})，13 位时自动补校验位
+	"itf14": encodeItf14,
+	// 二维码，适合小标签，规格和模块宽度见 size、module
+	"datamatrix": func(content string) (barcode.Barcode, error) {
+		return encodeDataMatrix(content, false, "")
+	},
+	// GS1 DataMatrix，内容与 gs1-128 相同，如 (01){{Gtin | pad 14 "0"}}(21){{DeviceNo}}
+	"gs1-datamatrix": func(content string) (barcode.Barcode, error) {
+		return encodeDataMatrix(content, true, "")
+	},
+	// 旧仓储系统使用，只支持数字、大写字母和 -. $/+%，校验字符见 checkChar
+	"code39": func(content string) (barcode.Barcode, error) {
+		return encodeCode39(content, false)
+	},
+	// 堆叠式二维条码，适合内容较多的清单，行列数和纠错等级见 columns、rows、security
+	"pdf417": func(content string) (barcode.Barcode, error) {
+		return encodePdf417(content, 0, 0, nil, 0)
+	},
+}
+
+// fieldPattern 模板中的字段表达式，如 {{BoxNum}}、{{NetWeight | fixed 2}}，语法见 expr.go
+var fieldPattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// templateDir 返回用户模板目录
+func templateDir() string {
+	if config.TemplateDir != "" {
+		return config.TemplateDir
+	}
+	return "./templates"
+}
+
+// TemplateRule 产品标签模板选择规则，设置的条件全部满足时使用 Template；条件支持 * 和 ? 通配符
+type TemplateRule struct {
+	Template      string
+	Customer      string
+	ProductName   string
+	BarCode69Type string
+}
+
+// matches 判断规则是否适用于标签数据，没有设置任何条件的规则总是适用
+func (r *TemplateRule) matches(excelData *ExcelData) bool {
+	barCode69Type := strings.TrimSuffix(excelData.BarCode69Type, "-69.png")
+	return matchRule(r.Customer, excelData.Customer) &&
+		matchRule(r.ProductName, excelData.ProductName) &&
+		matchRule(strings.TrimSuffix(r.BarCode69Type, "-69.png"), barCode69Type)
+}
+
+func matchRule(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(strings.TrimSpace(value)))
+	return err == nil && matched
+}
+
+// SelectTagTemplate 选择产品标签模板: 数据中指定了模板时直接使用，否则使用第一条匹配的 templateRules，都没有时使用 tag
+func SelectTagTemplate(excelData *ExcelData) string {
+	if name := strings.TrimSpace(excelData.Template); name != "" {
+		return name
+	}
+	for i := range config.TemplateRules {
+		if rule := &config.TemplateRules[i]; rule.Template != "" && rule.matches(excelData) {
+			return rule.Template
+		}
+	}
+	return TemplateTag
+}
+
+// templateWatchers 模板保存后需要刷新模板列表的界面
+var (
+	templateWatchersMu sync.Mutex
+	templateWatchers   []func()
+)
+
+// OnTemplatesChanged 注册模板列表变化时的回调
+func OnTemplatesChanged(f func()) {
+	templateWatchersMu.Lock()
+	defer templateWatchersMu.Unlock()
+	templateWatchers = append(templateWatchers, f)
+}
+
+func notifyTemplatesChanged() {
+	templateWatchersMu.Lock()
+	watchers := append([]func(){}, templateWatchers...)
+	templateWatchersMu.Unlock()
+	for _, f := range watchers {
+		f()
+	}
+}
+
+// TagTemplateNames 返回可用于产品标签的模板名，不含设备号和批量二维码模板
+func TagTemplateNames() []string {
+	var names []string
+	for _, name := range TemplateNames() {
+		if name != TemplateDevice && name != TemplateMulti {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// LoadTemplate 读取模板，优先使用 templateDir 中的文件，没有时使用内置模板
+func LoadTemplate(name string) (*LabelTemplate, error) {
+	// 模板名来自接口参数和选择规则，拼接路径前校验，不能读取 templateDir 以外的文件
+	if !isIdentifier(strings.ReplaceAll(name, "-", "_")) {
+		return nil, fmt.Errorf("模板名 %q 只能包含字母、数字、下划线和 -", name)
+	}
+	file := name + ".toml"
+	data, err := os.ReadFile(filepath.Join(templateDir(), file))
+	if os.IsNotExist(err) {
+		data, err = defaultTemplates.ReadFile("templates/" + file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("找不到模板 %s", name)
+	}
+	return ParseTemplate(name, data)
+}
+
+// TemplateNames 返回所有可用模板名，包括内置模板和 templateDir 中的模板
+func TemplateNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(file string) {
+		if name := strings.TrimSuffix(file, ".toml"); strings.HasSuffix(file, ".toml") && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if entries, err := defaultTemplates.ReadDir("templates"); err == nil {
+		for _, entry := range entries {
+			add(entry.Name())
+		}
+	}
+	if entries, err := os.ReadDir(templateDir()); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				add(entry.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SaveTemplate 校验后将模板写入 templateDir，之后打印时立即使用新模板，返回文件路径
+func SaveTemplate(name string, t *LabelTemplate) (string, error) {
+	if !isIdentifier(strings.ReplaceAll(name, "-", "_")) {
+		return "", fmt.Errorf("模板名 %q 只能包含字母、数字、下划线和 -", name)
+	}
+	data, err := t.Encode()
+	if err != nil {
+		return "", err
+	}
+	// 按打印时的流程重新解析一遍，保证保存的模板能被使用
+	if _, err := ParseTemplate(name, data); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(templateDir(), 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(templateDir(), name+".toml")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	t.name = name
+	t.source = data
+	t.version = templateVersion(data)
+	notifyTemplatesChanged()
+	return path, nil
+}
+
+// Encode 将模板编码为 TOML
+func (t *LabelTemplate) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(t); err != nil {
+		return nil, fmt.Errorf("编码模板失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseTemplate 解析并校验模板内容
+func ParseTemplate(name string, data []byte) (*LabelTemplate, error) {
+	return parseTemplateWith(name, data, func(lang string) error {
+		_, err := LoadCatalog(lang)
+		return err
+	})
+}
+
+// parseTemplateWith 解析并校验模板内容，模板指定的语言由 checkLanguage 检查
+func parseTemplateWith(name string, data []byte, checkLanguage func(lang string) error) (*LabelTemplate, error) {
+	t := &LabelTemplate{name: name, source: data, version: templateVersion(data)}
+	md, err := toml.Decode(string(data), t)
+	if err != nil {
+		return nil, fmt.Errorf("解析模板 %s 失败: %w", name, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return nil, fmt.Errorf("模板 %s 中有未知配置项: %s", name, strings.Join(keys, ", "))
+	}
+	if t.Width <= 0 || t.Height <= 0 {
+		return nil, fmt.Errorf("模板 %s 未设置页面宽高", name)
+	}
+	if t.PrintWidth < 0 {
+		return nil, fmt.Errorf("模板 %s 的 printWidth 不能为负数", name)
+	}
+	for _, lang := range splitLanguages(t.Language) {
+		if err := checkLanguage(lang); err != nil {
+			return nil, fmt.Errorf("模板 %s: %w", name, err)
+		}
+	}
+	for i := range t.Elements {
+		if err := t.Elements[i].check(); err != nil {
+			return nil, t.elementError(i, err)
+		}
+	}
+	for i := range t.Repeats {
+		r := &t.Repeats[i]
+		if err := checkFields(r.Items); err != nil {
+			return nil, t.repeatError(i, err)
+		}
+		if err := checkCondition(r.When); err != nil {
+			return nil, t.repeatError(i, err)
+		}
+		if r.capacity() <= 0 {
+			return nil, t.repeatError(i, fmt.Errorf("区域高度 h 至少要放下一行 rowHeight"))
+		}
+		if r.Direction != "" && r.Direction != "row" && r.Direction != "column" {
+			return nil, t.repeatError(i, fmt.Errorf("排列方向只能是 row 或 column"))
+		}
+		for j := range r.Elements {
+			if err := r.Elements[j].check(); err != nil {
+				return nil, t.repeatError(i, fmt.Errorf("第 %d 个元素(%s): %w", j+1, r.Elements[j].Type, err))
+			}
+			if r.Elements[j].Split == qrSplitPage {
+				return nil, t.repeatError(i, fmt.Errorf("第 %d 个元素(%s): 重复区域中的二维码不能拆分到多张标签", j+1, r.Elements[j].Type))
+			}
+		}
+	}
+	return t, nil
+}
+
+// check 检查元素的类型、表达式和条件
+func (e *TemplateElement) check() error {
+	if err := checkFields(e.Value); err != nil {
+		return err
+	}
+	if err := checkCondition(e.When); err != nil {
+		return err
+	}
+	switch e.Type {
+	case TemplateText, TemplateImage:
+	case TemplateQrcode:
+		opt := qrOptions{level: "M", mode: qrModeAuto, library: qrLibrarySkip2}
+		if e.Level != "" {
+			opt.level = strings.ToUpper(e.Level)
+		}
+		if e.QuietZone != nil {
+			opt.quietZone = *e.QuietZone
+		}
+		if e.Mode != "" {
+			opt.mode = strings.ToLower(e.Mode)
+		}
+		if e.Library != "" {
+			opt.library = strings.ToLower(e.Library)
+		} else if opt.mode != qrModeAuto {
+			// 未指定编码库时由 config.toml 决定，模式与编码库是否匹配在生成时检查
+			opt.library = qrLibraryBoombuler
+		}
+		if err := opt.check(); err != nil {
+			return err
+		}
+		if e.Split != "" && e.Split != qrSplitPage && e.Split != qrSplitGrid {
+			return fmt.Errorf("拆分方式 split 只能是 page 或 grid")
+		}
+	case TemplateBarcode:
+		if _, ok := barcodeEncoders[e.symbology()]; !ok {
+			return fmt.Errorf("不支持的条码类型 %s", e.Symbology)
+		}
+		if err := checkDataMatrixSize(e.Size); err != nil {
+			return err
+		}
+		if e.Module < 0 {
+			return fmt.Errorf("模块宽度 module 不能为负数")
+		}
+		if err := checkPdf417Options(e.Columns, e.Rows, e.Security); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("不支持的元素类型 %q", e.Type)
+	}
+	return nil
+}
+
+// Name 返回模板名
+func (t *LabelTemplate) Name() string {
+	return t.name
+}
+
+// Version 返回模板版本，即模板文件内容的哈希，内容不变时版本不变
+func (t *LabelTemplate) Version() string {
+	return t.version
+}
+
+// templateVersion 取模板内容 sha256 的前 12 位作为版本号
+func templateVersion(data []byte) string {
+	return ContentHash(data)[:12]
+}
+
+// Build 按字段生成标签版面，重复区域放不下或二维码拆分到多张标签时生成多页，第 2 页起文件名加 _页码；
+// 字段之外还可使用 Now、Shift 等内置变量，Page、Pages 页码，QrPart、QrParts 二维码分段序号，以及 T.xxx 标题
+func (t *LabelTemplate) Build(name string, fields map[string]string) ([]*Label, error) {
+	fields = withBuiltinFields(fields)
+	// 记录读取的标题表和素材，与模板一起决定版本
+	res := t.resources
+	if res == nil {
+		res = &labelResources{}
+	}
+	// config.toml 中影响版面的设置与模板一起记入版本，重打原版本时使用快照中的设置
+	settings := res.settings(t.name)
+	if settings.Device != nil {
+		var err error
+		if t, err = t.withDevice(*settings.Device); err != nil {
+			return nil, err
+		}
+	}
+	// 标题变量 T.xxx 随语言变化，不记入标签字段
+	render, err := t.withCaptions(fields, res)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先展开各重复区域的列表，确定总页数
+	lists := make([][]string, len(t.Repeats))
+	pages := 1
+	for i := range t.Repeats {
+		r := &t.Repeats[i]
+		show, err := evalCondition(r.When, render)
+		if err != nil {
+			return nil, t.repeatError(i, err)
+		}
+		if !show {
+			continue
+		}
+		items, err := expandFields(r.Items, render)
+		if err != nil {
+			return nil, t.repeatError(i, err)
+		}
+		lists[i] = splitList(items)
+		if n := (len(lists[i]) + r.capacity() - 1) / r.capacity(); n > pages {
+			pages = n
+		}
+	}
+	qrPlans, qrParts, err := t.planQrPages(render, settings)
+	if err != nil {
+		return nil, err
+	}
+	if qrParts > pages {
+		pages = qrParts
+	}
+
+	labels := make([]*Label, 0, pages)
+	for page := 1; page <= pages; page++ {
+		pageFields := copyFields(render)
+		pageFields["Page"] = strconv.Itoa(page)
+		pageFields["Pages"] = strconv.Itoa(pages)
+		pageFields["QrPart"] = strconv.Itoa(page)
+		pageFields["QrParts"] = strconv.Itoa(qrParts)
+
+		label := t.newLabel(name)
+		label.Fields = fields
+		label.resources = res
+		if page > 1 {
+			label.Name = fmt.Sprintf("%s_%d", name, page)
+		}
+		for i := range t.Elements {
+			if chunks, ok := qrPlans[i]; ok {
+				// 拆分的二维码按页放入对应的一段，段数少于页数时后面的页不再放
+				if page <= len(chunks) {
+					if err := t.Elements[i].addTo(label, chunks[page-1]); err != nil {
+						return nil, t.elementError(i, err)
+					}
+				}
+				continue
+			}
+			if err := t.Elements[i].build(label, pageFields, 0, 0); err != nil {
+				return nil, t.elementError(i, err)
+			}
+		}
+		for i := range t.Repeats {
+			r := &t.Repeats[i]
+			capacity := r.capacity()
+			for n := (page - 1) * capacity; n < len(lists[i]) && n < page*capacity; n++ {
+				itemFields := copyFields(pageFields)
+				itemFields["Item"] = lists[i][n]
+				itemFields["Index"] = strconv.Itoa(n + 1)
+				x, y := r.cell(n - (page-1)*capacity)
+				for j := range r.Elements {
+					if err := r.Elements[j].build(label, itemFields, x, y); err != nil {
+						return nil, t.repeatError(i, fmt.Errorf("第 %d 项第 %d 个元素(%s): %w", n+1, j+1, r.Elements[j].Type, err))
+					}
+				}
+			}
+		}
+		labels = append(labels, label)
+	}
+
+	version, snapshot, err := res.version(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		label.TemplateVersion = version
+		label.templateSnapshot = snapshot
+	}
+	return labels, nil
+}
+
+func (t *LabelTemplate) newLabel(name string) *Label {
+	label := &Label{
+		Name:            name,
+		Template:        t.name,
+		TemplateVersion: t.version,
+		Orientation:     "P",
+		Size:            gofpdf.SizeType{Wd: t.Width, Ht: t.Height},
+	}
+	if t.PrintWidth > 0 {
+		label.PrintScale = t.PrintWidth / t.Width
+	}
+	switch {
+	case t.Font == chineseFont:
+		label.setChineseFont()
+		return label
+	case isFontFile(t.Font):
+		label.FontFamily = strings.TrimSuffix(filepath.Base(t.Font), filepath.Ext(t.Font))
+		label.FontPath = t.Font
+	default:
+		label.FontFamily = t.Font
+	}
+	label.FontStyle = t.FontStyle
+	if f, ok := chineseLabelFont(); ok {
+		label.FallbackFonts = []LabelFont{f}
+	}
+	return label
+}
+
+// allElements 返回模板的全部元素，包括重复区域中的元素
+func (t *LabelTemplate) allElements() []TemplateElement {
+	elements := append([]TemplateElement{}, t.Elements...)
+	for _, r := range t.Repeats {
+		elements = append(elements, r.Elements...)
+	}
+	return elements
+}
+
+// isFontFile 判断模板字体是否为字体文件路径
+func isFontFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ttf", ".otf":
+		return true
+	}
+	return false
+}
+
+// build 条件成立时按字段将元素添加到版面，(dx, dy) 为坐标偏移
+func (e *TemplateElement) build(label *Label, fields map[string]string, dx, dy float64) error {
+	show, err := evalCondition(e.When, fields)
+	if err != nil || !show {
+		return err
+	}
+	value, err := expandFields(e.Value, fields)
+	if err != nil {
+		return err
+	}
+	placed := *e
+	placed.X += dx
+	placed.Y += dy
+	return placed.addTo(label, value)
+}
+
+func copyFields(fields map[string]string) map[string]string {
+	result := make(map[string]string, len(fields)+4)
+	for name, value := range fields {
+		result[name] = value
+	}
+	return result
+}
+
+func (t *LabelTemplate) elementError(index int, err error) error {
+	return fmt.Errorf("模板 %s 第 %d 个元素(%s): %w", t.name, index+1, t.Elements[index].Type, err)
+}
+
+func (t *LabelTemplate) repeatError(index int, err error) error {
+	return fmt.Errorf("模板 %s 第 %d 个重复区域: %w", t.name, index+1, err)
+}
+
+// addTo 将元素按已展开的内容添加到版面
+func (e *TemplateElement) addTo(label *Label, value string) error {
+	switch e.Type {
+	case TemplateText:
+		label.Elements = append(label.Elements, LabelElement{
+			Kind:        ElementText,
+			X:           e.X,
+			Y:           e.Y,
+			W:           e.W,
+			H:           e.H,
+			Text:        value,
+			FontSize:    e.FontSize,
+			Wrap:        e.Wrap,
+			MinFontSize: e.MinFontSize,
+			Ellipsis:    e.Ellipsis,
+			Align:       e.Align,
+			VAlign:      e.VAlign,
+			LineSpacing: e.LineSpacing,
+		})
+	case TemplateImage:
+		if name := strings.TrimPrefix(value, assetPrefix); name != value {
+			if err := label.AddAsset(name, e.X, e.Y, e.W, e.H); err != nil {
+				return fmt.Errorf("读取素材失败: %w", err)
+			}
+			break
+		}
+		if err := label.AddImageFile(value, e.X, e.Y, e.W, e.H); err != nil {
+			return fmt.Errorf("读取图片失败: %w", err)
+		}
+	case TemplateQrcode:
+		if e.Split == qrSplitGrid {
+			return e.addQrGrid(label, value)
+		}
+		data, err := e.qrcodePng(value, e.qrOptions(label.Template, label.settings()))
+		if err != nil {
+			if e.Split == "" {
+				return fmt.Errorf("生成二维码失败: %w，内容过多时可在模板中设置 split = \"page\" 或 \"grid\" 拆分", err)
+			}
+			return fmt.Errorf("生成二维码失败: %w", err)
+		}
+		label.AddBarcode(TemplateQrcode, "qrcode_"+value, value, data, e.X, e.Y, e.W, e.H)
+	case TemplateBarcode:
+		if e.isDataMatrix() {
+			return e.addDataMatrix(label, value)
+		}
+		if e.symbology() == "pdf417" {
+			return e.addPdf417(label, value)
+		}
+		data, err := e.barcodePng(value)
+		if err != nil {
+			return fmt.Errorf("生成条形码失败: %w", err)
+		}
+		want, err := e.barcodeContent(value)
+		if err != nil {
+			return err
+		}
+		label.AddBarcode(e.symbology(), "barcode_"+value, want, data, e.X, e.Y, e.W, e.H)
+	}
+	return nil
+}
+
+// barcodeContent 返回条码应解码出的内容，用于版面生成后的解码校验
+func (e *TemplateElement) barcodeContent(value string) (string, error) {
+	switch e.symbology() {
+	case "gs1-128", "gs1-datamatrix":
+		elements, err := ParseGs1(value)
+		if err != nil {
+			return "", err
+		}
+		// Data Matrix 与 GS1-128 的 FNC1 规则相同
+		return gs1Code128Content(elements), nil
+	case "ean13":
+		return NormalizeGtin(value)
+	case "itf14":
+		return NormalizeItf14(value)
+	case "code39":
+		if e.CheckChar {
+			return value + code39CheckChar(value), nil
+		}
+	}
+	return value, nil
+}
+
+func (e *TemplateElement) symbology() string {
+	if e.Symbology == "" {
+		return "code128"
+	}
+	return strings.ToLower(e.Symbology)
+}
+
+func (e *TemplateElement) isDataMatrix() bool {
+	return e.symbology() == "datamatrix" || e.symbology() == "gs1-datamatrix"
+}
+
+// addDataMatrix 添加 Data Matrix，图片含四周 1 个模块的空白；设置 module 时按模块数和实际模块宽度计算宽高，
+// 否则在 w、h 范围内按符号比例缩放
+func (e *TemplateElement) addDataMatrix(label *Label, value string) error {
+	code, err := encodeDataMatrix(value, e.symbology() == "gs1-datamatrix", e.Size)
+	if err != nil {
+		return fmt.Errorf("生成 Data Matrix 失败: %w", err)
+	}
+	data, err := dataMatrixPng(code, e.Pixels)
+	if err != nil {
+		return err
+	}
+	cols, rows := code.modules()
+	w, h := fitImageSize(e.W, e.H, float64(cols), float64(rows))
+	if e.W > 0 && e.H > 0 {
+		// 宽高都设置时在区域内按比例缩放，长方形符号不被拉伸
+		if scale := e.H / float64(rows); float64(cols)*scale <= e.W {
+			w, h = float64(cols)*scale, e.H
+		} else {
+			w, h = e.W, float64(rows)*e.W/float64(cols)
+		}
+	}
+	if e.Module > 0 {
+		w = float64(cols) * e.Module / label.printScale()
+		h = float64(rows) * e.Module / label.printScale()
+	}
+	want, err := e.barcodeContent(value)
+	if err != nil {
+		return err
+	}
+	label.AddBarcode(e.symbology(), "datamatrix_"+value, want, data, e.X, e.Y, w, h)
+	return nil
+}
+
+// addPdf417 添加 PDF417，未指定行列数时按元素宽高比选择；图片含四周 2 个模块的空白，
+// 在 w、h 范围内按比例缩放，元素比符号高时加高各行
+func (e *TemplateElement) addPdf417(label *Label, value string) error {
+	ratio := 0.0
+	if e.W > 0 && e.H > 0 {
+		ratio = e.H / e.W
+	}
+	aspect := 0.0
+	if ratio > 0 {
+		aspect = 1 / ratio
+	}
+	code, err := encodePdf417(value, e.Columns, e.Rows, e.Security, aspect)
+	if err != nil {
+		return fmt.Errorf("生成 PDF417 失败: %w", err)
+	}
+	data, err := pdf417Png(code, e.Pixels, ratio)
+	if err != nil {
+		return err
+	}
+	img, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	w, h := fitImageSize(e.W, e.H, float64(img.Width), float64(img.Height))
+	if e.W > 0 && e.H > 0 {
+		if scale := e.H / float64(img.Height); float64(img.Width)*scale <= e.W {
+			w, h = float64(img.Width)*scale, e.H
+		} else {
+			w, h = e.W, float64(img.Height)*e.W/float64(img.Width)
+		}
+	}
+	label.AddBarcode("pdf417", "pdf417_"+value, value, data, e.X, e.Y, w, h)
+	return nil
+}
+
+// qrcodePng 生成二维码 png 数据
+func (e *TemplateElement) qrcodePng(content string, opt qrOptions) ([]byte, error) {
+	pixels := e.Pixels
+	if pixels <= 0 {
+		pixels = 1000
+	}
+	return qrPng(content, opt, pixels)
+}
+
+// barcodePng 生成条码 png 数据
+func (e *TemplateElement) barcodePng(content string) ([]byte, error) {
+	if e.symbology() == "gs1-128" || e.symbology() == "itf14" || e.symbology() == "code39" {
+		ratio := 0.25
+		if e.W > 0 && e.H > 0 {
+			ratio = e.H / e.W
+		}
+		switch e.symbology() {
+		case "itf14":
+			return itf14Png(content, e.Pixels, ratio)
+		case "code39":
+			return code39Png(content, e.CheckChar, e.Pixels, ratio)
+		}
+		return gs1128Png(content, e.Pixels, ratio)
+	}
+	width := e.Pixels
+	if width <= 0 {
+		width = 200
+		if e.symbology() == "ean13" {
+			width = ean13DefaultPixels
+		}
+	}
+	height := width / 4
+	if e.W > 0 && e.H > 0 {
+		height = int(float64(width)*e.H/e.W + 0.5)
+	}
+	if e.symbology() == "ean13" {
+		return ean13Png(content, width, height)
+	}
+	code, err := barcodeEncoders[e.symbology()](content)
+	if err != nil {
+		return nil, err
+	}
+	return code128Png(code, width, height)
+}
+
+// code128Png 按整数像素的模块宽度生成 Code 128 png 数据，两侧各留 10 个模块空白，不依赖缩放剩余的像素；
+// 图片宽度不超过 width，放不下时每个模块 1 像素
+func code128Png(code barcode.Barcode, width, height int) ([]byte, error) {
+	modules := code.Bounds().Dx() + 2*code128Quiet
+	module := width / modules
+	if module < 1 {
+		module = 1
+	}
+	// 转为 RGBA 再编码，条码默认的 16 位灰度 PNG 无法写入 PDF
+	img := image.NewRGBA(image.Rect(0, 0, module*modules, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for x := 0; x < code.Bounds().Dx(); x++ {
+		if r, _, _, _ := code.At(x, 0).RGBA(); r == 0 {
+			left := (code128Quiet + x) * module
+			draw.Draw(img, image.Rect(left, 0, left+module, height), image.Black, image.Point{}, draw.Src)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// expandFields 计算文字中的每个 {{表达式}}，引用不存在的变量或表达式有误时返回错误
+func expandFields(text string, fields map[string]string) (string, error) {
+	var firstErr error
+	result := fieldPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if firstErr != nil {
+			return ""
+		}
+		expr, err := parseFieldExpr(fieldPattern.FindStringSubmatch(match)[1])
+		if err == nil {
+			var value string
+			if value, err = expr.eval(fields); err == nil {
+				return value
+			}
+		}
+		firstErr = err
+		return ""
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return result, nil
+}
+
+// checkFields 检查文字中的表达式语法，不计算变量
+func checkFields(text string) error {
+	for _, match := range fieldPattern.FindAllStringSubmatch(text, -1) {
+		if _, err := parseFieldExpr(match[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fieldNames(fields map[string]string) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// excelDataFields 将 ExcelData 的字段转换为模板变量，变量名与字段名相同
+func excelDataFields(excelData *ExcelData) map[string]string {
+	fields := map[string]string{}
+	v := reflect.ValueOf(excelData).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.String {
+			fields[v.Type().Field(i).Name] = f.String()
+		}
+	}
+	return fields
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 模板名和条码类型来自接口参数，不能通过 ../ 读取 templateDir、resources/images 以外的文件
+func TestTemplatePathTraversal(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	dir := t.TempDir()
+	config = &Config{TemplateDir: filepath.Join(dir, "templates")}
+	if err := os.MkdirAll(config.TemplateDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := defaultTemplates.ReadFile("templates/tag.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{filepath.Join(dir, "secret.toml"), filepath.Join(config.TemplateDir, "tag-copy.toml")} {
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"../secret", "..", "tag/../tag", `..\secret`, "/etc/passwd", ""} {
+		if _, err := LoadTemplate(name); err == nil || !strings.Contains(err.Error(), "模板名") {
+			t.Errorf("LoadTemplate(%q) error = %v, want invalid name", name, err)
+		}
+	}
+	for _, name := range []string{"tag", "tag-copy"} {
+		if _, err := LoadTemplate(name); err != nil {
+			t.Errorf("LoadTemplate(%q): %v", name, err)
+		}
+	}
+
+	excelData := &ExcelData{
+		ProductName: "耳机", ProductColor: "黑", ProductDate: "2024-01-05", ProductNum: "10",
+		NetWeight: "1.8", GrossWeight: "2", BoxNum: "B0001", DeviceNos: "SN2024000001",
+	}
+	for _, value := range []string{"../../config.toml", "../401-69.png", "401/../../x", ""} {
+		excelData.BarCode69Type = value
+		if _, err := BuildTagLabel(excelData); err == nil || !strings.Contains(err.Error(), "条码类型") {
+			t.Errorf("BarCode69Type %q: error = %v, want invalid type", value, err)
+		}
+	}
+	excelData.BarCode69Type = "../401"
+	if msg := validateTagData(excelData); !strings.Contains(msg, "条码类型") {
+		t.Errorf("validateTagData(%q) = %q, want invalid type", excelData.BarCode69Type, msg)
+	}
+	excelData.BarCode69Type = "401-69.png"
+	if _, err := BuildTagLabel(excelData); err != nil {
+		t.Errorf("BarCode69Type 401: %v", err)
+	}
+}
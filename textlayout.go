@@ -0,0 +1,316 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+)
+
+// 默认行高倍数
+const defaultLineSpacing = 1.2
+
+// 1pt 对应的毫米数
+const mmPerPt = 25.4 / 72
+
+// 缩小字号时每次递减的比例
+const shrinkStep = 0.95
+
+// textLine 排版后的一行文字，(X, Y) 为基线起点，单位 mm
+type textLine struct {
+	Text     string
+	X, Y     float64
+	FontSize float64
+}
+
+// IsTextBox 是否为需要在框内排版的文字元素
+func (e *LabelElement) IsTextBox() bool {
+	return e.Kind == ElementText && e.W > 0
+}
+
+// layoutText 计算文字元素的每一行位置，PDF 与预览图共用同一结果
+func layoutText(l *Label, e *LabelElement) ([]textLine, error) {
+	if !e.IsTextBox() {
+		return []textLine{{Text: e.Text, X: e.X, Y: e.Y, FontSize: e.FontSize}}, nil
+	}
+
+	m := &textMeasurer{label: l}
+	size := e.FontSize
+	lines, err := m.wrap(e, size)
+	if err != nil {
+		return nil, err
+	}
+	// 放不下时逐步缩小字号
+	for e.MinFontSize > 0 && size > e.MinFontSize {
+		fits, err := m.fits(e, lines, size)
+		if err != nil {
+			return nil, err
+		}
+		if fits {
+			break
+		}
+		size *= shrinkStep
+		if size < e.MinFontSize {
+			size = e.MinFontSize
+		}
+		if lines, err = m.wrap(e, size); err != nil {
+			return nil, err
+		}
+	}
+	if e.Ellipsis {
+		if lines, err = m.truncate(e, lines, size); err != nil {
+			return nil, err
+		}
+	}
+	return m.place(e, lines, size)
+}
+
+// lineHeight 返回指定字号的行高(mm)
+func (e *LabelElement) lineHeight(size float64) float64 {
+	spacing := e.LineSpacing
+	if spacing <= 0 {
+		spacing = defaultLineSpacing
+	}
+	return size * mmPerPt * spacing
+}
+
+// textMeasurer 使用与预览相同的字体文件测量文字宽度，中日韩字符按实际字宽计算，缺字时按后备字体测量
+type textMeasurer struct {
+	label *Label
+	faces map[faceKey]font.Face
+}
+
+type faceKey struct {
+	font LabelFont
+	size float64
+}
+
+// width 返回文字在指定字号下的宽度(mm)
+func (m *textMeasurer) width(text string, size float64) (float64, error) {
+	var total float64
+	for _, run := range m.label.textRuns(text) {
+		w, err := m.runWidth(run, size)
+		if err != nil {
+			return 0, err
+		}
+		total += w
+	}
+	return total, nil
+}
+
+// runWidth 返回同一字体的一段文字在指定字号下的宽度(mm)
+func (m *textMeasurer) runWidth(run textRun, size float64) (float64, error) {
+	if m.faces == nil {
+		m.faces = map[faceKey]font.Face{}
+	}
+	key := faceKey{font: run.Font, size: size}
+	face, ok := m.faces[key]
+	if !ok {
+		// 每毫米 1 像素，测量结果即为毫米
+		var err error
+		if face, err = fontFace(run.Font, size, 1); err != nil {
+			return 0, err
+		}
+		m.faces[key] = face
+	}
+	return float64(font.MeasureString(face, run.Text)) / 64, nil
+}
+
+// fits 判断排版结果是否在框内
+func (m *textMeasurer) fits(e *LabelElement, lines []string, size float64) (bool, error) {
+	if e.H > 0 && float64(len(lines))*e.lineHeight(size) > e.H+0.01 {
+		return false, nil
+	}
+	for _, line := range lines {
+		w, err := m.width(line, size)
+		if err != nil {
+			return false, err
+		}
+		if w > e.W+0.01 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// wrap 按框宽换行；不换行时保留原有的换行符
+func (m *textMeasurer) wrap(e *LabelElement, size float64) ([]string, error) {
+	var lines []string
+	for _, paragraph := range strings.Split(e.Text, "\n") {
+		if !e.Wrap {
+			lines = append(lines, paragraph)
+			continue
+		}
+		current := ""
+		for _, token := range breakTokens(paragraph) {
+			candidate := current + token
+			w, err := m.width(candidate, size)
+			if err != nil {
+				return nil, err
+			}
+			if w <= e.W {
+				current = candidate
+				continue
+			}
+			if current != "" {
+				lines = append(lines, strings.TrimRight(current, " "))
+				current = strings.TrimLeft(token, " ")
+				if w, err = m.width(current, size); err != nil {
+					return nil, err
+				}
+			} else {
+				current = token
+			}
+			if w > e.W {
+				// 单个词比框还宽，按字符拆开
+				parts, err := m.splitRunes(current, e.W, size)
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, parts[:len(parts)-1]...)
+				current = parts[len(parts)-1]
+			}
+		}
+		lines = append(lines, strings.TrimRight(current, " "))
+	}
+	return lines, nil
+}
+
+// splitRunes 将过长的文字按字符拆成多行
+func (m *textMeasurer) splitRunes(text string, maxWidth, size float64) ([]string, error) {
+	var parts []string
+	current := ""
+	for _, r := range text {
+		candidate := current + string(r)
+		w, err := m.width(candidate, size)
+		if err != nil {
+			return nil, err
+		}
+		if w > maxWidth && current != "" {
+			parts = append(parts, current)
+			candidate = string(r)
+		}
+		current = candidate
+	}
+	return append(parts, current), nil
+}
+
+// truncate 丢弃框内放不下的行，并在最后一行加省略号
+func (m *textMeasurer) truncate(e *LabelElement, lines []string, size float64) ([]string, error) {
+	maxLines := len(lines)
+	if e.H > 0 {
+		maxLines = int((e.H + 0.01) / e.lineHeight(size))
+		if maxLines < 1 {
+			maxLines = 1
+		}
+	}
+	truncated := maxLines < len(lines)
+	if truncated {
+		lines = append([]string(nil), lines[:maxLines]...)
+	}
+
+	ellipsis := "…"
+	if !m.label.covers('…') {
+		// 内置字体不支持 UTF-8 省略号
+		ellipsis = "..."
+	}
+	last := lines[len(lines)-1]
+	w, err := m.width(last, size)
+	if err != nil {
+		return nil, err
+	}
+	if !truncated && w <= e.W+0.01 {
+		return lines, nil
+	}
+
+	runes := []rune(strings.TrimRight(last, " "))
+	for len(runes) > 0 {
+		candidate := strings.TrimRight(string(runes), " ") + ellipsis
+		if w, err = m.width(candidate, size); err != nil {
+			return nil, err
+		}
+		if w <= e.W+0.01 {
+			break
+		}
+		runes = runes[:len(runes)-1]
+	}
+	lines[len(lines)-1] = strings.TrimRight(string(runes), " ") + ellipsis
+	return lines, nil
+}
+
+// place 计算每行基线位置，行内基线位于行高中间偏下，与字体无关以保证 PDF 和预览一致
+func (m *textMeasurer) place(e *LabelElement, lines []string, size float64) ([]textLine, error) {
+	lineHeight := e.lineHeight(size)
+	sizeMm := size * mmPerPt
+	top := e.Y
+	if e.H > 0 {
+		switch e.VAlign {
+		case "M":
+			top += (e.H - float64(len(lines))*lineHeight) / 2
+		case "B":
+			top += e.H - float64(len(lines))*lineHeight
+		}
+	}
+
+	result := make([]textLine, 0, len(lines))
+	for i, line := range lines {
+		x := e.X
+		if e.Align == "C" || e.Align == "R" {
+			w, err := m.width(line, size)
+			if err != nil {
+				return nil, err
+			}
+			if e.Align == "C" {
+				x += (e.W - w) / 2
+			} else {
+				x += e.W - w
+			}
+		}
+		baseline := top + float64(i)*lineHeight + (lineHeight-sizeMm)/2 + sizeMm*0.8
+		result = append(result, textLine{Text: line, X: x, Y: baseline, FontSize: size})
+	}
+	return result, nil
+}
+
+// breakTokens 拆分可换行的片段: 中日韩字符逐字可断，西文按单词断，行首禁则标点并入前一个片段
+func breakTokens(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case isNoLineStart(r) && (word.Len() > 0 || len(tokens) > 0):
+			if word.Len() > 0 {
+				word.WriteRune(r)
+			} else {
+				tokens[len(tokens)-1] += string(r)
+			}
+		case unicode.IsSpace(r):
+			word.WriteRune(r)
+			flush()
+		case isCJK(r):
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// isCJK 是否为可在任意位置换行的中日韩字符
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) || (r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF)
+}
+
+// isNoLineStart 不能出现在行首的标点
+func isNoLineStart(r rune) bool {
+	return strings.ContainsRune("，。、：；！？）》」』】,.:;!?)", r)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// 内置字体按模板的 fontStyle 测量: 常规比粗体窄，Courier 等宽
+func TestBuiltinFontStyleWidth(t *testing.T) {
+	width := func(f LabelFont, text string) float64 {
+		m := &textMeasurer{label: &Label{FontFamily: f.Family, FontStyle: f.Style}}
+		w, err := m.width(text, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	const text = "Net Weight 1.8kg"
+	regular, bold := width(LabelFont{Family: "Arial"}, text), width(LabelFont{Family: "Arial", Style: "B"}, text)
+	if regular >= bold {
+		t.Errorf("Arial regular %.2f mm, bold %.2f mm, want regular narrower", regular, bold)
+	}
+	// 与直接按对应字形的字体测量一致
+	file, _ := builtinFontFile(LabelFont{Family: "Arial"})
+	if file != "arial.ttf" {
+		t.Errorf("regular Arial file %s, want arial.ttf", file)
+	}
+	face, err := fontFace(LabelFont{Family: "Arial"}, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := float64(font.MeasureString(face, text)) / 64; regular != want {
+		t.Errorf("Arial regular %.3f mm, want %.3f", regular, want)
+	}
+	if i, w := width(LabelFont{Family: "Courier"}, "iiii"), width(LabelFont{Family: "Courier"}, "WWWW"); i != w {
+		t.Errorf("Courier iiii %.2f mm, WWWW %.2f mm, want equal", i, w)
+	}
+	if got, _ := builtinFontFile(LabelFont{Family: "Times", Style: "BI"}); got != "timesbi.ttf" {
+		t.Errorf("Times bold italic file %s, want timesbi.ttf", got)
+	}
+}
+
+// 主字体缺字时按字符使用后备字体，空白跟随前一段；都没有的字符使用主字体
+func TestTextRunsFallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goregular.ttf")
+	if err := os.WriteFile(path, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	main := LabelFont{Family: "Arial", Style: "B"}
+	latin := LabelFont{Family: "goregular", Path: path}
+	l := &Label{FontFamily: main.Family, FontStyle: main.Style, FallbackFonts: []LabelFont{latin}}
+
+	got := l.textRuns("Box Ωμέγα 12 箱号")
+	want := []textRun{{"Box ", main}, {"Ωμέγα ", latin}, {"12 箱号", main}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("textRuns = %v, want %v", got, want)
+	}
+
+	// 分段测量的宽度等于各段按各自字体测量之和
+	m := &textMeasurer{label: l}
+	total, err := m.width("Box Ωμέγα 12 箱号", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for _, run := range want {
+		w, err := (&textMeasurer{label: &Label{FontFamily: run.Font.Family, FontStyle: run.Font.Style, FontPath: run.Font.Path}}).width(run.Text, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += w
+	}
+	if diff := total - sum; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("width %.3f mm, sum of runs %.3f mm", total, sum)
+	}
+
+	// 系统有中文字体时，中文使用中文字体
+	cjk, ok := chineseLabelFont()
+	if !ok {
+		t.Log("no Chinese font on this system, skipping the CJK fallback case")
+		return
+	}
+	l.FallbackFonts = []LabelFont{latin, cjk}
+	got = l.textRuns("Box Ω 箱号 B1")
+	want = []textRun{{"Box ", main}, {"Ω ", latin}, {"箱号 ", cjk}, {"B1", main}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("textRuns with CJK font = %v, want %v", got, want)
+	}
+}
+
+// 中西文混排换行: 中文逐字可断，西文按单词断，标点不在行首，每行都不超过框宽
+func TestWrapMixedText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goregular.ttf")
+	if err := os.WriteFile(path, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := &Label{FontFamily: "Arial", FallbackFonts: []LabelFont{{Family: "goregular", Path: path}}}
+	m := &textMeasurer{label: l}
+	const text = "产品名称：Wireless Earphone 无线耳机，颜色 Ωμέγα Black"
+	for _, w := range []float64{20, 30, 45, 80} {
+		e := &LabelElement{Kind: ElementText, Text: text, W: w, FontSize: 10, Wrap: true}
+		lines, err := m.wrap(e, e.FontSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range lines {
+			lw, err := m.width(line, e.FontSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lw > w+0.01 {
+				t.Errorf("width %v: line %q is %.2f mm", w, line, lw)
+			}
+			if r := []rune(line); len(r) > 0 && isNoLineStart(r[0]) {
+				t.Errorf("width %v: line %q starts with punctuation", w, line)
+			}
+		}
+		joined := strings.Join(lines, "\n")
+		for _, word := range []string{"Wireless", "Earphone", "Ωμέγα", "Black"} {
+			if !strings.Contains(joined, word) {
+				t.Errorf("width %v: word %s split in %q", w, word, lines)
+			}
+		}
+		// 窄框中中文逐字断行，不会整句挪到下一行
+		if w == 20 && !strings.HasPrefix(lines[0], "产品名称") {
+			t.Errorf("width %v: first line %q, want the CJK text filled in", w, lines[0])
+		}
+		if joined := strings.Join(lines, ""); strings.ReplaceAll(joined, " ", "") != strings.ReplaceAll(text, " ", "") {
+			t.Errorf("width %v: lines %q lose text", w, lines)
+		}
+	}
+}